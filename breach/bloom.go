@@ -0,0 +1,140 @@
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+// bloomMagic starts file of bloom filter, it is followed by number of hashes and number of bits
+const bloomMagic = "UMBLOOM1"
+
+// Bloom is bloom filter of SHA-1 hashes of breached passwords. It is much smaller than the list it is built
+// from and kept in memory, but reports a password which is not breached as breached with false positive rate
+// chosen when it is built.
+type Bloom struct {
+	// k is number of bit positions of every hash, m is number of bits
+	k    uint32
+	m    uint64
+	bits []byte
+}
+
+// NewBloom returns empty filter for n hashes with false positive rate
+func NewBloom(n uint64, rate float64) (*Bloom, error) {
+	if n == 0 || rate <= 0 || rate >= 1 {
+		return nil, fmt.Errorf("bloom filter needs hashes and false positive rate between 0 and 1")
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+
+	return &Bloom{k: k, m: m, bits: make([]byte, (m+7)/8)}, nil
+}
+
+// ReadBloom reads filter written by WriteTo
+func ReadBloom(r io.Reader) (*Bloom, error) {
+	header := make([]byte, len(bloomMagic)+4+8)
+
+	_, err := io.ReadFull(r, header)
+	if err != nil || string(header[:len(bloomMagic)]) != bloomMagic {
+		return nil, errors.New("bloom filter has invalid header")
+	}
+
+	b := &Bloom{
+		k: binary.BigEndian.Uint32(header[len(bloomMagic):]),
+		m: binary.BigEndian.Uint64(header[len(bloomMagic)+4:]),
+	}
+
+	b.bits, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.k == 0 || b.m == 0 || uint64(len(b.bits)) != (b.m+7)/8 {
+		return nil, errors.New("bloom filter is truncated or corrupted")
+	}
+
+	return b, nil
+}
+
+// WriteTo writes filter to w
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(bloomMagic)+4+8)
+	copy(header, bloomMagic)
+	binary.BigEndian.PutUint32(header[len(bloomMagic):], b.k)
+	binary.BigEndian.PutUint64(header[len(bloomMagic)+4:], b.m)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	nb, err := w.Write(b.bits)
+
+	return int64(n + nb), err
+}
+
+// Add adds SHA-1 hash to filter
+func (b *Bloom) Add(hash []byte) {
+	b.positions(hash, func(i uint64) bool {
+		b.bits[i/8] |= 1 << (i % 8)
+		return true
+	})
+}
+
+// AddHashes adds hashes of lines `HASH:count` read from r and returns how many were added
+func (b *Bloom) AddHashes(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	added, line := uint64(0), 0
+
+	for scanner.Scan() {
+		line++
+
+		hash := lineHash(scanner.Text())
+		if hash == "" {
+			continue
+		}
+
+		sum, err := hex.DecodeString(hash)
+		if err != nil || len(sum) != sha1.Size {
+			return added, fmt.Errorf("line %d is not SHA-1 hash", line)
+		}
+
+		b.Add(sum)
+		added++
+	}
+
+	return added, scanner.Err()
+}
+
+// Breached reports whether SHA-1 of password is probably in filter
+func (b *Bloom) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	found := true
+
+	b.positions(sum[:], func(i uint64) bool {
+		found = b.bits[i/8]&(1<<(i%8)) != 0
+		return found
+	})
+
+	return found, nil
+}
+
+// positions calls f with bit positions of hash until it returns false. SHA-1 is uniform already,
+// so positions are derived from its two halves with double hashing.
+func (b *Bloom) positions(hash []byte, f func(uint64) bool) {
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16]) | 1
+
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !f((h1 + i*h2) % b.m) {
+			return
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Package breach tells whether passwords appeared in public breach corpora without sending them anywhere.
+// Datasets are lists of SHA-1 hashes of breached passwords like the one of Have I Been Pwned: a local file
+// sorted by hash, a bloom filter built from it, or a range API returning hashes which share the first
+// five hex digits with the password hash (k-anonymity), e.g. a local mirror.
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+)
+
+// Checker tells whether password appeared in breach corpus
+type Checker interface {
+	Breached(password string) (bool, error)
+}
+
+// hashHex returns upper case hex of SHA-1 of password, the form breach datasets use
+func hashHex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// lineHash returns upper case hash of dataset line `HASH:count`
+func lineHash(line string) string {
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+
+	return strings.ToUpper(strings.TrimSpace(line))
+}
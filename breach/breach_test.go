@@ -0,0 +1,146 @@
+package breach
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// breached returns passwords of test corpus and its lines sorted by hash
+func breached() ([]string, string) {
+	var passwords, lines []string
+
+	for i := 0; i < 1000; i++ {
+		passwords = append(passwords, fmt.Sprintf("password%d", i))
+	}
+
+	for i, p := range passwords {
+		lines = append(lines, fmt.Sprintf("%s:%d\r\n", hashHex(p), i+1))
+	}
+
+	sort.Strings(lines)
+
+	return passwords, strings.Join(lines, "")
+}
+
+func writeTemp(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "breach")
+	require.NoError(t, err)
+
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	return f.Name()
+}
+
+func assertChecker(t *testing.T, c Checker, passwords []string) {
+	for _, p := range passwords {
+		ok, err := c.Breached(p)
+		require.NoError(t, err)
+		assert.True(t, ok, p)
+	}
+
+	for _, p := range []string{"correct horse battery", "", "password1000", "PASSWORD1"} {
+		ok, err := c.Breached(p)
+		require.NoError(t, err)
+		assert.False(t, ok, p)
+	}
+}
+
+func TestSortedFile(t *testing.T) {
+	passwords, data := breached()
+
+	path := writeTemp(t, data)
+	defer os.Remove(path)
+
+	s, err := NewSortedFile(path)
+	require.NoError(t, err)
+
+	assertChecker(t, s, passwords)
+
+	// The first and the last line are found without new lines around them
+	lines := strings.Split(strings.TrimSpace(data), "\r\n")
+	require.NoError(t, ioutil.WriteFile(path, []byte(lines[0]+"\n"+lines[len(lines)-1]), 0600))
+
+	for _, p := range passwords {
+		ok, err := s.Breached(p)
+		require.NoError(t, err)
+
+		h := hashHex(p)
+		assert.Equal(t, strings.HasPrefix(lines[0], h) || strings.HasPrefix(lines[len(lines)-1], h), ok, p)
+	}
+
+	_, err = NewSortedFile(path + ".missing")
+	assert.Error(t, err)
+}
+
+func TestBloom(t *testing.T) {
+	passwords, data := breached()
+
+	b, err := NewBloom(uint64(len(passwords)), 0.0001)
+	require.NoError(t, err)
+
+	added, err := b.AddHashes(strings.NewReader(data + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(len(passwords)), added)
+
+	var buf bytes.Buffer
+	_, err = b.WriteTo(&buf)
+	require.NoError(t, err)
+
+	read, err := ReadBloom(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, b, read)
+
+	assertChecker(t, read, passwords)
+
+	_, err = b.AddHashes(strings.NewReader("not a hash:1\n"))
+	assert.Error(t, err)
+
+	_, err = ReadBloom(strings.NewReader("UMBLOOM1"))
+	assert.Error(t, err)
+
+	_, err = NewBloom(10, 1)
+	assert.Error(t, err)
+}
+
+func TestRangeAPI(t *testing.T) {
+	passwords, data := breached()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		prefix := strings.TrimPrefix(r.URL.Path, "/range/")
+		if len(prefix) != prefixLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for _, line := range strings.Split(data, "\r\n") {
+			if strings.HasPrefix(line, prefix) {
+				io.WriteString(w, line[prefixLength:]+"\r\n")
+			}
+		}
+
+		// Padding lines have count 0, even when they match
+		if padding := hashHex("correct horse battery"); strings.HasPrefix(padding, prefix) {
+			io.WriteString(w, padding[prefixLength:]+":0\r\n")
+		}
+	}))
+	defer srv.Close()
+
+	assertChecker(t, NewRangeAPI(NewHTTPRanges(srv.URL+"/range/", time.Second)), passwords)
+
+	_, err := NewRangeAPI(NewHTTPRanges(srv.URL+"/", time.Second)).Breached("password")
+	assert.Error(t, err)
+}
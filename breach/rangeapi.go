@@ -0,0 +1,80 @@
+package breach
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// prefixLength is number of hex digits of hash sent to range API
+const prefixLength = 5
+
+// RangeFetcher returns lines `SUFFIX:count` of hashes starting with prefix of five upper case hex digits
+type RangeFetcher interface {
+	FetchRange(prefix string) (io.ReadCloser, error)
+}
+
+// RangeAPI checks passwords with range API, only the first five hex digits of password hash leave the server
+type RangeAPI struct {
+	fetcher RangeFetcher
+}
+
+// NewRangeAPI returns checker asking fetcher for ranges
+func NewRangeAPI(fetcher RangeFetcher) *RangeAPI {
+	return &RangeAPI{fetcher: fetcher}
+}
+
+// Breached reports whether SHA-1 of password is in its range
+func (a *RangeAPI) Breached(password string) (bool, error) {
+	hash := hashHex(password)
+
+	body, err := a.fetcher.FetchRange(hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	suffix := hash[prefixLength:]
+	scanner := bufio.NewScanner(body)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Padding lines have count 0
+		if lineHash(line) == suffix && !strings.HasSuffix(strings.TrimSpace(line), ":0") {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// HTTPRanges fetches ranges from URL followed by prefix, e.g. http://mirror/range/ of a local mirror
+// of Pwned Passwords range API of Have I Been Pwned
+type HTTPRanges struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPRanges returns fetcher of ranges from url with requests timing out after timeout
+func NewHTTPRanges(url string, timeout time.Duration) *HTTPRanges {
+	return &HTTPRanges{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+// FetchRange requests range of prefix
+func (h *HTTPRanges) FetchRange(prefix string) (io.ReadCloser, error) {
+	resp, err := h.client.Get(h.url + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("range API responded with %s", resp.Status)
+	}
+
+	return resp.Body, nil
+}
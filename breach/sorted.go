@@ -0,0 +1,95 @@
+package breach
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// SortedFile checks passwords against file of `HASH:count` lines sorted by hash, as downloaded from
+// Have I Been Pwned ordered by hash. File is searched in place with binary search, so it is not loaded
+// into memory and can be replaced while the server runs.
+type SortedFile struct {
+	path string
+}
+
+// NewSortedFile returns checker of sorted file at path, which must be readable
+func NewSortedFile(path string) (*SortedFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SortedFile{path: path}, f.Close()
+}
+
+// Breached reports whether SHA-1 of password is in file
+func (s *SortedFile) Breached(password string) (bool, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	target := hashHex(password)
+	size := info.Size()
+
+	// The first line at or after offset is not less than target for offsets from lo on
+	lo, hi := int64(0), size
+
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		line, err := lineAt(f, mid, size)
+		if err != nil {
+			return false, err
+		}
+
+		if line == "" || lineHash(line) >= target {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	line, err := lineAt(f, lo, size)
+	if err != nil {
+		return false, err
+	}
+
+	return line != "" && lineHash(line) == target, nil
+}
+
+// lineAt returns the first line of f which starts at or after offset, empty at the end of file
+func lineAt(f io.ReaderAt, offset, size int64) (string, error) {
+	start := offset
+	if start > 0 {
+		// Line starts after new line, so reading from the previous byte finds line starting at offset
+		start--
+	}
+
+	r := bufio.NewReaderSize(io.NewSectionReader(f, start, size-start), 128)
+
+	if offset > 0 {
+		_, err := r.ReadString('\n')
+		if err == io.EOF {
+			return "", nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	return line, nil
+}
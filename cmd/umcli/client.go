@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/urfave/cli/v2"
+)
+
+const clientTimeout = 30 * time.Second
+
+// client calls user-manager REST API on behalf of admin.
+// Admin is authenticated with password when it is set, otherwise with tokens saved by login command.
+type client struct {
+	address         string
+	user            string
+	password        string
+	otp             string
+	clientID        string
+	credentialsPath string
+	http            *http.Client
+}
+
+func newClient(c *cli.Context) *client {
+	return &client{
+		address:         strings.TrimSuffix(c.String(flagAddress), "/"),
+		user:            c.String(flagUser),
+		password:        c.String(flagPassword),
+		otp:             c.String(flagOTP),
+		clientID:        c.String(flagClientID),
+		credentialsPath: c.String(flagCredentials),
+		http:            &http.Client{Timeout: clientTimeout},
+	}
+}
+
+// do sends in as JSON body and decodes response body into out, when they are not nil
+func (c *client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.address+path, body)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+
+		if c.otp != "" {
+			req.Header.Set(middleware.OTPHeader, c.otp)
+		}
+	} else {
+		accessToken, err := c.accessToken()
+		if err != nil {
+			return err
+		}
+
+		if accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiError model.Error
+		if err := json.NewDecoder(resp.Body).Decode(&apiError); err != nil || apiError.Message == "" {
+			return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+		}
+
+		// Admin actions need recent and strong enough authentication, tokens of an old login do not allow them
+		if strings.Contains(resp.Header.Get("WWW-Authenticate"), "insufficient_user_authentication") {
+			return fmt.Errorf("%s %s: %s, run umcli login", method, path, apiError.Message)
+		}
+
+		return fmt.Errorf("%s %s: %s %s", method, path, apiError.Code, apiError.Message)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	pathDeviceAuthorization = "/oauth/device"
+	pathToken               = "/oauth/token"
+	pathRevoke              = "/oauth/revoke"
+	// expirySkew renews access token a bit before it expires, so it does not expire on the way to server
+	expirySkew = 30 * time.Second
+	// slowDownStep is added to polling interval when server asks to slow down (RFC 8628 section 3.5)
+	slowDownStep = 5 * time.Second
+)
+
+// credentials are tokens saved by login command and used instead of admin password
+type credentials struct {
+	Address      string    `json:"address"`
+	ClientID     string    `json:"client_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// defaultCredentialsPath returns file in user config directory, e.g. ~/.config/umcli/credentials.json
+func defaultCredentialsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "umcli", "credentials.json")
+}
+
+func loginCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "login",
+		Usage: "sign in with device code in a browser and save tokens instead of admin password",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "scope",
+				Usage: "requested scope, all scopes of the client when empty",
+			},
+		},
+		Action: login,
+	}
+}
+
+func logoutCommand() *cli.Command {
+	return &cli.Command{
+		Name:   "logout",
+		Usage:  "revoke and remove saved tokens",
+		Action: logout,
+	}
+}
+
+func login(c *cli.Context) error {
+	cl := newClient(c)
+
+	var auth deviceAuthorization
+
+	err := cl.postForm(pathDeviceAuthorization, url.Values{"client_id": {cl.clientID}, "scope": {c.String("scope")}}, &auth)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("To sign in, open %s and enter code %s\n", auth.VerificationURI, auth.UserCode)
+
+	if auth.VerificationURIComplete != "" {
+		fmt.Printf("or open %s\n", auth.VerificationURIComplete)
+	}
+
+	interval := time.Duration(auth.Interval) * time.Second
+
+	for {
+		time.Sleep(interval)
+
+		var resp tokenResponse
+
+		err := cl.postForm(pathToken, url.Values{
+			"grant_type":  {model.GrantDeviceCode},
+			"client_id":   {cl.clientID},
+			"device_code": {auth.DeviceCode},
+		}, &resp)
+
+		var oerr *oauth.Error
+		if errors.As(err, &oerr) {
+			switch oerr.Code {
+			case oauth.ErrorAuthorizationPending:
+				continue
+			case oauth.ErrorSlowDown:
+				interval += slowDownStep
+				continue
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = cl.saveCredentials(cl.clientID, &resp)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println("Logged in")
+
+		return nil
+	}
+}
+
+func logout(c *cli.Context) error {
+	cl := newClient(c)
+
+	creds, err := cl.loadCredentials()
+	if err != nil || creds == nil {
+		return err
+	}
+
+	err = os.Remove(cl.credentialsPath)
+	if err != nil {
+		return err
+	}
+
+	if creds.RefreshToken == "" {
+		return nil
+	}
+
+	return cl.postForm(pathRevoke, url.Values{"client_id": {creds.ClientID}, "token": {creds.RefreshToken}}, nil)
+}
+
+// postForm sends form to OAuth endpoint, OAuth error responses are returned as *oauth.Error
+func (c *client) postForm(path string, form url.Values, out interface{}) error {
+	resp, err := c.http.PostForm(c.address+path, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var oerr oauth.Error
+		if err := json.NewDecoder(resp.Body).Decode(&oerr); err != nil || oerr.Code == "" {
+			return fmt.Errorf("POST %s: %s", path, resp.Status)
+		}
+
+		return &oerr
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// accessToken returns saved access token for server address, it is refreshed when expired.
+// Empty token is returned when user has not logged in.
+func (c *client) accessToken() (string, error) {
+	creds, err := c.loadCredentials()
+	if err != nil || creds == nil || creds.Address != c.address {
+		return "", err
+	}
+
+	if time.Now().Add(expirySkew).Before(creds.ExpiresAt) {
+		return creds.AccessToken, nil
+	}
+
+	if creds.RefreshToken == "" {
+		return "", errors.New("session expired, run umcli login")
+	}
+
+	var resp tokenResponse
+
+	err = c.postForm(pathToken, url.Values{
+		"grant_type":    {model.GrantRefreshToken},
+		"client_id":     {creds.ClientID},
+		"refresh_token": {creds.RefreshToken},
+	}, &resp)
+	if err != nil {
+		return "", fmt.Errorf("refresh session: %w, run umcli login", err)
+	}
+
+	err = c.saveCredentials(creds.ClientID, &resp)
+	if err != nil {
+		return "", err
+	}
+
+	return resp.AccessToken, nil
+}
+
+func (c *client) loadCredentials() (*credentials, error) {
+	if c.credentialsPath == "" {
+		return nil, nil
+	}
+
+	b, err := ioutil.ReadFile(c.credentialsPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var creds credentials
+
+	err = json.Unmarshal(b, &creds)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", c.credentialsPath, err)
+	}
+
+	return &creds, nil
+}
+
+// saveCredentials writes tokens readable only by the user
+func (c *client) saveCredentials(clientID string, resp *tokenResponse) error {
+	if c.credentialsPath == "" {
+		return errors.New("credentials file is not set")
+	}
+
+	b, err := json.MarshalIndent(&credentials{
+		Address:      c.address,
+		ClientID:     clientID,
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.credentialsPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.credentialsPath, b, 0600)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/urfave/cli/v2"
+)
+
+const pathLogLevel = "/admin/log/level"
+
+func logLevelCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "log-level",
+		Usage: "show or change log level of running server",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "get",
+				Usage:  "show log level of every component",
+				Action: getLogLevel,
+			},
+			{
+				Name:  "set",
+				Usage: "change log level of one or all components",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "component",
+						Usage: "component to change: main, http, auth, storage, discovery. All when empty",
+					},
+					&cli.StringFlag{
+						Name:     "level",
+						Usage:    "new log level",
+						Required: true,
+					},
+					&cli.DurationFlag{
+						Name:  "for",
+						Usage: "revert to configured level after duration, keep forever when zero",
+					},
+				},
+				Action: setLogLevel,
+			},
+		},
+	}
+}
+
+func getLogLevel(c *cli.Context) error {
+	var levels []logger.ComponentLevel
+
+	err := newClient(c).do(http.MethodGet, pathLogLevel, nil, &levels)
+	if err != nil {
+		return err
+	}
+
+	return printLevels(levels)
+}
+
+func setLogLevel(c *cli.Context) error {
+	req := map[string]string{
+		"component": c.String("component"),
+		"level":     c.String("level"),
+	}
+
+	if d := c.Duration("for"); d > 0 {
+		req["duration"] = d.String()
+	}
+
+	var levels []logger.ComponentLevel
+
+	err := newClient(c).do(http.MethodPut, pathLogLevel, req, &levels)
+	if err != nil {
+		return err
+	}
+
+	return printLevels(levels)
+}
+
+func printLevels(levels []logger.ComponentLevel) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tLEVEL\tREVERT AT")
+
+	for _, l := range levels {
+		revertAt := "-"
+		if l.RevertAt != nil {
+			revertAt = l.RevertAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", l.Component, l.Level, revertAt)
+	}
+
+	return w.Flush()
+}
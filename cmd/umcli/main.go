@@ -4,8 +4,78 @@
 // - delete a user by login
 // - disable a user by login
 // - get user information by login except of password hash and salt
+// - change log level of running server
+// - sign in with device code instead of admin password
+// - manage registered OAuth clients
+// - reset second factor of a user
 package main
 
+import (
+	"log"
+	"os"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	flagAddress     = "address"
+	flagUser        = "user"
+	flagPassword    = "password"
+	flagOTP         = "otp"
+	flagClientID    = "client-id"
+	flagCredentials = "credentials"
+)
+
 func main() {
+	app := &cli.App{
+		Name:  "umcli",
+		Usage: "admin command line tool for user-manager",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    flagAddress,
+				Usage:   "user-manager server address",
+				Value:   "http://localhost:8000",
+				EnvVars: []string{"UM_ADDRESS"},
+			},
+			&cli.StringFlag{
+				Name:    flagUser,
+				Usage:   "admin login",
+				EnvVars: []string{"UM_ADMIN_USER"},
+			},
+			&cli.StringFlag{
+				Name:    flagPassword,
+				Usage:   "admin password",
+				EnvVars: []string{"UM_ADMIN_PASSWORD"},
+			},
+			&cli.StringFlag{
+				Name:    flagOTP,
+				Usage:   "TOTP or recovery code of admin with two-factor authentication",
+				EnvVars: []string{"UM_ADMIN_OTP"},
+			},
+			&cli.StringFlag{
+				Name:    flagClientID,
+				Usage:   "OAuth client id used by login",
+				Value:   "umcli",
+				EnvVars: []string{"UM_CLIENT_ID"},
+			},
+			&cli.StringFlag{
+				Name:    flagCredentials,
+				Usage:   "file with tokens saved by login",
+				Value:   defaultCredentialsPath(),
+				EnvVars: []string{"UM_CREDENTIALS"},
+			},
+		},
+		Commands: []*cli.Command{
+			loginCommand(),
+			logoutCommand(),
+			logLevelCommand(),
+			clientCommand(),
+			userCommand(),
+		},
+	}
 
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/urfave/cli/v2"
+)
+
+const pathClients = "/admin/clients"
+
+// clientMetadataFlags set metadata of created or updated client
+var clientMetadataFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "name",
+		Usage: "human readable client name",
+	},
+	&cli.StringSliceFlag{
+		Name:  "redirect-uri",
+		Usage: "allowed redirect URI, can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "post-logout-redirect-uri",
+		Usage: "allowed redirect URI after logout, can be repeated",
+	},
+	&cli.StringSliceFlag{
+		Name:  "grant",
+		Usage: "allowed grant type, can be repeated. authorization_code when not set",
+	},
+	&cli.StringFlag{
+		Name:  "scope",
+		Usage: "space separated scopes client may request",
+	},
+	&cli.StringSliceFlag{
+		Name:  "exchange-audience",
+		Usage: "audience client may request with token exchange, can be repeated",
+	},
+	&cli.BoolFlag{
+		Name:  "impersonation",
+		Usage: "allow client to exchange token of administrator for token of other user",
+	},
+}
+
+func clientCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "client",
+		Usage: "manage registered OAuth clients",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "show all clients",
+				Action: listClients,
+			},
+			{
+				Name:      "get",
+				Usage:     "show client",
+				ArgsUsage: "<id>",
+				Action:    getClient,
+			},
+			{
+				Name:  "create",
+				Usage: "register client and print its secret",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "id",
+						Usage: "client id, generated when empty",
+					},
+					&cli.BoolFlag{
+						Name:  "public",
+						Usage: "register public client without secret, like single page or native application",
+					},
+				}, clientMetadataFlags...),
+				Action: createClient,
+			},
+			{
+				Name:      "update",
+				Usage:     "change metadata of client, not set flags keep current values",
+				ArgsUsage: "<id>",
+				Flags:     clientMetadataFlags,
+				Action:    updateClient,
+			},
+			{
+				Name:      "delete",
+				Usage:     "delete client and revoke its refresh tokens",
+				ArgsUsage: "<id>",
+				Action:    deleteClient,
+			},
+			{
+				Name:      "rotate-secret",
+				Usage:     "generate a new secret of confidential client, the old one stops working",
+				ArgsUsage: "<id>",
+				Action:    rotateClientSecret,
+			},
+		},
+	}
+}
+
+func listClients(c *cli.Context) error {
+	var clients []*handlers.ClientMetadata
+
+	err := newClient(c).do(http.MethodGet, pathClients, nil, &clients)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tAUTH METHOD\tGRANTS\tSCOPE")
+
+	for _, m := range clients {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.ClientID, m.ClientName, m.TokenEndpointAuthMethod,
+			strings.Join(m.GrantTypes, ","), m.Scope)
+	}
+
+	return w.Flush()
+}
+
+func getClient(c *cli.Context) error {
+	id, err := clientIDArg(c)
+	if err != nil {
+		return err
+	}
+
+	var m handlers.ClientMetadata
+
+	err = newClient(c).do(http.MethodGet, clientPath(id), nil, &m)
+	if err != nil {
+		return err
+	}
+
+	return printClient(&m)
+}
+
+func createClient(c *cli.Context) error {
+	m := &handlers.ClientMetadata{ClientID: c.String("id")}
+	if c.Bool("public") {
+		m.TokenEndpointAuthMethod = oauth.AuthMethodNone
+	}
+
+	applyClientFlags(c, m)
+
+	var resp handlers.ClientMetadata
+
+	err := newClient(c).do(http.MethodPost, pathClients, m, &resp)
+	if err != nil {
+		return err
+	}
+
+	return printClient(&resp)
+}
+
+func updateClient(c *cli.Context) error {
+	id, err := clientIDArg(c)
+	if err != nil {
+		return err
+	}
+
+	cl := newClient(c)
+
+	var m handlers.ClientMetadata
+
+	err = cl.do(http.MethodGet, clientPath(id), nil, &m)
+	if err != nil {
+		return err
+	}
+
+	applyClientFlags(c, &m)
+
+	var resp handlers.ClientMetadata
+
+	err = cl.do(http.MethodPut, clientPath(id), &m, &resp)
+	if err != nil {
+		return err
+	}
+
+	return printClient(&resp)
+}
+
+func deleteClient(c *cli.Context) error {
+	id, err := clientIDArg(c)
+	if err != nil {
+		return err
+	}
+
+	return newClient(c).do(http.MethodDelete, clientPath(id), nil, nil)
+}
+
+func rotateClientSecret(c *cli.Context) error {
+	id, err := clientIDArg(c)
+	if err != nil {
+		return err
+	}
+
+	var resp handlers.ClientMetadata
+
+	err = newClient(c).do(http.MethodPost, clientPath(id)+"/secret", nil, &resp)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(resp.ClientSecret)
+
+	return nil
+}
+
+// applyClientFlags sets metadata from flags given on command line
+func applyClientFlags(c *cli.Context, m *handlers.ClientMetadata) {
+	if c.IsSet("name") {
+		m.ClientName = c.String("name")
+	}
+
+	if c.IsSet("redirect-uri") {
+		m.RedirectURIs = c.StringSlice("redirect-uri")
+	}
+
+	if c.IsSet("post-logout-redirect-uri") {
+		m.PostLogoutRedirectURIs = c.StringSlice("post-logout-redirect-uri")
+	}
+
+	if c.IsSet("grant") {
+		m.GrantTypes = c.StringSlice("grant")
+	}
+
+	if c.IsSet("scope") {
+		m.Scope = c.String("scope")
+	}
+
+	if c.IsSet("exchange-audience") {
+		m.ExchangeAudiences = c.StringSlice("exchange-audience")
+	}
+
+	if c.IsSet("impersonation") {
+		m.Impersonation = c.Bool("impersonation")
+	}
+}
+
+func clientIDArg(c *cli.Context) (string, error) {
+	if c.NArg() != 1 {
+		return "", errors.New("client id is required")
+	}
+
+	return c.Args().First(), nil
+}
+
+func clientPath(id string) string {
+	return pathClients + "/" + url.PathEscape(id)
+}
+
+func printClient(m *handlers.ClientMetadata) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "ID\t%s\n", m.ClientID)
+
+	if m.ClientSecret != "" {
+		fmt.Fprintf(w, "SECRET\t%s\n", m.ClientSecret)
+	}
+
+	fmt.Fprintf(w, "NAME\t%s\n", m.ClientName)
+	fmt.Fprintf(w, "AUTH METHOD\t%s\n", m.TokenEndpointAuthMethod)
+	fmt.Fprintf(w, "GRANTS\t%s\n", strings.Join(m.GrantTypes, " "))
+	fmt.Fprintf(w, "SCOPE\t%s\n", m.Scope)
+	fmt.Fprintf(w, "REDIRECT URIS\t%s\n", strings.Join(m.RedirectURIs, " "))
+	fmt.Fprintf(w, "POST LOGOUT REDIRECT URIS\t%s\n", strings.Join(m.PostLogoutRedirectURIs, " "))
+
+	if len(m.ExchangeAudiences) > 0 || m.Impersonation {
+		fmt.Fprintf(w, "EXCHANGE AUDIENCES\t%s\n", strings.Join(m.ExchangeAudiences, " "))
+		fmt.Fprintf(w, "IMPERSONATION\t%t\n", m.Impersonation)
+	}
+
+	return w.Flush()
+}
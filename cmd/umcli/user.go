@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/urfave/cli/v2"
+)
+
+const pathUsers = "/admin/users"
+
+func userCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "user",
+		Usage: "manage credentials of users",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "reset-2fa",
+				Usage:     "remove second factor of user, who lost authenticator and recovery codes",
+				ArgsUsage: "LOGIN",
+				Action:    resetTwoFactor,
+			},
+			{
+				Name:      "unlock",
+				Usage:     "unlock user locked after too many failed logins",
+				ArgsUsage: "LOGIN",
+				Action:    unlockUser,
+			},
+		},
+	}
+}
+
+func resetTwoFactor(c *cli.Context) error {
+	login, err := loginArg(c)
+	if err != nil {
+		return err
+	}
+
+	return newClient(c).do(http.MethodDelete, userPath(login)+"/2fa", nil, nil)
+}
+
+func unlockUser(c *cli.Context) error {
+	login, err := loginArg(c)
+	if err != nil {
+		return err
+	}
+
+	return newClient(c).do(http.MethodDelete, userPath(login)+"/lockout", nil, nil)
+}
+
+func loginArg(c *cli.Context) (string, error) {
+	if c.NArg() != 1 {
+		return "", errors.New("login is required")
+	}
+
+	return c.Args().First(), nil
+}
+
+func userPath(login string) string {
+	return pathUsers + "/" + url.PathEscape(login)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lvl484/user-manager/breach"
+	"github.com/urfave/cli/v2"
+)
+
+func breachCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "breach",
+		Usage: "breached passwords datasets",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "bloom",
+				Usage: "build bloom filter for BREACH_CHECK=bloom from SHA-1 hashes of breached passwords",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "input",
+						Usage:    "file of HASH:count lines, e.g. Pwned Passwords SHA-1",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Usage:    "file of bloom filter",
+						Required: true,
+					},
+					&cli.Float64Flag{
+						Name:  "rate",
+						Usage: "false positive rate, share of passwords which are not breached but rejected",
+						Value: 0.001,
+					},
+				},
+				Action: buildBloom,
+			},
+		},
+	}
+}
+
+func buildBloom(c *cli.Context) error {
+	n, err := countLines(c.String("input"))
+	if err != nil {
+		return err
+	}
+
+	bloom, err := breach.NewBloom(n, c.Float64("rate"))
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(c.String("input"))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	added, err := bloom.AddHashes(bufio.NewReader(in))
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(c.String("output"))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(out)
+
+	size, err := bloom.WriteTo(w)
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(c.App.Writer, "Added %d hashes, filter has %d MiB\n", added, size>>20)
+
+	return err
+}
+
+// countLines returns number of lines of file at path
+func countLines(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	n := uint64(0)
+
+	for {
+		line, err := r.ReadSlice('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' || err == io.EOF && len(line) > 0 {
+			n++
+		}
+
+		if err == io.EOF {
+			return n, nil
+		}
+
+		if err != nil && err != bufio.ErrBufferFull {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/urfave/cli/v2"
+)
+
+const pepperKeyLength = 32
+
+func hashCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "hash",
+		Usage: "password hashing tools",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "tune",
+				Usage: "benchmark this host and recommend argon2id parameters for target latency",
+				Flags: []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "target",
+						Usage: "how long one hash may take",
+						Value: 500 * time.Millisecond,
+					},
+					&cli.IntFlag{
+						Name:  "max-memory",
+						Usage: "most memory of one hash in MiB, it is lowered when even one iteration is too slow",
+						Value: 64,
+					},
+					&cli.IntFlag{
+						Name:  "threads",
+						Usage: "parallelism of one hash",
+						Value: 1,
+					},
+					&cli.IntFlag{
+						Name:  "budget",
+						Usage: "memory budget of concurrent hashes in MiB, see HASH_MEMORY_BUDGET",
+						Value: 256,
+					},
+				},
+				Action: tuneHash,
+			},
+			{
+				Name:  "pepper",
+				Usage: "generate pepper key line to put on top of PASSWORD_PEPPER_FILE",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "id",
+						Usage:    "key id stored in password hashes, e.g. date of rotation",
+						Required: true,
+					},
+				},
+				Action: newPepperKey,
+			},
+		},
+	}
+}
+
+func tuneHash(c *cli.Context) error {
+	threads := c.Int("threads")
+	if threads < 1 || threads > 255 {
+		return fmt.Errorf("threads must be between 1 and 255")
+	}
+
+	fmt.Fprintf(c.App.Writer, "Benchmarking argon2id on %d CPUs for %s per hash...\n", runtime.NumCPU(),
+		c.Duration("target"))
+
+	params, took, err := model.TunePassword(c.Duration("target"), uint32(c.Int("max-memory"))*1024, uint8(threads))
+	if err != nil {
+		return err
+	}
+
+	return printHashParams(c.App.Writer, params, took, c.Int("budget"))
+}
+
+func newPepperKey(c *cli.Context) error {
+	key := make([]byte, pepperKeyLength)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return err
+	}
+
+	line := c.String("id") + ":" + base64.StdEncoding.EncodeToString(key)
+
+	// Line is checked the way server reads it
+	_, err = model.ParsePepper([]byte(line))
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(c.App.Writer, line)
+
+	return err
+}
+
+// printHashParams prints environment variables of params which hash in took
+func printHashParams(w io.Writer, params *model.PasswordConfig, took time.Duration, budget int) error {
+	memory := int(params.Memory() / 1024)
+
+	_, err := fmt.Fprintf(w, "One hash takes %s with %s\n\nHASH_TIME=%d\nHASH_MEMORY=%d\nHASH_THREADS=%d\n",
+		took.Round(time.Millisecond), params, params.Time(), memory, params.Threads())
+	if err != nil {
+		return err
+	}
+
+	if budget > 0 {
+		_, err = fmt.Fprintf(w, "\nHASH_MEMORY_BUDGET=%d runs %d hashes at once\n", budget, budget/memory)
+	}
+
+	return err
+}
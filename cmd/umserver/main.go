@@ -2,6 +2,8 @@
 // UM service stores user related context and credentials.
 // It provides a REST API to perform a set of CRUD to manage users and an endpoint to authenticate.
 // All users data will be stored in a database.
+// `umserver hash tune` recommends password hashing parameters for the host instead of starting the server,
+// `umserver breach bloom` builds bloom filter of breached passwords.
 package main
 
 import (
@@ -20,13 +22,36 @@ import (
 	"github.com/lvl484/user-manager/model"
 	"github.com/lvl484/user-manager/server"
 	"github.com/lvl484/user-manager/storage"
+	"github.com/lvl484/user-manager/token"
 
 	_ "github.com/lib/pq"
+	"github.com/urfave/cli/v2"
 )
 
 const gracefulShutdownTimeOut = 10 * time.Second
 
 func main() {
+	app := &cli.App{
+		Name:  "umserver",
+		Usage: "user-manager HTTP server",
+		Action: func(*cli.Context) error {
+			serve()
+			return nil
+		},
+		Commands: []*cli.Command{
+			hashCommand(),
+			breachCommand(),
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve runs HTTP server until it fails or process is interrupted
+func serve() {
 	var (
 		ctx, cancel = context.WithCancel(context.Background())
 		wg          = new(sync.WaitGroup)
@@ -48,11 +73,6 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// Example
-	log.Println(cfg)
-	log.Println(cfg.LoggerConfig(ctx))
-	log.Println(cfg.DBConfig(ctx))
-
 	dbConfig, err := cfg.DBConfig(ctx)
 	if err != nil {
 		logger.LogUM.Fatalf("Can not find data for DB configuration %v\n", err)
@@ -67,8 +87,85 @@ func main() {
 
 	closers = append(closers, db)
 
+	model.SetHashPool(cfg.HashPool())
+
+	passwords, err := cfg.PasswordConfig()
+	if err != nil {
+		logger.LogUM.Fatalf("Password hashing configuration is invalid %v\n", err)
+	}
+
+	model.SetPasswordConfig(passwords)
+
+	pepper, err := cfg.Pepper()
+	if err != nil {
+		logger.LogUM.Fatalf("Password pepper loading failed %v\n", err)
+	}
+
+	model.SetPepper(pepper)
+
+	policy, err := cfg.PasswordPolicy()
+	if err != nil {
+		logger.LogUM.Fatalf("Breached passwords loading failed %v\n", err)
+	}
+
+	model.SetPasswordPolicy(policy)
+
+	tokenConfig := cfg.TokenConfig()
+
+	keys, err := token.NewKeyRing(tokenConfig.KeyRing, model.NewSigningKeysRepo(db))
+	if err != nil {
+		logger.LogUM.Fatalf("Key ring initialization failed %v\n", err)
+	}
+
+	go keys.Run(ctx)
+
+	issuer, err := token.NewIssuer(keys, tokenConfig)
+	if err != nil {
+		logger.LogUM.Fatalf("Token issuer initialization failed %v\n", err)
+	}
+
+	codes, err := cfg.CodeSender()
+	if err != nil {
+		logger.LogUM.Fatalf("One-time code sender initialization failed %v\n", err)
+	}
+
+	limiter, err := cfg.RateLimiter(db)
+	if err != nil {
+		logger.LogUM.Fatalf("Rate limiter initialization failed %v\n", err)
+	}
+
+	go limiter.Run(ctx)
+
+	rr := model.NewRefreshTokensRepo(db, cfg.RefreshTokenTTL)
+
+	sr := model.NewSessionsRepo(db, cfg.SessionIdleTimeout, cfg.SessionTTL, cfg.MaxSessions)
+
+	credentials, err := model.NewCredentialCache(cfg.CredentialCacheTTL, cfg.CredentialCacheSize)
+	if err != nil {
+		logger.LogUM.Fatalf("Credential cache initialization failed %v\n", err)
+	}
+
 	ur := model.NewUsersRepo(db)
-	h := server.NewHTTP(cfg, ur)
+	ur.AddRevoker(rr)
+	ur.AddRevoker(sr)
+	ur.AddInvalidator(credentials)
+
+	h := server.NewHTTP(cfg, issuer, codes, &server.Repositories{
+		Users:          ur,
+		RefreshTokens:  rr,
+		Clients:        model.NewClientsRepo(db),
+		AuthCodes:      model.NewAuthCodesRepo(db, cfg.OAuthCodeTTL),
+		Consents:       model.NewConsentsRepo(db),
+		RevokedTokens:  model.NewRevokedTokensRepo(db),
+		DeviceCodes:    model.NewDeviceCodesRepo(db, cfg.DeviceCodeTTL, cfg.DeviceCodeInterval),
+		TokenExchanges: model.NewTokenExchangesRepo(db),
+		Sessions:       sr,
+		TwoFactor:      model.NewTwoFactorRepo(db),
+		WebAuthn:       model.NewWebAuthnRepo(db),
+		LoginAttempts:  model.NewLoginAttemptsRepo(db, cfg.LockoutPolicy()),
+		RateLimits:     limiter,
+		Credentials:    credentials,
+	})
 
 	// Go routine with run HTTP server
 	wg.Add(1)
@@ -3,14 +3,23 @@ package main
 import (
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/lvl484/user-manager/breach"
 	"github.com/lvl484/user-manager/config"
 	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
 	"github.com/lvl484/user-manager/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
 )
 
 func TestMain(m *testing.M) {
@@ -83,7 +92,7 @@ func Test_GracefulShutdown_Timeout(t *testing.T) {
 }
 
 func NewServerMock() *server.HTTP {
-	return server.NewHTTP(&config.Config{}, nil)
+	return server.NewHTTP(&config.Config{}, nil, nil, &server.Repositories{})
 }
 
 type CloserMock struct {
@@ -101,3 +110,59 @@ func NewCloserMock(name string, expected func() error) io.Closer {
 func (cm CloserMock) Close() error {
 	return cm.expected()
 }
+
+func TestPrintHashParams(t *testing.T) {
+	params, err := model.NewCustomPasswordConfig(3, 64*1024, 1, 16)
+	require.NoError(t, err)
+
+	var b strings.Builder
+
+	require.NoError(t, printHashParams(&b, params, 412*time.Millisecond, 256))
+	assert.Equal(t, "One hash takes 412ms with m=65536,t=3,p=1,len=16\n\n"+
+		"HASH_TIME=3\nHASH_MEMORY=64\nHASH_THREADS=1\n\nHASH_MEMORY_BUDGET=256 runs 4 hashes at once\n", b.String())
+}
+
+func TestHashPepper(t *testing.T) {
+	var b strings.Builder
+
+	app := &cli.App{Writer: &b, Commands: []*cli.Command{hashCommand()}}
+
+	require.NoError(t, app.Run([]string{"umserver", "hash", "pepper", "--id", "2020-05"}))
+
+	p, err := model.ParsePepper([]byte(b.String()))
+	require.NoError(t, err)
+	assert.Equal(t, "2020-05", p.Current())
+
+	assert.Error(t, app.Run([]string{"umserver", "hash", "pepper", "--id", "2020:05"}))
+}
+
+func TestBreachBloom(t *testing.T) {
+	dir, err := ioutil.TempDir("", "breach")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "pwned.txt")
+	require.NoError(t, ioutil.WriteFile(input, []byte("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"+
+		"7C4A8D09CA3762AF61E59520943DC26494F8941B:24230577"), 0600))
+
+	var b strings.Builder
+
+	app := &cli.App{Writer: &b, Commands: []*cli.Command{breachCommand()}}
+	output := filepath.Join(dir, "pwned.bloom")
+
+	require.NoError(t, app.Run([]string{"umserver", "breach", "bloom", "--input", input, "--output", output}))
+	assert.Equal(t, "Added 2 hashes, filter has 0 MiB\n", b.String())
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+
+	bloom, err := breach.ReadBloom(f)
+	require.NoError(t, err)
+
+	for _, password := range []string{"password", "123456"} {
+		ok, err := bloom.Breached(password)
+		require.NoError(t, err)
+		assert.True(t, ok, password)
+	}
+}
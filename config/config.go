@@ -4,17 +4,40 @@
 package config
 
 import (
+	"bufio"
 	"context"
+	"database/sql"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"time"
 
+	"github.com/lvl484/user-manager/breach"
 	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/notify"
+	"github.com/lvl484/user-manager/ratelimit"
 	"github.com/lvl484/user-manager/storage"
+	"github.com/lvl484/user-manager/token"
+	"github.com/lvl484/user-manager/webauthn"
 
 	consul "github.com/hashicorp/consul/api"
 	"github.com/kelseyhightower/envconfig"
 )
 
+// Stores of rate limits
+const (
+	rateLimitMemory   = "memory"
+	rateLimitPostgres = "postgres"
+)
+
+// Datasets of breached passwords
+const (
+	breachSorted = "sorted"
+	breachBloom  = "bloom"
+	breachRange  = "range"
+)
+
 // Config model includes all necessary information, which will be read from environment variables
 type Config struct {
 	PostgresUser string `envconfig:"POSTGRES_USER" required:"true"`
@@ -29,12 +52,117 @@ type Config struct {
 	ReadTimeout  time.Duration `envconfig:"READ_TIMEOUT" default:"60s"`
 	WriteTimeout time.Duration `envconfig:"WRITE_TIMEOUT" default:"60s"`
 
+	AdminUsers []string `envconfig:"ADMIN_USERS"`
+
+	// ClientRegistrationToken is initial access token of dynamic client registration, it is disabled when empty
+	ClientRegistrationToken string `envconfig:"CLIENT_REGISTRATION_TOKEN"`
+
+	TokenIssuer        string        `envconfig:"TOKEN_ISSUER" default:"user-manager"`
+	TokenAudience      string        `envconfig:"TOKEN_AUDIENCE"`
+	TokenOAuthAudience string        `envconfig:"TOKEN_OAUTH_AUDIENCE" default:"oauth"`
+	TokenTTL           time.Duration `envconfig:"TOKEN_TTL" default:"15m"`
+	TokenAlgorithm     string        `envconfig:"TOKEN_ALGORITHM" default:"EdDSA"`
+	TokenKeyRotation   time.Duration `envconfig:"TOKEN_KEY_ROTATION" default:"24h"`
+	TokenKeyOverlap    time.Duration `envconfig:"TOKEN_KEY_OVERLAP" default:"1h"`
+	RefreshTokenTTL    time.Duration `envconfig:"REFRESH_TOKEN_TTL" default:"720h"`
+	OAuthCodeTTL       time.Duration `envconfig:"OAUTH_CODE_TTL" default:"1m"`
+	DeviceCodeTTL      time.Duration `envconfig:"DEVICE_CODE_TTL" default:"10m"`
+	DeviceCodeInterval time.Duration `envconfig:"DEVICE_CODE_INTERVAL" default:"5s"`
+
+	SessionIdleTimeout  time.Duration `envconfig:"SESSION_IDLE_TIMEOUT" default:"30m"`
+	SessionTTL          time.Duration `envconfig:"SESSION_TTL" default:"12h"`
+	SessionCookieSecure bool          `envconfig:"SESSION_COOKIE_SECURE" default:"true"`
+	// TOTPIssuer is name of the service shown by authenticator apps
+	TOTPIssuer string `envconfig:"TOTP_ISSUER" default:"user-manager"`
+	// WebAuthnRPID is domain WebAuthn credentials are scoped to, WebAuthnOrigin is origin of login page
+	WebAuthnRPID   string `envconfig:"WEBAUTHN_RP_ID" default:"localhost"`
+	WebAuthnRPName string `envconfig:"WEBAUTHN_RP_NAME" default:"user-manager"`
+	WebAuthnOrigin string `envconfig:"WEBAUTHN_ORIGIN" default:"http://localhost:8000"`
+	// SMTPAddress is host:port of mail server one-time codes are sent with, email codes are disabled when empty
+	SMTPAddress  string        `envconfig:"SMTP_ADDRESS"`
+	SMTPFrom     string        `envconfig:"SMTP_FROM" default:"user-manager <noreply@localhost>"`
+	SMTPUsername string        `envconfig:"SMTP_USERNAME"`
+	SMTPPassword string        `envconfig:"SMTP_PASSWORD"`
+	SMTPTimeout  time.Duration `envconfig:"SMTP_TIMEOUT" default:"10s"`
+	// SMSURL is endpoint of HTTP SMS gateway, SMS codes are disabled when empty
+	SMSURL     string        `envconfig:"SMS_URL"`
+	SMSToken   string        `envconfig:"SMS_TOKEN"`
+	SMSFrom    string        `envconfig:"SMS_FROM"`
+	SMSTimeout time.Duration `envconfig:"SMS_TIMEOUT" default:"10s"`
+	// OTP templates are text/template of messages with one-time code, defaults of notify package are used when empty
+	OTPEmailSubject  string `envconfig:"OTP_EMAIL_SUBJECT"`
+	OTPEmailTemplate string `envconfig:"OTP_EMAIL_TEMPLATE"`
+	OTPSMSTemplate   string `envconfig:"OTP_SMS_TEMPLATE"`
+	// MaxSessions limits concurrent browser sessions of user, 0 means unlimited
+	MaxSessions int `envconfig:"MAX_SESSIONS" default:"0"`
+	// StepUpMaxAge is how long after login sensitive account operations and admin actions are allowed
+	StepUpMaxAge time.Duration `envconfig:"STEP_UP_MAX_AGE" default:"10m"`
+	// AdminACR is authentication context class administrators must reach, e.g. urn:user-manager:acr:mfa
+	// for two-factor authentication, any class is accepted when it is empty
+	AdminACR string `envconfig:"ADMIN_ACR"`
+	// LoginMaxAttempts is number of failed logins after which user is locked for LoginLockout,
+	// LoginIPMaxAttempts is the same for IP address, 0 disables lockout
+	LoginMaxAttempts   int           `envconfig:"LOGIN_MAX_ATTEMPTS" default:"10"`
+	LoginIPMaxAttempts int           `envconfig:"LOGIN_IP_MAX_ATTEMPTS" default:"100"`
+	LoginLockout       time.Duration `envconfig:"LOGIN_LOCKOUT" default:"15m"`
+	// LoginDelay is wait after failed login of user, which doubles with every next failure up to LoginMaxDelay
+	LoginDelay    time.Duration `envconfig:"LOGIN_DELAY" default:"1s"`
+	LoginMaxDelay time.Duration `envconfig:"LOGIN_MAX_DELAY" default:"30s"`
+	// LoginFailureWindow is time after the last failed login when failures are forgotten
+	LoginFailureWindow time.Duration `envconfig:"LOGIN_FAILURE_WINDOW" default:"1h"`
+	// RateLimitStore keeps counted requests: memory counts them on every server separately,
+	// postgres shares limits between all replicas
+	RateLimitStore string `envconfig:"RATE_LIMIT_STORE" default:"memory"`
+	// Rate limits are limit/period, e.g. 10/1m, 0 disables the limit. Login and registration are limited
+	// by IP address, OAuth client endpoints by client id, reads and writes by IP address and by user
+	RateLimitLogin        ratelimit.Rate `envconfig:"RATE_LIMIT_LOGIN" default:"10/1m"`
+	RateLimitRegistration ratelimit.Rate `envconfig:"RATE_LIMIT_REGISTRATION" default:"10/1h"`
+	RateLimitAPIKey       ratelimit.Rate `envconfig:"RATE_LIMIT_API_KEY" default:"120/1m"`
+	RateLimitRead         ratelimit.Rate `envconfig:"RATE_LIMIT_READ" default:"600/1m"`
+	RateLimitWrite        ratelimit.Rate `envconfig:"RATE_LIMIT_WRITE" default:"120/1m"`
+	// HashTime, HashMemory in MiB and HashThreads are argon2id parameters of new password hashes,
+	// `umserver hash tune` recommends them for the host. Hashes with weaker parameters are upgraded on login.
+	HashTime      int `envconfig:"HASH_TIME" default:"3"`
+	HashMemory    int `envconfig:"HASH_MEMORY" default:"64"`
+	HashThreads   int `envconfig:"HASH_THREADS" default:"1"`
+	HashKeyLength int `envconfig:"HASH_KEY_LENGTH" default:"16"`
+	// HashMemoryBudget is memory in MiB concurrent password hashes may use, 0 means unlimited. Hashes which do not
+	// fit wait in queue of HashQueueSize up to HashQueueTimeout, requests get 503 when queue is full or time passes.
+	HashMemoryBudget int           `envconfig:"HASH_MEMORY_BUDGET" default:"256"`
+	HashQueueSize    int           `envconfig:"HASH_QUEUE_SIZE" default:"64"`
+	HashQueueTimeout time.Duration `envconfig:"HASH_QUEUE_TIMEOUT" default:"2s"`
+	// PasswordPepperFile has `id:base64 key` lines of HMAC keys mixed into password hashes, the first key
+	// peppers new hashes and the others verify older ones. Empty path leaves passwords unpeppered.
+	PasswordPepperFile string `envconfig:"PASSWORD_PEPPER_FILE"`
+	// Password policy of created and updated users: PasswordMinLength characters, PasswordMaxLength bytes,
+	// PasswordMinClasses out of lower case, upper case, digits and others, PasswordMinEntropy estimated bits
+	// (0 disables it) and, unless PasswordAllowUserInfo, no user name or email in password
+	PasswordMinLength     int     `envconfig:"PASSWORD_MIN_LENGTH" default:"8"`
+	PasswordMaxLength     int     `envconfig:"PASSWORD_MAX_LENGTH" default:"128"`
+	PasswordMinClasses    int     `envconfig:"PASSWORD_MIN_CLASSES" default:"1"`
+	PasswordMinEntropy    float64 `envconfig:"PASSWORD_MIN_ENTROPY" default:"35"`
+	PasswordAllowUserInfo bool    `envconfig:"PASSWORD_ALLOW_USER_INFO" default:"false"`
+	// BreachCheck rejects passwords from breach corpus: sorted checks BreachFile of SHA-1 hashes sorted by hash,
+	// bloom loads bloom filter from BreachFile, range asks range API at BreachRangeURL, empty disables the check
+	BreachCheck    string        `envconfig:"BREACH_CHECK"`
+	BreachFile     string        `envconfig:"BREACH_FILE"`
+	BreachRangeURL string        `envconfig:"BREACH_RANGE_URL"`
+	BreachTimeout  time.Duration `envconfig:"BREACH_TIMEOUT" default:"2s"`
+	// CredentialCacheTTL is how long verified Basic credentials are remembered, up to model.MaxCredentialCacheTTL,
+	// 0 disables the cache, CredentialCacheSize is the most credentials remembered at once
+	CredentialCacheTTL  time.Duration `envconfig:"CREDENTIAL_CACHE_TTL" default:"0s"`
+	CredentialCacheSize int           `envconfig:"CREDENTIAL_CACHE_SIZE" default:"10000"`
+
 	LoggerPassSecret string `envconfig:"LOGGER_PASS_SECRET"`
 	LoggerPassSHA2   string `envconfig:"LOGGER_PASS_SHA2"`
 	LoggerOutput     string `envconfig:"LOGGER_OUTPUT" default:"Stdout"`
 	LoggerLevel      string `envconfig:"LOGGER_LEVEL" default:"info"`
 	LoggerType       string `envconfig:"LOGGER_TYPE" default:"async"`
 
+	LoggerRedactFields []string `envconfig:"LOGGER_REDACT_FIELDS"`
+	LoggerHashFields   []string `envconfig:"LOGGER_HASH_FIELDS"`
+	LoggerRedactKey    string   `envconfig:"LOGGER_REDACT_KEY"`
+
 	sd ServiceDiscovery
 }
 
@@ -47,6 +175,10 @@ func NewConfig() (*Config, error) {
 		return nil, fmt.Errorf("envconfig error %w", err)
 	}
 
+	if config.AdminACR != "" && !token.ValidACR(config.AdminACR) {
+		return nil, fmt.Errorf("ADMIN_ACR %q is not supported", config.AdminACR)
+	}
+
 	// initialization configuration for consul client
 	consulConfig := &consul.Config{
 		Address: config.ConsulAddress,
@@ -81,6 +213,10 @@ func (c *Config) LoggerConfig(ctx context.Context) (*logger.LogConfig, error) {
 		Output:     c.LoggerOutput,
 		Level:      c.LoggerLevel,
 		Type:       c.LoggerType,
+
+		RedactFields: c.LoggerRedactFields,
+		HashFields:   c.LoggerHashFields,
+		RedactKey:    c.LoggerRedactKey,
 	}, nil
 }
 
@@ -102,6 +238,181 @@ func (c *Config) DBConfig(ctx context.Context) (*storage.DBConfig, error) {
 	}, nil
 }
 
+// TokenConfig get configuration of issued tokens and their signing keys
+func (c *Config) TokenConfig() *token.Config {
+	return &token.Config{
+		Issuer:        c.TokenIssuer,
+		Audience:      c.TokenAudience,
+		OAuthAudience: c.TokenOAuthAudience,
+		TTL:           c.TokenTTL,
+		KeyRing: token.KeyRingConfig{
+			Algorithm: c.TokenAlgorithm,
+			Rotation:  c.TokenKeyRotation,
+			Overlap:   c.TokenKeyOverlap,
+		},
+	}
+}
+
+// LockoutPolicy get limits of failed logins
+func (c *Config) LockoutPolicy() model.LockoutPolicy {
+	return model.LockoutPolicy{
+		MaxAttempts:   c.LoginMaxAttempts,
+		IPMaxAttempts: c.LoginIPMaxAttempts,
+		Lockout:       c.LoginLockout,
+		Delay:         c.LoginDelay,
+		MaxDelay:      c.LoginMaxDelay,
+		Window:        c.LoginFailureWindow,
+	}
+}
+
+// RateLimiter get limiter counting requests in configured store
+func (c *Config) RateLimiter(db *sql.DB) (*ratelimit.Limiter, error) {
+	switch c.RateLimitStore {
+	case rateLimitMemory:
+		return ratelimit.NewLimiter(ratelimit.NewMemoryStore()), nil
+	case rateLimitPostgres:
+		return ratelimit.NewLimiter(model.NewRateLimitsRepo(db)), nil
+	default:
+		return nil, fmt.Errorf("RATE_LIMIT_STORE %q is not supported", c.RateLimitStore)
+	}
+}
+
+// PasswordConfig get argon2id parameters of new password hashes
+func (c *Config) PasswordConfig() (*model.PasswordConfig, error) {
+	if c.HashThreads < 1 || c.HashThreads > 255 {
+		return nil, fmt.Errorf("HASH_THREADS %d is not between 1 and 255", c.HashThreads)
+	}
+
+	return model.NewCustomPasswordConfig(uint32(c.HashTime), uint32(c.HashMemory)*1024, uint8(c.HashThreads),
+		uint32(c.HashKeyLength))
+}
+
+// PasswordPolicy get rules of passwords users may set
+func (c *Config) PasswordPolicy() (model.PasswordPolicy, error) {
+	breaches, err := c.BreachChecker()
+	if err != nil {
+		return model.PasswordPolicy{}, err
+	}
+
+	return model.PasswordPolicy{
+		MinLength:     c.PasswordMinLength,
+		MaxLength:     c.PasswordMaxLength,
+		MinClasses:    c.PasswordMinClasses,
+		MinEntropy:    c.PasswordMinEntropy,
+		AllowUserInfo: c.PasswordAllowUserInfo,
+		Breaches:      breaches,
+	}, nil
+}
+
+// BreachChecker get checker of passwords in breach corpus, nil when BreachCheck is empty
+func (c *Config) BreachChecker() (model.BreachChecker, error) {
+	switch c.BreachCheck {
+	case "":
+		return nil, nil
+	case breachSorted:
+		sorted, err := breach.NewSortedFile(c.BreachFile)
+		if err != nil {
+			return nil, err
+		}
+
+		return sorted, nil
+	case breachBloom:
+		f, err := os.Open(c.BreachFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		bloom, err := breach.ReadBloom(bufio.NewReader(f))
+		if err != nil {
+			return nil, err
+		}
+
+		return bloom, nil
+	case breachRange:
+		if c.BreachRangeURL == "" {
+			return nil, fmt.Errorf("BREACH_RANGE_URL is required by BREACH_CHECK range")
+		}
+
+		return breach.NewRangeAPI(breach.NewHTTPRanges(c.BreachRangeURL, c.BreachTimeout)), nil
+	default:
+		return nil, fmt.Errorf("BREACH_CHECK %q is not supported", c.BreachCheck)
+	}
+}
+
+// HashPool get pool limiting memory of concurrent password hashes
+func (c *Config) HashPool() *model.HashPool {
+	return model.NewHashPool(uint32(c.HashMemoryBudget)*1024, c.HashQueueSize, c.HashQueueTimeout)
+}
+
+// Pepper get pepper of password hashes read from PasswordPepperFile, nil when it is not set
+func (c *Config) Pepper() (*model.Pepper, error) {
+	if c.PasswordPepperFile == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(c.PasswordPepperFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return model.ParsePepper(data)
+}
+
+// RelyingParty get WebAuthn relying party of login page
+func (c *Config) RelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:     c.WebAuthnRPID,
+		Name:   c.WebAuthnRPName,
+		Origin: c.WebAuthnOrigin,
+	}
+}
+
+// CodeSender get senders of one-time codes over configured email and SMS channels
+func (c *Config) CodeSender() (*notify.Codes, error) {
+	codes := notify.NewCodes(c.TOTPIssuer, model.OTPTTL)
+
+	if c.SMTPAddress != "" {
+		t, err := notify.NewTemplate(orDefault(c.OTPEmailSubject, notify.DefaultEmailSubject),
+			orDefault(c.OTPEmailTemplate, notify.DefaultEmailBody))
+		if err != nil {
+			return nil, fmt.Errorf("email template error %w", err)
+		}
+
+		codes.Register(notify.Email, notify.NewSMTP(notify.SMTPConfig{
+			Address:  c.SMTPAddress,
+			From:     c.SMTPFrom,
+			Username: c.SMTPUsername,
+			Password: c.SMTPPassword,
+			Timeout:  c.SMTPTimeout,
+		}), t)
+	}
+
+	if c.SMSURL != "" {
+		t, err := notify.NewTemplate("", orDefault(c.OTPSMSTemplate, notify.DefaultSMSBody))
+		if err != nil {
+			return nil, fmt.Errorf("SMS template error %w", err)
+		}
+
+		codes.Register(notify.SMS, notify.NewHTTPSMS(notify.SMSConfig{
+			URL:     c.SMSURL,
+			Token:   c.SMSToken,
+			From:    c.SMSFrom,
+			Timeout: c.SMSTimeout,
+		}), t)
+	}
+
+	return codes, nil
+}
+
+func orDefault(value, def string) string {
+	if value == "" {
+		return def
+	}
+
+	return value
+}
+
 func (c *Config) ServerAddress() string {
 	return fmt.Sprintf("%s:%d", c.HTTPIP, c.HTTPPort)
 }
@@ -3,9 +3,17 @@ package config
 import (
 	"context"
 	"errors"
+	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/lvl484/user-manager/breach"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/notify"
+	"github.com/lvl484/user-manager/ratelimit"
+	"github.com/lvl484/user-manager/token"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -84,6 +92,178 @@ func TestNewConfigDefault(t *testing.T) {
 			name:     "WRITE_TIMEOUT",
 			got:      cfg.WriteTimeout.Seconds(),
 			expected: 60,
+		}, {
+			name:     "TOKEN_ISSUER",
+			got:      cfg.TokenIssuer,
+			expected: "user-manager",
+		}, {
+			name:     "TOKEN_TTL",
+			got:      cfg.TokenTTL.Minutes(),
+			expected: 15,
+		}, {
+			name:     "TOKEN_ALGORITHM",
+			got:      cfg.TokenAlgorithm,
+			expected: "EdDSA",
+		}, {
+			name:     "OAUTH_CODE_TTL",
+			got:      cfg.OAuthCodeTTL.Seconds(),
+			expected: 60,
+		}, {
+			name:     "DEVICE_CODE_TTL",
+			got:      cfg.DeviceCodeTTL.Minutes(),
+			expected: 10,
+		}, {
+			name:     "DEVICE_CODE_INTERVAL",
+			got:      cfg.DeviceCodeInterval.Seconds(),
+			expected: 5,
+		}, {
+			name:     "SESSION_IDLE_TIMEOUT",
+			got:      cfg.SessionIdleTimeout.Minutes(),
+			expected: 30,
+		}, {
+			name:     "SESSION_TTL",
+			got:      cfg.SessionTTL.Hours(),
+			expected: 12,
+		}, {
+			name:     "SESSION_COOKIE_SECURE",
+			got:      cfg.SessionCookieSecure,
+			expected: true,
+		}, {
+			name:     "TOTP_ISSUER",
+			got:      cfg.TOTPIssuer,
+			expected: "user-manager",
+		}, {
+			name:     "MAX_SESSIONS",
+			got:      cfg.MaxSessions,
+			expected: 0,
+		}, {
+			name:     "SMTP_TIMEOUT",
+			got:      cfg.SMTPTimeout.Seconds(),
+			expected: 10,
+		}, {
+			name:     "STEP_UP_MAX_AGE",
+			got:      cfg.StepUpMaxAge.Minutes(),
+			expected: 10,
+		}, {
+			name:     "ADMIN_ACR",
+			got:      cfg.AdminACR,
+			expected: "",
+		}, {
+			name:     "LOGIN_MAX_ATTEMPTS",
+			got:      cfg.LoginMaxAttempts,
+			expected: 10,
+		}, {
+			name:     "LOGIN_IP_MAX_ATTEMPTS",
+			got:      cfg.LoginIPMaxAttempts,
+			expected: 100,
+		}, {
+			name:     "LOGIN_LOCKOUT",
+			got:      cfg.LoginLockout.Minutes(),
+			expected: 15,
+		}, {
+			name:     "LOGIN_DELAY",
+			got:      cfg.LoginDelay.Seconds(),
+			expected: 1,
+		}, {
+			name:     "LOGIN_MAX_DELAY",
+			got:      cfg.LoginMaxDelay.Seconds(),
+			expected: 30,
+		}, {
+			name:     "LOGIN_FAILURE_WINDOW",
+			got:      cfg.LoginFailureWindow.Hours(),
+			expected: 1,
+		}, {
+			name:     "RATE_LIMIT_STORE",
+			got:      cfg.RateLimitStore,
+			expected: "memory",
+		}, {
+			name:     "RATE_LIMIT_LOGIN",
+			got:      cfg.RateLimitLogin,
+			expected: ratelimit.Rate{Limit: 10, Period: time.Minute},
+		}, {
+			name:     "RATE_LIMIT_REGISTRATION",
+			got:      cfg.RateLimitRegistration,
+			expected: ratelimit.Rate{Limit: 10, Period: time.Hour},
+		}, {
+			name:     "RATE_LIMIT_API_KEY",
+			got:      cfg.RateLimitAPIKey,
+			expected: ratelimit.Rate{Limit: 120, Period: time.Minute},
+		}, {
+			name:     "RATE_LIMIT_READ",
+			got:      cfg.RateLimitRead,
+			expected: ratelimit.Rate{Limit: 600, Period: time.Minute},
+		}, {
+			name:     "RATE_LIMIT_WRITE",
+			got:      cfg.RateLimitWrite,
+			expected: ratelimit.Rate{Limit: 120, Period: time.Minute},
+		}, {
+			name:     "HASH_TIME",
+			got:      cfg.HashTime,
+			expected: 3,
+		}, {
+			name:     "HASH_MEMORY",
+			got:      cfg.HashMemory,
+			expected: 64,
+		}, {
+			name:     "HASH_THREADS",
+			got:      cfg.HashThreads,
+			expected: 1,
+		}, {
+			name:     "HASH_KEY_LENGTH",
+			got:      cfg.HashKeyLength,
+			expected: 16,
+		}, {
+			name:     "HASH_MEMORY_BUDGET",
+			got:      cfg.HashMemoryBudget,
+			expected: 256,
+		}, {
+			name:     "HASH_QUEUE_SIZE",
+			got:      cfg.HashQueueSize,
+			expected: 64,
+		}, {
+			name:     "HASH_QUEUE_TIMEOUT",
+			got:      cfg.HashQueueTimeout,
+			expected: 2 * time.Second,
+		}, {
+			name:     "PASSWORD_PEPPER_FILE",
+			got:      cfg.PasswordPepperFile,
+			expected: "",
+		}, {
+			name:     "PASSWORD_MIN_LENGTH",
+			got:      cfg.PasswordMinLength,
+			expected: 8,
+		}, {
+			name:     "PASSWORD_MAX_LENGTH",
+			got:      cfg.PasswordMaxLength,
+			expected: 128,
+		}, {
+			name:     "PASSWORD_MIN_CLASSES",
+			got:      cfg.PasswordMinClasses,
+			expected: 1,
+		}, {
+			name:     "PASSWORD_MIN_ENTROPY",
+			got:      cfg.PasswordMinEntropy,
+			expected: 35,
+		}, {
+			name:     "PASSWORD_ALLOW_USER_INFO",
+			got:      cfg.PasswordAllowUserInfo,
+			expected: false,
+		}, {
+			name:     "BREACH_CHECK",
+			got:      cfg.BreachCheck,
+			expected: "",
+		}, {
+			name:     "BREACH_TIMEOUT",
+			got:      cfg.BreachTimeout,
+			expected: 2 * time.Second,
+		}, {
+			name:     "CREDENTIAL_CACHE_TTL",
+			got:      cfg.CredentialCacheTTL,
+			expected: time.Duration(0),
+		}, {
+			name:     "CREDENTIAL_CACHE_SIZE",
+			got:      cfg.CredentialCacheSize,
+			expected: 10000,
 		},
 	}
 
@@ -92,6 +272,25 @@ func TestNewConfigDefault(t *testing.T) {
 	}
 }
 
+func TestNewConfigAdminACR(t *testing.T) {
+	os.Setenv("POSTGRES_USER", "unused")
+	os.Setenv("POSTGRES_PASSWORD", "unused")
+	os.Setenv("POSTGRES_DB", "unused")
+	os.Setenv("CONSUL_ADDRESS", "unused:8500")
+	os.Setenv("ADMIN_ACR", "urn:other:acr")
+	defer os.Unsetenv("ADMIN_ACR")
+
+	_, err := NewConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ADMIN_ACR")
+
+	os.Setenv("ADMIN_ACR", token.ACRMultiFactor)
+
+	cfg, err := NewConfig()
+	require.NoError(t, err)
+	assert.Equal(t, token.ACRMultiFactor, cfg.AdminACR)
+}
+
 func TestNewConfig(t *testing.T) {
 	os.Unsetenv("POSTGRES_USER")
 
@@ -147,7 +346,11 @@ func TestConfigLoggerConfig(t *testing.T) {
 		LoggerOutput:     "Stdout",
 		LoggerLevel:      "info",
 		LoggerType:       "async",
-		sd:               sd,
+
+		LoggerRedactFields: []string{"password"},
+		LoggerHashFields:   []string{"email"},
+		LoggerRedactKey:    "redactKey",
+		sd:                 sd,
 	}
 
 	got, err := c.LoggerConfig(context.Background())
@@ -160,8 +363,193 @@ func TestConfigLoggerConfig(t *testing.T) {
 	assert.Equal(t, c.LoggerOutput, got.Output)
 	assert.Equal(t, c.LoggerLevel, got.Level)
 	assert.Equal(t, c.LoggerType, got.Type)
+	assert.Equal(t, c.LoggerRedactFields, got.RedactFields)
+	assert.Equal(t, c.LoggerHashFields, got.HashFields)
+	assert.Equal(t, c.LoggerRedactKey, got.RedactKey)
 
 	sd.Err = errors.New("negative test case")
 	got, err = c.LoggerConfig(context.Background())
 	assert.Error(t, err)
 }
+
+func TestConfigTokenConfig(t *testing.T) {
+	c := Config{
+		TokenIssuer:      "https://um.example.com",
+		TokenAudience:    "api",
+		TokenTTL:         5 * time.Minute,
+		TokenAlgorithm:   "RS256",
+		TokenKeyRotation: 12 * time.Hour,
+		TokenKeyOverlap:  30 * time.Minute,
+	}
+
+	got := c.TokenConfig()
+
+	assert.Equal(t, c.TokenIssuer, got.Issuer)
+	assert.Equal(t, c.TokenAudience, got.Audience)
+	assert.Equal(t, c.TokenTTL, got.TTL)
+	assert.Equal(t, c.TokenAlgorithm, got.KeyRing.Algorithm)
+	assert.Equal(t, c.TokenKeyRotation, got.KeyRing.Rotation)
+	assert.Equal(t, c.TokenKeyOverlap, got.KeyRing.Overlap)
+}
+
+func TestConfigLockoutPolicy(t *testing.T) {
+	c := Config{
+		LoginMaxAttempts:   5,
+		LoginIPMaxAttempts: 50,
+		LoginLockout:       time.Hour,
+		LoginDelay:         2 * time.Second,
+		LoginMaxDelay:      time.Minute,
+		LoginFailureWindow: 24 * time.Hour,
+	}
+
+	assert.Equal(t, model.LockoutPolicy{
+		MaxAttempts:   5,
+		IPMaxAttempts: 50,
+		Lockout:       time.Hour,
+		Delay:         2 * time.Second,
+		MaxDelay:      time.Minute,
+		Window:        24 * time.Hour,
+	}, c.LockoutPolicy())
+}
+
+func TestConfigRateLimiter(t *testing.T) {
+	l, err := (&Config{RateLimitStore: "memory"}).RateLimiter(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, l)
+
+	l, err = (&Config{RateLimitStore: "postgres"}).RateLimiter(nil)
+	require.NoError(t, err)
+	assert.NotNil(t, l)
+
+	_, err = (&Config{RateLimitStore: "redis"}).RateLimiter(nil)
+	assert.Error(t, err)
+}
+
+func TestConfigPasswordConfig(t *testing.T) {
+	c := Config{HashTime: 3, HashMemory: 64, HashThreads: 1, HashKeyLength: 16}
+
+	got, err := c.PasswordConfig()
+	require.NoError(t, err)
+	assert.Equal(t, model.NewPasswordConfig(), got)
+
+	c.HashThreads = 0
+	_, err = c.PasswordConfig()
+	assert.Error(t, err)
+
+	c = Config{HashTime: 0, HashMemory: 64, HashThreads: 1, HashKeyLength: 16}
+	_, err = c.PasswordConfig()
+	assert.Error(t, err)
+}
+
+func TestConfigPasswordPolicy(t *testing.T) {
+	c := Config{PasswordMinLength: 8, PasswordMaxLength: 128, PasswordMinClasses: 1, PasswordMinEntropy: 35}
+
+	got, err := c.PasswordPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, model.PasswordPolicy{
+		MinLength:  model.DefaultPasswordMinLength,
+		MaxLength:  model.DefaultPasswordMaxLength,
+		MinClasses: model.DefaultPasswordMinClasses,
+		MinEntropy: model.DefaultPasswordMinEntropy,
+	}, got)
+
+	c.BreachCheck = "range"
+	c.BreachRangeURL = "http://mirror/range/"
+
+	got, err = c.PasswordPolicy()
+	require.NoError(t, err)
+	assert.IsType(t, &breach.RangeAPI{}, got.Breaches)
+}
+
+func TestConfigBreachChecker(t *testing.T) {
+	path := writeTemp(t, "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n")
+	defer os.Remove(path)
+
+	c := Config{BreachCheck: "sorted", BreachFile: path}
+
+	got, err := c.BreachChecker()
+	require.NoError(t, err)
+
+	breached, err := got.Breached("password")
+	require.NoError(t, err)
+	assert.True(t, breached)
+
+	bloom, err := breach.NewBloom(1, 0.01)
+	require.NoError(t, err)
+	_, err = bloom.AddHashes(strings.NewReader("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824"))
+	require.NoError(t, err)
+
+	var b strings.Builder
+	_, err = bloom.WriteTo(&b)
+	require.NoError(t, err)
+
+	bloomPath := writeTemp(t, b.String())
+	defer os.Remove(bloomPath)
+
+	c = Config{BreachCheck: "bloom", BreachFile: bloomPath}
+	got, err = c.BreachChecker()
+	require.NoError(t, err)
+	assert.Equal(t, bloom, got)
+
+	for _, bad := range []Config{
+		{BreachCheck: "sorted", BreachFile: path + ".missing"},
+		{BreachCheck: "bloom", BreachFile: path},
+		{BreachCheck: "range"},
+		{BreachCheck: "online"},
+	} {
+		_, err = bad.BreachChecker()
+		assert.Error(t, err, bad.BreachCheck)
+	}
+}
+
+func TestConfigHashPool(t *testing.T) {
+	c := Config{HashMemoryBudget: 128, HashQueueSize: 10, HashQueueTimeout: time.Second}
+
+	assert.Equal(t, model.NewHashPool(128*1024, 10, time.Second), c.HashPool())
+}
+
+func TestConfigPepper(t *testing.T) {
+	c := Config{}
+
+	got, err := c.Pepper()
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	path := writeTemp(t, "2020-05:QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE=\n")
+	defer os.Remove(path)
+
+	c.PasswordPepperFile = path
+	got, err = c.Pepper()
+	require.NoError(t, err)
+	assert.Equal(t, "2020-05", got.Current())
+
+	c.PasswordPepperFile = path + ".missing"
+	_, err = c.Pepper()
+	assert.Error(t, err)
+}
+
+func TestConfigCodeSender(t *testing.T) {
+	codes, err := (&Config{}).CodeSender()
+	require.NoError(t, err)
+	assert.False(t, codes.Supports(notify.Email))
+	assert.False(t, codes.Supports(notify.SMS))
+
+	codes, err = (&Config{SMTPAddress: "localhost:25", SMSURL: "http://localhost/sms"}).CodeSender()
+	require.NoError(t, err)
+	assert.True(t, codes.Supports(notify.Email))
+	assert.True(t, codes.Supports(notify.SMS))
+
+	_, err = (&Config{SMSURL: "http://localhost/sms", OTPSMSTemplate: "{{.Code"}).CodeSender()
+	assert.Error(t, err)
+}
+
+func writeTemp(t *testing.T, data string) string {
+	f, err := ioutil.TempFile("", "config")
+	require.NoError(t, err)
+
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	return f.Name()
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/lvl484/user-manager/logger"
+
 	consul "github.com/hashicorp/consul/api"
 )
 
@@ -27,5 +29,8 @@ func (s consulSD) GetService(ctx context.Context, name string) (string, int, err
 		return "", 0, fmt.Errorf("%s service not found", name)
 	}
 
+	logger.Component(logger.ComponentDiscovery).Debugf("Resolved %s service at %s:%d",
+		name, services[0].ServiceAddress, services[0].ServicePort)
+
 	return services[0].ServiceAddress, services[0].ServicePort, nil
 }
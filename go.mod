@@ -3,6 +3,7 @@ module github.com/lvl484/user-manager
 go 1.13
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
 	github.com/golang/mock v1.4.3
 	github.com/google/btree v1.0.0 // indirect
 	github.com/google/uuid v1.1.1
@@ -0,0 +1,195 @@
+// Package logger provides implementation of writing Log messages to Graylog, file, and stdout.
+// Supports log levels and destination.
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Components of the application, which have own log level
+const (
+	ComponentMain      = "main"
+	ComponentHTTP      = "http"
+	ComponentAuth      = "auth"
+	ComponentStorage   = "storage"
+	ComponentDiscovery = "discovery"
+
+	componentField = "component"
+)
+
+// ErrUnknownComponent is the error returned when level is changed for not registered component
+var ErrUnknownComponent = errors.New("unknown log component")
+
+var componentNames = []string{ComponentMain, ComponentHTTP, ComponentAuth, ComponentStorage, ComponentDiscovery}
+
+// ComponentLevel describes current log level of a component
+type ComponentLevel struct {
+	Component string     `json:"component"`
+	Level     string     `json:"level"`
+	RevertAt  *time.Time `json:"revert_at,omitempty"`
+}
+
+// component is a logger with its own level, which shares output, formatter and hooks with main logger
+type component struct {
+	log      *logrus.Logger
+	base     logrus.Level
+	revert   *time.Timer
+	revertAt *time.Time
+}
+
+var (
+	componentsMu sync.Mutex
+	components   map[string]*component
+)
+
+// componentHook adds name of the component to every entry
+type componentHook string
+
+func (h componentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h componentHook) Fire(e *logrus.Entry) error {
+	data := make(logrus.Fields, len(e.Data)+1)
+	for k, v := range e.Data {
+		data[k] = v
+	}
+
+	data[componentField] = string(h)
+	e.Data = data
+
+	return nil
+}
+
+// setComponents creates loggers for all components from already configured main logger
+func setComponents(main *logrus.Logger) {
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+
+	for _, c := range components {
+		if c.revert != nil {
+			c.revert.Stop()
+		}
+	}
+
+	components = make(map[string]*component, len(componentNames))
+	components[ComponentMain] = &component{log: main, base: main.GetLevel()}
+
+	for _, name := range componentNames[1:] {
+		log := logrus.New()
+		log.SetOutput(main.Out)
+		log.SetFormatter(main.Formatter)
+		log.SetLevel(main.GetLevel())
+		log.AddHook(componentHook(name))
+
+		for level, hooks := range main.Hooks {
+			log.Hooks[level] = append(log.Hooks[level], hooks...)
+		}
+
+		components[name] = &component{log: log, base: main.GetLevel()}
+	}
+}
+
+// Component returns logger of the component, main logger is returned for unknown names
+// and logrus standard logger is returned until SetLogger is called
+func Component(name string) Logger {
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+
+	if components == nil {
+		return logrus.StandardLogger()
+	}
+
+	if c, ok := components[name]; ok {
+		return c.log
+	}
+
+	return LogUM
+}
+
+// SetLevel changes level of the component or of all components when name is empty.
+// When duration is positive level is reverted to the configured one after it elapses.
+func SetLevel(name, level string, duration time.Duration) error {
+	lev, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+
+	names := []string{name}
+	if name == "" {
+		names = componentNames
+	}
+
+	for _, n := range names {
+		if _, ok := components[n]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownComponent, n)
+		}
+	}
+
+	for _, n := range names {
+		components[n].set(n, lev, duration)
+	}
+
+	return nil
+}
+
+// set changes level and schedules revert, components lock must be held
+func (c *component) set(name string, level logrus.Level, duration time.Duration) {
+	if c.revert != nil {
+		c.revert.Stop()
+		c.revert, c.revertAt = nil, nil
+	}
+
+	c.log.SetLevel(level)
+
+	if duration <= 0 {
+		c.base = level
+		return
+	}
+
+	revertAt := time.Now().Add(duration)
+	c.revertAt = &revertAt
+	c.revert = time.AfterFunc(duration, func() {
+		componentsMu.Lock()
+		defer componentsMu.Unlock()
+
+		// Component could be changed again or logger reconfigured while timer was firing
+		if components[name] != c || c.revertAt != &revertAt {
+			return
+		}
+
+		c.log.SetLevel(c.base)
+		c.revert, c.revertAt = nil, nil
+	})
+}
+
+// Levels returns current level of every component sorted by component name
+func Levels() []ComponentLevel {
+	componentsMu.Lock()
+	defer componentsMu.Unlock()
+
+	levels := make([]ComponentLevel, 0, len(components))
+
+	for name, c := range components {
+		levels = append(levels, ComponentLevel{
+			Component: name,
+			Level:     c.log.GetLevel().String(),
+			RevertAt:  c.revertAt,
+		})
+	}
+
+	sort.Slice(levels, func(i, j int) bool {
+		return levels[i].Component < levels[j].Component
+	})
+
+	return levels
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func levelOf(t *testing.T, name string) ComponentLevel {
+	for _, l := range Levels() {
+		if l.Component == name {
+			return l
+		}
+	}
+
+	t.Fatalf("component %s not found", name)
+
+	return ComponentLevel{}
+}
+
+func TestComponent(t *testing.T) {
+	require.NoError(t, SetLogger(&LogConfig{Output: "Stdout", Level: "info"}))
+
+	assert.Equal(t, LogUM, Component(ComponentMain))
+	assert.Equal(t, LogUM, Component("unknown"))
+	assert.NotEqual(t, LogUM, Component(ComponentAuth))
+	assert.Len(t, Levels(), len(componentNames))
+}
+
+func TestSetLevel(t *testing.T) {
+	require.NoError(t, SetLogger(&LogConfig{Output: "Stdout", Level: "info"}))
+
+	require.NoError(t, SetLevel(ComponentAuth, "debug", 0))
+	assert.Equal(t, "debug", levelOf(t, ComponentAuth).Level)
+	assert.Nil(t, levelOf(t, ComponentAuth).RevertAt)
+	assert.Equal(t, "info", levelOf(t, ComponentHTTP).Level)
+	assert.True(t, Component(ComponentAuth).(*log.Logger).IsLevelEnabled(log.DebugLevel))
+
+	require.NoError(t, SetLevel("", "warning", 0))
+
+	for _, l := range Levels() {
+		assert.Equal(t, "warning", l.Level, l.Component)
+	}
+}
+
+func TestSetLevelRevert(t *testing.T) {
+	require.NoError(t, SetLogger(&LogConfig{Output: "Stdout", Level: "info"}))
+
+	require.NoError(t, SetLevel(ComponentStorage, "trace", 20*time.Millisecond))
+	assert.Equal(t, "trace", levelOf(t, ComponentStorage).Level)
+	assert.NotNil(t, levelOf(t, ComponentStorage).RevertAt)
+
+	assert.Eventually(t, func() bool {
+		return levelOf(t, ComponentStorage).Level == "info"
+	}, time.Second, 5*time.Millisecond)
+	assert.Nil(t, levelOf(t, ComponentStorage).RevertAt)
+}
+
+func TestSetLevelOverridesRevert(t *testing.T) {
+	require.NoError(t, SetLogger(&LogConfig{Output: "Stdout", Level: "info"}))
+
+	require.NoError(t, SetLevel(ComponentHTTP, "debug", 10*time.Millisecond))
+	require.NoError(t, SetLevel(ComponentHTTP, "error", 0))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, "error", levelOf(t, ComponentHTTP).Level)
+}
+
+func TestSetLevelErrors(t *testing.T) {
+	require.NoError(t, SetLogger(&LogConfig{Output: "Stdout", Level: "info"}))
+
+	assert.Error(t, SetLevel(ComponentAuth, "loud", 0))
+	assert.True(t, errors.Is(SetLevel("kafka", "debug", 0), ErrUnknownComponent))
+}
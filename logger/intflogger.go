@@ -24,6 +24,12 @@ type LogConfig struct {
 	Output     string
 	Level      string
 	Type       string
+	// RedactFields are names of fields whose values are never written
+	RedactFields []string
+	// HashFields are names of fields whose values are written as keyed hash
+	HashFields []string
+	// RedactKey is HMAC key for hashed values, random one is used when empty
+	RedactKey string
 }
 
 // Logger represent interface for logging function
@@ -39,6 +45,8 @@ type Logger interface {
 	Warn(args ...interface{})
 	Debugf(format string, args ...interface{})
 	Debug(args ...interface{})
+	WithField(key string, value interface{}) *logrus.Entry
+	WithFields(fields logrus.Fields) *logrus.Entry
 }
 
 // SetLogger is the setter for Log variable
@@ -52,5 +60,7 @@ func SetLogger(cfg *LogConfig) error {
 
 	LogUM = log
 
+	setComponents(log)
+
 	return nil
 }
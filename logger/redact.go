@@ -0,0 +1,187 @@
+// Package logger provides implementation of writing Log messages to Graylog, file, and stdout.
+// Supports log levels and destination.
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	redactedValue = "[REDACTED]"
+	hashedFormat  = "hmac:%s"
+	hashedLength  = 12
+	redactKeySize = 32
+)
+
+// DefaultRedactFields are field names whose values are always replaced with redactedValue
+var DefaultRedactFields = []string{"password", "pass", "authorization", "token", "secret", "hash"}
+
+// DefaultHashFields are field names whose values are replaced with a keyed hash,
+// so entries of the same user can still be correlated without disclosing the value
+var DefaultHashFields = []string{"user", "username", "user_name", "login", "email", "phone"}
+
+// redactionRule describes value pattern which has to be scrubbed from messages and field values
+type redactionRule struct {
+	pattern *regexp.Regexp
+	hash    bool
+	// match additionally checks found value, when it is nil every found value is scrubbed
+	match func(string) bool
+}
+
+// redactionRules are applied to every message and string field value in order
+var redactionRules = []redactionRule{
+	// Basic credentials from Authorization header
+	{pattern: regexp.MustCompile(`(?i)\bbasic\s+[A-Za-z0-9+/]+=*`), match: isBasicCredentials},
+	// Bearer tokens from Authorization header
+	{pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]{16,}=*`)},
+	// Encoded argon2 password hashes
+	{pattern: regexp.MustCompile(`\$argon2(?:id|i|d)\$[^\s"';]+`)},
+	// Email addresses
+	{pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), hash: true},
+	// Phone numbers in E.164 format
+	{pattern: regexp.MustCompile(`\+[1-9]\d{6,14}\b`), hash: true},
+}
+
+// RedactionHook is a logrus hook, which removes personal data and secrets from an entry
+// before it reaches formatter or any other hook
+type RedactionHook struct {
+	redact map[string]bool
+	hash   map[string]bool
+	key    []byte
+}
+
+// NewRedactionHook returns hook which redacts values of redactFields and hashes values of hashFields.
+// Hashes are HMAC-SHA256 with key, when key is empty random one is generated.
+func NewRedactionHook(redactFields, hashFields []string, key string) (*RedactionHook, error) {
+	h := &RedactionHook{
+		redact: fieldSet(redactFields),
+		hash:   fieldSet(hashFields),
+		key:    []byte(key),
+	}
+
+	if len(h.key) == 0 {
+		h.key = make([]byte, redactKeySize)
+
+		_, err := rand.Read(h.key)
+		if err != nil {
+			return nil, fmt.Errorf("redaction key error: %w", err)
+		}
+	}
+
+	return h, nil
+}
+
+// fieldSet builds case insensitive set of field names
+func fieldSet(fields []string) map[string]bool {
+	set := make(map[string]bool, len(fields))
+
+	for _, f := range fields {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if f != "" {
+			set[f] = true
+		}
+	}
+
+	return set
+}
+
+// Levels returns all levels, personal data must not leak on any of them
+func (h *RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire scrubs message and fields of the entry. Data is replaced with a copy,
+// because the map may be shared with the entry the caller keeps.
+func (h *RedactionHook) Fire(e *logrus.Entry) error {
+	e.Message = h.scrub(e.Message)
+
+	data := make(logrus.Fields, len(e.Data))
+
+	for k, v := range e.Data {
+		data[k] = h.field(k, v)
+	}
+
+	e.Data = data
+
+	return nil
+}
+
+// field returns safe representation of the field value
+func (h *RedactionHook) field(name string, value interface{}) interface{} {
+	name = strings.ToLower(name)
+
+	switch {
+	case h.redact[name]:
+		return redactedValue
+	case h.hash[name]:
+		return h.sum(fmt.Sprint(value))
+	}
+
+	var s string
+
+	switch v := value.(type) {
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		return value
+	}
+
+	if scrubbed := h.scrub(s); scrubbed != s {
+		return scrubbed
+	}
+
+	return value
+}
+
+// scrub replaces all sensitive patterns in s
+func (h *RedactionHook) scrub(s string) string {
+	for _, rule := range redactionRules {
+		rule := rule
+		s = rule.pattern.ReplaceAllStringFunc(s, func(found string) string {
+			switch {
+			case rule.match != nil && !rule.match(found):
+				return found
+			case rule.hash:
+				return h.sum(found)
+			default:
+				return redactedValue
+			}
+		})
+	}
+
+	return s
+}
+
+// isBasicCredentials reports whether found value is "Basic" followed by base64 encoded "user:password",
+// so plain phrases like "basic authentication" stay untouched
+func isBasicCredentials(found string) bool {
+	fields := strings.Fields(found)
+	if len(fields) != 2 {
+		return false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(fields[1])
+
+	return err == nil && strings.Contains(string(decoded), ":")
+}
+
+// sum returns shortened keyed hash of value
+func (h *RedactionHook) sum(value string) string {
+	mac := hmac.New(sha256.New, h.key)
+	_, _ = mac.Write([]byte(value))
+
+	return fmt.Sprintf(hashedFormat, hex.EncodeToString(mac.Sum(nil))[:hashedLength])
+}
@@ -21,7 +21,12 @@ func (NullFormatter) Format(e *logrus.Entry) ([]byte, error) {
 
 // NewLogger initialized logger according to configuration
 func configLogger(log *logrus.Logger, lc *LogConfig) error {
-	var err error
+	// Redaction hook has to be added first, so the rest of hooks get already scrubbed entry
+	err := lc.setRedaction(log)
+	if err != nil {
+		return err
+	}
+
 	switch lc.Output {
 	case "Stdout":
 		lc.setLoggerToStdout(log)
@@ -44,6 +49,27 @@ func configLogger(log *logrus.Logger, lc *LogConfig) error {
 	return err
 }
 
+// setRedaction adds hook which removes secrets and personal data from every entry
+func (lc *LogConfig) setRedaction(log *logrus.Logger) error {
+	redactFields, hashFields := lc.RedactFields, lc.HashFields
+	if redactFields == nil {
+		redactFields = DefaultRedactFields
+	}
+
+	if hashFields == nil {
+		hashFields = DefaultHashFields
+	}
+
+	hook, err := NewRedactionHook(redactFields, hashFields, lc.RedactKey)
+	if err != nil {
+		return err
+	}
+
+	log.AddHook(hook)
+
+	return nil
+}
+
 // setLoggerToFile initialize logger for writing to file
 func (lc *LogConfig) setLoggerToFile(log *logrus.Logger) error {
 	f, err := os.OpenFile("../user_manager_api.log", os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
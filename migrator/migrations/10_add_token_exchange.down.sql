@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.token_exchanges;
+ALTER TABLE public.oauth_clients DROP COLUMN IF EXISTS impersonation;
+ALTER TABLE public.oauth_clients DROP COLUMN IF EXISTS exchange_audiences;
@@ -0,0 +1,20 @@
+ALTER TABLE public.oauth_clients ADD COLUMN IF NOT EXISTS exchange_audiences text[] NOT NULL DEFAULT '{}';
+ALTER TABLE public.oauth_clients ADD COLUMN IF NOT EXISTS impersonation boolean NOT NULL DEFAULT false;
+
+CREATE TABLE public.token_exchanges
+(
+    token_id varchar(64) NOT NULL,
+    client_id varchar(64) NOT NULL,
+    subject_id varchar(64) NOT NULL,
+    subject_name varchar(255) NOT NULL DEFAULT '',
+    actor_id varchar(64) NOT NULL,
+    actor_name varchar(255) NOT NULL DEFAULT '',
+    impersonation boolean NOT NULL,
+    audience text[] NOT NULL DEFAULT '{}',
+    scope text NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT token_exchanges_pk PRIMARY KEY (token_id)
+);
+CREATE INDEX token_exchanges_subject_idx ON public.token_exchanges (subject_id, created_at);
+CREATE INDEX token_exchanges_actor_idx ON public.token_exchanges (actor_id, created_at);
+GRANT SELECT, INSERT ON public.token_exchanges TO um_user;
@@ -0,0 +1,17 @@
+CREATE TABLE public.sessions
+(
+    id uuid NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    user_id uuid NOT NULL,
+    csrf_token varchar(64) NOT NULL,
+    user_agent text NOT NULL,
+    ip_address varchar(64) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_seen_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    CONSTRAINT sessions_pk PRIMARY KEY (id),
+    CONSTRAINT sessions_hash_unique UNIQUE (token_hash),
+    CONSTRAINT sessions_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+CREATE INDEX sessions_user_idx ON public.sessions (user_id);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.sessions TO um_user;
@@ -0,0 +1,3 @@
+ALTER TABLE public.sessions DROP COLUMN IF EXISTS mfa_pending;
+DROP TABLE IF EXISTS public.recovery_codes;
+DROP TABLE IF EXISTS public.totp_secrets;
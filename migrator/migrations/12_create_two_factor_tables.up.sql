@@ -0,0 +1,25 @@
+CREATE TABLE public.totp_secrets
+(
+    user_id uuid NOT NULL,
+    secret varchar(64) NOT NULL,
+    last_counter bigint NOT NULL DEFAULT 0,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    locked_until timestamp NULL,
+    created_at timestamp NOT NULL,
+    confirmed_at timestamp NULL,
+    CONSTRAINT totp_secrets_pk PRIMARY KEY (user_id),
+    CONSTRAINT totp_secrets_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.totp_secrets TO um_user;
+
+CREATE TABLE public.recovery_codes
+(
+    user_id uuid NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamp NULL,
+    CONSTRAINT recovery_codes_pk PRIMARY KEY (user_id, code_hash),
+    CONSTRAINT recovery_codes_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.recovery_codes TO um_user;
+
+ALTER TABLE public.sessions ADD COLUMN IF NOT EXISTS mfa_pending boolean NOT NULL DEFAULT false;
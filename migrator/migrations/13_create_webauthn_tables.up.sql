@@ -0,0 +1,28 @@
+CREATE TABLE public.webauthn_credentials
+(
+    id varchar(1400) NOT NULL,
+    user_id uuid NOT NULL,
+    name varchar(64) NOT NULL,
+    public_key bytea NOT NULL,
+    algorithm integer NOT NULL,
+    sign_count bigint NOT NULL DEFAULT 0,
+    aaguid bytea NOT NULL,
+    format varchar(16) NOT NULL,
+    created_at timestamp NOT NULL,
+    last_used_at timestamp NULL,
+    CONSTRAINT webauthn_credentials_pk PRIMARY KEY (id),
+    CONSTRAINT webauthn_credentials_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+CREATE INDEX webauthn_credentials_user_idx ON public.webauthn_credentials (user_id);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.webauthn_credentials TO um_user;
+
+CREATE TABLE public.webauthn_challenges
+(
+    challenge varchar(64) NOT NULL,
+    user_id uuid NULL,
+    ceremony varchar(16) NOT NULL,
+    expires_at timestamp NOT NULL,
+    CONSTRAINT webauthn_challenges_pk PRIMARY KEY (challenge),
+    CONSTRAINT webauthn_challenges_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE ON public.webauthn_challenges TO um_user;
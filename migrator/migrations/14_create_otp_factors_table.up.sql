@@ -0,0 +1,16 @@
+CREATE TABLE public.otp_factors
+(
+    user_id uuid NOT NULL,
+    channel varchar(16) NOT NULL,
+    destination varchar(255) NOT NULL,
+    code_hash varchar(64) NULL,
+    code_expires_at timestamp NULL,
+    code_sent_at timestamp NULL,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    locked_until timestamp NULL,
+    created_at timestamp NOT NULL,
+    confirmed_at timestamp NULL,
+    CONSTRAINT otp_factors_pk PRIMARY KEY (user_id),
+    CONSTRAINT otp_factors_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.otp_factors TO um_user;
@@ -0,0 +1,8 @@
+ALTER TABLE public.refresh_tokens DROP COLUMN IF EXISTS amr;
+ALTER TABLE public.refresh_tokens DROP COLUMN IF EXISTS auth_time;
+ALTER TABLE public.oauth_device_codes DROP COLUMN IF EXISTS amr;
+ALTER TABLE public.oauth_device_codes DROP COLUMN IF EXISTS auth_time;
+ALTER TABLE public.oauth_codes DROP COLUMN IF EXISTS amr;
+ALTER TABLE public.oauth_codes DROP COLUMN IF EXISTS auth_time;
+ALTER TABLE public.sessions DROP COLUMN IF EXISTS amr;
+ALTER TABLE public.sessions DROP COLUMN IF EXISTS auth_time;
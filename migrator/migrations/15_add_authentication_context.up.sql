@@ -0,0 +1,10 @@
+ALTER TABLE public.sessions ADD COLUMN IF NOT EXISTS auth_time timestamp NULL;
+ALTER TABLE public.sessions ADD COLUMN IF NOT EXISTS amr varchar(64) NOT NULL DEFAULT '';
+UPDATE public.sessions SET auth_time=created_at, amr='pwd' WHERE auth_time IS NULL;
+ALTER TABLE public.sessions ALTER COLUMN auth_time SET NOT NULL;
+ALTER TABLE public.oauth_codes ADD COLUMN IF NOT EXISTS auth_time timestamp NULL;
+ALTER TABLE public.oauth_codes ADD COLUMN IF NOT EXISTS amr varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE public.oauth_device_codes ADD COLUMN IF NOT EXISTS auth_time timestamp NULL;
+ALTER TABLE public.oauth_device_codes ADD COLUMN IF NOT EXISTS amr varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE public.refresh_tokens ADD COLUMN IF NOT EXISTS auth_time timestamp NULL;
+ALTER TABLE public.refresh_tokens ADD COLUMN IF NOT EXISTS amr varchar(64) NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+CREATE TABLE public.login_failures
+(
+    kind varchar(8) NOT NULL,
+    subject varchar(255) NOT NULL,
+    failed_attempts integer NOT NULL DEFAULT 0,
+    last_failed_at timestamp NOT NULL,
+    locked_until timestamp NULL,
+    CONSTRAINT login_failures_pk PRIMARY KEY (kind, subject)
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.login_failures TO um_user;
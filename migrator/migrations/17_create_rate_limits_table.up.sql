@@ -0,0 +1,7 @@
+CREATE TABLE public.rate_limits
+(
+    key varchar(512) NOT NULL,
+    full_at timestamp NOT NULL,
+    CONSTRAINT rate_limits_pk PRIMARY KEY (key)
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.rate_limits TO um_user;
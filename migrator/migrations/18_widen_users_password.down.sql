@@ -0,0 +1 @@
+ALTER TABLE public.users ALTER COLUMN "password" TYPE varchar(64);
@@ -0,0 +1,2 @@
+ALTER TABLE public.refresh_tokens DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE public.refresh_tokens DROP COLUMN IF EXISTS user_agent;
@@ -0,0 +1,2 @@
+ALTER TABLE public.refresh_tokens ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '';
+ALTER TABLE public.refresh_tokens ADD COLUMN IF NOT EXISTS ip_address varchar(64) NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+CREATE TABLE public.oauth_consent_requests
+(
+    id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    expires_at timestamp NOT NULL,
+    CONSTRAINT oauth_consent_requests_pk PRIMARY KEY (id),
+    CONSTRAINT oauth_consent_requests_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE ON public.oauth_consent_requests TO um_user;
@@ -0,0 +1 @@
+ALTER TABLE public.oauth_clients DROP COLUMN IF EXISTS introspection;
@@ -0,0 +1 @@
+ALTER TABLE public.oauth_clients ADD COLUMN IF NOT EXISTS introspection boolean NOT NULL DEFAULT false;
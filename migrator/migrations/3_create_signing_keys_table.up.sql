@@ -0,0 +1,10 @@
+CREATE TABLE public.signing_keys
+(
+    id uuid NOT NULL,
+    algorithm varchar(10) NOT NULL,
+    private_key text NOT NULL,
+    activate_at timestamp NOT NULL,
+    created_at timestamp NOT NULL,
+    CONSTRAINT signing_keys_pk PRIMARY KEY (id)
+);
+GRANT SELECT, INSERT, DELETE ON public.signing_keys TO um_user;
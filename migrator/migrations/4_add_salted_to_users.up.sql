@@ -0,0 +1 @@
+ALTER TABLE public.users ADD COLUMN IF NOT EXISTS salted boolean NOT NULL DEFAULT false;
@@ -0,0 +1,18 @@
+CREATE TABLE public.refresh_tokens
+(
+    id uuid NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    family_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    client_id varchar(64) NOT NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at timestamp NULL,
+    revoked_at timestamp NULL,
+    CONSTRAINT refresh_tokens_pk PRIMARY KEY (id),
+    CONSTRAINT refresh_tokens_hash_unique UNIQUE (token_hash),
+    CONSTRAINT refresh_tokens_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+CREATE INDEX refresh_tokens_family_idx ON public.refresh_tokens (family_id);
+CREATE INDEX refresh_tokens_user_idx ON public.refresh_tokens (user_id);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.refresh_tokens TO um_user;
@@ -0,0 +1,4 @@
+ALTER TABLE public.refresh_tokens DROP COLUMN IF EXISTS scope;
+DROP TABLE IF EXISTS public.oauth_consents;
+DROP TABLE IF EXISTS public.oauth_codes;
+DROP TABLE IF EXISTS public.oauth_clients;
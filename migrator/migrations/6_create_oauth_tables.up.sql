@@ -0,0 +1,44 @@
+CREATE TABLE public.oauth_clients
+(
+    id varchar(64) NOT NULL,
+    secret_hash varchar(255) NOT NULL DEFAULT '',
+    name varchar(255) NOT NULL,
+    redirect_uris text[] NOT NULL DEFAULT '{}',
+    grant_types text[] NOT NULL DEFAULT '{}',
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_at timestamp NOT NULL,
+    CONSTRAINT oauth_clients_pk PRIMARY KEY (id)
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.oauth_clients TO um_user;
+
+CREATE TABLE public.oauth_codes
+(
+    code_hash varchar(64) NOT NULL,
+    client_id varchar(64) NOT NULL,
+    user_id uuid NOT NULL,
+    redirect_uri text NOT NULL,
+    scope text NOT NULL,
+    code_challenge varchar(128) NOT NULL DEFAULT '',
+    code_challenge_method varchar(10) NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at timestamp NULL,
+    CONSTRAINT oauth_codes_pk PRIMARY KEY (code_hash),
+    CONSTRAINT oauth_codes_client_fk FOREIGN KEY (client_id) REFERENCES public.oauth_clients (id) ON DELETE CASCADE,
+    CONSTRAINT oauth_codes_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.oauth_codes TO um_user;
+
+CREATE TABLE public.oauth_consents
+(
+    user_id uuid NOT NULL,
+    client_id varchar(64) NOT NULL,
+    scopes text[] NOT NULL,
+    granted_at timestamp NOT NULL,
+    CONSTRAINT oauth_consents_pk PRIMARY KEY (user_id, client_id),
+    CONSTRAINT oauth_consents_client_fk FOREIGN KEY (client_id) REFERENCES public.oauth_clients (id) ON DELETE CASCADE,
+    CONSTRAINT oauth_consents_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.oauth_consents TO um_user;
+
+ALTER TABLE public.refresh_tokens ADD COLUMN IF NOT EXISTS scope text NOT NULL DEFAULT '';
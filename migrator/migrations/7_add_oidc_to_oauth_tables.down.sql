@@ -0,0 +1,2 @@
+ALTER TABLE public.oauth_codes DROP COLUMN IF EXISTS nonce;
+ALTER TABLE public.oauth_clients DROP COLUMN IF EXISTS post_logout_redirect_uris;
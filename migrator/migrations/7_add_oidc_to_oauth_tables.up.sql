@@ -0,0 +1,2 @@
+ALTER TABLE public.oauth_clients ADD COLUMN IF NOT EXISTS post_logout_redirect_uris text[] NOT NULL DEFAULT '{}';
+ALTER TABLE public.oauth_codes ADD COLUMN IF NOT EXISTS nonce varchar(255) NOT NULL DEFAULT '';
@@ -0,0 +1,8 @@
+CREATE TABLE public.revoked_tokens
+(
+    id varchar(64) NOT NULL,
+    expires_at timestamp NOT NULL,
+    CONSTRAINT revoked_tokens_pk PRIMARY KEY (id)
+);
+CREATE INDEX revoked_tokens_expires_idx ON public.revoked_tokens (expires_at);
+GRANT SELECT, INSERT, DELETE ON public.revoked_tokens TO um_user;
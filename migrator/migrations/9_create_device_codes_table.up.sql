@@ -0,0 +1,18 @@
+CREATE TABLE public.oauth_device_codes
+(
+    device_code_hash varchar(64) NOT NULL,
+    user_code varchar(16) NOT NULL,
+    client_id varchar(64) NOT NULL,
+    scope text NOT NULL,
+    status varchar(16) NOT NULL,
+    user_id uuid NULL,
+    poll_interval integer NOT NULL,
+    polled_at timestamp NULL,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    CONSTRAINT oauth_device_codes_pk PRIMARY KEY (device_code_hash),
+    CONSTRAINT oauth_device_codes_user_code_key UNIQUE (user_code),
+    CONSTRAINT oauth_device_codes_client_fk FOREIGN KEY (client_id) REFERENCES public.oauth_clients (id) ON DELETE CASCADE,
+    CONSTRAINT oauth_device_codes_user_fk FOREIGN KEY (user_id) REFERENCES public.users (id) ON DELETE CASCADE
+);
+GRANT SELECT, INSERT, DELETE, UPDATE ON public.oauth_device_codes TO um_user;
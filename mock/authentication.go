@@ -1,49 +0,0 @@
-// Code generated by MockGen. DO NOT EDIT.
-// Source: ../middleware/authentication.go
-
-// Package mock is a generated GoMock package.
-package mock
-
-import (
-	gomock "github.com/golang/mock/gomock"
-	model "github.com/lvl484/user-manager/model"
-	reflect "reflect"
-)
-
-// MockUserProvider is a mock of UserProvider interface
-type MockUserProvider struct {
-	ctrl     *gomock.Controller
-	recorder *MockUserProviderMockRecorder
-}
-
-// MockUserProviderMockRecorder is the mock recorder for MockUserProvider
-type MockUserProviderMockRecorder struct {
-	mock *MockUserProvider
-}
-
-// NewMockUserProvider creates a new mock instance
-func NewMockUserProvider(ctrl *gomock.Controller) *MockUserProvider {
-	mock := &MockUserProvider{ctrl: ctrl}
-	mock.recorder = &MockUserProviderMockRecorder{mock}
-	return mock
-}
-
-// EXPECT returns an object that allows the caller to indicate expected use
-func (m *MockUserProvider) EXPECT() *MockUserProviderMockRecorder {
-	return m.recorder
-}
-
-// GetInfo mocks base method
-func (m *MockUserProvider) GetInfo(username string) (*model.User, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInfo", username)
-	ret0, _ := ret[0].(*model.User)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// GetInfo indicates an expected call of GetInfo
-func (mr *MockUserProviderMockRecorder) GetInfo(username interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockUserProvider)(nil).GetInfo), username)
-}
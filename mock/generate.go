@@ -1,4 +1,5 @@
 // go generate .
 package mock
 
-//go:generate mockgen -source=../middleware/authentication.go -destination=authentication.go -package=mock
+//go:generate mockgen -source=../server/http/handlers/handlers.go -destination=handlers.go -package=mock
+//go:generate mockgen -source=../server/http/middleware/providers.go -destination=providers.go -package=mock
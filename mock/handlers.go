@@ -0,0 +1,1264 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../server/http/handlers/handlers.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	gomock "github.com/golang/mock/gomock"
+	model "github.com/lvl484/user-manager/model"
+	reflect "reflect"
+	time "time"
+)
+
+// MockRefreshTokens is a mock of RefreshTokens interface
+type MockRefreshTokens struct {
+	ctrl     *gomock.Controller
+	recorder *MockRefreshTokensMockRecorder
+}
+
+// MockRefreshTokensMockRecorder is the mock recorder for MockRefreshTokens
+type MockRefreshTokensMockRecorder struct {
+	mock *MockRefreshTokens
+}
+
+// NewMockRefreshTokens creates a new mock instance
+func NewMockRefreshTokens(ctrl *gomock.Controller) *MockRefreshTokens {
+	mock := &MockRefreshTokens{ctrl: ctrl}
+	mock.recorder = &MockRefreshTokensMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRefreshTokens) EXPECT() *MockRefreshTokensMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method
+func (m *MockRefreshTokens) Create(userID, clientID, scope string, authTime time.Time, amr []string, userAgent, ip string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", userID, clientID, scope, authTime, amr, userAgent, ip)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create
+func (mr *MockRefreshTokensMockRecorder) Create(userID, clientID, scope, authTime, amr, userAgent, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRefreshTokens)(nil).Create), userID, clientID, scope, authTime, amr, userAgent, ip)
+}
+
+// Rotate mocks base method
+func (m *MockRefreshTokens) Rotate(raw, clientID, userAgent, ip string) (*model.RefreshToken, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rotate", raw, clientID, userAgent, ip)
+	ret0, _ := ret[0].(*model.RefreshToken)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Rotate indicates an expected call of Rotate
+func (mr *MockRefreshTokensMockRecorder) Rotate(raw, clientID, userAgent, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rotate", reflect.TypeOf((*MockRefreshTokens)(nil).Rotate), raw, clientID, userAgent, ip)
+}
+
+// Find mocks base method
+func (m *MockRefreshTokens) Find(raw string) (*model.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", raw)
+	ret0, _ := ret[0].(*model.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find
+func (mr *MockRefreshTokensMockRecorder) Find(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockRefreshTokens)(nil).Find), raw)
+}
+
+// Revoke mocks base method
+func (m *MockRefreshTokens) Revoke(raw string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", raw)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke
+func (mr *MockRefreshTokensMockRecorder) Revoke(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockRefreshTokens)(nil).Revoke), raw)
+}
+
+// RevokeClient mocks base method
+func (m *MockRefreshTokens) RevokeClient(userID, clientID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeClient", userID, clientID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeClient indicates an expected call of RevokeClient
+func (mr *MockRefreshTokensMockRecorder) RevokeClient(userID, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeClient", reflect.TypeOf((*MockRefreshTokens)(nil).RevokeClient), userID, clientID)
+}
+
+// RevokeUser mocks base method
+func (m *MockRefreshTokens) RevokeUser(login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUser", login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUser indicates an expected call of RevokeUser
+func (mr *MockRefreshTokensMockRecorder) RevokeUser(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUser", reflect.TypeOf((*MockRefreshTokens)(nil).RevokeUser), login)
+}
+
+// List mocks base method
+func (m *MockRefreshTokens) List(login string) ([]*model.RefreshToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", login)
+	ret0, _ := ret[0].([]*model.RefreshToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockRefreshTokensMockRecorder) List(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRefreshTokens)(nil).List), login)
+}
+
+// RevokeFamily mocks base method
+func (m *MockRefreshTokens) RevokeFamily(login, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeFamily", login, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeFamily indicates an expected call of RevokeFamily
+func (mr *MockRefreshTokensMockRecorder) RevokeFamily(login, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeFamily", reflect.TypeOf((*MockRefreshTokens)(nil).RevokeFamily), login, id)
+}
+
+// MockUsers is a mock of Users interface
+type MockUsers struct {
+	ctrl     *gomock.Controller
+	recorder *MockUsersMockRecorder
+}
+
+// MockUsersMockRecorder is the mock recorder for MockUsers
+type MockUsersMockRecorder struct {
+	mock *MockUsers
+}
+
+// NewMockUsers creates a new mock instance
+func NewMockUsers(ctrl *gomock.Controller) *MockUsers {
+	mock := &MockUsers{ctrl: ctrl}
+	mock.recorder = &MockUsersMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockUsers) EXPECT() *MockUsersMockRecorder {
+	return m.recorder
+}
+
+// GetInfo mocks base method
+func (m *MockUsers) GetInfo(login string) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInfo", login)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInfo indicates an expected call of GetInfo
+func (mr *MockUsersMockRecorder) GetInfo(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockUsers)(nil).GetInfo), login)
+}
+
+// VerifyAndUpgrade mocks base method
+func (m *MockUsers) VerifyAndUpgrade(user *model.User, password string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyAndUpgrade", user, password)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyAndUpgrade indicates an expected call of VerifyAndUpgrade
+func (mr *MockUsersMockRecorder) VerifyAndUpgrade(user, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyAndUpgrade", reflect.TypeOf((*MockUsers)(nil).VerifyAndUpgrade), user, password)
+}
+
+// MockClients is a mock of Clients interface
+type MockClients struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientsMockRecorder
+}
+
+// MockClientsMockRecorder is the mock recorder for MockClients
+type MockClientsMockRecorder struct {
+	mock *MockClients
+}
+
+// NewMockClients creates a new mock instance
+func NewMockClients(ctrl *gomock.Controller) *MockClients {
+	mock := &MockClients{ctrl: ctrl}
+	mock.recorder = &MockClientsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockClients) EXPECT() *MockClientsMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method
+func (m *MockClients) Get(id string) (*model.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", id)
+	ret0, _ := ret[0].(*model.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockClientsMockRecorder) Get(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClients)(nil).Get), id)
+}
+
+// MockClientRegistry is a mock of ClientRegistry interface
+type MockClientRegistry struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientRegistryMockRecorder
+}
+
+// MockClientRegistryMockRecorder is the mock recorder for MockClientRegistry
+type MockClientRegistryMockRecorder struct {
+	mock *MockClientRegistry
+}
+
+// NewMockClientRegistry creates a new mock instance
+func NewMockClientRegistry(ctrl *gomock.Controller) *MockClientRegistry {
+	mock := &MockClientRegistry{ctrl: ctrl}
+	mock.recorder = &MockClientRegistryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockClientRegistry) EXPECT() *MockClientRegistryMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method
+func (m *MockClientRegistry) Add(client *model.Client, secret string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", client, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add
+func (mr *MockClientRegistryMockRecorder) Add(client, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockClientRegistry)(nil).Add), client, secret)
+}
+
+// Get mocks base method
+func (m *MockClientRegistry) Get(id string) (*model.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", id)
+	ret0, _ := ret[0].(*model.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockClientRegistryMockRecorder) Get(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClientRegistry)(nil).Get), id)
+}
+
+// List mocks base method
+func (m *MockClientRegistry) List() ([]*model.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List")
+	ret0, _ := ret[0].([]*model.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockClientRegistryMockRecorder) List() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockClientRegistry)(nil).List))
+}
+
+// Update mocks base method
+func (m *MockClientRegistry) Update(client *model.Client) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", client)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update
+func (mr *MockClientRegistryMockRecorder) Update(client interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockClientRegistry)(nil).Update), client)
+}
+
+// RotateSecret mocks base method
+func (m *MockClientRegistry) RotateSecret(id string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSecret", id)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateSecret indicates an expected call of RotateSecret
+func (mr *MockClientRegistryMockRecorder) RotateSecret(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSecret", reflect.TypeOf((*MockClientRegistry)(nil).RotateSecret), id)
+}
+
+// Delete mocks base method
+func (m *MockClientRegistry) Delete(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockClientRegistryMockRecorder) Delete(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockClientRegistry)(nil).Delete), id)
+}
+
+// MockAuthCodes is a mock of AuthCodes interface
+type MockAuthCodes struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuthCodesMockRecorder
+}
+
+// MockAuthCodesMockRecorder is the mock recorder for MockAuthCodes
+type MockAuthCodesMockRecorder struct {
+	mock *MockAuthCodes
+}
+
+// NewMockAuthCodes creates a new mock instance
+func NewMockAuthCodes(ctrl *gomock.Controller) *MockAuthCodes {
+	mock := &MockAuthCodes{ctrl: ctrl}
+	mock.recorder = &MockAuthCodesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAuthCodes) EXPECT() *MockAuthCodesMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method
+func (m *MockAuthCodes) Create(code *model.AuthCode) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", code)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Create indicates an expected call of Create
+func (mr *MockAuthCodesMockRecorder) Create(code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockAuthCodes)(nil).Create), code)
+}
+
+// Consume mocks base method
+func (m *MockAuthCodes) Consume(raw string) (*model.AuthCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Consume", raw)
+	ret0, _ := ret[0].(*model.AuthCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Consume indicates an expected call of Consume
+func (mr *MockAuthCodesMockRecorder) Consume(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Consume", reflect.TypeOf((*MockAuthCodes)(nil).Consume), raw)
+}
+
+// MockConsents is a mock of Consents interface
+type MockConsents struct {
+	ctrl     *gomock.Controller
+	recorder *MockConsentsMockRecorder
+}
+
+// MockConsentsMockRecorder is the mock recorder for MockConsents
+type MockConsentsMockRecorder struct {
+	mock *MockConsents
+}
+
+// NewMockConsents creates a new mock instance
+func NewMockConsents(ctrl *gomock.Controller) *MockConsents {
+	mock := &MockConsents{ctrl: ctrl}
+	mock.recorder = &MockConsentsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockConsents) EXPECT() *MockConsentsMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method
+func (m *MockConsents) Get(userID, clientID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", userID, clientID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockConsentsMockRecorder) Get(userID, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockConsents)(nil).Get), userID, clientID)
+}
+
+// Grant mocks base method
+func (m *MockConsents) Grant(userID, clientID string, scopes []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Grant", userID, clientID, scopes)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Grant indicates an expected call of Grant
+func (mr *MockConsentsMockRecorder) Grant(userID, clientID, scopes interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Grant", reflect.TypeOf((*MockConsents)(nil).Grant), userID, clientID, scopes)
+}
+
+// CreateRequest mocks base method
+func (m *MockConsents) CreateRequest(userID string, expiresAt time.Time) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRequest", userID, expiresAt)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRequest indicates an expected call of CreateRequest
+func (mr *MockConsentsMockRecorder) CreateRequest(userID, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRequest", reflect.TypeOf((*MockConsents)(nil).CreateRequest), userID, expiresAt)
+}
+
+// ConsumeRequest mocks base method
+func (m *MockConsents) ConsumeRequest(id, userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeRequest", id, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ConsumeRequest indicates an expected call of ConsumeRequest
+func (mr *MockConsentsMockRecorder) ConsumeRequest(id, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeRequest", reflect.TypeOf((*MockConsents)(nil).ConsumeRequest), id, userID)
+}
+
+// MockRevokedTokens is a mock of RevokedTokens interface
+type MockRevokedTokens struct {
+	ctrl     *gomock.Controller
+	recorder *MockRevokedTokensMockRecorder
+}
+
+// MockRevokedTokensMockRecorder is the mock recorder for MockRevokedTokens
+type MockRevokedTokensMockRecorder struct {
+	mock *MockRevokedTokens
+}
+
+// NewMockRevokedTokens creates a new mock instance
+func NewMockRevokedTokens(ctrl *gomock.Controller) *MockRevokedTokens {
+	mock := &MockRevokedTokens{ctrl: ctrl}
+	mock.recorder = &MockRevokedTokensMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRevokedTokens) EXPECT() *MockRevokedTokensMockRecorder {
+	return m.recorder
+}
+
+// Revoke mocks base method
+func (m *MockRevokedTokens) Revoke(id string, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Revoke", id, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Revoke indicates an expected call of Revoke
+func (mr *MockRevokedTokensMockRecorder) Revoke(id, expiresAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Revoke", reflect.TypeOf((*MockRevokedTokens)(nil).Revoke), id, expiresAt)
+}
+
+// IsRevoked mocks base method
+func (m *MockRevokedTokens) IsRevoked(id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsRevoked", id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsRevoked indicates an expected call of IsRevoked
+func (mr *MockRevokedTokensMockRecorder) IsRevoked(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsRevoked", reflect.TypeOf((*MockRevokedTokens)(nil).IsRevoked), id)
+}
+
+// MockDeviceCodes is a mock of DeviceCodes interface
+type MockDeviceCodes struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeviceCodesMockRecorder
+}
+
+// MockDeviceCodesMockRecorder is the mock recorder for MockDeviceCodes
+type MockDeviceCodesMockRecorder struct {
+	mock *MockDeviceCodes
+}
+
+// NewMockDeviceCodes creates a new mock instance
+func NewMockDeviceCodes(ctrl *gomock.Controller) *MockDeviceCodes {
+	mock := &MockDeviceCodes{ctrl: ctrl}
+	mock.recorder = &MockDeviceCodesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockDeviceCodes) EXPECT() *MockDeviceCodesMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method
+func (m *MockDeviceCodes) Create(clientID, scope string) (string, *model.DeviceCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", clientID, scope)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(*model.DeviceCode)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Create indicates an expected call of Create
+func (mr *MockDeviceCodesMockRecorder) Create(clientID, scope interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockDeviceCodes)(nil).Create), clientID, scope)
+}
+
+// Find mocks base method
+func (m *MockDeviceCodes) Find(userCode string) (*model.DeviceCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Find", userCode)
+	ret0, _ := ret[0].(*model.DeviceCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Find indicates an expected call of Find
+func (mr *MockDeviceCodesMockRecorder) Find(userCode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Find", reflect.TypeOf((*MockDeviceCodes)(nil).Find), userCode)
+}
+
+// Decide mocks base method
+func (m *MockDeviceCodes) Decide(userCode, userID string, approve bool, authTime time.Time, amr []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Decide", userCode, userID, approve, authTime, amr)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Decide indicates an expected call of Decide
+func (mr *MockDeviceCodesMockRecorder) Decide(userCode, userID, approve, authTime, amr interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Decide", reflect.TypeOf((*MockDeviceCodes)(nil).Decide), userCode, userID, approve, authTime, amr)
+}
+
+// Poll mocks base method
+func (m *MockDeviceCodes) Poll(raw, clientID string) (*model.DeviceCode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Poll", raw, clientID)
+	ret0, _ := ret[0].(*model.DeviceCode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Poll indicates an expected call of Poll
+func (mr *MockDeviceCodesMockRecorder) Poll(raw, clientID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Poll", reflect.TypeOf((*MockDeviceCodes)(nil).Poll), raw, clientID)
+}
+
+// MockTokenExchanges is a mock of TokenExchanges interface
+type MockTokenExchanges struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenExchangesMockRecorder
+}
+
+// MockTokenExchangesMockRecorder is the mock recorder for MockTokenExchanges
+type MockTokenExchangesMockRecorder struct {
+	mock *MockTokenExchanges
+}
+
+// NewMockTokenExchanges creates a new mock instance
+func NewMockTokenExchanges(ctrl *gomock.Controller) *MockTokenExchanges {
+	mock := &MockTokenExchanges{ctrl: ctrl}
+	mock.recorder = &MockTokenExchangesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockTokenExchanges) EXPECT() *MockTokenExchangesMockRecorder {
+	return m.recorder
+}
+
+// Record mocks base method
+func (m *MockTokenExchanges) Record(e *model.TokenExchange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Record", e)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Record indicates an expected call of Record
+func (mr *MockTokenExchangesMockRecorder) Record(e interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Record", reflect.TypeOf((*MockTokenExchanges)(nil).Record), e)
+}
+
+// MockSessions is a mock of Sessions interface
+type MockSessions struct {
+	ctrl     *gomock.Controller
+	recorder *MockSessionsMockRecorder
+}
+
+// MockSessionsMockRecorder is the mock recorder for MockSessions
+type MockSessionsMockRecorder struct {
+	mock *MockSessions
+}
+
+// NewMockSessions creates a new mock instance
+func NewMockSessions(ctrl *gomock.Controller) *MockSessions {
+	mock := &MockSessions{ctrl: ctrl}
+	mock.recorder = &MockSessionsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSessions) EXPECT() *MockSessionsMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method
+func (m *MockSessions) Create(user *model.User, userAgent, ip, method string, pending bool) (string, *model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", user, userAgent, ip, method, pending)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(*model.Session)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Create indicates an expected call of Create
+func (mr *MockSessionsMockRecorder) Create(user, userAgent, ip, method, pending interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockSessions)(nil).Create), user, userAgent, ip, method, pending)
+}
+
+// Touch mocks base method
+func (m *MockSessions) Touch(raw string) (*model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", raw)
+	ret0, _ := ret[0].(*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Touch indicates an expected call of Touch
+func (mr *MockSessionsMockRecorder) Touch(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockSessions)(nil).Touch), raw)
+}
+
+// TouchPending mocks base method
+func (m *MockSessions) TouchPending(raw string) (*model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchPending", raw)
+	ret0, _ := ret[0].(*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TouchPending indicates an expected call of TouchPending
+func (mr *MockSessionsMockRecorder) TouchPending(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchPending", reflect.TypeOf((*MockSessions)(nil).TouchPending), raw)
+}
+
+// Complete mocks base method
+func (m *MockSessions) Complete(raw, method string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Complete", raw, method)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Complete indicates an expected call of Complete
+func (mr *MockSessionsMockRecorder) Complete(raw, method interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Complete", reflect.TypeOf((*MockSessions)(nil).Complete), raw, method)
+}
+
+// Delete mocks base method
+func (m *MockSessions) Delete(raw string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", raw)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockSessionsMockRecorder) Delete(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockSessions)(nil).Delete), raw)
+}
+
+// List mocks base method
+func (m *MockSessions) List(login string) ([]*model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", login)
+	ret0, _ := ret[0].([]*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockSessionsMockRecorder) List(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockSessions)(nil).List), login)
+}
+
+// DeleteByID mocks base method
+func (m *MockSessions) DeleteByID(login, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteByID", login, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteByID indicates an expected call of DeleteByID
+func (mr *MockSessionsMockRecorder) DeleteByID(login, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteByID", reflect.TypeOf((*MockSessions)(nil).DeleteByID), login, id)
+}
+
+// DeleteOthers mocks base method
+func (m *MockSessions) DeleteOthers(login, keep string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteOthers", login, keep)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteOthers indicates an expected call of DeleteOthers
+func (mr *MockSessionsMockRecorder) DeleteOthers(login, keep interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteOthers", reflect.TypeOf((*MockSessions)(nil).DeleteOthers), login, keep)
+}
+
+// MockLoginAttempts is a mock of LoginAttempts interface
+type MockLoginAttempts struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginAttemptsMockRecorder
+}
+
+// MockLoginAttemptsMockRecorder is the mock recorder for MockLoginAttempts
+type MockLoginAttemptsMockRecorder struct {
+	mock *MockLoginAttempts
+}
+
+// NewMockLoginAttempts creates a new mock instance
+func NewMockLoginAttempts(ctrl *gomock.Controller) *MockLoginAttempts {
+	mock := &MockLoginAttempts{ctrl: ctrl}
+	mock.recorder = &MockLoginAttemptsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLoginAttempts) EXPECT() *MockLoginAttemptsMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method
+func (m *MockLoginAttempts) Check(login, ip string) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", login, ip)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Check indicates an expected call of Check
+func (mr *MockLoginAttemptsMockRecorder) Check(login, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockLoginAttempts)(nil).Check), login, ip)
+}
+
+// Fail mocks base method
+func (m *MockLoginAttempts) Fail(login, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fail", login, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Fail indicates an expected call of Fail
+func (mr *MockLoginAttemptsMockRecorder) Fail(login, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fail", reflect.TypeOf((*MockLoginAttempts)(nil).Fail), login, ip)
+}
+
+// Reset mocks base method
+func (m *MockLoginAttempts) Reset(login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset
+func (mr *MockLoginAttemptsMockRecorder) Reset(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginAttempts)(nil).Reset), login)
+}
+
+// MockSecondFactors is a mock of SecondFactors interface
+type MockSecondFactors struct {
+	ctrl     *gomock.Controller
+	recorder *MockSecondFactorsMockRecorder
+}
+
+// MockSecondFactorsMockRecorder is the mock recorder for MockSecondFactors
+type MockSecondFactorsMockRecorder struct {
+	mock *MockSecondFactors
+}
+
+// NewMockSecondFactors creates a new mock instance
+func NewMockSecondFactors(ctrl *gomock.Controller) *MockSecondFactors {
+	mock := &MockSecondFactors{ctrl: ctrl}
+	mock.recorder = &MockSecondFactorsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSecondFactors) EXPECT() *MockSecondFactorsMockRecorder {
+	return m.recorder
+}
+
+// EnrollTOTP mocks base method
+func (m *MockSecondFactors) EnrollTOTP(userID string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTOTP", userID)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollTOTP indicates an expected call of EnrollTOTP
+func (mr *MockSecondFactorsMockRecorder) EnrollTOTP(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTOTP", reflect.TypeOf((*MockSecondFactors)(nil).EnrollTOTP), userID)
+}
+
+// ConfirmTOTP mocks base method
+func (m *MockSecondFactors) ConfirmTOTP(userID, code string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTOTP", userID, code)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTOTP indicates an expected call of ConfirmTOTP
+func (mr *MockSecondFactorsMockRecorder) ConfirmTOTP(userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTOTP", reflect.TypeOf((*MockSecondFactors)(nil).ConfirmTOTP), userID, code)
+}
+
+// EnrollOTP mocks base method
+func (m *MockSecondFactors) EnrollOTP(userID, channel, destination string) (*model.OTPDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollOTP", userID, channel, destination)
+	ret0, _ := ret[0].(*model.OTPDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollOTP indicates an expected call of EnrollOTP
+func (mr *MockSecondFactorsMockRecorder) EnrollOTP(userID, channel, destination interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollOTP", reflect.TypeOf((*MockSecondFactors)(nil).EnrollOTP), userID, channel, destination)
+}
+
+// ConfirmOTP mocks base method
+func (m *MockSecondFactors) ConfirmOTP(userID, code string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmOTP", userID, code)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmOTP indicates an expected call of ConfirmOTP
+func (mr *MockSecondFactorsMockRecorder) ConfirmOTP(userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmOTP", reflect.TypeOf((*MockSecondFactors)(nil).ConfirmOTP), userID, code)
+}
+
+// IssueOTP mocks base method
+func (m *MockSecondFactors) IssueOTP(userID string) (*model.OTPDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueOTP", userID)
+	ret0, _ := ret[0].(*model.OTPDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueOTP indicates an expected call of IssueOTP
+func (mr *MockSecondFactorsMockRecorder) IssueOTP(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueOTP", reflect.TypeOf((*MockSecondFactors)(nil).IssueOTP), userID)
+}
+
+// Enabled mocks base method
+func (m *MockSecondFactors) Enabled(userID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enabled", userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Enabled indicates an expected call of Enabled
+func (mr *MockSecondFactorsMockRecorder) Enabled(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enabled", reflect.TypeOf((*MockSecondFactors)(nil).Enabled), userID)
+}
+
+// Status mocks base method
+func (m *MockSecondFactors) Status(userID string) (*model.TwoFactorStatus, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Status", userID)
+	ret0, _ := ret[0].(*model.TwoFactorStatus)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Status indicates an expected call of Status
+func (mr *MockSecondFactorsMockRecorder) Status(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockSecondFactors)(nil).Status), userID)
+}
+
+// Verify mocks base method
+func (m *MockSecondFactors) Verify(userID, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", userID, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify
+func (mr *MockSecondFactorsMockRecorder) Verify(userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockSecondFactors)(nil).Verify), userID, code)
+}
+
+// RegenerateRecoveryCodes mocks base method
+func (m *MockSecondFactors) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegenerateRecoveryCodes", userID)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegenerateRecoveryCodes indicates an expected call of RegenerateRecoveryCodes
+func (mr *MockSecondFactorsMockRecorder) RegenerateRecoveryCodes(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegenerateRecoveryCodes", reflect.TypeOf((*MockSecondFactors)(nil).RegenerateRecoveryCodes), userID)
+}
+
+// Disable mocks base method
+func (m *MockSecondFactors) Disable(userID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Disable", userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Disable indicates an expected call of Disable
+func (mr *MockSecondFactorsMockRecorder) Disable(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Disable", reflect.TypeOf((*MockSecondFactors)(nil).Disable), userID)
+}
+
+// Reset mocks base method
+func (m *MockSecondFactors) Reset(login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset
+func (mr *MockSecondFactorsMockRecorder) Reset(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockSecondFactors)(nil).Reset), login)
+}
+
+// MockCodeSender is a mock of CodeSender interface
+type MockCodeSender struct {
+	ctrl     *gomock.Controller
+	recorder *MockCodeSenderMockRecorder
+}
+
+// MockCodeSenderMockRecorder is the mock recorder for MockCodeSender
+type MockCodeSenderMockRecorder struct {
+	mock *MockCodeSender
+}
+
+// NewMockCodeSender creates a new mock instance
+func NewMockCodeSender(ctrl *gomock.Controller) *MockCodeSender {
+	mock := &MockCodeSender{ctrl: ctrl}
+	mock.recorder = &MockCodeSenderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCodeSender) EXPECT() *MockCodeSenderMockRecorder {
+	return m.recorder
+}
+
+// Supports mocks base method
+func (m *MockCodeSender) Supports(channel string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Supports", channel)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Supports indicates an expected call of Supports
+func (mr *MockCodeSenderMockRecorder) Supports(channel interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Supports", reflect.TypeOf((*MockCodeSender)(nil).Supports), channel)
+}
+
+// Send mocks base method
+func (m *MockCodeSender) Send(ctx context.Context, channel, to, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, channel, to, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send
+func (mr *MockCodeSenderMockRecorder) Send(ctx, channel, to, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockCodeSender)(nil).Send), ctx, channel, to, code)
+}
+
+// MockWebAuthnCredentials is a mock of WebAuthnCredentials interface
+type MockWebAuthnCredentials struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebAuthnCredentialsMockRecorder
+}
+
+// MockWebAuthnCredentialsMockRecorder is the mock recorder for MockWebAuthnCredentials
+type MockWebAuthnCredentialsMockRecorder struct {
+	mock *MockWebAuthnCredentials
+}
+
+// NewMockWebAuthnCredentials creates a new mock instance
+func NewMockWebAuthnCredentials(ctrl *gomock.Controller) *MockWebAuthnCredentials {
+	mock := &MockWebAuthnCredentials{ctrl: ctrl}
+	mock.recorder = &MockWebAuthnCredentialsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockWebAuthnCredentials) EXPECT() *MockWebAuthnCredentialsMockRecorder {
+	return m.recorder
+}
+
+// Add mocks base method
+func (m *MockWebAuthnCredentials) Add(c *model.WebAuthnCredential) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Add", c)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Add indicates an expected call of Add
+func (mr *MockWebAuthnCredentialsMockRecorder) Add(c interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Add", reflect.TypeOf((*MockWebAuthnCredentials)(nil).Add), c)
+}
+
+// List mocks base method
+func (m *MockWebAuthnCredentials) List(userID string) ([]*model.WebAuthnCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", userID)
+	ret0, _ := ret[0].([]*model.WebAuthnCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List
+func (mr *MockWebAuthnCredentialsMockRecorder) List(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockWebAuthnCredentials)(nil).List), userID)
+}
+
+// Get mocks base method
+func (m *MockWebAuthnCredentials) Get(id string) (*model.WebAuthnCredential, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", id)
+	ret0, _ := ret[0].(*model.WebAuthnCredential)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockWebAuthnCredentialsMockRecorder) Get(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockWebAuthnCredentials)(nil).Get), id)
+}
+
+// Use mocks base method
+func (m *MockWebAuthnCredentials) Use(id string, signCount uint32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Use", id, signCount)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Use indicates an expected call of Use
+func (mr *MockWebAuthnCredentialsMockRecorder) Use(id, signCount interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Use", reflect.TypeOf((*MockWebAuthnCredentials)(nil).Use), id, signCount)
+}
+
+// Delete mocks base method
+func (m *MockWebAuthnCredentials) Delete(userID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete
+func (mr *MockWebAuthnCredentialsMockRecorder) Delete(userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockWebAuthnCredentials)(nil).Delete), userID, id)
+}
+
+// CreateChallenge mocks base method
+func (m *MockWebAuthnCredentials) CreateChallenge(userID, ceremony string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateChallenge", userID, ceremony)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateChallenge indicates an expected call of CreateChallenge
+func (mr *MockWebAuthnCredentialsMockRecorder) CreateChallenge(userID, ceremony interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChallenge", reflect.TypeOf((*MockWebAuthnCredentials)(nil).CreateChallenge), userID, ceremony)
+}
+
+// ConsumeChallenge mocks base method
+func (m *MockWebAuthnCredentials) ConsumeChallenge(challenge, ceremony string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeChallenge", challenge, ceremony)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeChallenge indicates an expected call of ConsumeChallenge
+func (mr *MockWebAuthnCredentialsMockRecorder) ConsumeChallenge(challenge, ceremony interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeChallenge", reflect.TypeOf((*MockWebAuthnCredentials)(nil).ConsumeChallenge), challenge, ceremony)
+}
+
+// MockAdmins is a mock of Admins interface
+type MockAdmins struct {
+	ctrl     *gomock.Controller
+	recorder *MockAdminsMockRecorder
+}
+
+// MockAdminsMockRecorder is the mock recorder for MockAdmins
+type MockAdminsMockRecorder struct {
+	mock *MockAdmins
+}
+
+// NewMockAdmins creates a new mock instance
+func NewMockAdmins(ctrl *gomock.Controller) *MockAdmins {
+	mock := &MockAdmins{ctrl: ctrl}
+	mock.recorder = &MockAdminsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockAdmins) EXPECT() *MockAdminsMockRecorder {
+	return m.recorder
+}
+
+// IsAdmin mocks base method
+func (m *MockAdmins) IsAdmin(username string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsAdmin", username)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsAdmin indicates an expected call of IsAdmin
+func (mr *MockAdminsMockRecorder) IsAdmin(username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAdmin", reflect.TypeOf((*MockAdmins)(nil).IsAdmin), username)
+}
@@ -0,0 +1,453 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../server/http/middleware/providers.go
+
+// Package mock is a generated GoMock package.
+package mock
+
+import (
+	context "context"
+	gomock "github.com/golang/mock/gomock"
+	model "github.com/lvl484/user-manager/model"
+	ratelimit "github.com/lvl484/user-manager/ratelimit"
+	reflect "reflect"
+	time "time"
+)
+
+// MockUserProvider is a mock of UserProvider interface
+type MockUserProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserProviderMockRecorder
+}
+
+// MockUserProviderMockRecorder is the mock recorder for MockUserProvider
+type MockUserProviderMockRecorder struct {
+	mock *MockUserProvider
+}
+
+// NewMockUserProvider creates a new mock instance
+func NewMockUserProvider(ctrl *gomock.Controller) *MockUserProvider {
+	mock := &MockUserProvider{ctrl: ctrl}
+	mock.recorder = &MockUserProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockUserProvider) EXPECT() *MockUserProviderMockRecorder {
+	return m.recorder
+}
+
+// GetInfo mocks base method
+func (m *MockUserProvider) GetInfo(username string) (*model.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInfo", username)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetInfo indicates an expected call of GetInfo
+func (mr *MockUserProviderMockRecorder) GetInfo(username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockUserProvider)(nil).GetInfo), username)
+}
+
+// VerifyAndUpgrade mocks base method
+func (m *MockUserProvider) VerifyAndUpgrade(user *model.User, password string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyAndUpgrade", user, password)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyAndUpgrade indicates an expected call of VerifyAndUpgrade
+func (mr *MockUserProviderMockRecorder) VerifyAndUpgrade(user, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyAndUpgrade", reflect.TypeOf((*MockUserProvider)(nil).VerifyAndUpgrade), user, password)
+}
+
+// MockRevokedTokenProvider is a mock of RevokedTokenProvider interface
+type MockRevokedTokenProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockRevokedTokenProviderMockRecorder
+}
+
+// MockRevokedTokenProviderMockRecorder is the mock recorder for MockRevokedTokenProvider
+type MockRevokedTokenProviderMockRecorder struct {
+	mock *MockRevokedTokenProvider
+}
+
+// NewMockRevokedTokenProvider creates a new mock instance
+func NewMockRevokedTokenProvider(ctrl *gomock.Controller) *MockRevokedTokenProvider {
+	mock := &MockRevokedTokenProvider{ctrl: ctrl}
+	mock.recorder = &MockRevokedTokenProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRevokedTokenProvider) EXPECT() *MockRevokedTokenProviderMockRecorder {
+	return m.recorder
+}
+
+// IsRevoked mocks base method
+func (m *MockRevokedTokenProvider) IsRevoked(id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsRevoked", id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsRevoked indicates an expected call of IsRevoked
+func (mr *MockRevokedTokenProviderMockRecorder) IsRevoked(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsRevoked", reflect.TypeOf((*MockRevokedTokenProvider)(nil).IsRevoked), id)
+}
+
+// MockClientProvider is a mock of ClientProvider interface
+type MockClientProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientProviderMockRecorder
+}
+
+// MockClientProviderMockRecorder is the mock recorder for MockClientProvider
+type MockClientProviderMockRecorder struct {
+	mock *MockClientProvider
+}
+
+// NewMockClientProvider creates a new mock instance
+func NewMockClientProvider(ctrl *gomock.Controller) *MockClientProvider {
+	mock := &MockClientProvider{ctrl: ctrl}
+	mock.recorder = &MockClientProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockClientProvider) EXPECT() *MockClientProviderMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method
+func (m *MockClientProvider) Get(id string) (*model.Client, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", id)
+	ret0, _ := ret[0].(*model.Client)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockClientProviderMockRecorder) Get(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockClientProvider)(nil).Get), id)
+}
+
+// MockSessionProvider is a mock of SessionProvider interface
+type MockSessionProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockSessionProviderMockRecorder
+}
+
+// MockSessionProviderMockRecorder is the mock recorder for MockSessionProvider
+type MockSessionProviderMockRecorder struct {
+	mock *MockSessionProvider
+}
+
+// NewMockSessionProvider creates a new mock instance
+func NewMockSessionProvider(ctrl *gomock.Controller) *MockSessionProvider {
+	mock := &MockSessionProvider{ctrl: ctrl}
+	mock.recorder = &MockSessionProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSessionProvider) EXPECT() *MockSessionProviderMockRecorder {
+	return m.recorder
+}
+
+// Touch mocks base method
+func (m *MockSessionProvider) Touch(raw string) (*model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Touch", raw)
+	ret0, _ := ret[0].(*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Touch indicates an expected call of Touch
+func (mr *MockSessionProviderMockRecorder) Touch(raw interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Touch", reflect.TypeOf((*MockSessionProvider)(nil).Touch), raw)
+}
+
+// MockSecondFactorProvider is a mock of SecondFactorProvider interface
+type MockSecondFactorProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockSecondFactorProviderMockRecorder
+}
+
+// MockSecondFactorProviderMockRecorder is the mock recorder for MockSecondFactorProvider
+type MockSecondFactorProviderMockRecorder struct {
+	mock *MockSecondFactorProvider
+}
+
+// NewMockSecondFactorProvider creates a new mock instance
+func NewMockSecondFactorProvider(ctrl *gomock.Controller) *MockSecondFactorProvider {
+	mock := &MockSecondFactorProvider{ctrl: ctrl}
+	mock.recorder = &MockSecondFactorProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockSecondFactorProvider) EXPECT() *MockSecondFactorProviderMockRecorder {
+	return m.recorder
+}
+
+// Enabled mocks base method
+func (m *MockSecondFactorProvider) Enabled(userID string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Enabled", userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Enabled indicates an expected call of Enabled
+func (mr *MockSecondFactorProviderMockRecorder) Enabled(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Enabled", reflect.TypeOf((*MockSecondFactorProvider)(nil).Enabled), userID)
+}
+
+// Verify mocks base method
+func (m *MockSecondFactorProvider) Verify(userID, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", userID, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify
+func (mr *MockSecondFactorProviderMockRecorder) Verify(userID, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockSecondFactorProvider)(nil).Verify), userID, code)
+}
+
+// IssueOTP mocks base method
+func (m *MockSecondFactorProvider) IssueOTP(userID string) (*model.OTPDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueOTP", userID)
+	ret0, _ := ret[0].(*model.OTPDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueOTP indicates an expected call of IssueOTP
+func (mr *MockSecondFactorProviderMockRecorder) IssueOTP(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueOTP", reflect.TypeOf((*MockSecondFactorProvider)(nil).IssueOTP), userID)
+}
+
+// MockLoginAttemptsProvider is a mock of LoginAttemptsProvider interface
+type MockLoginAttemptsProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginAttemptsProviderMockRecorder
+}
+
+// MockLoginAttemptsProviderMockRecorder is the mock recorder for MockLoginAttemptsProvider
+type MockLoginAttemptsProviderMockRecorder struct {
+	mock *MockLoginAttemptsProvider
+}
+
+// NewMockLoginAttemptsProvider creates a new mock instance
+func NewMockLoginAttemptsProvider(ctrl *gomock.Controller) *MockLoginAttemptsProvider {
+	mock := &MockLoginAttemptsProvider{ctrl: ctrl}
+	mock.recorder = &MockLoginAttemptsProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockLoginAttemptsProvider) EXPECT() *MockLoginAttemptsProviderMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method
+func (m *MockLoginAttemptsProvider) Check(login, ip string) (time.Duration, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", login, ip)
+	ret0, _ := ret[0].(time.Duration)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Check indicates an expected call of Check
+func (mr *MockLoginAttemptsProviderMockRecorder) Check(login, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockLoginAttemptsProvider)(nil).Check), login, ip)
+}
+
+// Fail mocks base method
+func (m *MockLoginAttemptsProvider) Fail(login, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fail", login, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Fail indicates an expected call of Fail
+func (mr *MockLoginAttemptsProviderMockRecorder) Fail(login, ip interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fail", reflect.TypeOf((*MockLoginAttemptsProvider)(nil).Fail), login, ip)
+}
+
+// Reset mocks base method
+func (m *MockLoginAttemptsProvider) Reset(login string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", login)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset
+func (mr *MockLoginAttemptsProviderMockRecorder) Reset(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginAttemptsProvider)(nil).Reset), login)
+}
+
+// MockCredentialCacheProvider is a mock of CredentialCacheProvider interface
+type MockCredentialCacheProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockCredentialCacheProviderMockRecorder
+}
+
+// MockCredentialCacheProviderMockRecorder is the mock recorder for MockCredentialCacheProvider
+type MockCredentialCacheProviderMockRecorder struct {
+	mock *MockCredentialCacheProvider
+}
+
+// NewMockCredentialCacheProvider creates a new mock instance
+func NewMockCredentialCacheProvider(ctrl *gomock.Controller) *MockCredentialCacheProvider {
+	mock := &MockCredentialCacheProvider{ctrl: ctrl}
+	mock.recorder = &MockCredentialCacheProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCredentialCacheProvider) EXPECT() *MockCredentialCacheProviderMockRecorder {
+	return m.recorder
+}
+
+// Generation mocks base method
+func (m *MockCredentialCacheProvider) Generation(login string) uint64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Generation", login)
+	ret0, _ := ret[0].(uint64)
+	return ret0
+}
+
+// Generation indicates an expected call of Generation
+func (mr *MockCredentialCacheProviderMockRecorder) Generation(login interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Generation", reflect.TypeOf((*MockCredentialCacheProvider)(nil).Generation), login)
+}
+
+// Get mocks base method
+func (m *MockCredentialCacheProvider) Get(login, password string) (*model.User, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", login, password)
+	ret0, _ := ret[0].(*model.User)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get
+func (mr *MockCredentialCacheProviderMockRecorder) Get(login, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCredentialCacheProvider)(nil).Get), login, password)
+}
+
+// Put mocks base method
+func (m *MockCredentialCacheProvider) Put(login, password string, user *model.User, gen uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Put", login, password, user, gen)
+}
+
+// Put indicates an expected call of Put
+func (mr *MockCredentialCacheProviderMockRecorder) Put(login, password, user, gen interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockCredentialCacheProvider)(nil).Put), login, password, user, gen)
+}
+
+// MockCodeDeliveryProvider is a mock of CodeDeliveryProvider interface
+type MockCodeDeliveryProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockCodeDeliveryProviderMockRecorder
+}
+
+// MockCodeDeliveryProviderMockRecorder is the mock recorder for MockCodeDeliveryProvider
+type MockCodeDeliveryProviderMockRecorder struct {
+	mock *MockCodeDeliveryProvider
+}
+
+// NewMockCodeDeliveryProvider creates a new mock instance
+func NewMockCodeDeliveryProvider(ctrl *gomock.Controller) *MockCodeDeliveryProvider {
+	mock := &MockCodeDeliveryProvider{ctrl: ctrl}
+	mock.recorder = &MockCodeDeliveryProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockCodeDeliveryProvider) EXPECT() *MockCodeDeliveryProviderMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method
+func (m *MockCodeDeliveryProvider) Send(ctx context.Context, channel, to, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, channel, to, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send
+func (mr *MockCodeDeliveryProviderMockRecorder) Send(ctx, channel, to, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockCodeDeliveryProvider)(nil).Send), ctx, channel, to, code)
+}
+
+// MockRateLimiterProvider is a mock of RateLimiterProvider interface
+type MockRateLimiterProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimiterProviderMockRecorder
+}
+
+// MockRateLimiterProviderMockRecorder is the mock recorder for MockRateLimiterProvider
+type MockRateLimiterProviderMockRecorder struct {
+	mock *MockRateLimiterProvider
+}
+
+// NewMockRateLimiterProvider creates a new mock instance
+func NewMockRateLimiterProvider(ctrl *gomock.Controller) *MockRateLimiterProvider {
+	mock := &MockRateLimiterProvider{ctrl: ctrl}
+	mock.recorder = &MockRateLimiterProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use
+func (m *MockRateLimiterProvider) EXPECT() *MockRateLimiterProviderMockRecorder {
+	return m.recorder
+}
+
+// Allow mocks base method
+func (m *MockRateLimiterProvider) Allow(key string, rate ratelimit.Rate) (*ratelimit.Result, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Allow", key, rate)
+	ret0, _ := ret[0].(*ratelimit.Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Allow indicates an expected call of Allow
+func (mr *MockRateLimiterProviderMockRecorder) Allow(key, rate interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Allow", reflect.TypeOf((*MockRateLimiterProvider)(nil).Allow), key, rate)
+}
@@ -0,0 +1,142 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	queryInsertAuthCode = `INSERT INTO oauth_codes(code_hash, client_id, user_id, redirect_uri, scope, nonce,
+		code_challenge, code_challenge_method, created_at, expires_at, auth_time, amr)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
+	querySelectAuthCode = `SELECT c.client_id, c.user_id, c.redirect_uri, c.scope, c.nonce, c.code_challenge,
+		c.code_challenge_method, c.expires_at, c.used_at, c.auth_time, c.amr, u.user_name, u.salted
+		FROM oauth_codes c JOIN users u ON u.id = c.user_id WHERE c.code_hash=$1 FOR UPDATE OF c`
+	queryUseAuthCode       = `UPDATE oauth_codes SET used_at=$1 WHERE code_hash=$2`
+	msgErrorGeneratingCode = "Error generating authorization code"
+	msgErrorConsumingCode  = "Error consuming authorization code"
+)
+
+// ErrAuthCodeInvalid is returned for unknown, expired or already used authorization code
+var ErrAuthCodeInvalid = errors.New("Authorization code is invalid")
+
+// AuthCode is a short-lived single use grant issued to client after user approval
+type AuthCode struct {
+	ClientID    string
+	UserID      string
+	Username    string
+	RedirectURI string
+	Scope       string
+	// Nonce of OpenID Connect authentication request, it is returned in ID token
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	ExpiresAt           time.Time
+	// AuthTime is when user authenticated and AMR are methods used, they are passed to issued tokens.
+	// AuthTime is zero when authentication time of user is not known.
+	AuthTime time.Time
+	AMR      []string
+}
+
+// AuthCodesRepo stores hashes of authorization codes
+type AuthCodesRepo struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewAuthCodesRepo returns AuthCodesRepo with db, issued codes expire after ttl
+func NewAuthCodesRepo(data *sql.DB, ttl time.Duration) *AuthCodesRepo {
+	return &AuthCodesRepo{db: data, ttl: ttl}
+}
+
+// Create stores code and returns its raw value, which is handed to client
+func (cr *AuthCodesRepo) Create(code *AuthCode) (string, error) {
+	raw, hash, err := token.NewOpaque()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorGeneratingCode)
+	}
+
+	now := time.Now()
+	code.ExpiresAt = now.Add(cr.ttl)
+
+	_, err = cr.db.Exec(queryInsertAuthCode, hash, code.ClientID, code.UserID, code.RedirectURI, code.Scope, code.Nonce,
+		code.CodeChallenge, code.CodeChallengeMethod, now, code.ExpiresAt, nullTime(code.AuthTime), strings.Join(code.AMR, " "))
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// Consume marks code as used and returns it. Code can be consumed only once.
+func (cr *AuthCodesRepo) Consume(raw string) (*AuthCode, error) {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		code         AuthCode
+		used         *time.Time
+		authTime     *time.Time
+		amr          string
+		userDisabled bool
+		hash         = token.HashOpaque(raw)
+	)
+
+	err = tx.QueryRow(querySelectAuthCode, hash).Scan(&code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope,
+		&code.Nonce, &code.CodeChallenge, &code.CodeChallengeMethod, &code.ExpiresAt, &used, &authTime, &amr,
+		&code.Username, &userDisabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthCodeInvalid
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorConsumingCode)
+	}
+
+	now := time.Now()
+
+	if used != nil || userDisabled || !now.Before(code.ExpiresAt) {
+		return nil, ErrAuthCodeInvalid
+	}
+
+	code.AuthTime, code.AMR = timeValue(authTime), strings.Fields(amr)
+
+	_, err = tx.Exec(queryUseAuthCode, now, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorConsumingCode)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorConsumingCode)
+	}
+
+	return &code, nil
+}
+
+// nullTime returns nil for zero time, so it is stored as NULL
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+// timeValue returns zero time for NULL column
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
@@ -0,0 +1,121 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lvl484/user-manager/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var authCodeColumns = []string{"client_id", "user_id", "redirect_uri", "scope", "nonce", "code_challenge",
+	"code_challenge_method", "expires_at", "used_at", "auth_time", "amr", "user_name", "salted"}
+
+func TestAuthCodesRepoCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertAuthCode)).
+		WithArgs(sqlmock.AnyArg(), "web", "user-id", "https://app.example.com/cb", "profile", "n-0S6", "challenge", "S256",
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "pwd otp").
+		WillReturnResult(driver.RowsAffected(1))
+
+	code := &AuthCode{
+		ClientID:            "web",
+		UserID:              "user-id",
+		RedirectURI:         "https://app.example.com/cb",
+		Scope:               "profile",
+		Nonce:               "n-0S6",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+		AuthTime:            time.Now(),
+		AMR:                 []string{"pwd", "otp"},
+	}
+
+	raw, err := NewAuthCodesRepo(db, time.Minute).Create(code)
+	require.NoError(t, err)
+	assert.NotEmpty(t, raw)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), code.ExpiresAt, time.Second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthCodesRepoConsume(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expires, authTime := time.Now().Add(time.Minute), time.Now().Add(-time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectAuthCode)).
+		WithArgs(token.HashOpaque("raw")).
+		WillReturnRows(sqlmock.NewRows(authCodeColumns).
+			AddRow("web", "user-id", "https://app.example.com/cb", "profile", "n-0S6", "", "", expires, nil, authTime,
+				"pwd webauthn", "i3odja", false))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseAuthCode)).
+		WithArgs(sqlmock.AnyArg(), token.HashOpaque("raw")).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	code, err := NewAuthCodesRepo(db, time.Minute).Consume("raw")
+	require.NoError(t, err)
+	assert.Equal(t, "i3odja", code.Username)
+	assert.Equal(t, "profile", code.Scope)
+	assert.Equal(t, "n-0S6", code.Nonce)
+	assert.Equal(t, authTime, code.AuthTime)
+	assert.Equal(t, []string{"pwd", "webauthn"}, code.AMR)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthCodesRepoConsumeInvalid(t *testing.T) {
+	expires, expired, used := time.Now().Add(time.Minute), time.Now().Add(-time.Minute), time.Now()
+
+	tests := []struct {
+		name string
+		row  []driver.Value
+	}{
+		{
+			name: "Used",
+			row: []driver.Value{"web", "user-id", "https://app.example.com/cb", "", "", "", "", expires, used, nil, "",
+				"i3odja", false},
+		}, {
+			name: "Expired",
+			row: []driver.Value{"web", "user-id", "https://app.example.com/cb", "", "", "", "", expired, nil, nil, "",
+				"i3odja", false},
+		}, {
+			name: "Disabled user",
+			row: []driver.Value{"web", "user-id", "https://app.example.com/cb", "", "", "", "", expires, nil, nil, "",
+				"i3odja", true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(querySelectAuthCode)).
+				WillReturnRows(sqlmock.NewRows(authCodeColumns).AddRow(tt.row...))
+			mock.ExpectRollback()
+
+			_, err = NewAuthCodesRepo(db, time.Minute).Consume("raw")
+			assert.Equal(t, ErrAuthCodeInvalid, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
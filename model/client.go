@@ -0,0 +1,341 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// clientSecretLength is number of random bytes in generated client secret
+const clientSecretLength = 32
+
+// Grant types clients can be allowed to use
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+	// GrantDeviceCode is device authorization grant (RFC 8628)
+	GrantDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+	// GrantTokenExchange is token exchange (RFC 8693)
+	GrantTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+)
+
+const (
+	queryInsertClient = `INSERT INTO oauth_clients(id, secret_hash, name, redirect_uris, post_logout_redirect_uris,
+		grant_types, scopes, exchange_audiences, impersonation, introspection, created_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) ON CONFLICT (id) DO NOTHING`
+	querySelectClient = `SELECT id, secret_hash, name, redirect_uris, post_logout_redirect_uris, grant_types, scopes,
+		exchange_audiences, impersonation, introspection, created_at FROM oauth_clients WHERE id=$1`
+	querySelectClients = `SELECT id, secret_hash, name, redirect_uris, post_logout_redirect_uris, grant_types, scopes,
+		exchange_audiences, impersonation, introspection, created_at FROM oauth_clients ORDER BY id`
+	queryUpdateClient = `UPDATE oauth_clients SET name=$2, redirect_uris=$3, post_logout_redirect_uris=$4, grant_types=$5,
+		scopes=$6, exchange_audiences=$7, impersonation=$8, introspection=$9 WHERE id=$1`
+	queryUpdateClientSecret   = `UPDATE oauth_clients SET secret_hash=$2 WHERE id=$1 AND secret_hash <> ''`
+	queryDeleteClient         = `DELETE FROM oauth_clients WHERE id=$1`
+	queryRevokeClientTokens   = `UPDATE refresh_tokens SET revoked_at=$2 WHERE client_id=$1 AND revoked_at IS NULL`
+	msgErrorHashingSecret     = "Error hashing client secret"
+	msgErrorGeneratingSecret  = "Error generating client secret"
+	msgErrorReadingClient     = "Error reading client"
+	msgErrorAddingClient      = "Error adding client"
+	msgErrorUpdatingClient    = "Error updating client"
+	msgErrorDeletingClient    = "Error deleting client"
+	msgErrorRevokingClientRTs = "Error revoking refresh tokens of client"
+)
+
+var (
+	// ErrClientNotFound is returned when there is no client with requested id
+	ErrClientNotFound = errors.New("There is no such client")
+	// ErrClientExists is returned when client with the same id is already registered
+	ErrClientExists = errors.New("Client already exists")
+	// ErrClientPublic is returned on secret rotation of client, which has no secret
+	ErrClientPublic = errors.New("Public client has no secret")
+)
+
+// Client is an application registered to obtain tokens on behalf of users or itself
+type Client struct {
+	ID string `json:"client_id"`
+	// SecretHash is argon2 hash of client secret, it is empty for public clients
+	SecretHash   string   `json:"-"`
+	Name         string   `json:"client_name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// PostLogoutRedirectURIs are allowed targets of redirect after RP-initiated logout
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	GrantTypes             []string `json:"grant_types"`
+	Scopes                 []string `json:"scopes"`
+	// ExchangeAudiences are audiences client may request tokens for with token exchange
+	ExchangeAudiences []string `json:"exchange_audiences,omitempty"`
+	// Impersonation allows client to exchange token of administrator for token of other user
+	Impersonation bool `json:"impersonation,omitempty"`
+	// Introspection allows client to introspect access tokens issued to other clients, like resource servers do
+	Introspection bool       `json:"introspection,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+}
+
+// Public reports whether client can not keep a secret, like single page and native applications
+func (c *Client) Public() bool {
+	return c.SecretHash == ""
+}
+
+// AllowsGrant reports whether client is allowed to use grant type
+func (c *Client) AllowsGrant(grant string) bool {
+	return contains(c.GrantTypes, grant)
+}
+
+// AllowsRedirect reports whether redirect URI is registered for client, URIs are compared exactly
+func (c *Client) AllowsRedirect(uri string) bool {
+	return contains(c.RedirectURIs, uri)
+}
+
+// AllowsPostLogoutRedirect reports whether URI is registered for redirect after logout
+func (c *Client) AllowsPostLogoutRedirect(uri string) bool {
+	return contains(c.PostLogoutRedirectURIs, uri)
+}
+
+// AllowsAudience reports whether client may request token for audience with token exchange
+func (c *Client) AllowsAudience(audience string) bool {
+	return contains(c.ExchangeAudiences, audience)
+}
+
+// AllowsIntrospection reports whether client may introspect access token issued to client with clientID
+func (c *Client) AllowsIntrospection(clientID string) bool {
+	return clientID == c.ID || c.Introspection
+}
+
+// VerifySecret returns true if secret matches the one of confidential client
+func (c *Client) VerifySecret(secret string) (bool, error) {
+	if c.Public() || secret == "" {
+		return false, nil
+	}
+
+	return ComparePassword(secret, c.SecretHash)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ClientsRepo stores registered OAuth clients
+type ClientsRepo struct {
+	db *sql.DB
+}
+
+// NewClientsRepo returns ClientsRepo with db
+func NewClientsRepo(data *sql.DB) *ClientsRepo {
+	return &ClientsRepo{db: data}
+}
+
+// NewClientSecret returns random secret for confidential client
+func NewClientSecret() (string, error) {
+	b := make([]byte, clientSecretLength)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorGeneratingSecret)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashClientSecret hashes secret with the same parameters as user passwords
+func hashClientSecret(secret string) (string, error) {
+	hash, err := EncodePassword(NewPasswordConfig(), secret)
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorHashingSecret)
+	}
+
+	return hash, nil
+}
+
+// Add registers client, secret is hashed like user passwords. Empty secret registers public client.
+func (cr *ClientsRepo) Add(client *Client, secret string) error {
+	if secret != "" {
+		hash, err := hashClientSecret(secret)
+		if err != nil {
+			return err
+		}
+
+		client.SecretHash = hash
+	}
+
+	now := time.Now()
+	client.CreatedAt = &now
+
+	res, err := cr.db.Exec(queryInsertClient, client.ID, client.SecretHash, client.Name, pq.Array(client.RedirectURIs),
+		pq.Array(client.PostLogoutRedirectURIs), pq.Array(client.GrantTypes), pq.Array(client.Scopes),
+		pq.Array(client.ExchangeAudiences), client.Impersonation, client.Introspection, now)
+	if err != nil {
+		return errors.Wrap(err, msgErrorAddingClient)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorAddingClient)
+	}
+
+	if n == 0 {
+		return ErrClientExists
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanClient(row scanner) (*Client, error) {
+	var c Client
+
+	err := row.Scan(&c.ID, &c.SecretHash, &c.Name, pq.Array(&c.RedirectURIs), pq.Array(&c.PostLogoutRedirectURIs),
+		pq.Array(&c.GrantTypes), pq.Array(&c.Scopes), pq.Array(&c.ExchangeAudiences), &c.Impersonation, &c.Introspection,
+		&c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// Get returns client by id
+func (cr *ClientsRepo) Get(id string) (*Client, error) {
+	c, err := scanClient(cr.db.QueryRow(querySelectClient, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrClientNotFound
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingClient)
+	}
+
+	return c, nil
+}
+
+// List returns all registered clients ordered by id
+func (cr *ClientsRepo) List() ([]*Client, error) {
+	rows, err := cr.db.Query(querySelectClients)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingClient)
+	}
+	defer rows.Close()
+
+	clients := []*Client{}
+
+	for rows.Next() {
+		c, err := scanClient(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorReadingClient)
+		}
+
+		clients = append(clients, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingClient)
+	}
+
+	return clients, nil
+}
+
+// Update replaces metadata of client, its secret is changed only by RotateSecret
+func (cr *ClientsRepo) Update(client *Client) error {
+	res, err := cr.db.Exec(queryUpdateClient, client.ID, client.Name, pq.Array(client.RedirectURIs),
+		pq.Array(client.PostLogoutRedirectURIs), pq.Array(client.GrantTypes), pq.Array(client.Scopes),
+		pq.Array(client.ExchangeAudiences), client.Impersonation, client.Introspection)
+	if err != nil {
+		return errors.Wrap(err, msgErrorUpdatingClient)
+	}
+
+	return clientAffected(res, msgErrorUpdatingClient)
+}
+
+// RotateSecret replaces secret of confidential client with a new random one and returns it.
+// The old secret stops working immediately.
+func (cr *ClientsRepo) RotateSecret(id string) (string, error) {
+	secret, err := NewClientSecret()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := hashClientSecret(secret)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := cr.db.Exec(queryUpdateClientSecret, id, hash)
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorUpdatingClient)
+	}
+
+	err = clientAffected(res, msgErrorUpdatingClient)
+	if err == ErrClientNotFound {
+		// Secret is not set only for public clients, tell them apart from missing ones
+		if _, err := cr.Get(id); err != nil {
+			return "", err
+		}
+
+		return "", ErrClientPublic
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// Delete removes client and revokes refresh tokens issued to it
+func (cr *ClientsRepo) Delete(id string) error {
+	tx, err := cr.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingClient)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(queryDeleteClient, id)
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingClient)
+	}
+
+	err = clientAffected(res, msgErrorDeletingClient)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(queryRevokeClientTokens, id, time.Now())
+	if err != nil {
+		return errors.Wrap(err, msgErrorRevokingClientRTs)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingClient)
+	}
+
+	return nil
+}
+
+// clientAffected returns ErrClientNotFound when statement has not changed any client
+func clientAffected(res sql.Result, msg string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msg)
+	}
+
+	if n == 0 {
+		return ErrClientNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var clientColumns = []string{"id", "secret_hash", "name", "redirect_uris", "post_logout_redirect_uris", "grant_types",
+	"scopes", "exchange_audiences", "impersonation", "introspection", "created_at"}
+
+func TestClientsRepoAdd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	client := &Client{
+		ID:           "web",
+		Name:         "Web",
+		RedirectURIs: []string{"https://app.example.com/cb"},
+		GrantTypes:   []string{GrantAuthorizationCode},
+		Scopes:       []string{"profile"},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertClient)).
+		WithArgs("web", sqlmock.AnyArg(), "Web", pq.Array(client.RedirectURIs), pq.Array(client.PostLogoutRedirectURIs),
+			pq.Array(client.GrantTypes), pq.Array(client.Scopes), pq.Array(client.ExchangeAudiences), false, false,
+			sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	err = NewClientsRepo(db).Add(client, "secret")
+	require.NoError(t, err)
+	assert.False(t, client.Public())
+
+	ok, err := client.VerifySecret("secret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = client.VerifySecret("other")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertClient)).
+		WillReturnResult(driver.RowsAffected(0))
+
+	err = NewClientsRepo(db).Add(&Client{ID: "web"}, "")
+	assert.Equal(t, ErrClientExists, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClientsRepoGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectClient)).
+		WithArgs("spa").
+		WillReturnRows(sqlmock.NewRows(clientColumns).
+			AddRow("spa", "", "SPA", "{https://spa.example.com/cb}", "{https://spa.example.com/}", "{authorization_code,refresh_token}", "{profile}",
+				"{https://billing.example.com}", false, false, time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectClient)).
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows(clientColumns))
+
+	repo := NewClientsRepo(db)
+
+	client, err := repo.Get("spa")
+	require.NoError(t, err)
+	assert.True(t, client.Public())
+	assert.True(t, client.AllowsRedirect("https://spa.example.com/cb"))
+	assert.False(t, client.AllowsRedirect("https://spa.example.com/cb/"))
+	assert.True(t, client.AllowsPostLogoutRedirect("https://spa.example.com/"))
+	assert.True(t, client.AllowsGrant(GrantRefreshToken))
+	assert.False(t, client.AllowsGrant(GrantClientCredentials))
+	assert.True(t, client.AllowsAudience("https://billing.example.com"))
+	assert.False(t, client.AllowsAudience("https://admin.example.com"))
+
+	ok, err := client.VerifySecret("")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = repo.Get("unknown")
+	assert.Equal(t, ErrClientNotFound, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClientsRepoList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectClients)).
+		WillReturnRows(sqlmock.NewRows(clientColumns).
+			AddRow("billing", "$argon2id$hash", "Billing", "{}", "{}", "{client_credentials}", "{profile}", "{}", false,
+				true, time.Now()).
+			AddRow("spa", "", "SPA", "{https://spa.example.com/cb}", "{}", "{authorization_code}", "{}", "{}", false,
+				false, time.Now()))
+
+	clients, err := NewClientsRepo(db).List()
+	require.NoError(t, err)
+	require.Len(t, clients, 2)
+	assert.Equal(t, "billing", clients[0].ID)
+	assert.False(t, clients[0].Public())
+	assert.True(t, clients[0].AllowsIntrospection("spa"))
+	assert.True(t, clients[1].Public())
+	assert.True(t, clients[1].AllowsIntrospection("spa"))
+	assert.False(t, clients[1].AllowsIntrospection("billing"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClientsRepoUpdate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	client := &Client{
+		ID:           "web",
+		Name:         "Web",
+		RedirectURIs: []string{"https://app.example.com/cb"},
+		GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken},
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(queryUpdateClient)).
+		WithArgs("web", "Web", pq.Array(client.RedirectURIs), pq.Array(client.PostLogoutRedirectURIs),
+			pq.Array(client.GrantTypes), pq.Array(client.Scopes), pq.Array(client.ExchangeAudiences), false, false).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryUpdateClient)).
+		WillReturnResult(driver.RowsAffected(0))
+
+	repo := NewClientsRepo(db)
+
+	require.NoError(t, repo.Update(client))
+	assert.Equal(t, ErrClientNotFound, repo.Update(&Client{ID: "unknown"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClientsRepoRotateSecret(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	var hash string
+
+	mock.ExpectExec(regexp.QuoteMeta(queryUpdateClientSecret)).
+		WithArgs("billing", hashArg{&hash}).
+		WillReturnResult(driver.RowsAffected(1))
+
+	repo := NewClientsRepo(db)
+
+	secret, err := repo.RotateSecret("billing")
+	require.NoError(t, err)
+	assert.NotEmpty(t, secret)
+
+	ok, err := (&Client{SecretHash: hash}).VerifySecret(secret)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Public and unknown clients are told apart
+	mock.ExpectExec(regexp.QuoteMeta(queryUpdateClientSecret)).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectClient)).
+		WithArgs("spa").
+		WillReturnRows(sqlmock.NewRows(clientColumns).
+			AddRow("spa", "", "SPA", "{}", "{}", "{authorization_code}", "{}", "{}", false, false, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(queryUpdateClientSecret)).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectClient)).
+		WithArgs("unknown").
+		WillReturnRows(sqlmock.NewRows(clientColumns))
+
+	_, err = repo.RotateSecret("spa")
+	assert.Equal(t, ErrClientPublic, err)
+
+	_, err = repo.RotateSecret("unknown")
+	assert.Equal(t, ErrClientNotFound, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestClientsRepoDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteClient)).
+		WithArgs("web").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeClientTokens)).
+		WithArgs("web", sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(3))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteClient)).
+		WithArgs("unknown").
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectRollback()
+
+	repo := NewClientsRepo(db)
+
+	require.NoError(t, repo.Delete("web"))
+	assert.Equal(t, ErrClientNotFound, repo.Delete("unknown"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// hashArg captures secret hash passed to the query
+type hashArg struct {
+	hash *string
+}
+
+func (a hashArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*a.hash = s
+
+	return ok && s != ""
+}
@@ -0,0 +1,97 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	querySelectConsent = `SELECT scopes FROM oauth_consents WHERE user_id=$1 AND client_id=$2`
+	queryUpsertConsent = `INSERT INTO oauth_consents(user_id, client_id, scopes, granted_at) VALUES ($1,$2,$3,$4)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes=EXCLUDED.scopes, granted_at=EXCLUDED.granted_at`
+	queryInsertConsentRequest         = `INSERT INTO oauth_consent_requests(id, user_id, expires_at) VALUES ($1,$2,$3)`
+	queryDeleteExpiredConsentRequests = `DELETE FROM oauth_consent_requests WHERE expires_at <= $1`
+	// Request ids come from consent form, they are compared as text so malformed ids are not found instead of failing
+	queryConsumeConsentRequest = `DELETE FROM oauth_consent_requests WHERE id::text=$1 AND user_id=$2
+		AND expires_at > $3`
+
+	msgErrorCreatingConsentRequest  = "Error creating consent request"
+	msgErrorConsumingConsentRequest = "Error consuming consent request"
+)
+
+// ErrConsentRequestInvalid is returned for unknown, expired or already decided consent request
+var ErrConsentRequestInvalid = errors.New("Consent request is invalid")
+
+// ConsentsRepo stores scopes users granted to clients, so they are not asked again
+type ConsentsRepo struct {
+	db *sql.DB
+}
+
+// NewConsentsRepo returns ConsentsRepo with db
+func NewConsentsRepo(data *sql.DB) *ConsentsRepo {
+	return &ConsentsRepo{db: data}
+}
+
+// Get returns scopes user granted to client, nil when user has not granted anything yet
+func (cr *ConsentsRepo) Get(userID, clientID string) ([]string, error) {
+	var scopes []string
+
+	err := cr.db.QueryRow(querySelectConsent, userID, clientID).Scan(pq.Array(&scopes))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return scopes, err
+}
+
+// Grant records scopes user granted to client, replacing previous consent
+func (cr *ConsentsRepo) Grant(userID, clientID string, scopes []string) error {
+	_, err := cr.db.Exec(queryUpsertConsent, userID, clientID, pq.Array(scopes), time.Now())
+
+	return err
+}
+
+// CreateRequest records consent page shown to user and returns its id, user has to decide before expiresAt
+func (cr *ConsentsRepo) CreateRequest(userID string, expiresAt time.Time) (string, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorCreatingConsentRequest)
+	}
+
+	_, err = cr.db.Exec(queryDeleteExpiredConsentRequests, time.Now())
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorCreatingConsentRequest)
+	}
+
+	_, err = cr.db.Exec(queryInsertConsentRequest, id.String(), userID, expiresAt)
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorCreatingConsentRequest)
+	}
+
+	return id.String(), nil
+}
+
+// ConsumeRequest removes consent request of user, so decision on consent page is accepted only once
+func (cr *ConsentsRepo) ConsumeRequest(id, userID string) error {
+	res, err := cr.db.Exec(queryConsumeConsentRequest, id, userID, time.Now())
+	if err != nil {
+		return errors.Wrap(err, msgErrorConsumingConsentRequest)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorConsumingConsentRequest)
+	}
+
+	if n == 0 {
+		return ErrConsentRequestInvalid
+	}
+
+	return nil
+}
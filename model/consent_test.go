@@ -0,0 +1,80 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsentsRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectConsent)).
+		WithArgs("user-id", "web").
+		WillReturnRows(sqlmock.NewRows([]string{"scopes"}))
+	mock.ExpectExec(regexp.QuoteMeta(queryUpsertConsent)).
+		WithArgs("user-id", "web", pq.Array([]string{"profile"}), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectConsent)).
+		WithArgs("user-id", "web").
+		WillReturnRows(sqlmock.NewRows([]string{"scopes"}).AddRow("{profile}"))
+
+	repo := NewConsentsRepo(db)
+
+	scopes, err := repo.Get("user-id", "web")
+	require.NoError(t, err)
+	assert.Nil(t, scopes)
+
+	require.NoError(t, repo.Grant("user-id", "web", []string{"profile"}))
+
+	scopes, err = repo.Get("user-id", "web")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"profile"}, scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConsentsRepoRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expiresAt := time.Now().Add(10 * time.Minute)
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteExpiredConsentRequests)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertConsentRequest)).
+		WithArgs(sqlmock.AnyArg(), "user-id", expiresAt).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryConsumeConsentRequest)).
+		WithArgs(sqlmock.AnyArg(), "user-id", sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	// Decided request can not be used again
+	mock.ExpectExec(regexp.QuoteMeta(queryConsumeConsentRequest)).
+		WithArgs(sqlmock.AnyArg(), "user-id", sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+
+	repo := NewConsentsRepo(db)
+
+	id, err := repo.CreateRequest("user-id", expiresAt)
+	require.NoError(t, err)
+	assert.NotEmpty(t, id)
+
+	require.NoError(t, repo.ConsumeRequest(id, "user-id"))
+	assert.Equal(t, ErrConsentRequestInvalid, repo.ConsumeRequest(id, "user-id"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
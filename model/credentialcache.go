@@ -0,0 +1,208 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"expvar"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+const (
+	credentialCacheKeyLength = 32
+	// credentialGenerations is the number of generation counters logins are spread over
+	credentialGenerations = 1024
+	// MaxCredentialCacheTTL bounds how long other replicas may accept password which was changed
+	MaxCredentialCacheTTL = 5 * time.Minute
+)
+
+// Metrics of credential cache published by expvar
+var (
+	credentialMetrics = expvar.NewMap("credential_cache")
+	credentialCached  = new(expvar.Int)
+)
+
+func init() {
+	credentialMetrics.Set("size", credentialCached)
+}
+
+// CredentialCache remembers successful password verifications for a short time, so repeated requests
+// with the same Basic credentials do not load the user and run argon2 again. Entries are keyed by HMAC
+// of login and password with a random key of the process, plaintext passwords are never kept.
+// Cache is local to the process, other replicas forget changed passwords only when entries expire,
+// so TTL can not exceed MaxCredentialCacheTTL.
+type CredentialCache struct {
+	ttl     time.Duration
+	maxSize int
+	key     []byte
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// order has entries from the oldest, they expire in the same order
+	order *list.List
+	// generations are incremented when users are invalidated, verification which started before
+	// invalidation of its user is not cached. Logins share counters, collision only skips caching.
+	generations [credentialGenerations]uint64
+}
+
+type credentialEntry struct {
+	key       string
+	login     string
+	user      *User
+	expiresAt time.Time
+}
+
+// NewCredentialCache returns cache keeping up to maxSize verifications for ttl, 0 ttl disables it
+func NewCredentialCache(ttl time.Duration, maxSize int) (*CredentialCache, error) {
+	if ttl > MaxCredentialCacheTTL {
+		return nil, fmt.Errorf("credential cache TTL %s exceeds %s", ttl, MaxCredentialCacheTTL)
+	}
+
+	key := make([]byte, credentialCacheKeyLength)
+
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		key:     key,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}, nil
+}
+
+func (c *CredentialCache) enabled() bool {
+	return c.ttl > 0 && c.maxSize > 0
+}
+
+// entryKey returns keyed hash of credentials
+func (c *CredentialCache) entryKey(login, password string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(login))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+
+	return string(mac.Sum(nil))
+}
+
+// generation returns index of generation counter of login
+func generation(login string) int {
+	h := fnv.New32a()
+	h.Write([]byte(login))
+
+	return int(h.Sum32() % credentialGenerations)
+}
+
+// Generation returns generation of login, it must be read before user is loaded and password is verified,
+// and passed to Put
+func (c *CredentialCache) Generation(login string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.generations[generation(login)]
+}
+
+// Get returns copy of user whose login and password were verified recently
+func (c *CredentialCache) Get(login, password string) (*User, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+
+	key := c.entryKey(login, password)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		credentialMetrics.Add("misses", 1)
+		return nil, false
+	}
+
+	e := el.Value.(*credentialEntry)
+	if !c.now().Before(e.expiresAt) {
+		c.remove(el)
+		credentialMetrics.Add("misses", 1)
+
+		return nil, false
+	}
+
+	credentialMetrics.Add("hits", 1)
+
+	u := *e.user
+
+	return &u, true
+}
+
+// Put remembers that password of user was verified, the oldest entry is evicted when cache is full.
+// Verification is not remembered when user was invalidated since gen was read with Generation,
+// password it checked may not be valid anymore.
+func (c *CredentialCache) Put(login, password string, user *User, gen uint64) {
+	if !c.enabled() {
+		return
+	}
+
+	key := c.entryKey(login, password)
+	u := *user
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generations[generation(login)] != gen {
+		return
+	}
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	for c.order.Len() >= c.maxSize {
+		c.remove(c.order.Front())
+		credentialMetrics.Add("evictions", 1)
+	}
+
+	c.entries[key] = c.order.PushBack(&credentialEntry{
+		key:       key,
+		login:     login,
+		user:      &u,
+		expiresAt: c.now().Add(c.ttl),
+	})
+	credentialCached.Set(int64(c.order.Len()))
+}
+
+// InvalidateUser forgets verifications of user, when password changes or user is disabled or deleted
+func (c *CredentialCache) InvalidateUser(login string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generations[generation(login)]++
+
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+
+		if el.Value.(*credentialEntry).login == login {
+			c.remove(el)
+			credentialMetrics.Add("invalidations", 1)
+		}
+
+		el = next
+	}
+}
+
+// remove drops entry, c.mu must be held
+func (c *CredentialCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*credentialEntry).key)
+	credentialCached.Set(int64(c.order.Len()))
+}
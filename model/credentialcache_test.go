@@ -0,0 +1,109 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialCache(t *testing.T) {
+	now := time.Now()
+
+	c, err := NewCredentialCache(time.Minute, 10)
+	require.NoError(t, err)
+	c.now = func() time.Time { return now }
+
+	user := &User{ID: "1", Username: "i3odja"}
+	c.Put("i3odja", "secret", user, c.Generation("i3odja"))
+
+	got, ok := c.Get("i3odja", "secret")
+	require.True(t, ok)
+	assert.Equal(t, user, got)
+	assert.False(t, got == user, "cached user is a copy")
+
+	_, ok = c.Get("i3odja", "wrong")
+	assert.False(t, ok)
+	_, ok = c.Get("other", "secret")
+	assert.False(t, ok)
+
+	// Neither login nor password is kept in plaintext key
+	for key := range c.entries {
+		assert.False(t, strings.Contains(key, "secret"))
+		assert.False(t, strings.Contains(key, "i3odja"))
+	}
+
+	now = now.Add(time.Minute)
+
+	_, ok = c.Get("i3odja", "secret")
+	assert.False(t, ok)
+	assert.Empty(t, c.entries)
+}
+
+func TestCredentialCacheBounded(t *testing.T) {
+	c, err := NewCredentialCache(time.Minute, 2)
+	require.NoError(t, err)
+
+	c.Put("a", "1", &User{Username: "a"}, c.Generation("a"))
+	c.Put("b", "2", &User{Username: "b"}, c.Generation("b"))
+	c.Put("c", "3", &User{Username: "c"}, c.Generation("c"))
+
+	// The oldest entry is evicted
+	_, ok := c.Get("a", "1")
+	assert.False(t, ok)
+	_, ok = c.Get("b", "2")
+	assert.True(t, ok)
+	_, ok = c.Get("c", "3")
+	assert.True(t, ok)
+
+	c.InvalidateUser("b")
+
+	_, ok = c.Get("b", "2")
+	assert.False(t, ok)
+	assert.Equal(t, 1, c.order.Len())
+}
+
+func TestCredentialCacheInvalidatedDuringVerification(t *testing.T) {
+	c, err := NewCredentialCache(time.Minute, 10)
+	require.NoError(t, err)
+
+	// Login read generation and verified the old password, then the password was changed
+	gen := c.Generation("i3odja")
+	other := c.Generation("other")
+	c.InvalidateUser("i3odja")
+	c.Put("i3odja", "old", &User{Username: "i3odja"}, gen)
+
+	_, ok := c.Get("i3odja", "old")
+	assert.False(t, ok)
+
+	// Verifications of other users are still cached
+	c.Put("other", "1", &User{Username: "other"}, other)
+
+	_, ok = c.Get("other", "1")
+	assert.True(t, ok)
+
+	// Login which started after invalidation is cached
+	c.Put("i3odja", "new", &User{Username: "i3odja"}, c.Generation("i3odja"))
+
+	_, ok = c.Get("i3odja", "new")
+	assert.True(t, ok)
+}
+
+func TestCredentialCacheMaxTTL(t *testing.T) {
+	_, err := NewCredentialCache(MaxCredentialCacheTTL+time.Second, 10)
+	assert.Error(t, err)
+}
+
+func TestCredentialCacheDisabled(t *testing.T) {
+	c, err := NewCredentialCache(0, 10)
+	require.NoError(t, err)
+
+	c.Put("a", "1", &User{Username: "a"}, c.Generation("a"))
+
+	_, ok := c.Get("a", "1")
+	assert.False(t, ok)
+}
@@ -0,0 +1,255 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/token"
+	"github.com/pkg/errors"
+)
+
+// States of device code
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+	DeviceCodeUsed     = "used"
+)
+
+const (
+	queryDeleteExpiredDeviceCodes = `DELETE FROM oauth_device_codes WHERE expires_at < $1`
+	queryInsertDeviceCode         = `INSERT INTO oauth_device_codes(device_code_hash, user_code, client_id, scope, status,
+		poll_interval, created_at, expires_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT DO NOTHING`
+	querySelectUserCode = `SELECT client_id, scope, status, expires_at FROM oauth_device_codes WHERE user_code=$1`
+	queryDecideUserCode = `UPDATE oauth_device_codes SET status=$1, user_id=$2, auth_time=$3, amr=$4
+		WHERE user_code=$5 AND status=$6 AND expires_at > $7`
+	querySelectDeviceCode = `SELECT d.client_id, d.scope, d.user_code, d.status, d.user_id, d.poll_interval, d.polled_at,
+		d.expires_at, d.auth_time, d.amr, u.user_name, u.salted
+		FROM oauth_device_codes d LEFT JOIN users u ON u.id = d.user_id WHERE d.device_code_hash=$1 FOR UPDATE OF d`
+	queryPollDeviceCode = `UPDATE oauth_device_codes SET status=$1, poll_interval=$2, polled_at=$3
+		WHERE device_code_hash=$4`
+	msgErrorGeneratingDeviceCode = "Error generating device code"
+	msgErrorPollingDeviceCode    = "Error polling device code"
+	// userCodeAttempts is how many times new user code is generated when it collides with existing one
+	userCodeAttempts = 3
+	// slowDownStep is added to polling interval of device polling too often (RFC 8628 section 3.5)
+	slowDownStep = 5 * time.Second
+)
+
+var (
+	// ErrDeviceCodeInvalid is returned for unknown or already used device code and for unknown user code
+	ErrDeviceCodeInvalid = errors.New("Device code is invalid")
+	// ErrDeviceCodeExpired is returned when device code expired before user approved it
+	ErrDeviceCodeExpired = errors.New("Device code is expired")
+	// ErrDeviceCodePending is returned while user has not decided yet
+	ErrDeviceCodePending = errors.New("Device authorization is pending")
+	// ErrDeviceCodeDenied is returned when user denied authorization
+	ErrDeviceCodeDenied = errors.New("Device authorization is denied")
+	// ErrDeviceSlowDown is returned when device polls more often than allowed
+	ErrDeviceSlowDown = errors.New("Device polls too often")
+)
+
+// DeviceCode is device authorization request (RFC 8628) waiting for user to approve it on other device
+type DeviceCode struct {
+	ClientID string
+	Scope    string
+	// UserCode is normalized code user enters on verification page
+	UserCode string
+	Status   string
+	UserID   string
+	Username string
+	// Interval is minimal time between two polls of device
+	Interval  time.Duration
+	ExpiresAt time.Time
+	// AuthTime is when user who approved the request authenticated and AMR are methods used,
+	// they are passed to issued tokens. AuthTime is zero when authentication time is not known.
+	AuthTime time.Time
+	AMR      []string
+}
+
+// DeviceCodesRepo stores device authorization requests
+type DeviceCodesRepo struct {
+	db       *sql.DB
+	ttl      time.Duration
+	interval time.Duration
+}
+
+// NewDeviceCodesRepo returns DeviceCodesRepo with db, codes expire after ttl and are polled not more often than interval
+func NewDeviceCodesRepo(data *sql.DB, ttl, interval time.Duration) *DeviceCodesRepo {
+	return &DeviceCodesRepo{db: data, ttl: ttl, interval: interval}
+}
+
+// Create stores new device authorization request of client and returns raw device code
+func (dr *DeviceCodesRepo) Create(clientID, scope string) (string, *DeviceCode, error) {
+	now := time.Now()
+
+	// Expired codes are removed, so their user codes can be issued again
+	_, err := dr.db.Exec(queryDeleteExpiredDeviceCodes, now)
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorGeneratingDeviceCode)
+	}
+
+	code := &DeviceCode{
+		ClientID:  clientID,
+		Scope:     scope,
+		Status:    DeviceCodePending,
+		Interval:  dr.interval,
+		ExpiresAt: now.Add(dr.ttl),
+	}
+
+	for i := 0; i < userCodeAttempts; i++ {
+		raw, hash, err := token.NewOpaque()
+		if err != nil {
+			return "", nil, errors.Wrap(err, msgErrorGeneratingDeviceCode)
+		}
+
+		code.UserCode, err = oauth.NewUserCode()
+		if err != nil {
+			return "", nil, errors.Wrap(err, msgErrorGeneratingDeviceCode)
+		}
+
+		res, err := dr.db.Exec(queryInsertDeviceCode, hash, code.UserCode, clientID, scope, code.Status,
+			int(dr.interval.Seconds()), now, code.ExpiresAt)
+		if err != nil {
+			return "", nil, errors.Wrap(err, msgErrorGeneratingDeviceCode)
+		}
+
+		inserted, err := res.RowsAffected()
+		if err != nil {
+			return "", nil, errors.Wrap(err, msgErrorGeneratingDeviceCode)
+		}
+
+		if inserted == 1 {
+			return raw, code, nil
+		}
+	}
+
+	return "", nil, errors.New(msgErrorGeneratingDeviceCode + ": user code collision")
+}
+
+// Find returns pending device authorization request by normalized user code
+func (dr *DeviceCodesRepo) Find(userCode string) (*DeviceCode, error) {
+	code := DeviceCode{UserCode: userCode}
+
+	err := dr.db.QueryRow(querySelectUserCode, userCode).Scan(&code.ClientID, &code.Scope, &code.Status, &code.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeviceCodeInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if code.Status != DeviceCodePending || !time.Now().Before(code.ExpiresAt) {
+		return nil, ErrDeviceCodeInvalid
+	}
+
+	return &code, nil
+}
+
+// Decide records decision of user, who authenticated at authTime with amr methods,
+// on pending device authorization request
+func (dr *DeviceCodesRepo) Decide(userCode, userID string, approve bool, authTime time.Time, amr []string) error {
+	status := DeviceCodeDenied
+	if approve {
+		status = DeviceCodeApproved
+	}
+
+	res, err := dr.db.Exec(queryDecideUserCode, status, userID, nullTime(authTime), strings.Join(amr, " "), userCode,
+		DeviceCodePending, time.Now())
+	if err != nil {
+		return err
+	}
+
+	decided, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if decided == 0 {
+		return ErrDeviceCodeInvalid
+	}
+
+	return nil
+}
+
+// Poll returns approved device authorization request of client and marks it used.
+// Until user approves the request an error describing its state is returned.
+func (dr *DeviceCodesRepo) Poll(raw, clientID string) (*DeviceCode, error) {
+	tx, err := dr.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		code         DeviceCode
+		userID       sql.NullString
+		username     sql.NullString
+		userDisabled sql.NullBool
+		interval     int
+		polled       *time.Time
+		authTime     *time.Time
+		amr          string
+		hash         = token.HashOpaque(raw)
+	)
+
+	err = tx.QueryRow(querySelectDeviceCode, hash).Scan(&code.ClientID, &code.Scope, &code.UserCode, &code.Status,
+		&userID, &interval, &polled, &code.ExpiresAt, &authTime, &amr, &username, &userDisabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrDeviceCodeInvalid
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorPollingDeviceCode)
+	}
+
+	now := time.Now()
+
+	switch {
+	case code.ClientID != clientID || code.Status == DeviceCodeUsed:
+		return nil, ErrDeviceCodeInvalid
+	case !now.Before(code.ExpiresAt):
+		return nil, ErrDeviceCodeExpired
+	}
+
+	code.UserID, code.Username, code.Interval = userID.String, username.String, time.Duration(interval)*time.Second
+	code.AuthTime, code.AMR = timeValue(authTime), strings.Fields(amr)
+
+	var pollErr error
+
+	switch {
+	case polled != nil && now.Sub(*polled) < code.Interval:
+		code.Interval += slowDownStep
+		pollErr = ErrDeviceSlowDown
+	case code.Status == DeviceCodePending:
+		pollErr = ErrDeviceCodePending
+	case code.Status == DeviceCodeDenied:
+		pollErr = ErrDeviceCodeDenied
+	case userDisabled.Bool:
+		code.Status = DeviceCodeUsed
+		pollErr = ErrDeviceCodeInvalid
+	default:
+		code.Status = DeviceCodeUsed
+	}
+
+	_, err = tx.Exec(queryPollDeviceCode, code.Status, int(code.Interval.Seconds()), now, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorPollingDeviceCode)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorPollingDeviceCode)
+	}
+
+	if pollErr != nil {
+		return nil, pollErr
+	}
+
+	return &code, nil
+}
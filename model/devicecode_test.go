@@ -0,0 +1,198 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lvl484/user-manager/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var deviceCodeColumns = []string{"client_id", "scope", "user_code", "status", "user_id", "poll_interval", "polled_at",
+	"expires_at", "auth_time", "amr", "user_name", "salted"}
+
+func TestDeviceCodesRepoCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteExpiredDeviceCodes)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	// First user code collides with existing one
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertDeviceCode)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "cli", "profile", DeviceCodePending, 5, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertDeviceCode)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "cli", "profile", DeviceCodePending, 5, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	raw, code, err := NewDeviceCodesRepo(db, 10*time.Minute, 5*time.Second).Create("cli", "profile")
+	require.NoError(t, err)
+	assert.NotEmpty(t, raw)
+	assert.Len(t, code.UserCode, 8)
+	assert.Equal(t, 5*time.Second, code.Interval)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), code.ExpiresAt, time.Second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeviceCodesRepoFind(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"client_id", "scope", "status", "expires_at"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectUserCode)).
+		WithArgs("BCDFGHJK").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("cli", "profile", DeviceCodePending, time.Now().Add(time.Minute)))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectUserCode)).
+		WithArgs("BCDFGHJK").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("cli", "profile", DeviceCodeApproved, time.Now().Add(time.Minute)))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectUserCode)).
+		WithArgs("BCDFGHJK").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	dr := NewDeviceCodesRepo(db, time.Minute, time.Second)
+
+	code, err := dr.Find("BCDFGHJK")
+	require.NoError(t, err)
+	assert.Equal(t, "cli", code.ClientID)
+
+	_, err = dr.Find("BCDFGHJK")
+	assert.Equal(t, ErrDeviceCodeInvalid, err)
+
+	_, err = dr.Find("BCDFGHJK")
+	assert.Equal(t, ErrDeviceCodeInvalid, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeviceCodesRepoDecide(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	authTime := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDecideUserCode)).
+		WithArgs(DeviceCodeApproved, "user-id", authTime, "pwd", "BCDFGHJK", DeviceCodePending, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDecideUserCode)).
+		WithArgs(DeviceCodeDenied, "user-id", authTime, "pwd", "BCDFGHJK", DeviceCodePending, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+
+	dr := NewDeviceCodesRepo(db, time.Minute, time.Second)
+
+	assert.NoError(t, dr.Decide("BCDFGHJK", "user-id", true, authTime, []string{"pwd"}))
+	assert.Equal(t, ErrDeviceCodeInvalid, dr.Decide("BCDFGHJK", "user-id", false, authTime, []string{"pwd"}))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeviceCodesRepoPoll(t *testing.T) {
+	var (
+		expires  = time.Now().Add(time.Minute)
+		expired  = time.Now().Add(-time.Minute)
+		recently = time.Now()
+		earlier  = time.Now().Add(-time.Minute)
+	)
+
+	tests := []struct {
+		name     string
+		row      []driver.Value
+		status   string
+		interval int
+		err      error
+	}{
+		{
+			name:     "Approved",
+			row:      []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodeApproved, "user-id", 5, earlier, expires, earlier, "pwd otp", "i3odja", false},
+			status:   DeviceCodeUsed,
+			interval: 5,
+		}, {
+			name:     "Pending",
+			row:      []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodePending, nil, 5, nil, expires, nil, "", nil, nil},
+			status:   DeviceCodePending,
+			interval: 5,
+			err:      ErrDeviceCodePending,
+		}, {
+			name:     "SlowDown",
+			row:      []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodePending, nil, 5, recently, expires, nil, "", nil, nil},
+			status:   DeviceCodePending,
+			interval: 10,
+			err:      ErrDeviceSlowDown,
+		}, {
+			name:     "Denied",
+			row:      []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodeDenied, "user-id", 5, earlier, expires, nil, "", "i3odja", false},
+			status:   DeviceCodeDenied,
+			interval: 5,
+			err:      ErrDeviceCodeDenied,
+		}, {
+			name:     "UserDisabled",
+			row:      []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodeApproved, "user-id", 5, earlier, expires, nil, "", "i3odja", true},
+			status:   DeviceCodeUsed,
+			interval: 5,
+			err:      ErrDeviceCodeInvalid,
+		}, {
+			name: "Expired",
+			row:  []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodeApproved, "user-id", 5, earlier, expired, nil, "", "i3odja", false},
+			err:  ErrDeviceCodeExpired,
+		}, {
+			name: "Used",
+			row:  []driver.Value{"cli", "profile", "BCDFGHJK", DeviceCodeUsed, "user-id", 5, earlier, expires, nil, "", "i3odja", false},
+			err:  ErrDeviceCodeInvalid,
+		}, {
+			name: "OtherClient",
+			row:  []driver.Value{"web", "profile", "BCDFGHJK", DeviceCodeApproved, "user-id", 5, earlier, expires, nil, "", "i3odja", false},
+			err:  ErrDeviceCodeInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(querySelectDeviceCode)).
+				WithArgs(token.HashOpaque("raw")).
+				WillReturnRows(sqlmock.NewRows(deviceCodeColumns).AddRow(tt.row...))
+
+			if tt.status != "" {
+				mock.ExpectExec(regexp.QuoteMeta(queryPollDeviceCode)).
+					WithArgs(tt.status, tt.interval, sqlmock.AnyArg(), token.HashOpaque("raw")).
+					WillReturnResult(driver.RowsAffected(1))
+				mock.ExpectCommit()
+			} else {
+				mock.ExpectRollback()
+			}
+
+			code, err := NewDeviceCodesRepo(db, time.Minute, 5*time.Second).Poll("raw", "cli")
+			assert.Equal(t, tt.err, err)
+
+			if tt.err == nil {
+				require.NotNil(t, code)
+				assert.Equal(t, "i3odja", code.Username)
+				assert.Equal(t, "user-id", code.UserID)
+				assert.Equal(t, earlier, code.AuthTime)
+				assert.Equal(t, []string{"pwd", "otp"}, code.AMR)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Upper bounds of parameters of verified hashes, hash above them would stall the server
+const (
+	maxHashMemory    = 1024 * 1024
+	maxBcryptCost    = 16
+	maxPBKDF2Rounds  = 5000000
+	maxScryptLogN    = 20
+	maxScryptBlocks  = 32
+	maxScryptThreads = 16
+	minHashKeyLength = 16
+)
+
+var (
+	// ErrUnknownHashFormat is returned when password hash has no registered format
+	ErrUnknownHashFormat = errors.New("Unknown format of password hash")
+	// ErrMalformedHash is returned when password hash can not be decoded or its parameters are out of bounds
+	ErrMalformedHash = errors.New("Malformed password hash")
+)
+
+// PasswordHasher verifies passwords against hashes of one format
+type PasswordHasher interface {
+	Verify(password, hash string) (bool, error)
+}
+
+// PasswordHasherFunc is function used as PasswordHasher
+type PasswordHasherFunc func(password, hash string) (bool, error)
+
+// Verify returns f(password, hash)
+func (f PasswordHasherFunc) Verify(password, hash string) (bool, error) {
+	return f(password, hash)
+}
+
+// passwordHashers are registered hashers by prefix of their hashes
+var passwordHashers = make(map[string]PasswordHasher)
+
+func init() {
+	RegisterPasswordHasher(argon2idPrefix, PasswordHasherFunc(compareArgon2id))
+
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		RegisterPasswordHasher(prefix, PasswordHasherFunc(compareBcrypt))
+	}
+
+	RegisterPasswordHasher("$scrypt$", PasswordHasherFunc(compareScrypt))
+	RegisterPasswordHasher("$pbkdf2-sha256$", PasswordHasherFunc(comparePBKDF2))
+	RegisterPasswordHasher("pbkdf2_sha256$", PasswordHasherFunc(compareDjangoPBKDF2))
+	RegisterPasswordHasher("{SSHA}", saltedSHA(sha1.New))
+	RegisterPasswordHasher("{SSHA256}", saltedSHA(sha256.New))
+	RegisterPasswordHasher("{SSHA512}", saltedSHA(sha512.New))
+}
+
+// RegisterPasswordHasher makes hashes starting with prefix verified by h, it must be called
+// before passwords are compared. Hashes are upgraded to argon2id after successful login.
+func RegisterPasswordHasher(prefix string, h PasswordHasher) {
+	passwordHashers[prefix] = h
+}
+
+// passwordHasher returns hasher registered with the longest prefix of hash
+func passwordHasher(hash string) (PasswordHasher, bool) {
+	var found PasswordHasher
+	longest := 0
+
+	for prefix, h := range passwordHashers {
+		if len(prefix) > longest && strings.HasPrefix(hash, prefix) {
+			found, longest = h, len(prefix)
+		}
+	}
+
+	return found, found != nil
+}
+
+func malformedHash(format string) error {
+	return errors.Wrap(ErrMalformedHash, format)
+}
+
+// decodeAB64 decodes adapted base64 of passlib, which has '.' instead of '+' and no padding
+func decodeAB64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.Replace(s, ".", "+", -1))
+}
+
+// compareBcrypt returns true if password matches bcrypt hash
+func compareBcrypt(password, hash string) (bool, error) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil || cost > maxBcryptCost {
+		return false, malformedHash("bcrypt")
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+
+	switch err {
+	case nil:
+		return true, nil
+	case bcrypt.ErrMismatchedHashAndPassword:
+		return false, nil
+	default:
+		return false, malformedHash("bcrypt")
+	}
+}
+
+// compareScrypt returns true if password matches scrypt hash of passlib $scrypt$ln=N,r=R,p=P$salt$key
+func compareScrypt(password, hash string) (bool, error) {
+	parts := strings.Split(hash, hashSplit)
+	if len(parts) != 5 {
+		return false, malformedHash("scrypt")
+	}
+
+	var logN, r, p uint
+	_, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &logN, &r, &p)
+
+	// scrypt uses 128*r*N bytes of memory
+	if err != nil || logN < 1 || logN > maxScryptLogN || r < 1 || r > maxScryptBlocks ||
+		p < 1 || p > maxScryptThreads || 128*r<<logN/1024 > maxHashMemory {
+		return false, malformedHash("scrypt")
+	}
+
+	salt, err := decodeAB64(parts[3])
+	if err != nil {
+		return false, malformedHash("scrypt")
+	}
+
+	key, err := decodeAB64(parts[4])
+	if err != nil || len(key) < minHashKeyLength {
+		return false, malformedHash("scrypt")
+	}
+
+	release, err := hashPool.acquire(uint32(128 * r << logN / 1024))
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	derived, err := scrypt.Key([]byte(password), salt, 1<<logN, int(r), int(p), len(key))
+	if err != nil {
+		return false, malformedHash("scrypt")
+	}
+
+	return subtle.ConstantTimeCompare(key, derived) == 1, nil
+}
+
+// comparePBKDF2 returns true if password matches PBKDF2-SHA256 hash of passlib $pbkdf2-sha256$rounds$salt$key
+func comparePBKDF2(password, hash string) (bool, error) {
+	parts := strings.Split(hash, hashSplit)
+	if len(parts) != 5 {
+		return false, malformedHash("pbkdf2-sha256")
+	}
+
+	salt, err := decodeAB64(parts[3])
+	if err != nil {
+		return false, malformedHash("pbkdf2-sha256")
+	}
+
+	key, err := decodeAB64(parts[4])
+	if err != nil {
+		return false, malformedHash("pbkdf2-sha256")
+	}
+
+	return verifyPBKDF2(password, parts[2], salt, key)
+}
+
+// compareDjangoPBKDF2 returns true if password matches PBKDF2-SHA256 hash of Django pbkdf2_sha256$rounds$salt$key
+func compareDjangoPBKDF2(password, hash string) (bool, error) {
+	parts := strings.Split(hash, hashSplit)
+	if len(parts) != 4 {
+		return false, malformedHash("pbkdf2_sha256")
+	}
+
+	key, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, malformedHash("pbkdf2_sha256")
+	}
+
+	// Django uses salt as it is
+	return verifyPBKDF2(password, parts[1], []byte(parts[2]), key)
+}
+
+// verifyPBKDF2 returns true if password derives key with salt in rounds iterations of PBKDF2-SHA256
+func verifyPBKDF2(password, rounds string, salt, key []byte) (bool, error) {
+	iterations, err := strconv.Atoi(rounds)
+	if err != nil || iterations < 1 || iterations > maxPBKDF2Rounds || len(key) < minHashKeyLength {
+		return false, malformedHash("pbkdf2-sha256")
+	}
+
+	derived := pbkdf2.Key([]byte(password), salt, iterations, len(key), sha256.New)
+
+	return subtle.ConstantTimeCompare(key, derived) == 1, nil
+}
+
+// saltedSHA returns hasher of LDAP {SSHA} hashes, which are base64 of digest of password and salt followed by salt
+func saltedSHA(h func() hash.Hash) PasswordHasher {
+	return PasswordHasherFunc(func(password, encoded string) (bool, error) {
+		decoded, err := base64.StdEncoding.DecodeString(encoded[strings.Index(encoded, "}")+1:])
+
+		size := h().Size()
+		if err != nil || len(decoded) <= size {
+			return false, malformedHash("salted SHA")
+		}
+
+		digest := h()
+		digest.Write([]byte(password))
+		digest.Write(decoded[size:])
+
+		return subtle.ConstantTimeCompare(decoded[:size], digest.Sum(nil)) == 1, nil
+	})
+}
@@ -0,0 +1,90 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestComparePasswordLegacy(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("ostap"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	for _, hash := range []string{
+		string(bcryptHash),
+		"$2y$" + strings.TrimPrefix(string(bcryptHash), "$2a$"),
+		"$scrypt$ln=10,r=8,p=1$AAECAwQFBgcICQoLDA0ODw$piqtd4CMMSxcEy/ZShla.ACqVT.RDSlm2lB5iF92QZ8",
+		"$pbkdf2-sha256$1000$AAECAwQFBgcICQoLDA0ODw$6D1hUqsGd0nd0bU./pTAvRsg0cbRSOQerYLuTGSTk18",
+		"pbkdf2_sha256$1000$seasalt$dK+DcRpHz60SxXQ5EodG5d1QDN2/ykI+claols+L6/w=",
+		"{SSHA}4zv0Eenn/9c+hwH2h8vCBUviD0pzYWx0MTIzNA==",
+		"{SSHA256}mhSbSGyH8OaGEPyRWaJJOLBqPiEypF9UVumXPXcq5dZzYWx0MTIzNA==",
+		"{SSHA512}TkFBbreCEqt7y2nxS70cJNh2NajyJbDf7E/L4CEwpt/M2LySgbuvTsRvLFcLXmgOM3Z3ra+o2jB85lFYFZyc/HNhbHQxMjM0",
+	} {
+		ok, err := ComparePassword("ostap", hash)
+		assert.NoError(t, err, hash)
+		assert.True(t, ok, hash)
+
+		ok, err = ComparePassword("wrongPassword", hash)
+		assert.NoError(t, err, hash)
+		assert.False(t, ok, hash)
+
+		assert.True(t, NeedsRehash(hash), hash)
+	}
+}
+
+func TestComparePasswordMalformed(t *testing.T) {
+	for _, hash := range []string{
+		"$argon2id$v=19$m=65536,t=3,p=1",
+		"$argon2id$v=19$m=65536,t=0,p=1$L/cXOPSeeE9f68JKienFug$52t2o11NiXF/gr0wCF514g",
+		"$argon2id$v=19$m=65536,t=3,p=0$L/cXOPSeeE9f68JKienFug$52t2o11NiXF/gr0wCF514g",
+		"$argon2id$v=19$m=65536,t=3,p=1$L/cXOPSeeE9f68JKienFug$",
+		"$2a$10$short",
+		"$2a$31$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy",
+		"$scrypt$ln=10,r=8,p=1$AAECAwQFBgcICQoLDA0ODw",
+		"$scrypt$ln=30,r=8,p=1$AAECAwQFBgcICQoLDA0ODw$piqtd4CMMSxcEy/ZShla.ACqVT.RDSlm2lB5iF92QZ8",
+		"$pbkdf2-sha256$x$AAECAwQFBgcICQoLDA0ODw$6D1hUqsGd0nd0bU./pTAvRsg0cbRSOQerYLuTGSTk18",
+		"$pbkdf2-sha256$1000000000$AAECAwQFBgcICQoLDA0ODw$6D1hUqsGd0nd0bU./pTAvRsg0cbRSOQerYLuTGSTk18",
+		"pbkdf2_sha256$1000$seasalt$",
+		"{SSHA}4zv0Eenn/9c+hwH2h8vCBUviD0o=",
+		"{SSHA}not base64",
+	} {
+		ok, err := ComparePassword("ostap", hash)
+		assert.Equal(t, ErrMalformedHash, errors.Cause(err), hash)
+		assert.False(t, ok, hash)
+	}
+
+	for _, hash := range []string{"", "$", "ostap", "$1$salt$hash", "{SHA}4zv0Eenn/9c+hwH2h8vCBUviD0o="} {
+		ok, err := ComparePassword("ostap", hash)
+		assert.Equal(t, ErrUnknownHashFormat, err, hash)
+		assert.False(t, ok, hash)
+		assert.False(t, NeedsRehash(hash), hash)
+	}
+}
+
+func TestRegisterPasswordHasher(t *testing.T) {
+	defer delete(passwordHashers, "$plain$")
+	defer delete(passwordHashers, "$plain$upper$")
+
+	RegisterPasswordHasher("$plain$", PasswordHasherFunc(func(password, hash string) (bool, error) {
+		return "$plain$"+password == hash, nil
+	}))
+	RegisterPasswordHasher("$plain$upper$", PasswordHasherFunc(func(password, hash string) (bool, error) {
+		return "$plain$upper$"+strings.ToUpper(password) == hash, nil
+	}))
+
+	ok, err := ComparePassword("ostap", "$plain$ostap")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// The longest prefix wins
+	ok, err = ComparePassword("ostap", "$plain$upper$OSTAP")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, NeedsRehash("$plain$ostap"))
+}
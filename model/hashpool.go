@@ -0,0 +1,176 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults of password hashing pool, four hashes with default parameters run at once
+const (
+	DefaultHashMemoryBudget = 4 * configMemory
+	DefaultHashQueueSize    = 64
+	DefaultHashQueueTimeout = 2 * time.Second
+)
+
+// ErrHashingBusy is returned when password can not be hashed because too many hashes are computed or queued
+var ErrHashingBusy = errors.New("Password hashing is busy")
+
+// Metrics of password hashing published by expvar
+var (
+	hashMetrics = expvar.NewMap("password_hashing")
+	// hashRunning is number of running hashes and hashMemory is memory they use in KiB
+	hashRunning = new(expvar.Int)
+	hashMemory  = new(expvar.Int)
+	// hashQueued is number of hashes waiting for memory
+	hashQueued = new(expvar.Int)
+)
+
+func init() {
+	hashMetrics.Set("running", hashRunning)
+	hashMetrics.Set("memory_kib", hashMemory)
+	hashMetrics.Set("queued", hashQueued)
+}
+
+// hashPool is used by EncodePassword and ComparePassword
+var hashPool = NewHashPool(DefaultHashMemoryBudget, DefaultHashQueueSize, DefaultHashQueueTimeout)
+
+// SetHashPool replaces pool of password hashing, it must be called before passwords are hashed
+func SetHashPool(p *HashPool) {
+	hashPool = p
+}
+
+// HashingRetryAfter returns time after which request rejected with ErrHashingBusy should be repeated
+func HashingRetryAfter() time.Duration {
+	return hashPool.timeout
+}
+
+// HashPool caps memory of concurrent argon2 hashes. Hashes which do not fit into budget wait in FIFO queue
+// up to timeout, and are rejected with ErrHashingBusy when queue is full or timeout passes.
+type HashPool struct {
+	// budget is memory hashes may use at once in KiB, 0 means unlimited
+	budget   uint32
+	maxQueue int
+	timeout  time.Duration
+
+	mu    sync.Mutex
+	used  uint32
+	queue []*hashWaiter
+}
+
+type hashWaiter struct {
+	memory uint32
+	ready  chan struct{}
+}
+
+// NewHashPool returns pool running hashes which use up to budget KiB of memory at once
+// with up to maxQueue hashes waiting up to timeout
+func NewHashPool(budget uint32, maxQueue int, timeout time.Duration) *HashPool {
+	return &HashPool{budget: budget, maxQueue: maxQueue, timeout: timeout}
+}
+
+// acquire waits until hash using memory KiB may run, release must be called when it is done.
+// Hash needing more than whole budget runs alone.
+func (p *HashPool) acquire(memory uint32) (func(), error) {
+	if p.budget == 0 {
+		return func() {}, nil
+	}
+
+	if memory > p.budget {
+		memory = p.budget
+	}
+
+	start := time.Now()
+
+	p.mu.Lock()
+
+	if len(p.queue) == 0 && p.used+memory <= p.budget {
+		p.used += memory
+		p.mu.Unlock()
+
+		return p.started(memory, start), nil
+	}
+
+	if len(p.queue) >= p.maxQueue {
+		p.mu.Unlock()
+		hashMetrics.Add("rejected", 1)
+
+		return nil, ErrHashingBusy
+	}
+
+	w := &hashWaiter{memory: memory, ready: make(chan struct{})}
+	p.queue = append(p.queue, w)
+	hashQueued.Add(1)
+	p.mu.Unlock()
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	select {
+	case <-w.ready:
+	case <-timer.C:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		select {
+		case <-w.ready:
+			// Memory was granted while timer fired
+		default:
+			p.remove(w)
+			// Waiter blocking the head of queue may let smaller ones behind it run
+			p.grant()
+			hashMetrics.Add("rejected", 1)
+			hashMetrics.AddFloat("wait_seconds_total", time.Since(start).Seconds())
+
+			return nil, ErrHashingBusy
+		}
+	}
+
+	return p.started(memory, start), nil
+}
+
+// started counts hash which waited since start and returns its release
+func (p *HashPool) started(memory uint32, start time.Time) func() {
+	hashRunning.Add(1)
+	hashMemory.Add(int64(memory))
+	hashMetrics.Add("started", 1)
+	hashMetrics.AddFloat("wait_seconds_total", time.Since(start).Seconds())
+
+	return func() {
+		hashRunning.Add(-1)
+		hashMemory.Add(-int64(memory))
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.used -= memory
+		p.grant()
+	}
+}
+
+// grant lets waiting hashes run in order while their memory fits into budget, p.mu must be held
+func (p *HashPool) grant() {
+	for len(p.queue) > 0 && p.used+p.queue[0].memory <= p.budget {
+		w := p.queue[0]
+		p.queue = p.queue[1:]
+		p.used += w.memory
+		hashQueued.Add(-1)
+		close(w.ready)
+	}
+}
+
+// remove drops waiter from queue, p.mu must be held
+func (p *HashPool) remove(w *hashWaiter) {
+	for i, q := range p.queue {
+		if q == w {
+			p.queue = append(p.queue[:i], p.queue[i+1:]...)
+			hashQueued.Add(-1)
+
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPoolBudget(t *testing.T) {
+	p := NewHashPool(100, 1, time.Second)
+
+	release1, err := p.acquire(60)
+	require.NoError(t, err)
+	release2, err := p.acquire(40)
+	require.NoError(t, err)
+
+	// Budget is used up, the next hash waits until memory is released
+	done := make(chan error)
+	go func() {
+		release, err := p.acquire(50)
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+
+	assert.Eventually(t, func() bool { return queued(p) == 1 }, time.Second, time.Millisecond)
+
+	// Queue is full
+	_, err = p.acquire(10)
+	assert.Equal(t, ErrHashingBusy, err)
+
+	release1()
+	assert.NoError(t, <-done)
+
+	release2()
+	assert.Equal(t, uint32(0), p.used)
+}
+
+func TestHashPoolTimeout(t *testing.T) {
+	p := NewHashPool(100, 10, 10*time.Millisecond)
+
+	release, err := p.acquire(100)
+	require.NoError(t, err)
+
+	_, err = p.acquire(1)
+	assert.Equal(t, ErrHashingBusy, err)
+	assert.Equal(t, 0, queued(p))
+
+	release()
+
+	// Hash bigger than budget runs alone
+	release, err = p.acquire(1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(100), p.used)
+	release()
+}
+
+func TestHashPoolUnlimited(t *testing.T) {
+	p := NewHashPool(0, 0, 0)
+
+	for i := 0; i < 10; i++ {
+		_, err := p.acquire(configMemory)
+		require.NoError(t, err)
+	}
+}
+
+func TestHashPoolPassword(t *testing.T) {
+	defer SetHashPool(hashPool)
+
+	SetHashPool(NewHashPool(configMemory, 0, time.Second))
+	assert.Equal(t, time.Second, HashingRetryAfter())
+
+	hash, err := EncodePassword(NewPasswordConfig(), "ostap")
+	require.NoError(t, err)
+
+	release, err := hashPool.acquire(configMemory)
+	require.NoError(t, err)
+
+	_, err = ComparePassword("ostap", hash)
+	assert.Equal(t, ErrHashingBusy, err)
+
+	_, err = EncodePassword(NewPasswordConfig(), "ostap")
+	assert.Equal(t, ErrHashingBusy, err)
+
+	release()
+
+	ok, err := ComparePassword("ostap", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func queued(p *HashPool) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.queue)
+}
@@ -0,0 +1,188 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	querySelectLoginFailures = `SELECT kind, failed_attempts, last_failed_at, locked_until FROM login_failures
+		WHERE (kind=$1 AND subject=$2) OR (kind=$3 AND subject=$4)`
+	// Failures are counted from 1 again when the last one is older than window ($4) or lockout ended
+	queryFailLogin = `INSERT INTO login_failures(kind, subject, failed_attempts, last_failed_at) VALUES ($1,$2,1,$3)
+		ON CONFLICT (kind, subject) DO UPDATE SET failed_attempts=CASE
+		WHEN login_failures.last_failed_at < $4 OR login_failures.locked_until <= $3 THEN 1
+		ELSE login_failures.failed_attempts + 1 END,
+		locked_until=CASE WHEN login_failures.locked_until <= $3 THEN NULL ELSE login_failures.locked_until END,
+		last_failed_at=$3 RETURNING failed_attempts`
+	queryLockLogin          = `UPDATE login_failures SET locked_until=$3 WHERE kind=$1 AND subject=$2`
+	queryResetLogin         = `DELETE FROM login_failures WHERE kind=$1 AND subject=$2`
+	msgErrorCheckingLogin   = "Error checking failed logins"
+	msgErrorCountingFailure = "Error counting failed login"
+)
+
+// Kinds of subjects failed logins are counted for
+const (
+	loginByUser = "user"
+	loginByIP   = "ip"
+)
+
+var (
+	// ErrLoginLocked is returned when user or IP address is locked after too many failed logins
+	ErrLoginLocked = errors.New("Login is locked after too many failed attempts")
+	// ErrLoginThrottled is returned when user tries to log in again before delay after failed login ends
+	ErrLoginThrottled = errors.New("Login is attempted too soon after failed one")
+)
+
+// LockoutPolicy limits password guessing. Every failed login of user delays the next one,
+// and user or IP address with too many failed logins is locked for a while.
+type LockoutPolicy struct {
+	// MaxAttempts is number of failed logins of user after which user is locked for Lockout, 0 disables it
+	MaxAttempts int
+	// IPMaxAttempts is number of failed logins from IP address after which it is locked, 0 disables it
+	IPMaxAttempts int
+	Lockout       time.Duration
+	// Delay is wait after failed login of user, which doubles with every next failure up to MaxDelay.
+	// IP addresses are not delayed, they can be shared by many users.
+	Delay    time.Duration
+	MaxDelay time.Duration
+	// Window is time after the last failure when failures are forgotten
+	Window time.Duration
+}
+
+// delay returns wait after failed attempts
+func (p *LockoutPolicy) delay(failed int) time.Duration {
+	d := p.Delay
+
+	for i := 1; i < failed && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return d
+}
+
+// wait returns time left until next login of subject is allowed at now with error telling why it is not allowed
+func (p *LockoutPolicy) wait(kind string, failed int, lastFailed time.Time, lockedUntil *time.Time,
+	now time.Time) (time.Duration, error) {
+	if locked(lockedUntil, now) {
+		return lockedUntil.Sub(now), ErrLoginLocked
+	}
+
+	// Failures before ended lockout are counted from the start with the next one
+	if kind != loginByUser || lockedUntil != nil || now.Sub(lastFailed) > p.Window {
+		return 0, nil
+	}
+
+	if next := lastFailed.Add(p.delay(failed)); now.Before(next) {
+		return next.Sub(now), ErrLoginThrottled
+	}
+
+	return 0, nil
+}
+
+// LoginAttemptsRepo counts failed logins by user name and by IP address.
+// User names are counted whether such user exists or not, so lockout does not reveal existing users.
+type LoginAttemptsRepo struct {
+	db     *sql.DB
+	policy LockoutPolicy
+}
+
+// NewLoginAttemptsRepo returns LoginAttemptsRepo with db, failed logins are limited by policy
+func NewLoginAttemptsRepo(data *sql.DB, policy LockoutPolicy) *LoginAttemptsRepo {
+	return &LoginAttemptsRepo{db: data, policy: policy}
+}
+
+// Check returns ErrLoginLocked when user or IP address is locked and ErrLoginThrottled when delay after
+// failed login of user lasts, together with time left until the next login is allowed
+func (lr *LoginAttemptsRepo) Check(login, ip string) (time.Duration, error) {
+	rows, err := lr.db.Query(querySelectLoginFailures, loginByUser, login, loginByIP, ip)
+	if err != nil {
+		return 0, errors.Wrap(err, msgErrorCheckingLogin)
+	}
+	defer rows.Close()
+
+	var (
+		retryAfter time.Duration
+		result     error
+		now        = time.Now()
+	)
+
+	for rows.Next() {
+		var (
+			kind        string
+			failed      int
+			lastFailed  time.Time
+			lockedUntil *time.Time
+		)
+
+		err = rows.Scan(&kind, &failed, &lastFailed, &lockedUntil)
+		if err != nil {
+			return 0, errors.Wrap(err, msgErrorCheckingLogin)
+		}
+
+		wait, err := lr.policy.wait(kind, failed, lastFailed, lockedUntil, now)
+
+		// Lockout is reported before delay, the longest wait of the same kind is reported
+		switch {
+		case err == nil:
+		case result == nil || err == ErrLoginLocked && result == ErrLoginThrottled:
+			result, retryAfter = err, wait
+		case err == result && wait > retryAfter:
+			retryAfter = wait
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, errors.Wrap(err, msgErrorCheckingLogin)
+	}
+
+	return retryAfter, result
+}
+
+// Fail counts failed login of user from IP address, user or address reaching its limit is locked
+func (lr *LoginAttemptsRepo) Fail(login, ip string) error {
+	now := time.Now()
+
+	err := lr.fail(loginByUser, login, lr.policy.MaxAttempts, now)
+	if err != nil {
+		return err
+	}
+
+	return lr.fail(loginByIP, ip, lr.policy.IPMaxAttempts, now)
+}
+
+func (lr *LoginAttemptsRepo) fail(kind, subject string, maxAttempts int, now time.Time) error {
+	var failed int
+
+	err := lr.db.QueryRow(queryFailLogin, kind, subject, now, now.Add(-lr.policy.Window)).Scan(&failed)
+	if err != nil {
+		return errors.Wrap(err, msgErrorCountingFailure)
+	}
+
+	if maxAttempts == 0 || failed < maxAttempts {
+		return nil
+	}
+
+	_, err = lr.db.Exec(queryLockLogin, kind, subject, now.Add(lr.policy.Lockout))
+	if err != nil {
+		return errors.Wrap(err, msgErrorCountingFailure)
+	}
+
+	return nil
+}
+
+// Reset forgets failed logins of user and unlocks it, after successful login or on request of admin.
+// Failed logins from IP address are not forgotten, a correct password of one user does not excuse guessing others.
+func (lr *LoginAttemptsRepo) Reset(login string) error {
+	_, err := lr.db.Exec(queryResetLogin, loginByUser, login)
+
+	return err
+}
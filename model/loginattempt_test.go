@@ -0,0 +1,145 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var loginFailureColumns = []string{"kind", "failed_attempts", "last_failed_at", "locked_until"}
+
+var testLockoutPolicy = LockoutPolicy{
+	MaxAttempts:   3,
+	IPMaxAttempts: 10,
+	Lockout:       15 * time.Minute,
+	Delay:         time.Second,
+	MaxDelay:      10 * time.Second,
+	Window:        time.Hour,
+}
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	p := testLockoutPolicy
+
+	assert.Equal(t, time.Second, p.delay(1))
+	assert.Equal(t, 2*time.Second, p.delay(2))
+	assert.Equal(t, 8*time.Second, p.delay(4))
+	assert.Equal(t, 10*time.Second, p.delay(5))
+	assert.Equal(t, 10*time.Second, p.delay(100))
+
+	p.Delay = 0
+	assert.Equal(t, time.Duration(0), p.delay(3))
+}
+
+func TestLoginAttemptsRepoCheck(t *testing.T) {
+	now := time.Now()
+	locked := now.Add(5 * time.Minute)
+	ended := now.Add(-time.Minute)
+
+	tests := []struct {
+		name  string
+		rows  [][]driver.Value
+		err   error
+		after time.Duration
+	}{
+		{
+			name: "No failures",
+		}, {
+			name: "Delay passed",
+			rows: [][]driver.Value{{loginByUser, 2, now.Add(-3 * time.Second), nil}},
+		}, {
+			name:  "Delayed",
+			rows:  [][]driver.Value{{loginByUser, 2, now, nil}},
+			err:   ErrLoginThrottled,
+			after: 2 * time.Second,
+		}, {
+			name: "Failures forgotten",
+			rows: [][]driver.Value{{loginByUser, 2, now.Add(-2 * time.Hour), nil}},
+		}, {
+			name: "IP address is not delayed",
+			rows: [][]driver.Value{{loginByIP, 5, now, nil}},
+		}, {
+			name:  "User locked",
+			rows:  [][]driver.Value{{loginByUser, 3, now, locked}},
+			err:   ErrLoginLocked,
+			after: 5 * time.Minute,
+		}, {
+			name:  "IP address locked while user delayed",
+			rows:  [][]driver.Value{{loginByUser, 2, now, nil}, {loginByIP, 10, now, locked}},
+			err:   ErrLoginLocked,
+			after: 5 * time.Minute,
+		}, {
+			name: "Lockout ended",
+			rows: [][]driver.Value{{loginByUser, 3, now.Add(-16 * time.Minute), ended}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			rows := sqlmock.NewRows(loginFailureColumns)
+			for _, row := range tt.rows {
+				rows.AddRow(row...)
+			}
+
+			mock.ExpectQuery(regexp.QuoteMeta(querySelectLoginFailures)).
+				WithArgs(loginByUser, "i3odja", loginByIP, "10.0.0.1").
+				WillReturnRows(rows)
+
+			after, err := NewLoginAttemptsRepo(db, testLockoutPolicy).Check("i3odja", "10.0.0.1")
+			assert.Equal(t, tt.err, err)
+			assert.InDelta(t, tt.after.Seconds(), after.Seconds(), 1)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestLoginAttemptsRepoFail(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Third failure of user locks it, address is below its limit
+	mock.ExpectQuery(regexp.QuoteMeta(queryFailLogin)).
+		WithArgs(loginByUser, "i3odja", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(3))
+	mock.ExpectExec(regexp.QuoteMeta(queryLockLogin)).
+		WithArgs(loginByUser, "i3odja", sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectQuery(regexp.QuoteMeta(queryFailLogin)).
+		WithArgs(loginByIP, "10.0.0.1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"failed_attempts"}).AddRow(3))
+
+	repo := NewLoginAttemptsRepo(db, testLockoutPolicy)
+
+	require.NoError(t, repo.Fail("i3odja", "10.0.0.1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLoginAttemptsRepoReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryResetLogin)).
+		WithArgs(loginByUser, "i3odja").
+		WillReturnResult(driver.RowsAffected(1))
+
+	require.NoError(t, NewLoginAttemptsRepo(db, testLockoutPolicy).Reset("i3odja"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
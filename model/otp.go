@@ -0,0 +1,279 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	// queryEnrollOTP replaces channel of unconfirmed enrollment, confirmed channel is kept. Code is not replaced
+	// before $7, when the previous one was sent less than OTPResendInterval ago, and lockout that has not ended
+	// is kept with its failed attempts.
+	queryEnrollOTP = `INSERT INTO otp_factors(user_id, channel, destination, code_hash, code_expires_at, code_sent_at,
+		created_at) VALUES ($1,$2,$3,$4,$5,$6,$6) ON CONFLICT (user_id) DO UPDATE SET channel=$2, destination=$3,
+		code_hash=$4, code_expires_at=$5, code_sent_at=$6, created_at=$6,
+		failed_attempts=CASE WHEN otp_factors.locked_until > $6 THEN otp_factors.failed_attempts ELSE 0 END,
+		locked_until=CASE WHEN otp_factors.locked_until > $6 THEN otp_factors.locked_until END
+		WHERE otp_factors.confirmed_at IS NULL AND (otp_factors.code_sent_at IS NULL OR otp_factors.code_sent_at <= $7)`
+	querySelectOTPForUpdate = `SELECT channel, destination, code_hash, code_expires_at, code_sent_at, failed_attempts,
+		locked_until, confirmed_at IS NOT NULL FROM otp_factors WHERE user_id=$1 FOR UPDATE`
+	queryIssueOTP = `UPDATE otp_factors SET code_hash=$2, code_expires_at=$3, code_sent_at=$4 WHERE user_id=$1`
+	// queryAcceptOTP burns issued code, so it can not be used again
+	queryAcceptOTP  = `UPDATE otp_factors SET code_hash=NULL, code_expires_at=NULL, failed_attempts=0 WHERE user_id=$1`
+	queryConfirmOTP = `UPDATE otp_factors SET code_hash=NULL, code_expires_at=NULL, failed_attempts=0, confirmed_at=$2
+		WHERE user_id=$1`
+	// queryFailOTP burns issued code when factor gets locked, new code has to be requested after lockout
+	queryFailOTP = `UPDATE otp_factors SET failed_attempts=$2, locked_until=$3,
+		code_hash=CASE WHEN $3::timestamp IS NULL THEN code_hash END WHERE user_id=$1`
+	queryDeleteOTP = `DELETE FROM otp_factors WHERE user_id=$1`
+	queryResetOTP  = `DELETE FROM otp_factors WHERE user_id=(SELECT id FROM users WHERE user_name=$1)`
+
+	msgErrorEnrollingOTP = "Error enrolling one-time code"
+	msgErrorIssuingOTP   = "Error issuing one-time code"
+
+	// OTPTTL is how long code sent by email or SMS is valid
+	OTPTTL = 10 * time.Minute
+	// OTPResendInterval is minimal time between codes sent to user, so users can not be flooded with messages
+	OTPResendInterval = 30 * time.Second
+	// otpModulo makes 6 digit codes
+	otpModulo = 1000000
+)
+
+// ErrOTPTooSoon is returned when new code is requested before previous one could be delivered
+var ErrOTPTooSoon = errors.New("One-time code was sent recently")
+
+// OTPDelivery is one-time code to send to user over channel
+type OTPDelivery struct {
+	// Channel is notification channel, email or sms
+	Channel string
+	// Destination is email address or phone number
+	Destination string
+	Code        string
+}
+
+// otpState is stored one-time code factor of user with its brute force protection state
+type otpState struct {
+	channel     string
+	destination string
+	codeHash    sql.NullString
+	expiresAt   *time.Time
+	sentAt      *time.Time
+	failed      int
+	lockedUntil *time.Time
+	confirmed   bool
+}
+
+// matches reports whether code is the issued one and has not expired
+func (s *otpState) matches(code string, now time.Time) bool {
+	if !s.codeHash.Valid || s.expiresAt == nil || !s.expiresAt.After(now) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(s.codeHash.String), []byte(hashOTP(code))) == 1
+}
+
+// EnrollOTP starts enrollment of codes sent over channel to destination and returns code confirming it.
+// Channel is not used for login until it is confirmed. Enrolling again does not send codes more often
+// than OTPResendInterval and does not end lockout of the factor.
+func (tr *TwoFactorRepo) EnrollOTP(userID, channel, destination string) (*OTPDelivery, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+	defer tx.Rollback()
+
+	state, err := selectOTP(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	switch {
+	case state == nil:
+	case state.confirmed:
+		return nil, ErrTwoFactorEnabled
+	case sentRecently(state, now):
+		return nil, ErrOTPTooSoon
+	}
+
+	code, err := newOTP()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+
+	res, err := tx.Exec(queryEnrollOTP, userID, channel, destination, hashOTP(code), now.Add(OTPTTL), now,
+		now.Add(-OTPResendInterval))
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+
+	// Factor that did not exist when it was selected has been enrolled concurrently
+	if n == 0 {
+		return nil, ErrOTPTooSoon
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+
+	return &OTPDelivery{Channel: channel, Destination: destination, Code: code}, nil
+}
+
+// ConfirmOTP enables enrolled channel when code sent over it matches and returns new recovery codes
+func (tr *TwoFactorRepo) ConfirmOTP(userID, code string) ([]string, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+	defer tx.Rollback()
+
+	state, err := selectOTP(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	switch {
+	case state == nil:
+		return nil, ErrTwoFactorNotEnrolled
+	case state.confirmed:
+		return nil, ErrTwoFactorEnabled
+	case locked(state.lockedUntil, now):
+		return nil, ErrTwoFactorLocked
+	case !state.matches(code, now):
+		err = failOTP(tx, userID, state, now)
+		if err != nil {
+			return nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+		}
+
+		return nil, ErrTwoFactorCodeInvalid
+	}
+
+	_, err = tx.Exec(queryConfirmOTP, userID, now)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingOTP)
+	}
+
+	return codes, nil
+}
+
+// IssueOTP generates new code of user with confirmed email or SMS channel, it replaces code sent before
+func (tr *TwoFactorRepo) IssueOTP(userID string) (*OTPDelivery, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorIssuingOTP)
+	}
+	defer tx.Rollback()
+
+	state, err := selectOTP(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	switch {
+	case state == nil || !state.confirmed:
+		return nil, ErrTwoFactorNotEnrolled
+	case locked(state.lockedUntil, now):
+		return nil, ErrTwoFactorLocked
+	case sentRecently(state, now):
+		return nil, ErrOTPTooSoon
+	}
+
+	code, err := newOTP()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorIssuingOTP)
+	}
+
+	_, err = tx.Exec(queryIssueOTP, userID, hashOTP(code), now.Add(OTPTTL), now)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorIssuingOTP)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorIssuingOTP)
+	}
+
+	return &OTPDelivery{Channel: state.channel, Destination: state.destination, Code: code}, nil
+}
+
+// selectOTP locks code factor of user within transaction, it returns nil when user has none
+func selectOTP(tx *sql.Tx, userID string) (*otpState, error) {
+	var s otpState
+
+	err := tx.QueryRow(querySelectOTPForUpdate, userID).Scan(&s.channel, &s.destination, &s.codeHash, &s.expiresAt,
+		&s.sentAt, &s.failed, &s.lockedUntil, &s.confirmed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingFactor)
+	}
+
+	return &s, nil
+}
+
+// sentRecently reports whether code was sent less than OTPResendInterval ago
+func sentRecently(state *otpState, now time.Time) bool {
+	return state.sentAt != nil && state.sentAt.Add(OTPResendInterval).After(now)
+}
+
+// failOTP counts wrong code, too many of them lock the factor and burn issued code
+func failOTP(tx *sql.Tx, userID string, state *otpState, now time.Time) error {
+	failed, lockedUntil := countFailure(state.failed, now)
+
+	_, err := tx.Exec(queryFailOTP, userID, failed, lockedUntil)
+
+	return errors.Wrap(err, msgErrorVerifyingFactor)
+}
+
+// newOTP returns random 6 digit code
+func newOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(otpModulo))
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// hashOTP hashes code ignoring surrounding spaces
+func hashOTP(code string) string {
+	return token.HashOpaque(strings.TrimSpace(code))
+}
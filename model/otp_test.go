@@ -0,0 +1,289 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var otpColumns = []string{"channel", "destination", "code_hash", "code_expires_at", "code_sent_at", "failed_attempts",
+	"locked_until", "confirmed"}
+
+func TestTwoFactorRepoEnrollOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectExec(regexp.QuoteMeta(queryEnrollOTP)).
+		WithArgs(testFactorUser, "email", "i3odja@example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Confirmed channel is kept
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", nil, nil, time.Now().Add(-time.Hour), 0, nil, true))
+	mock.ExpectRollback()
+
+	// Enrolling again does not send codes more often than OTPResendInterval
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", hashOTP("123456"), time.Now().Add(OTPTTL), time.Now(), 0, nil, false))
+	mock.ExpectRollback()
+
+	// Locked factor gets new code after the interval, lockout is kept by the query
+	lockedUntil := time.Now().Add(factorLockout)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", nil, nil, time.Now().Add(-time.Minute), 0, lockedUntil, false))
+	mock.ExpectExec(regexp.QuoteMeta(queryEnrollOTP)).
+		WithArgs(testFactorUser, "sms", "+380501234567", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Concurrent enrollment sent code first
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectExec(regexp.QuoteMeta(queryEnrollOTP)).
+		WithArgs(testFactorUser, "sms", "+380501234567", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectRollback()
+
+	repo := NewTwoFactorRepo(db)
+
+	d, err := repo.EnrollOTP(testFactorUser, "email", "i3odja@example.com")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9]{6}$`, d.Code)
+	assert.Equal(t, "i3odja@example.com", d.Destination)
+
+	_, err = repo.EnrollOTP(testFactorUser, "sms", "+380501234567")
+	assert.Equal(t, ErrTwoFactorEnabled, err)
+
+	_, err = repo.EnrollOTP(testFactorUser, "email", "i3odja@example.com")
+	assert.Equal(t, ErrOTPTooSoon, err)
+
+	d, err = repo.EnrollOTP(testFactorUser, "sms", "+380501234567")
+	require.NoError(t, err)
+	assert.Equal(t, "sms", d.Channel)
+
+	_, err = repo.EnrollOTP(testFactorUser, "sms", "+380501234567")
+	assert.Equal(t, ErrOTPTooSoon, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoConfirmOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expires := time.Now().Add(OTPTTL)
+
+	// Wrong code is counted
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", hashOTP("123456"), expires, time.Now(), 0, nil, false))
+	mock.ExpectExec(regexp.QuoteMeta(queryFailOTP)).
+		WithArgs(testFactorUser, 1, nil).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", hashOTP("123456"), expires, time.Now(), 1, nil, false))
+	mock.ExpectExec(regexp.QuoteMeta(queryConfirmOTP)).
+		WithArgs(testFactorUser, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteRecovery)).
+		WithArgs(testFactorUser).
+		WillReturnResult(driver.RowsAffected(0))
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		mock.ExpectExec(regexp.QuoteMeta(queryInsertRecovery)).
+			WithArgs(testFactorUser, sqlmock.AnyArg()).
+			WillReturnResult(driver.RowsAffected(1))
+	}
+
+	mock.ExpectCommit()
+
+	// Expired code is not accepted
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("sms", "+380501234567", hashOTP("123456"), time.Now().Add(-time.Second), time.Now(), 0, nil, false))
+	mock.ExpectExec(regexp.QuoteMeta(queryFailOTP)).
+		WithArgs(testFactorUser, 1, nil).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectRollback()
+
+	repo := NewTwoFactorRepo(db)
+
+	_, err = repo.ConfirmOTP(testFactorUser, "654321")
+	assert.Equal(t, ErrTwoFactorCodeInvalid, err)
+
+	codes, err := repo.ConfirmOTP(testFactorUser, " 123456 ")
+	require.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	_, err = repo.ConfirmOTP(testFactorUser, "123456")
+	assert.Equal(t, ErrTwoFactorCodeInvalid, err)
+
+	_, err = repo.ConfirmOTP(testFactorUser, "123456")
+	assert.Equal(t, ErrTwoFactorNotEnrolled, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoIssueOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("sms", "+380501234567", nil, nil, time.Now().Add(-time.Minute), 0, nil, true))
+	mock.ExpectExec(regexp.QuoteMeta(queryIssueOTP)).
+		WithArgs(testFactorUser, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Codes are not sent more often than OTPResendInterval
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("sms", "+380501234567", "hash", time.Now().Add(OTPTTL), time.Now(), 0, nil, true))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("sms", "+380501234567", nil, nil, nil, 0, time.Now().Add(time.Minute), true))
+	mock.ExpectRollback()
+
+	// Unconfirmed channel gets codes only on enrollment
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("sms", "+380501234567", nil, nil, nil, 0, nil, false))
+	mock.ExpectRollback()
+
+	repo := NewTwoFactorRepo(db)
+
+	d, err := repo.IssueOTP(testFactorUser)
+	require.NoError(t, err)
+	assert.Equal(t, "sms", d.Channel)
+	assert.Equal(t, "+380501234567", d.Destination)
+	assert.Len(t, d.Code, 6)
+
+	_, err = repo.IssueOTP(testFactorUser)
+	assert.Equal(t, ErrOTPTooSoon, err)
+
+	_, err = repo.IssueOTP(testFactorUser)
+	assert.Equal(t, ErrTwoFactorLocked, err)
+
+	_, err = repo.IssueOTP(testFactorUser)
+	assert.Equal(t, ErrTwoFactorNotEnrolled, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoVerifyOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expires := time.Now().Add(OTPTTL)
+
+	// Code sent by email is accepted for user without TOTP
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", hashOTP("123456"), expires, time.Now(), 2, nil, true))
+	mock.ExpectExec(regexp.QuoteMeta(queryAcceptOTP)).
+		WithArgs(testFactorUser).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Last allowed wrong code locks factor and burns issued code
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", hashOTP("123456"), expires, time.Now(), maxFactorAttempts-1, nil, true))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseRecoveryCode)).
+		WithArgs(testFactorUser, hashRecoveryCode("654321"), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryFailOTP)).
+		WithArgs(testFactorUser, 0, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Unconfirmed TOTP and channel are not second factor yet
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, 0, 0, nil, false))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns).
+			AddRow("email", "i3odja@example.com", hashOTP("123456"), expires, time.Now(), 0, nil, false))
+	mock.ExpectRollback()
+
+	repo := NewTwoFactorRepo(db)
+
+	require.NoError(t, repo.Verify(testFactorUser, "123456"))
+	assert.Equal(t, ErrTwoFactorCodeInvalid, repo.Verify(testFactorUser, "654321"))
+	assert.Equal(t, ErrTwoFactorNotEnrolled, repo.Verify(testFactorUser, "123456"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -20,12 +20,19 @@ const (
 	configKeyLen          = 16
 	lengthSalt            = 16
 	hashFormat            = "$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s"
+	pepperedHashFormat    = "$argon2id$v=%d$m=%d,t=%d,p=%d,keyid=%s$%s$%s"
 	hashSplit             = "$"
+	argon2idPrefix        = "$argon2id$"
 	configFormat          = "m=%d,t=%d,p=%d"
 	messageSaltError      = "Error generating salt for password"
 	messageConfigDecode   = "Decoding of password's configuration failed"
 	messageSaltDecode     = "Decoding of password's salt failed"
 	messagePasswordDecode = "Decoding of user's password failed"
+
+	// Lower bounds of configurable parameters, below them argon2id gives little protection
+	minConfigTime   = 1
+	minConfigMemory = 8 * 1024
+	minConfigKeyLen = 16
 )
 
 // PasswordConfig is structure that describes complication of hashing the password
@@ -36,14 +43,95 @@ type PasswordConfig struct {
 	keyLen  uint32
 }
 
+// passwordConfig hashes new passwords, it is replaced by SetPasswordConfig
+var passwordConfig = PasswordConfig{
+	time:    configTime,
+	memory:  configMemory,
+	threads: configThreads,
+	keyLen:  configKeyLen,
+}
+
 // NewPasswordConfig returns config for encode
 func NewPasswordConfig() *PasswordConfig {
-	return &PasswordConfig{
-		time:    configTime,
-		memory:  configMemory,
-		threads: configThreads,
-		keyLen:  configKeyLen,
+	c := passwordConfig
+	return &c
+}
+
+// NewCustomPasswordConfig returns config with argon2id iterations, memory in KiB, threads and key length in bytes
+func NewCustomPasswordConfig(time, memory uint32, threads uint8, keyLen uint32) (*PasswordConfig, error) {
+	switch {
+	case time < minConfigTime:
+		return nil, fmt.Errorf("password hashing time %d is less than %d", time, minConfigTime)
+	case threads < 1:
+		return nil, fmt.Errorf("password hashing needs at least 1 thread")
+	case memory < minConfigMemory || memory < 8*uint32(threads):
+		return nil, fmt.Errorf("password hashing memory %d KiB is less than %d KiB", memory, minConfigMemory)
+	case keyLen < minConfigKeyLen:
+		return nil, fmt.Errorf("password hash length %d is less than %d", keyLen, minConfigKeyLen)
 	}
+
+	return &PasswordConfig{time: time, memory: memory, threads: threads, keyLen: keyLen}, nil
+}
+
+// SetPasswordConfig replaces config new passwords are hashed with, it must be called before passwords are hashed
+func SetPasswordConfig(c *PasswordConfig) {
+	passwordConfig = *c
+}
+
+func (c *PasswordConfig) String() string {
+	return fmt.Sprintf("m=%d,t=%d,p=%d,len=%d", c.memory, c.time, c.threads, c.keyLen)
+}
+
+// Time returns number of argon2id iterations
+func (c *PasswordConfig) Time() uint32 {
+	return c.time
+}
+
+// Memory returns memory of argon2id in KiB
+func (c *PasswordConfig) Memory() uint32 {
+	return c.memory
+}
+
+// Threads returns argon2id parallelism
+func (c *PasswordConfig) Threads() uint8 {
+	return c.threads
+}
+
+// NeedsRehash reports whether hash was produced with weaker parameters than the current config,
+// with another supported algorithm or with another pepper key, so it should be replaced after the password is verified
+func NeedsRehash(hash string) bool {
+	if !strings.HasPrefix(hash, argon2idPrefix) {
+		_, ok := passwordHasher(hash)
+		return ok
+	}
+
+	parts := strings.Split(hash, hashSplit)
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false
+	}
+
+	var version int
+	c := &PasswordConfig{}
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return false
+	}
+
+	params, keyID := splitKeyID(parts[3])
+
+	_, err = fmt.Sscanf(params, configFormat, &c.memory, &c.time, &c.threads)
+	if err != nil {
+		return false
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false
+	}
+
+	return version < argon2.Version || c.memory < passwordConfig.memory || c.time < passwordConfig.time ||
+		uint32(len(key)) < passwordConfig.keyLen || keyID != currentKeyID()
 }
 
 // createSalt create random salt according to lengthSalt
@@ -60,27 +148,60 @@ func EncodePassword(c *PasswordConfig, pass string) (string, error) {
 		return "", errors.Wrap(err, messageSaltError)
 	}
 
-	passByte := []byte(pass)
+	keyID := currentKeyID()
+
+	passByte, err := pepperPassword(keyID, pass)
+	if err != nil {
+		return "", err
+	}
+
+	release, err := hashPool.acquire(c.memory)
+	if err != nil {
+		return "", err
+	}
+	defer release()
 
 	hash := argon2.IDKey(passByte, salt, c.time, c.memory, c.threads, c.keyLen)
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Hash := base64.RawStdEncoding.EncodeToString(hash)
 
 	full := fmt.Sprintf(hashFormat, argon2.Version, c.memory, c.time, c.threads, b64Salt, b64Hash)
+	if keyID != "" {
+		full = fmt.Sprintf(pepperedHashFormat, argon2.Version, c.memory, c.time, c.threads, keyID, b64Salt, b64Hash)
+	}
 
 	return full, nil
 }
 
-// ComparePassword returns true if password matches
+// ComparePassword returns true if password matches hash of any registered format
 func ComparePassword(password, hash string) (bool, error) {
+	h, ok := passwordHasher(hash)
+	if !ok {
+		return false, ErrUnknownHashFormat
+	}
+
+	return h.Verify(password, hash)
+}
+
+// compareArgon2id returns true if password matches argon2id hash
+func compareArgon2id(password, hash string) (bool, error) {
 	parts := strings.Split(hash, hashSplit)
+	if len(parts) != 6 {
+		return false, malformedHash("argon2id")
+	}
+
 	c := &PasswordConfig{}
-	_, err := fmt.Sscanf(parts[3], configFormat, &c.memory, &c.time, &c.threads)
+	params, keyID := splitKeyID(parts[3])
+	_, err := fmt.Sscanf(params, configFormat, &c.memory, &c.time, &c.threads)
 
 	if err != nil {
 		return false, errors.Wrap(err, messageConfigDecode)
 	}
 
+	if c.time < 1 || c.threads < 1 || c.memory < 8*uint32(c.threads) || c.memory > maxHashMemory {
+		return false, malformedHash("argon2id")
+	}
+
 	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
 
 	if err != nil {
@@ -93,8 +214,24 @@ func ComparePassword(password, hash string) (bool, error) {
 		return false, errors.Wrap(err, messagePasswordDecode)
 	}
 
+	if len(decodedHash) == 0 {
+		return false, malformedHash("argon2id")
+	}
+
 	c.keyLen = uint32(len(decodedHash))
-	comparisonHash := argon2.IDKey([]byte(password), salt, c.time, c.memory, c.threads, c.keyLen)
+
+	passByte, err := pepperPassword(keyID, password)
+	if err != nil {
+		return false, err
+	}
+
+	release, err := hashPool.acquire(c.memory)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	comparisonHash := argon2.IDKey(passByte, salt, c.time, c.memory, c.threads, c.keyLen)
 
 	return (subtle.ConstantTimeCompare(decodedHash, comparisonHash) == 1), nil
 }
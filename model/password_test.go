@@ -6,6 +6,7 @@ import (
 	"encoding/base64"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/argon2"
@@ -75,3 +76,67 @@ func TestComparePassword(t *testing.T) {
 	assert.False(t, isBad)
 	assert.NoError(t, err)
 }
+
+func TestNewCustomPasswordConfig(t *testing.T) {
+	c, err := NewCustomPasswordConfig(4, 128*1024, 2, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, &PasswordConfig{time: 4, memory: 128 * 1024, threads: 2, keyLen: 32}, c)
+	assert.Equal(t, "m=131072,t=4,p=2,len=32", c.String())
+
+	for _, bad := range []*PasswordConfig{
+		{time: 0, memory: configMemory, threads: 1, keyLen: 16},
+		{time: 1, memory: 1024, threads: 1, keyLen: 16},
+		{time: 1, memory: configMemory, threads: 0, keyLen: 16},
+		{time: 1, memory: configMemory, threads: 1, keyLen: 8},
+	} {
+		_, err = NewCustomPasswordConfig(bad.time, bad.memory, bad.threads, bad.keyLen)
+		assert.Error(t, err, bad.String())
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	defer SetPasswordConfig(NewPasswordConfig())
+
+	current := "$argon2id$v=19$m=65536,t=3,p=1$L/cXOPSeeE9f68JKienFug$52t2o11NiXF/gr0wCF514g"
+	fewerIterations := "$argon2id$v=19$m=65536,t=1,p=1$L/cXOPSeeE9f68JKienFug$52t2o11NiXF/gr0wCF514g"
+	lessMemory := "$argon2id$v=19$m=32768,t=3,p=1$L/cXOPSeeE9f68JKienFug$52t2o11NiXF/gr0wCF514g"
+	shortKey := "$argon2id$v=19$m=65536,t=3,p=1$L/cXOPSeeE9f68JKienFug$52t2o1"
+
+	assert.False(t, NeedsRehash(current))
+	assert.True(t, NeedsRehash(fewerIterations))
+	assert.True(t, NeedsRehash(lessMemory))
+	assert.True(t, NeedsRehash(shortKey))
+	assert.False(t, NeedsRehash("malformed"))
+
+	c, err := NewCustomPasswordConfig(4, configMemory, 1, 16)
+	assert.NoError(t, err)
+	SetPasswordConfig(c)
+
+	assert.True(t, NeedsRehash(current))
+	assert.Equal(t, c, NewPasswordConfig())
+}
+
+func TestTunePassword(t *testing.T) {
+	defer func(m func(*PasswordConfig) time.Duration) { measureHash = m }(measureHash)
+
+	// Every iteration takes 1ms per MiB
+	measureHash = func(c *PasswordConfig) time.Duration {
+		return time.Duration(c.time) * time.Duration(c.memory/1024) * time.Millisecond
+	}
+
+	c, d, err := TunePassword(500*time.Millisecond, 64*1024, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(64*1024), c.Memory())
+	assert.Equal(t, uint32(7), c.Time())
+	assert.Equal(t, 448*time.Millisecond, d)
+
+	// Memory is lowered when one iteration is too slow
+	c, d, err = TunePassword(40*time.Millisecond, 64*1024, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(32*1024), c.Memory())
+	assert.Equal(t, uint32(1), c.Time())
+	assert.Equal(t, 32*time.Millisecond, d)
+
+	_, _, err = TunePassword(time.Millisecond, 64*1024, 1)
+	assert.Error(t, err)
+}
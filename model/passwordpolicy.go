@@ -0,0 +1,213 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Codes of password policy violations returned to clients
+const (
+	ViolationTooShort         = "too_short"
+	ViolationTooLong          = "too_long"
+	ViolationTooFewClasses    = "too_few_character_classes"
+	ViolationContainsUsername = "contains_username"
+	ViolationContainsEmail    = "contains_email"
+	ViolationTooPredictable   = "too_predictable"
+	ViolationBreached         = "breached"
+)
+
+// Defaults of password policy
+const (
+	DefaultPasswordMinLength  = 8
+	DefaultPasswordMaxLength  = 128
+	DefaultPasswordMinClasses = 1
+	DefaultPasswordMinEntropy = 35
+
+	msgPasswordRejected      = "Password does not meet policy"
+	msgErrorCheckingBreaches = "Error checking password in breach corpus"
+	// minUserInfoLength is the shortest user name or email local part which is looked for in password
+	minUserInfoLength = 3
+)
+
+// BreachChecker tells whether password appeared in breach corpus
+type BreachChecker interface {
+	Breached(password string) (bool, error)
+}
+
+// PasswordPolicy describes passwords users may set
+type PasswordPolicy struct {
+	// MinLength is the fewest characters of password
+	MinLength int
+	// MaxLength is the most bytes of password, it bounds work of hashing huge passwords, 0 means unlimited
+	MaxLength int
+	// MinClasses is the fewest classes of characters out of lower case, upper case, digits and others
+	MinClasses int
+	// MinEntropy is the fewest bits of estimated entropy, 0 disables the estimate
+	MinEntropy float64
+	// AllowUserInfo lets password contain user name or local part of email
+	AllowUserInfo bool
+	// Breaches rejects passwords from breach corpus, nil disables the check
+	Breaches BreachChecker
+}
+
+// passwordPolicy is checked when users are added or updated
+var passwordPolicy = PasswordPolicy{
+	MinLength:  DefaultPasswordMinLength,
+	MaxLength:  DefaultPasswordMaxLength,
+	MinClasses: DefaultPasswordMinClasses,
+	MinEntropy: DefaultPasswordMinEntropy,
+}
+
+// SetPasswordPolicy replaces policy of new passwords, it must be called before users are added
+func SetPasswordPolicy(p PasswordPolicy) {
+	passwordPolicy = p
+}
+
+// PasswordPolicyError is returned for password which violates policy
+type PasswordPolicyError struct {
+	// Violations are codes of rules password breaks, e.g. ViolationTooShort
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return msgPasswordRejected + ": " + strings.Join(e.Violations, ", ")
+}
+
+// ValidatePassword returns *PasswordPolicyError when password of user violates the current policy
+func ValidatePassword(user *User) error {
+	violations, err := passwordPolicy.Check(user.Password, user.Username, user.Email)
+	if err != nil {
+		return errors.Wrap(err, msgErrorCheckingBreaches)
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// Check returns codes of rules password of user with username and email violates
+func (p *PasswordPolicy) Check(password, username, email string) ([]string, error) {
+	var violations []string
+
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, ViolationTooShort)
+	}
+
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, ViolationTooLong)
+	}
+
+	if characterClasses(password) < p.MinClasses {
+		violations = append(violations, ViolationTooFewClasses)
+	}
+
+	if !p.AllowUserInfo {
+		lower := strings.ToLower(password)
+
+		if containsInfo(lower, username) {
+			violations = append(violations, ViolationContainsUsername)
+		}
+
+		if i := strings.Index(email, "@"); i >= 0 && containsInfo(lower, email[:i]) {
+			violations = append(violations, ViolationContainsEmail)
+		}
+	}
+
+	if p.MinEntropy > 0 && passwordEntropy(password) < p.MinEntropy {
+		violations = append(violations, ViolationTooPredictable)
+	}
+
+	// Breach corpus is checked only for passwords passing the other rules, they would be rejected anyway
+	if p.Breaches != nil && len(violations) == 0 {
+		breached, err := p.Breaches.Breached(password)
+		if err != nil {
+			return nil, err
+		}
+
+		if breached {
+			violations = append(violations, ViolationBreached)
+		}
+	}
+
+	return violations, nil
+}
+
+// containsInfo reports whether lower case password contains info long enough to be guessed from it
+func containsInfo(password, info string) bool {
+	return len(info) >= minUserInfoLength && strings.Contains(password, strings.ToLower(info))
+}
+
+// characterClasses returns number of classes password has characters of
+func characterClasses(password string) int {
+	var lower, upper, digit, other int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
+
+// passwordEntropy estimates bits of entropy of password as if its characters were picked at random from
+// alphabets of classes it has. Character repeating the previous one or continuing a sequence like abc or 321
+// adds nothing, so aaaaaaaa and 12345678 are cheap.
+func passwordEntropy(password string) float64 {
+	alphabet := 0
+	seen := map[string]bool{}
+
+	for _, r := range password {
+		class, size := "other", 33
+		switch {
+		case r > unicode.MaxASCII:
+			class, size = "unicode", 100
+		case unicode.IsLower(r):
+			class, size = "lower", 26
+		case unicode.IsUpper(r):
+			class, size = "upper", 26
+		case unicode.IsDigit(r):
+			class, size = "digit", 10
+		}
+
+		if !seen[class] {
+			seen[class] = true
+			alphabet += size
+		}
+	}
+
+	if alphabet == 0 {
+		return 0
+	}
+
+	effective := 0
+	var prev, prevStep rune
+
+	for i, r := range []rune(password) {
+		step := r - prev
+
+		// Repeated character and the third one of a sequence are guessed from the previous ones
+		if i == 0 || step != 0 && !((step == 1 || step == -1) && step == prevStep) {
+			effective++
+		}
+
+		prev, prevStep = r, step
+	}
+
+	return float64(effective) * math.Log2(float64(alphabet))
+}
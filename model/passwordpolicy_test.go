@@ -0,0 +1,100 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 8, MaxLength: 64, MinClasses: 2, MinEntropy: 35}
+
+	tests := []struct {
+		password   string
+		violations []string
+	}{
+		{"correct horse battery", nil},
+		{"Tr0ub4dor&3", nil},
+		{"", []string{ViolationTooShort, ViolationTooFewClasses, ViolationTooPredictable}},
+		{"x7#Lq", []string{ViolationTooShort, ViolationTooPredictable}},
+		{strings.Repeat("aB3$", 20), []string{ViolationTooLong}},
+		{"zqwtkvbnmp", []string{ViolationTooFewClasses}},
+		{"Ostap2020!", []string{ViolationContainsUsername}},
+		{"pedro.p 2020", []string{ViolationContainsEmail}},
+		{"aaaaaaaa11", []string{ViolationTooPredictable}},
+		{"abcdefgh123456", []string{ViolationTooPredictable}},
+	}
+
+	for _, tt := range tests {
+		violations, err := p.Check(tt.password, "ostap", "pedro.p@company.com")
+		require.NoError(t, err)
+		assert.Equal(t, tt.violations, violations, tt.password)
+	}
+
+	p.AllowUserInfo = true
+	violations, err := p.Check("Ostap2020!", "ostap", "pedro.p@company.com")
+	require.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+type breachesMock map[string]bool
+
+func (b breachesMock) Breached(password string) (bool, error) {
+	if password == "unavailable" {
+		return false, errors.New("corpus is unavailable")
+	}
+
+	return b[password], nil
+}
+
+func TestPasswordPolicyBreaches(t *testing.T) {
+	p := &PasswordPolicy{MinLength: 8, Breaches: breachesMock{"Tr0ub4dor&3": true, "x7#Lq": true}}
+
+	violations, err := p.Check("Tr0ub4dor&3", "ostap", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ViolationBreached}, violations)
+
+	// Corpus is not consulted for password breaking other rules
+	violations, err = p.Check("x7#Lq", "ostap", "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ViolationTooShort}, violations)
+
+	_, err = p.Check("unavailable", "ostap", "")
+	assert.Error(t, err)
+}
+
+func TestPasswordEntropy(t *testing.T) {
+	assert.Equal(t, 0.0, passwordEntropy(""))
+	// Repeats and sequences add nothing
+	assert.Equal(t, passwordEntropy("a"), passwordEntropy("aaaaaaaa"))
+	assert.Equal(t, passwordEntropy("19"), passwordEntropy("12345678"))
+	assert.Equal(t, passwordEntropy("ab"), passwordEntropy("abcdef"))
+	assert.InDelta(t, 8*5.954, passwordEntropy("Tr0ub4do"), 0.01)
+}
+
+func TestUsersRepoRejectsWeakPassword(t *testing.T) {
+	db, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	userRepo := NewUsersRepo(db)
+
+	for _, err := range []error{
+		userRepo.Add(&User{Username: "user1", Password: ""}),
+		userRepo.Update(&User{Username: "user1", Password: "user1user1"}),
+	} {
+		require.IsType(t, &PasswordPolicyError{}, err)
+		assert.NotEmpty(t, err.(*PasswordPolicyError).Violations)
+	}
+
+	defer SetPasswordPolicy(passwordPolicy)
+	SetPasswordPolicy(PasswordPolicy{AllowUserInfo: true})
+
+	assert.NoError(t, ValidatePassword(&User{Username: "user1", Password: "user1"}))
+}
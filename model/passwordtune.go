@@ -0,0 +1,56 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// measureHash returns how long one hash with config takes on this host
+var measureHash = func(c *PasswordConfig) time.Duration {
+	salt := make([]byte, lengthSalt)
+
+	start := time.Now()
+	argon2.IDKey([]byte("benchmark password"), salt, c.time, c.memory, c.threads, c.keyLen)
+
+	return time.Since(start)
+}
+
+// TunePassword benchmarks this host and returns the strongest parameters which hash a password within target,
+// together with measured time of one hash. Memory starts at maxMemory KiB and is halved until one iteration
+// fits into target, then iterations are added while they fit.
+func TunePassword(target time.Duration, maxMemory uint32, threads uint8) (*PasswordConfig, time.Duration, error) {
+	c, err := NewCustomPasswordConfig(minConfigTime, maxMemory, threads, passwordConfig.keyLen)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d := measureHash(c)
+
+	for d > target && c.memory/2 >= minConfigMemory {
+		c.memory /= 2
+		d = measureHash(c)
+	}
+
+	if d > target {
+		return nil, 0, fmt.Errorf("one hash with %d KiB takes %s, which is longer than %s", c.memory, d, target)
+	}
+
+	// Time of hash grows with iterations linearly, the estimate is checked and lowered until it fits
+	estimate := *c
+	estimate.time = uint32(target / d)
+
+	for estimate.time > c.time {
+		ed := measureHash(&estimate)
+		if ed <= target {
+			return &estimate, ed, nil
+		}
+
+		estimate.time--
+	}
+
+	return c, d, nil
+}
@@ -0,0 +1,147 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// minPepperLength is the shortest pepper key in bytes
+	minPepperLength = 32
+	pepperKeyID     = ",keyid="
+)
+
+// ErrUnknownPepper is returned when password hash was peppered with key which is not configured
+var ErrUnknownPepper = errors.New("Password hash was peppered with unknown key")
+
+var pepperIDFormat = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// pepper is mixed into new password hashes, nil keeps them unpeppered
+var pepper *Pepper
+
+// SetPepper replaces pepper of password hashes, it must be called before passwords are hashed
+func SetPepper(p *Pepper) {
+	pepper = p
+}
+
+// Pepper is set of secret keys, password is replaced with its HMAC-SHA256 under the key before argon2id,
+// so hashes leaked from database can not be cracked without the key. Id of the key is stored in the hash,
+// new hashes use the current key and older keys verify hashes until they are peppered again on login.
+type Pepper struct {
+	current string
+	keys    map[string][]byte
+}
+
+// ParsePepper parses lines `id:key` with key in base64, the first key is the current one.
+// Empty lines and lines starting with # are skipped.
+func ParsePepper(data []byte) (*Pepper, error) {
+	p := &Pepper{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("pepper line has no key id")
+		}
+
+		id := line[:i]
+		if !pepperIDFormat.MatchString(id) {
+			return nil, fmt.Errorf("pepper key id %q may have only letters, digits, '.', '_' and '-'", id)
+		}
+
+		if _, ok := p.keys[id]; ok {
+			return nil, fmt.Errorf("pepper key id %q is repeated", id)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(line[i+1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding of pepper key %q failed", id)
+		}
+
+		if len(key) < minPepperLength {
+			return nil, fmt.Errorf("pepper key %q is shorter than %d bytes", id, minPepperLength)
+		}
+
+		if p.current == "" {
+			p.current = id
+		}
+
+		p.keys[id] = key
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if p.current == "" {
+		return nil, fmt.Errorf("pepper has no keys")
+	}
+
+	return p, nil
+}
+
+// Current returns id of the key new hashes are peppered with
+func (p *Pepper) Current() string {
+	return p.current
+}
+
+// apply returns password peppered with key id
+func (p *Pepper) apply(id, password string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, ErrUnknownPepper
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(password))
+
+	return mac.Sum(nil), nil
+}
+
+// splitKeyID returns argon2id parameters of hash without key id and the key id, which is empty for
+// hashes without pepper
+func splitKeyID(params string) (string, string) {
+	i := strings.Index(params, pepperKeyID)
+	if i < 0 {
+		return params, ""
+	}
+
+	return params[:i], params[i+len(pepperKeyID):]
+}
+
+// pepperPassword returns password peppered with key id, password is not changed when id is empty
+func pepperPassword(id, password string) ([]byte, error) {
+	if id == "" {
+		return []byte(password), nil
+	}
+
+	if pepper == nil {
+		return nil, ErrUnknownPepper
+	}
+
+	return pepper.apply(id, password)
+}
+
+// currentKeyID returns id of pepper key of new hashes, empty when pepper is not configured
+func currentKeyID() string {
+	if pepper == nil {
+		return ""
+	}
+
+	return pepper.current
+}
@@ -0,0 +1,84 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testPepperNew = "2020-05:QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE="
+	testPepperOld = "2020-01:QkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkJCQkI="
+)
+
+func TestParsePepper(t *testing.T) {
+	p, err := ParsePepper([]byte("# current key first\n" + testPepperNew + "\n\n" + testPepperOld + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "2020-05", p.Current())
+	assert.Len(t, p.keys, 2)
+
+	for _, bad := range []string{
+		"",
+		"# no keys",
+		"QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE=",
+		"2020$05:QUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUFBQUE=",
+		"2020-05:QUFBQQ==",
+		"2020-05:not base64",
+		testPepperNew + "\n" + testPepperNew,
+	} {
+		_, err = ParsePepper([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestPepperRotation(t *testing.T) {
+	defer SetPepper(nil)
+
+	plain, err := EncodePassword(NewPasswordConfig(), "ostap")
+	require.NoError(t, err)
+
+	old, err := ParsePepper([]byte(testPepperOld))
+	require.NoError(t, err)
+	SetPepper(old)
+
+	// Hashes without pepper are still verified and get peppered on login
+	ok, err := ComparePassword("ostap", plain)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, NeedsRehash(plain))
+
+	peppered, err := EncodePassword(NewPasswordConfig(), "ostap")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(peppered, "$argon2id$v=19$m=65536,t=3,p=1,keyid=2020-01$"), peppered)
+	assert.False(t, NeedsRehash(peppered))
+
+	rotated, err := ParsePepper([]byte(testPepperNew + "\n" + testPepperOld))
+	require.NoError(t, err)
+	SetPepper(rotated)
+
+	ok, err = ComparePassword("ostap", peppered)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, NeedsRehash(peppered))
+
+	ok, err = ComparePassword("wrongPassword", peppered)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The key is needed to verify the hash
+	SetPepper(nil)
+
+	_, err = ComparePassword("ostap", peppered)
+	assert.Equal(t, ErrUnknownPepper, err)
+
+	current, err := ParsePepper([]byte(testPepperNew))
+	require.NoError(t, err)
+	SetPepper(current)
+
+	_, err = ComparePassword("ostap", peppered)
+	assert.Equal(t, ErrUnknownPepper, err)
+}
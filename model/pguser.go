@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lvl484/user-manager/logger"
 	"github.com/pkg/errors"
 )
 
@@ -15,18 +16,41 @@ const (
 		last_name, phone, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`
 	queryUpdate = `UPDATE users SET (password,email,first_name, last_name, phone, 
 		updated_at)=($1,$2,$3,$4,$5,$6) WHERE user_name=$7`
-	queryDelete             = `DELETE FROM users WHERE user_name=$1`
-	queryDisable            = `UPDATE users SET salted=$1 WHERE user_name=$2`
-	querySelectInfo         = `SELECT id,user_name,password,email,first_name, last_name, phone, salted FROM users WHERE user_name=$1`
+	queryRehash     = `UPDATE users SET password=$1 WHERE user_name=$2 AND password=$3`
+	queryDelete     = `DELETE FROM users WHERE user_name=$1`
+	queryDisable    = `UPDATE users SET salted=$1 WHERE user_name=$2`
+	querySelectInfo = `SELECT u.id,u.user_name,u.password,u.email,u.first_name, u.last_name, u.phone, u.salted,
+		f.locked_until FROM users u LEFT JOIN login_failures f ON f.kind='user' AND f.subject=u.user_name
+		WHERE u.user_name=$1`
 	msgUserDisable          = "User is disabled"
 	msgErrorHashingPassword = "Error hashing password"
 	msgErrorGeneratingUUID  = "Error generating new UUID for user"
 	msgUserDidNotExist      = "There is no such user in database"
+	msgErrorRevoking        = "Error revoking user credentials"
 )
 
-//UsersRepo structure that contain pointer to database
+var (
+	// ErrUserNotFound is returned when there is no user with requested login
+	ErrUserNotFound = errors.New(msgUserDidNotExist)
+	// ErrUserDisabled is returned for disabled user
+	ErrUserDisabled = errors.New(msgUserDisable)
+)
+
+// CredentialsRevoker revokes credentials issued to user, when user loses access
+type CredentialsRevoker interface {
+	RevokeUser(login string) error
+}
+
+// CredentialsInvalidator forgets cached verifications of user credentials
+type CredentialsInvalidator interface {
+	InvalidateUser(login string)
+}
+
+// UsersRepo structure that contain pointer to database
 type UsersRepo struct {
-	db *sql.DB
+	db           *sql.DB
+	revokers     []CredentialsRevoker
+	invalidators []CredentialsInvalidator
 }
 
 // NeUsersRepo returns UsersRepo with db
@@ -34,8 +58,42 @@ func NewUsersRepo(data *sql.DB) *UsersRepo {
 	return &UsersRepo{db: data}
 }
 
-// Add adds new user to database
+// AddRevoker registers revoker, which is called when user is disabled or deleted
+func (ur *UsersRepo) AddRevoker(r CredentialsRevoker) {
+	ur.revokers = append(ur.revokers, r)
+}
+
+// AddInvalidator registers invalidator, which is called when user is updated, disabled or deleted
+func (ur *UsersRepo) AddInvalidator(i CredentialsInvalidator) {
+	ur.invalidators = append(ur.invalidators, i)
+}
+
+// invalidate forgets cached verifications of the user credentials
+func (ur *UsersRepo) invalidate(login string) {
+	for _, i := range ur.invalidators {
+		i.InvalidateUser(login)
+	}
+}
+
+// revoke revokes credentials of the user with all registered revokers
+func (ur *UsersRepo) revoke(login string) error {
+	for _, r := range ur.revokers {
+		err := r.RevokeUser(login)
+		if err != nil {
+			return errors.Wrap(err, msgErrorRevoking)
+		}
+	}
+
+	return nil
+}
+
+// Add adds new user to database, password violating policy is rejected with *PasswordPolicyError
 func (ur *UsersRepo) Add(user *User) error {
+	err := ValidatePassword(user)
+	if err != nil {
+		return err
+	}
+
 	pwd, err := EncodePassword(NewPasswordConfig(), user.Password)
 	if err != nil {
 		return errors.Wrap(err, msgErrorHashingPassword)
@@ -49,20 +107,70 @@ func (ur *UsersRepo) Add(user *User) error {
 	return err
 }
 
-// Update update information about user in database
+// Update update information about user in database, password violating policy is rejected with *PasswordPolicyError
 func (ur *UsersRepo) Update(user *User) error {
+	err := ValidatePassword(user)
+	if err != nil {
+		return err
+	}
+
 	pwd, err := EncodePassword(NewPasswordConfig(), user.Password)
 	if err != nil {
 		return errors.Wrap(err, msgErrorHashingPassword)
 	}
 	_, err = ur.db.Exec(queryUpdate, pwd, user.Email, user.FirstName, user.LastName, user.Phone, time.Now(), user.Username)
+	ur.invalidate(user.Username)
 
 	return err
 }
 
+// Rehash hashes verified password of user again with the current config, when its hash was produced
+// with weaker parameters or legacy algorithm. Hash changed meanwhile, e.g. by password update, is not replaced.
+func (ur *UsersRepo) Rehash(login, password, oldHash string) error {
+	pwd, err := EncodePassword(NewPasswordConfig(), password)
+	if err != nil {
+		return errors.Wrap(err, msgErrorHashingPassword)
+	}
+
+	_, err = ur.db.Exec(queryRehash, pwd, login, oldHash)
+
+	return err
+}
+
+// VerifyAndUpgrade reports whether password matches hash of user found by GetInfo. Hash produced with
+// weaker parameters, legacy algorithm or old pepper is upgraded in background, login does not wait for it
+// and does not fail when it can not be.
+func (ur *UsersRepo) VerifyAndUpgrade(user *User, password string) (bool, error) {
+	matched, err := ComparePassword(password, user.Password)
+	if err != nil || !matched {
+		return false, err
+	}
+
+	if NeedsRehash(user.Password) {
+		go ur.upgrade(user.Username, password, user.Password)
+	}
+
+	return true, nil
+}
+
+// upgrade rehashes password of user and logs failure, login it runs after has already succeeded
+func (ur *UsersRepo) upgrade(login, password, oldHash string) {
+	err := ur.Rehash(login, password, oldHash)
+	if err != nil {
+		logger.Component(logger.ComponentAuth).WithField("user", login).Errorf("Password rehash failed: %v", err)
+	}
+}
+
 // Delete delete information about user in database
 func (ur *UsersRepo) Delete(login string) error {
-	_, err := ur.db.Exec(queryDelete, login)
+	// Credentials are revoked first, revokers may need the user to find them
+	err := ur.revoke(login)
+	if err != nil {
+		return err
+	}
+
+	_, err = ur.db.Exec(queryDelete, login)
+	ur.invalidate(login)
 
 	return err
 }
@@ -70,8 +178,13 @@ func (ur *UsersRepo) Delete(login string) error {
 // Disable deactivate information about user in database
 func (ur *UsersRepo) Disable(login string) error {
 	_, err := ur.db.Exec(queryDisable, "true", login)
+	ur.invalidate(login)
 
-	return err
+	if err != nil {
+		return err
+	}
+
+	return ur.revoke(login)
 }
 
 // Activate deactivate information about user in database
@@ -81,20 +194,26 @@ func (ur *UsersRepo) Activate(login string) error {
 	return err
 }
 
-// GetInfo get user information from database
+// GetInfo get user information from database, locked user is returned with UserLocked status
 func (ur *UsersRepo) GetInfo(login string) (*User, error) {
 	var usr User
 	var salted bool
+	var lockedUntil *time.Time
 	err := ur.db.QueryRow(querySelectInfo, login).Scan(&usr.ID, &usr.Username, &usr.Password,
-		&usr.Email, &usr.FirstName, &usr.LastName, &usr.Phone, &salted)
+		&usr.Email, &usr.FirstName, &usr.LastName, &usr.Phone, &salted, &lockedUntil)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.Wrap(err, msgUserDidNotExist)
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
 	if salted {
-		return nil, errors.New(msgUserDisable)
+		return nil, ErrUserDisabled
+	}
+
+	usr.Status = UserActive
+	if locked(lockedUntil, time.Now()) {
+		usr.Status, usr.LockedUntil = UserLocked, lockedUntil
 	}
 
 	return &usr, nil
@@ -12,6 +12,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewUsersRepo(t *testing.T) {
@@ -170,13 +171,14 @@ func TestGetInfo(t *testing.T) {
 		FirstName: "Pedro",
 		LastName:  "Petrenko",
 		Phone:     "77777777777",
+		Status:    UserActive,
 	}
 
 	userRepo := NewUsersRepo(db)
 
-	rowsInfo := sqlmock.NewRows([]string{"id", "user_name", "password", "email", "first_name", "last_name", "phone", "salted"}).
+	rowsInfo := sqlmock.NewRows([]string{"id", "user_name", "password", "email", "first_name", "last_name", "phone", "salted", "locked_until"}).
 		AddRow("3b60ac82-5e8f-4010-ac99-2344cfa72ce0", "user1", "$argon2id$v=19$m=65536,t=3,p=1$BCDndJ1kUOAAW/mwP7ViOQ$Ig4hpteBW1YM7Lrh3EHkHQ",
-			"email1@company.com", "Pedro", "Petrenko", "77777777777", "false")
+			"email1@company.com", "Pedro", "Petrenko", "77777777777", "false", time.Now().Add(-time.Minute))
 
 	mock.ExpectQuery(regexp.QuoteMeta(querySelectInfo)).
 		WithArgs("user1").
@@ -186,9 +188,23 @@ func TestGetInfo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, &user1, user)
 
-	rowsDisabled := sqlmock.NewRows([]string{"id", "user_name", "password", "email", "first_name", "last_name", "phone", "salted"}).
+	lockedUntil := time.Now().Add(time.Minute)
+	rowsLocked := sqlmock.NewRows([]string{"id", "user_name", "password", "email", "first_name", "last_name", "phone", "salted", "locked_until"}).
 		AddRow("3b60ac82-5e8f-4010-ac99-2344cfa72ce0", "user1", "$argon2id$v=19$m=65536,t=3,p=1$BCDndJ1kUOAAW/mwP7ViOQ$Ig4hpteBW1YM7Lrh3EHkHQ",
-			"email1@company.com", "Pedro", "Petrenko", "77777777777", "true")
+			"email1@company.com", "Pedro", "Petrenko", "77777777777", "false", lockedUntil)
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectInfo)).
+		WithArgs("user1").
+		WillReturnRows(rowsLocked)
+
+	user, err = userRepo.GetInfo("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, UserLocked, user.Status)
+	assert.Equal(t, &lockedUntil, user.LockedUntil)
+
+	rowsDisabled := sqlmock.NewRows([]string{"id", "user_name", "password", "email", "first_name", "last_name", "phone", "salted", "locked_until"}).
+		AddRow("3b60ac82-5e8f-4010-ac99-2344cfa72ce0", "user1", "$argon2id$v=19$m=65536,t=3,p=1$BCDndJ1kUOAAW/mwP7ViOQ$Ig4hpteBW1YM7Lrh3EHkHQ",
+			"email1@company.com", "Pedro", "Petrenko", "77777777777", "true", nil)
 
 	mock.ExpectQuery(regexp.QuoteMeta(querySelectInfo)).
 		WithArgs("user1").
@@ -198,3 +214,125 @@ func TestGetInfo(t *testing.T) {
 	assert.Error(t, err)
 
 }
+
+type revokerMock []string
+
+func (r *revokerMock) RevokeUser(login string) error {
+	*r = append(*r, login)
+	return nil
+}
+
+func TestRevokersOnDisableAndDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	revoker := &revokerMock{}
+	userRepo := NewUsersRepo(db)
+	userRepo.AddRevoker(revoker)
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDisable)).
+		WithArgs("true", "user1").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDelete)).
+		WithArgs("user2").
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, userRepo.Disable("user1"))
+	assert.NoError(t, userRepo.Delete("user2"))
+	assert.Equal(t, &revokerMock{"user1", "user2"}, revoker)
+}
+
+func TestInvalidatorsOnUpdateDisableAndDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	cache, err := NewCredentialCache(time.Minute, 10)
+	require.NoError(t, err)
+
+	userRepo := NewUsersRepo(db)
+	userRepo.AddInvalidator(cache)
+
+	for _, login := range []string{"user1", "user2", "user3"} {
+		cache.Put(login, "password", &User{Username: login}, cache.Generation(login))
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(queryUpdate)).
+		WithArgs(sqlmock.AnyArg(), "", "", "", "", sqlmock.AnyArg(), "user1").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDisable)).
+		WithArgs("true", "user2").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDelete)).
+		WithArgs("user3").
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, userRepo.Update(&User{Username: "user1", Password: "changed password"}))
+	assert.NoError(t, userRepo.Disable("user2"))
+	assert.NoError(t, userRepo.Delete("user3"))
+
+	for _, login := range []string{"user1", "user2", "user3"} {
+		_, ok := cache.Get(login, "password")
+		assert.False(t, ok, login)
+	}
+}
+
+func TestRehash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	old := "$argon2id$v=19$m=65536,t=1,p=1$L/cXOPSeeE9f68JKienFug$52t2o11NiXF/gr0wCF514g"
+
+	mock.ExpectExec(regexp.QuoteMeta(queryRehash)).
+		WithArgs(sqlmock.AnyArg(), "user1", old).
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, NewUsersRepo(db).Rehash("user1", "password", old))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyAndUpgrade(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	userRepo := NewUsersRepo(db)
+
+	current, err := EncodePassword(NewPasswordConfig(), "1q2w3e4r")
+	require.NoError(t, err)
+
+	// Hash with fewer iterations than the current config
+	weak := "$argon2id$v=19$m=65536,t=1,p=1$lkSivcrDeHZ/BmZ5I8CVnw$VpZAWTT+w0KDA/e503EgGg"
+
+	// Wrong password and current hash are not rehashed
+	matched, err := userRepo.VerifyAndUpgrade(&User{Username: "user1", Password: weak}, "wrong")
+	assert.NoError(t, err)
+	assert.False(t, matched)
+
+	matched, err = userRepo.VerifyAndUpgrade(&User{Username: "user1", Password: current}, "1q2w3e4r")
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	_, err = userRepo.VerifyAndUpgrade(&User{Username: "user1", Password: "$argon2id$malformed"}, "1q2w3e4r")
+	assert.Error(t, err)
+
+	// Weak hash is upgraded in background after login
+	mock.ExpectExec(regexp.QuoteMeta(queryRehash)).
+		WithArgs(sqlmock.AnyArg(), "user1", weak).
+		WillReturnResult(driver.RowsAffected(1))
+
+	matched, err = userRepo.VerifyAndUpgrade(&User{Username: "user1", Password: weak}, "1q2w3e4r")
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	assert.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, time.Millisecond)
+}
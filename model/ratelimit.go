@@ -0,0 +1,64 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lvl484/user-manager/ratelimit"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Bucket of key ($1) is moved forward by refill interval ($3, microseconds) from now ($2) or from the time
+	// it is full again, whichever is later, unless that goes beyond period ($4, microseconds) from now
+	queryTakeRateLimit = `INSERT INTO rate_limits(key, full_at) VALUES ($1, $2::timestamp + $3 * INTERVAL '1 microsecond')
+		ON CONFLICT (key) DO UPDATE SET full_at=GREATEST(rate_limits.full_at, $2::timestamp) + $3 * INTERVAL '1 microsecond'
+		WHERE GREATEST(rate_limits.full_at, $2::timestamp) + $3 * INTERVAL '1 microsecond' <=
+		$2::timestamp + $4 * INTERVAL '1 microsecond' RETURNING full_at`
+	querySelectRateLimit    = `SELECT full_at FROM rate_limits WHERE key=$1`
+	queryDeleteRateLimits   = `DELETE FROM rate_limits WHERE full_at <= $1`
+	msgErrorTakingRateLimit = "Error taking rate limit token"
+)
+
+// RateLimitsRepo keeps token buckets of rate limits in the database, so limits are shared by all servers
+type RateLimitsRepo struct {
+	db *sql.DB
+}
+
+func NewRateLimitsRepo(data *sql.DB) *RateLimitsRepo {
+	return &RateLimitsRepo{db: data}
+}
+
+// Take takes a token from bucket of key when bucket is not empty at now,
+// it returns time the bucket is full again and whether the token was taken
+func (rr *RateLimitsRepo) Take(key string, rate ratelimit.Rate, now time.Time) (time.Time, bool, error) {
+	var fullAt time.Time
+
+	err := rr.db.QueryRow(queryTakeRateLimit, key, now, rate.Interval().Microseconds(),
+		rate.Period.Microseconds()).Scan(&fullAt)
+	if err == nil {
+		return fullAt, true, nil
+	}
+
+	if err != sql.ErrNoRows {
+		return time.Time{}, false, errors.Wrap(err, msgErrorTakingRateLimit)
+	}
+
+	// Bucket is empty, it is read again to tell when it is refilled
+	err = rr.db.QueryRow(querySelectRateLimit, key).Scan(&fullAt)
+	if err != nil {
+		return time.Time{}, false, errors.Wrap(err, msgErrorTakingRateLimit)
+	}
+
+	return fullAt, false, nil
+}
+
+// Sweep removes buckets which are full at now
+func (rr *RateLimitsRepo) Sweep(now time.Time) error {
+	_, err := rr.db.Exec(queryDeleteRateLimits, now)
+
+	return err
+}
@@ -0,0 +1,81 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/ratelimit"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRate = ratelimit.Rate{Limit: 10, Period: time.Minute}
+
+func TestRateLimitsRepoTake(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	fullAt := now.Add(6 * time.Second)
+
+	mock.ExpectQuery(regexp.QuoteMeta(queryTakeRateLimit)).
+		WithArgs("login:ip:10.0.0.1", now, int64(6000000), int64(60000000)).
+		WillReturnRows(sqlmock.NewRows([]string{"full_at"}).AddRow(fullAt))
+
+	got, ok, err := NewRateLimitsRepo(db).Take("login:ip:10.0.0.1", testRate, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, fullAt, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRateLimitsRepoTakeEmpty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	fullAt := now.Add(time.Minute)
+
+	mock.ExpectQuery(regexp.QuoteMeta(queryTakeRateLimit)).
+		WithArgs("login:ip:10.0.0.1", now, int64(6000000), int64(60000000)).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectRateLimit)).
+		WithArgs("login:ip:10.0.0.1").
+		WillReturnRows(sqlmock.NewRows([]string{"full_at"}).AddRow(fullAt))
+
+	got, ok, err := NewRateLimitsRepo(db).Take("login:ip:10.0.0.1", testRate, now)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, fullAt, got)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRateLimitsRepoSweep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteRateLimits)).
+		WithArgs(now).
+		WillReturnResult(driver.RowsAffected(3))
+
+	require.NoError(t, NewRateLimitsRepo(db).Sweep(now))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,306 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lvl484/user-manager/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	queryInsertRefreshToken = `INSERT INTO refresh_tokens(id, token_hash, family_id, user_id, client_id, scope,
+		created_at, expires_at, auth_time, amr, user_agent, ip_address) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
+	querySelectRefreshToken = `SELECT r.id, r.family_id, r.user_id, r.client_id, r.scope, r.expires_at, r.used_at, r.revoked_at,
+		r.auth_time, r.amr, u.user_name, u.salted FROM refresh_tokens r JOIN users u ON u.id = r.user_id WHERE r.token_hash=$1 FOR UPDATE OF r`
+	queryFindRefreshToken = `SELECT r.id, r.family_id, r.user_id, r.client_id, r.scope, r.expires_at, r.used_at, r.revoked_at,
+		r.auth_time, r.amr, u.user_name, u.salted FROM refresh_tokens r JOIN users u ON u.id = r.user_id WHERE r.token_hash=$1`
+	queryUseRefreshToken     = `UPDATE refresh_tokens SET used_at=$1 WHERE id=$2`
+	queryRevokeRefreshFamily = `UPDATE refresh_tokens SET revoked_at=$1 WHERE revoked_at IS NULL
+		AND family_id=(SELECT family_id FROM refresh_tokens WHERE token_hash=$2)`
+	queryRevokeFamilyByID    = `UPDATE refresh_tokens SET revoked_at=$1 WHERE revoked_at IS NULL AND family_id=$2`
+	queryRevokeRefreshClient = `UPDATE refresh_tokens SET revoked_at=$1 WHERE revoked_at IS NULL
+		AND user_id=$2 AND client_id=$3`
+	queryRevokeRefreshUser = `UPDATE refresh_tokens SET revoked_at=$1 WHERE revoked_at IS NULL
+		AND user_id=(SELECT id FROM users WHERE user_name=$2)`
+	// Family ids come from request path, they are compared as text so malformed ids are not found instead of failing
+	queryRevokeRefreshUserFamily = `UPDATE refresh_tokens SET revoked_at=$1 WHERE revoked_at IS NULL
+		AND user_id=(SELECT id FROM users WHERE user_name=$2) AND family_id::text=$3`
+	// querySelectUserRefreshTokens returns the active token of every family of user, most recently used first.
+	// Family was created with its first token and last used when its active token was issued.
+	querySelectUserRefreshTokens = `SELECT r.family_id, r.client_id, r.scope, r.user_agent, r.ip_address,
+		(SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = r.family_id), r.created_at, r.expires_at
+		FROM refresh_tokens r JOIN users u ON u.id = r.user_id WHERE u.user_name=$1 AND r.used_at IS NULL
+		AND r.revoked_at IS NULL AND r.expires_at > $2 ORDER BY r.created_at DESC`
+	msgErrorGeneratingToken = "Error generating refresh token"
+	msgErrorRotatingToken   = "Error rotating refresh token"
+	msgErrorReadingToken    = "Error reading refresh tokens"
+	msgErrorRevokingToken   = "Error revoking refresh token"
+)
+
+// FirstPartyClientID is client id of refresh tokens issued at POST /token. Registered OAuth clients always
+// have an id, so their tokens can not be rotated as first-party ones.
+const FirstPartyClientID = ""
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired or revoked token and for token of other client
+	ErrRefreshTokenInvalid = errors.New("Refresh token is invalid")
+	// ErrRefreshTokenReused is returned when already rotated token is presented again,
+	// whole token family is revoked in this case
+	ErrRefreshTokenReused = errors.New("Refresh token reuse detected")
+	// ErrRefreshTokenNotFound is returned when user has no active token family with given id
+	ErrRefreshTokenNotFound = errors.New("Refresh token not found")
+)
+
+// RefreshToken is a long-lived credential bound to user and client.
+// Every use rotates it to a new token of the same family.
+type RefreshToken struct {
+	ID       string
+	FamilyID string
+	UserID   string
+	Username string
+	ClientID string
+	// Scope granted to the token family, access tokens issued for it can not have wider scope
+	Scope     string
+	ExpiresAt time.Time
+	// AuthTime is when user authenticated to get the first token of family and AMR are methods used,
+	// every token of the family keeps them. AuthTime is zero when authentication time is not known.
+	AuthTime time.Time
+	AMR      []string
+	// UserAgent and IPAddress are of the request the token was issued to
+	UserAgent string
+	IPAddress string
+	// CreatedAt is when the family was created and LastSeenAt when the token was issued, that is when
+	// the family was last used
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// RefreshTokensRepo stores hashes of refresh tokens
+type RefreshTokensRepo struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewRefreshTokensRepo returns RefreshTokensRepo with db, issued tokens expire after ttl
+func NewRefreshTokensRepo(data *sql.DB, ttl time.Duration) *RefreshTokensRepo {
+	return &RefreshTokensRepo{db: data, ttl: ttl}
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Create issues token of a new family for user and client with granted scope, user authenticated at authTime
+// with amr methods. Token is issued to request from ip with userAgent.
+func (rr *RefreshTokensRepo) Create(userID, clientID, scope string, authTime time.Time, amr []string,
+	userAgent, ip string) (string, error) {
+	family, err := uuid.NewRandom()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorGeneratingToken)
+	}
+
+	return rr.insert(rr.db, &RefreshToken{FamilyID: family.String(), UserID: userID, ClientID: clientID, Scope: scope,
+		AuthTime: authTime, AMR: amr, UserAgent: userAgent, IPAddress: ip})
+}
+
+// insert stores new token of the family of rt and returns its raw value
+func (rr *RefreshTokensRepo) insert(ex execer, rt *RefreshToken) (string, error) {
+	raw, hash, err := token.NewOpaque()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorGeneratingToken)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorGeneratingToken)
+	}
+
+	now := time.Now()
+
+	_, err = ex.Exec(queryInsertRefreshToken, id, hash, rt.FamilyID, rt.UserID, rt.ClientID, rt.Scope, now,
+		now.Add(rr.ttl), nullTime(rt.AuthTime), strings.Join(rt.AMR, " "), rt.UserAgent, rt.IPAddress)
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// Rotate exchanges token for a new one of the same family, which records userAgent and ip of the request.
+// Presenting already used token revokes the whole family.
+func (rr *RefreshTokensRepo) Rotate(raw, clientID, userAgent, ip string) (*RefreshToken, string, error) {
+	tx, err := rr.db.Begin()
+	if err != nil {
+		return nil, "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		rt            RefreshToken
+		used, revoked *time.Time
+		authTime      *time.Time
+		amr           string
+		userDisabled  bool
+	)
+
+	err = tx.QueryRow(querySelectRefreshToken, token.HashOpaque(raw)).Scan(&rt.ID, &rt.FamilyID, &rt.UserID,
+		&rt.ClientID, &rt.Scope, &rt.ExpiresAt, &used, &revoked, &authTime, &amr, &rt.Username, &userDisabled)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrRefreshTokenInvalid
+	}
+
+	if err != nil {
+		return nil, "", errors.Wrap(err, msgErrorRotatingToken)
+	}
+
+	rt.AuthTime, rt.AMR = timeValue(authTime), strings.Fields(amr)
+
+	now := time.Now()
+
+	switch {
+	case revoked != nil || rt.ClientID != clientID || !now.Before(rt.ExpiresAt):
+		return nil, "", ErrRefreshTokenInvalid
+	case used != nil || userDisabled:
+		_, err = tx.Exec(queryRevokeFamilyByID, now, rt.FamilyID)
+		if err != nil {
+			return nil, "", errors.Wrap(err, msgErrorRotatingToken)
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, "", errors.Wrap(err, msgErrorRotatingToken)
+		}
+
+		if userDisabled {
+			return nil, "", ErrRefreshTokenInvalid
+		}
+
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec(queryUseRefreshToken, now, rt.ID)
+	if err != nil {
+		return nil, "", errors.Wrap(err, msgErrorRotatingToken)
+	}
+
+	rt.UserAgent, rt.IPAddress = userAgent, ip
+
+	next, err := rr.insert(tx, &rt)
+	if err != nil {
+		return nil, "", errors.Wrap(err, msgErrorRotatingToken)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, "", errors.Wrap(err, msgErrorRotatingToken)
+	}
+
+	return &rt, next, nil
+}
+
+// Find returns active token, ErrRefreshTokenInvalid is returned for used, revoked and expired tokens
+// and for tokens of disabled users
+func (rr *RefreshTokensRepo) Find(raw string) (*RefreshToken, error) {
+	var (
+		rt            RefreshToken
+		used, revoked *time.Time
+		authTime      *time.Time
+		amr           string
+		userDisabled  bool
+	)
+
+	err := rr.db.QueryRow(queryFindRefreshToken, token.HashOpaque(raw)).Scan(&rt.ID, &rt.FamilyID, &rt.UserID,
+		&rt.ClientID, &rt.Scope, &rt.ExpiresAt, &used, &revoked, &authTime, &amr, &rt.Username, &userDisabled)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if used != nil || revoked != nil || userDisabled || !time.Now().Before(rt.ExpiresAt) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	rt.AuthTime, rt.AMR = timeValue(authTime), strings.Fields(amr)
+
+	return &rt, nil
+}
+
+// Revoke revokes token and all tokens of its family
+func (rr *RefreshTokensRepo) Revoke(raw string) error {
+	_, err := rr.db.Exec(queryRevokeRefreshFamily, time.Now(), token.HashOpaque(raw))
+
+	return err
+}
+
+// RevokeClient revokes all tokens of the user issued to client
+func (rr *RefreshTokensRepo) RevokeClient(userID, clientID string) error {
+	_, err := rr.db.Exec(queryRevokeRefreshClient, time.Now(), userID, clientID)
+
+	return err
+}
+
+// RevokeUser revokes all tokens of the user
+func (rr *RefreshTokensRepo) RevokeUser(login string) error {
+	_, err := rr.db.Exec(queryRevokeRefreshUser, time.Now(), login)
+
+	return err
+}
+
+// List returns the active token of every family of user with login, most recently used first
+func (rr *RefreshTokensRepo) List(login string) ([]*RefreshToken, error) {
+	rows, err := rr.db.Query(querySelectUserRefreshTokens, login, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingToken)
+	}
+	defer rows.Close()
+
+	var tokens []*RefreshToken
+
+	for rows.Next() {
+		var rt RefreshToken
+
+		err = rows.Scan(&rt.FamilyID, &rt.ClientID, &rt.Scope, &rt.UserAgent, &rt.IPAddress, &rt.CreatedAt,
+			&rt.LastSeenAt, &rt.ExpiresAt)
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorReadingToken)
+		}
+
+		rt.Username = login
+		tokens = append(tokens, &rt)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingToken)
+	}
+
+	return tokens, nil
+}
+
+// RevokeFamily revokes all tokens of family with id of user with login
+func (rr *RefreshTokensRepo) RevokeFamily(login, id string) error {
+	res, err := rr.db.Exec(queryRevokeRefreshUserFamily, time.Now(), login, id)
+	if err != nil {
+		return errors.Wrap(err, msgErrorRevokingToken)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorRevokingToken)
+	}
+
+	if n == 0 {
+		return ErrRefreshTokenNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lvl484/user-manager/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var refreshTokenColumns = []string{"id", "family_id", "user_id", "client_id", "scope", "expires_at", "used_at", "revoked_at",
+	"auth_time", "amr", "user_name", "salted"}
+
+func TestRefreshTokensRepoCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewRefreshTokensRepo(db, time.Hour)
+	authTime := time.Now()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertRefreshToken)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "user-id", "web", "profile", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			authTime, "pwd otp", "Firefox", "10.0.0.1").
+		WillReturnResult(driver.RowsAffected(1))
+
+	raw, err := repo.Create("user-id", "web", "profile", authTime, []string{"pwd", "otp"}, "Firefox", "10.0.0.1")
+	require.NoError(t, err)
+	assert.NotEmpty(t, raw)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokensRepoRotate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewRefreshTokensRepo(db, time.Hour)
+	expires := time.Now().Add(time.Hour)
+	authTime := time.Now().Add(-time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectRefreshToken)).
+		WithArgs(token.HashOpaque("raw")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow("id", "family", "user-id", "web", "profile", expires, nil, nil, authTime, "pwd", "i3odja", false))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseRefreshToken)).
+		WithArgs(sqlmock.AnyArg(), "id").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertRefreshToken)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "family", "user-id", "web", "profile", sqlmock.AnyArg(), sqlmock.AnyArg(),
+			authTime, "pwd", "curl/7.68.0", "10.0.0.2").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	rt, next, err := repo.Rotate("raw", "web", "curl/7.68.0", "10.0.0.2")
+	require.NoError(t, err)
+	assert.NotEmpty(t, next)
+	assert.Equal(t, "i3odja", rt.Username)
+	assert.Equal(t, "family", rt.FamilyID)
+	assert.Equal(t, "profile", rt.Scope)
+	assert.Equal(t, authTime, rt.AuthTime)
+	assert.Equal(t, []string{"pwd"}, rt.AMR)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokensRepoRotateReuse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewRefreshTokensRepo(db, time.Hour)
+	expires, used := time.Now().Add(time.Hour), time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectRefreshToken)).
+		WithArgs(token.HashOpaque("raw")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow("id", "family", "user-id", "web", "profile", expires, used, nil, nil, "", "i3odja", false))
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeFamilyByID)).
+		WithArgs(sqlmock.AnyArg(), "family").
+		WillReturnResult(driver.RowsAffected(3))
+	mock.ExpectCommit()
+
+	_, _, err = repo.Rotate("raw", "web", "Firefox", "10.0.0.1")
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokensRepoRotateInvalid(t *testing.T) {
+	expires, expired, revoked := time.Now().Add(time.Hour), time.Now().Add(-time.Hour), time.Now()
+
+	tests := []struct {
+		name     string
+		clientID string
+		row      []driver.Value
+	}{
+		{
+			name:     "Expired",
+			clientID: "web",
+			row:      []driver.Value{"id", "family", "user-id", "web", "profile", expired, nil, nil, nil, "", "i3odja", false},
+		}, {
+			name:     "Revoked",
+			clientID: "web",
+			row:      []driver.Value{"id", "family", "user-id", "web", "profile", expires, nil, revoked, nil, "", "i3odja", false},
+		}, {
+			name:     "Other client",
+			clientID: "mobile",
+			row:      []driver.Value{"id", "family", "user-id", "web", "profile", expires, nil, nil, nil, "", "i3odja", false},
+		}, {
+			// Token of OAuth client is not rotated at POST /token/refresh
+			name:     "OAuth client",
+			clientID: FirstPartyClientID,
+			row:      []driver.Value{"id", "family", "user-id", "spa", "profile", expires, nil, nil, nil, "", "i3odja", false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(regexp.QuoteMeta(querySelectRefreshToken)).
+				WillReturnRows(sqlmock.NewRows(refreshTokenColumns).AddRow(tt.row...))
+			mock.ExpectRollback()
+
+			_, _, err = NewRefreshTokensRepo(db, time.Hour).Rotate("raw", tt.clientID, "Firefox", "10.0.0.1")
+			assert.Equal(t, ErrRefreshTokenInvalid, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRefreshTokensRepoRevoke(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewRefreshTokensRepo(db, time.Hour)
+
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeRefreshFamily)).
+		WithArgs(sqlmock.AnyArg(), token.HashOpaque("raw")).
+		WillReturnResult(driver.RowsAffected(2))
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeRefreshUser)).
+		WithArgs(sqlmock.AnyArg(), "i3odja").
+		WillReturnResult(driver.RowsAffected(5))
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeRefreshClient)).
+		WithArgs(sqlmock.AnyArg(), "user-id", "web").
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, repo.Revoke("raw"))
+	assert.NoError(t, repo.RevokeUser("i3odja"))
+	assert.NoError(t, repo.RevokeClient("user-id", "web"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokensRepoFind(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expires := time.Now().Add(time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(queryFindRefreshToken)).
+		WithArgs(token.HashOpaque("active")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow("id", "family", "user-id", "web", "profile", expires, nil, nil, nil, "", "i3odja", false))
+	mock.ExpectQuery(regexp.QuoteMeta(queryFindRefreshToken)).
+		WithArgs(token.HashOpaque("disabled")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow("id", "family", "user-id", "web", "profile", expires, nil, nil, nil, "", "i3odja", true))
+	mock.ExpectQuery(regexp.QuoteMeta(queryFindRefreshToken)).
+		WithArgs(token.HashOpaque("unknown")).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns))
+
+	repo := NewRefreshTokensRepo(db, time.Hour)
+
+	rt, err := repo.Find("active")
+	require.NoError(t, err)
+	assert.Equal(t, "i3odja", rt.Username)
+
+	_, err = repo.Find("disabled")
+	assert.Equal(t, ErrRefreshTokenInvalid, err)
+
+	_, err = repo.Find("unknown")
+	assert.Equal(t, ErrRefreshTokenInvalid, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokensRepoList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectUserRefreshTokens)).
+		WithArgs("i3odja", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"family_id", "client_id", "scope", "user_agent", "ip_address",
+			"created_at", "last_seen_at", "expires_at"}).
+			AddRow("family", "umcli", "profile", "umcli/1.0", "10.0.0.2", now.Add(-time.Hour), now, now.Add(time.Hour)))
+
+	tokens, err := NewRefreshTokensRepo(db, time.Hour).List("i3odja")
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "family", tokens[0].FamilyID)
+	assert.Equal(t, "umcli/1.0", tokens[0].UserAgent)
+	assert.Equal(t, now.Add(-time.Hour), tokens[0].CreatedAt)
+	assert.Equal(t, now, tokens[0].LastSeenAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokensRepoRevokeFamily(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeRefreshUserFamily)).
+		WithArgs(sqlmock.AnyArg(), "i3odja", "family").
+		WillReturnResult(driver.RowsAffected(2))
+	mock.ExpectExec(regexp.QuoteMeta(queryRevokeRefreshUserFamily)).
+		WithArgs(sqlmock.AnyArg(), "i3odja", "other").
+		WillReturnResult(driver.RowsAffected(0))
+
+	repo := NewRefreshTokensRepo(db, time.Hour)
+
+	require.NoError(t, repo.RevokeFamily("i3odja", "family"))
+	assert.Equal(t, ErrRefreshTokenNotFound, repo.RevokeFamily("i3odja", "other"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
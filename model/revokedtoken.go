@@ -0,0 +1,45 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	queryInsertRevokedToken = `INSERT INTO revoked_tokens(id, expires_at) VALUES ($1,$2) ON CONFLICT (id) DO NOTHING`
+	queryDeleteRevokedToken = `DELETE FROM revoked_tokens WHERE expires_at < $1`
+	querySelectRevokedToken = `SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE id=$1)`
+)
+
+// RevokedTokensRepo keeps ids of revoked access tokens until they expire
+type RevokedTokensRepo struct {
+	db *sql.DB
+}
+
+// NewRevokedTokensRepo returns RevokedTokensRepo with db
+func NewRevokedTokensRepo(data *sql.DB) *RevokedTokensRepo {
+	return &RevokedTokensRepo{db: data}
+}
+
+// Revoke records id of token, which expires at expiresAt. Records of already expired tokens are removed.
+func (tr *RevokedTokensRepo) Revoke(id string, expiresAt time.Time) error {
+	_, err := tr.db.Exec(queryInsertRevokedToken, id, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tr.db.Exec(queryDeleteRevokedToken, time.Now())
+
+	return err
+}
+
+// IsRevoked reports whether token with id was revoked
+func (tr *RevokedTokensRepo) IsRevoked(id string) (bool, error) {
+	var revoked bool
+
+	err := tr.db.QueryRow(querySelectRevokedToken, id).Scan(&revoked)
+
+	return revoked, err
+}
@@ -0,0 +1,43 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevokedTokensRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	expires := time.Now().Add(time.Minute)
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertRevokedToken)).
+		WithArgs("jti", expires).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteRevokedToken)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(3))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectRevokedToken)).
+		WithArgs("jti").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	repo := NewRevokedTokensRepo(db)
+
+	require.NoError(t, repo.Revoke("jti", expires))
+
+	revoked, err := repo.IsRevoked("jti")
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,317 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lvl484/user-manager/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	queryInsertSession = `INSERT INTO sessions(id, token_hash, user_id, csrf_token, user_agent, ip_address, created_at,
+		last_seen_at, expires_at, mfa_pending, auth_time, amr) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`
+	// queryTouchSession extends idle timeout of active session of enabled user and returns it,
+	// $4 selects sessions waiting for second factor instead of signed in ones
+	queryTouchSession = `UPDATE sessions s SET last_seen_at=$2 FROM users u
+		WHERE u.id = s.user_id AND s.token_hash=$1 AND s.expires_at > $2 AND s.last_seen_at > $3 AND NOT u.salted
+		AND s.mfa_pending=$4
+		RETURNING s.id, s.user_id, u.user_name, s.csrf_token, s.user_agent, s.ip_address, s.created_at,
+		s.last_seen_at, s.expires_at, s.mfa_pending, s.auth_time, s.amr`
+	// queryCompleteSession adds method of second factor, authentication time is when it passed
+	queryCompleteSession = `UPDATE sessions SET mfa_pending=false, amr=amr || ' ' || $2, auth_time=$3
+		WHERE token_hash=$1 AND mfa_pending RETURNING user_id`
+	// querySelectUserSessions returns active sessions of user, most recently used first
+	querySelectUserSessions = `SELECT s.id, s.user_id, u.user_name, s.csrf_token, s.user_agent, s.ip_address, s.created_at,
+		s.last_seen_at, s.expires_at, s.mfa_pending, s.auth_time, s.amr FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE u.user_name=$1 AND s.expires_at > $2 AND s.last_seen_at > $3 AND NOT s.mfa_pending
+		ORDER BY s.last_seen_at DESC`
+	// queryEvictSessions keeps only $4 most recently used active signed in sessions of user. Sessions waiting
+	// for second factor are neither counted nor ended, so password alone can not end sessions of the user.
+	queryEvictSessions = `DELETE FROM sessions WHERE user_id=$1 AND NOT mfa_pending AND id NOT IN (SELECT id
+		FROM sessions WHERE user_id=$1 AND NOT mfa_pending AND expires_at > $2 AND last_seen_at > $3
+		ORDER BY last_seen_at DESC LIMIT $4)`
+	queryDeleteSession      = `DELETE FROM sessions WHERE token_hash=$1`
+	queryDeleteUserSessions = `DELETE FROM sessions WHERE user_id=(SELECT id FROM users WHERE user_name=$1)`
+	// Session ids come from request path, they are compared as text so malformed ids are not found instead of failing
+	queryDeleteUserSession   = `DELETE FROM sessions WHERE user_id=(SELECT id FROM users WHERE user_name=$1) AND id::text=$2`
+	queryDeleteOtherSessions = `DELETE FROM sessions WHERE user_id=(SELECT id FROM users WHERE user_name=$1)
+		AND id::text <> $2`
+	msgErrorCreatingSession = "Error creating session"
+	msgErrorReadingSession  = "Error reading session"
+	msgErrorDeletingSession = "Error deleting session"
+)
+
+var (
+	// ErrSessionInvalid is returned for unknown, expired or idle session and for session of disabled user
+	ErrSessionInvalid = errors.New("Session is invalid")
+	// ErrSessionNotFound is returned when user has no session with given id
+	ErrSessionNotFound = errors.New("Session not found")
+)
+
+// Session is a browser session started on login page, browser keeps its token in a cookie
+type Session struct {
+	ID       string
+	UserID   string
+	Username string
+	// CSRFToken must be sent with every form posted within the session
+	CSRFToken  string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// ExpiresAt is absolute timeout, session ends then regardless of activity
+	ExpiresAt time.Time
+	// Pending session authenticated user with password only, it is not signed in until second factor passes
+	Pending bool
+	// AuthTime is when user last authenticated and AMR are methods used, see token.AMRPassword and others
+	AuthTime time.Time
+	AMR      []string
+}
+
+// SessionsRepo stores hashes of session tokens
+type SessionsRepo struct {
+	db *sql.DB
+	// idle is how long session lives without requests
+	idle time.Duration
+	// ttl is how long session lives at most
+	ttl time.Duration
+	// max is number of concurrent sessions of user, 0 means unlimited
+	max int
+}
+
+// NewSessionsRepo returns SessionsRepo with db, sessions end after idle timeout without requests
+// and after ttl since login at the latest. When user has more than max sessions, least recently used
+// ones are ended, max 0 allows any number of sessions.
+func NewSessionsRepo(data *sql.DB, idle, ttl time.Duration, max int) *SessionsRepo {
+	return &SessionsRepo{db: data, idle: idle, ttl: ttl, max: max}
+}
+
+// Create starts session of user authenticated with method and returns its raw token. Sessions of user
+// over the limit are ended. Pending session has to be completed after second factor of user passes,
+// it counts to the limit only then.
+func (sr *SessionsRepo) Create(user *User, userAgent, ip, method string, pending bool) (string, *Session, error) {
+	raw, hash, err := token.NewOpaque()
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	csrf, _, err := token.NewOpaque()
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	now := time.Now()
+
+	s := &Session{
+		ID:         id.String(),
+		UserID:     user.ID,
+		Username:   user.Username,
+		CSRFToken:  csrf,
+		UserAgent:  userAgent,
+		IPAddress:  ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(sr.ttl),
+		Pending:    pending,
+		AuthTime:   now,
+		AMR:        []string{method},
+	}
+
+	tx, err := sr.db.Begin()
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(queryInsertSession, s.ID, hash, s.UserID, s.CSRFToken, s.UserAgent, s.IPAddress, s.CreatedAt,
+		s.LastSeenAt, s.ExpiresAt, s.Pending, s.AuthTime, method)
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	if !pending {
+		err = sr.evict(tx, s.UserID, now)
+		if err != nil {
+			return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", nil, errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	return raw, s, nil
+}
+
+// Touch returns active session by raw token and records activity, so idle timeout starts again
+func (sr *SessionsRepo) Touch(raw string) (*Session, error) {
+	return sr.touch(raw, false)
+}
+
+// TouchPending returns active session waiting for second factor by raw token
+func (sr *SessionsRepo) TouchPending(raw string) (*Session, error) {
+	return sr.touch(raw, true)
+}
+
+// Complete signs in pending session after second factor of user passed with method,
+// sessions of user over the limit are ended
+func (sr *SessionsRepo) Complete(raw, method string) error {
+	now := time.Now()
+
+	tx, err := sr.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, msgErrorCreatingSession)
+	}
+	defer tx.Rollback()
+
+	var userID string
+
+	err = tx.QueryRow(queryCompleteSession, token.HashOpaque(raw), method, now).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return ErrSessionInvalid
+	}
+
+	if err != nil {
+		return errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	err = sr.evict(tx, userID, now)
+	if err != nil {
+		return errors.Wrap(err, msgErrorCreatingSession)
+	}
+
+	return errors.Wrap(tx.Commit(), msgErrorCreatingSession)
+}
+
+// evict ends least recently used signed in sessions of user over the limit
+func (sr *SessionsRepo) evict(ex execer, userID string, now time.Time) error {
+	if sr.max == 0 {
+		return nil
+	}
+
+	_, err := ex.Exec(queryEvictSessions, userID, now, now.Add(-sr.idle), sr.max)
+
+	return err
+}
+
+func (sr *SessionsRepo) touch(raw string, pending bool) (*Session, error) {
+	now := time.Now()
+
+	var s Session
+
+	err := scanSession(sr.db.QueryRow(queryTouchSession, token.HashOpaque(raw), now, now.Add(-sr.idle), pending), &s)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionInvalid
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingSession)
+	}
+
+	return &s, nil
+}
+
+// List returns active sessions of user with login, most recently used first
+func (sr *SessionsRepo) List(login string) ([]*Session, error) {
+	now := time.Now()
+
+	rows, err := sr.db.Query(querySelectUserSessions, login, now, now.Add(-sr.idle))
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingSession)
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+
+	for rows.Next() {
+		var s Session
+
+		err = scanSession(rows, &s)
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorReadingSession)
+		}
+
+		sessions = append(sessions, &s)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingSession)
+	}
+
+	return sessions, nil
+}
+
+// DeleteByID ends session of user with login by session id
+func (sr *SessionsRepo) DeleteByID(login, id string) error {
+	res, err := sr.db.Exec(queryDeleteUserSession, login, id)
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingSession)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingSession)
+	}
+
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// DeleteOthers ends all sessions of user with login except session with id keep
+func (sr *SessionsRepo) DeleteOthers(login, keep string) error {
+	_, err := sr.db.Exec(queryDeleteOtherSessions, login, keep)
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingSession)
+	}
+
+	return nil
+}
+
+// Delete ends session by raw token, unknown tokens are ignored
+func (sr *SessionsRepo) Delete(raw string) error {
+	_, err := sr.db.Exec(queryDeleteSession, token.HashOpaque(raw))
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingSession)
+	}
+
+	return nil
+}
+
+// RevokeUser ends all sessions of user, it is called when user is disabled or deleted
+func (sr *SessionsRepo) RevokeUser(login string) error {
+	_, err := sr.db.Exec(queryDeleteUserSessions, login)
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingSession)
+	}
+
+	return nil
+}
+
+func scanSession(row scanner, s *Session) error {
+	var amr string
+
+	err := row.Scan(&s.ID, &s.UserID, &s.Username, &s.CSRFToken, &s.UserAgent, &s.IPAddress, &s.CreatedAt,
+		&s.LastSeenAt, &s.ExpiresAt, &s.Pending, &s.AuthTime, &amr)
+	if err != nil {
+		return err
+	}
+
+	s.AMR = strings.Fields(amr)
+
+	return nil
+}
@@ -0,0 +1,222 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lvl484/user-manager/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sessionColumns = []string{"id", "user_id", "user_name", "csrf_token", "user_agent", "ip_address", "created_at",
+	"last_seen_at", "expires_at", "mfa_pending", "auth_time", "amr"}
+
+func TestSessionsRepoCreate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := &User{ID: "5b5e8c7a-0000-4000-8000-000000000001", Username: "i3odja"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertSession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, sqlmock.AnyArg(), "Firefox", "10.0.0.1", sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), false, sqlmock.AnyArg(), "pwd").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	raw, s, err := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 0).Create(user, "Firefox", "10.0.0.1", "pwd", false)
+	require.NoError(t, err)
+	assert.NotEmpty(t, raw)
+	assert.NotEmpty(t, s.CSRFToken)
+	assert.NotEqual(t, raw, s.CSRFToken)
+	assert.Equal(t, "i3odja", s.Username)
+	assert.Equal(t, []string{"pwd"}, s.AMR)
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), s.ExpiresAt, time.Minute)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionsRepoCreateOverLimit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	user := &User{ID: "5b5e8c7a-0000-4000-8000-000000000001", Username: "i3odja"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertSession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, sqlmock.AnyArg(), "Firefox", "10.0.0.1", sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), false, sqlmock.AnyArg(), "pwd").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryEvictSessions)).
+		WithArgs(user.ID, sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Session waiting for second factor does not end other sessions
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertSession)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), user.ID, sqlmock.AnyArg(), "curl/7.68.0", "10.0.0.2", sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), true, sqlmock.AnyArg(), "pwd").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	repo := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 2)
+
+	_, _, err = repo.Create(user, "Firefox", "10.0.0.1", "pwd", false)
+	require.NoError(t, err)
+
+	_, _, err = repo.Create(user, "curl/7.68.0", "10.0.0.2", "pwd", true)
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionsRepoList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectUserSessions)).
+		WithArgs("i3odja", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("sid1", "uid", "i3odja", "csrf1", "Firefox", "10.0.0.1", now, now, now.Add(time.Hour), false, now, "pwd").
+			AddRow("sid2", "uid", "i3odja", "csrf2", "curl/7.68.0", "10.0.0.2", now, now, now.Add(time.Hour), false, now, "pwd"))
+
+	sessions, err := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 0).List("i3odja")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "sid1", sessions[0].ID)
+	assert.Equal(t, "curl/7.68.0", sessions[1].UserAgent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionsRepoTouch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(queryTouchSession)).
+		WithArgs(token.HashOpaque("raw"), sqlmock.AnyArg(), sqlmock.AnyArg(), false).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("sid", "uid", "i3odja", "csrf", "Firefox", "10.0.0.1", now, now, now.Add(time.Hour), false, now, "pwd"))
+	mock.ExpectQuery(regexp.QuoteMeta(queryTouchSession)).
+		WithArgs(token.HashOpaque("expired"), sqlmock.AnyArg(), sqlmock.AnyArg(), false).
+		WillReturnRows(sqlmock.NewRows(sessionColumns))
+
+	repo := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 0)
+
+	s, err := repo.Touch("raw")
+	require.NoError(t, err)
+	assert.Equal(t, "sid", s.ID)
+	assert.Equal(t, "i3odja", s.Username)
+	assert.Equal(t, "csrf", s.CSRFToken)
+	assert.Equal(t, []string{"pwd"}, s.AMR)
+	assert.Equal(t, now, s.AuthTime)
+
+	_, err = repo.Touch("expired")
+	assert.Equal(t, ErrSessionInvalid, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionsRepoPending(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(queryTouchSession)).
+		WithArgs(token.HashOpaque("raw"), sqlmock.AnyArg(), sqlmock.AnyArg(), true).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("sid", "uid", "i3odja", "csrf", "Firefox", "10.0.0.1", now, now, now.Add(time.Hour), true, now, "pwd"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(queryCompleteSession)).
+		WithArgs(token.HashOpaque("raw"), "otp", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("uid"))
+	// Completed session counts to the limit
+	mock.ExpectExec(regexp.QuoteMeta(queryEvictSessions)).
+		WithArgs("uid", sqlmock.AnyArg(), sqlmock.AnyArg(), 2).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(queryCompleteSession)).
+		WithArgs(token.HashOpaque("raw"), "otp", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+
+	repo := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 2)
+
+	s, err := repo.TouchPending("raw")
+	require.NoError(t, err)
+	assert.True(t, s.Pending)
+
+	require.NoError(t, repo.Complete("raw", "otp"))
+	assert.Equal(t, ErrSessionInvalid, repo.Complete("raw", "otp"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionsRepoDelete(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteSession)).
+		WithArgs(token.HashOpaque("raw")).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteUserSessions)).
+		WithArgs("i3odja").
+		WillReturnResult(driver.RowsAffected(2))
+
+	repo := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 0)
+
+	require.NoError(t, repo.Delete("raw"))
+	require.NoError(t, repo.RevokeUser("i3odja"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSessionsRepoDeleteByID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteUserSession)).
+		WithArgs("i3odja", "sid").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteUserSession)).
+		WithArgs("i3odja", "other").
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteOtherSessions)).
+		WithArgs("i3odja", "sid").
+		WillReturnResult(driver.RowsAffected(3))
+
+	repo := NewSessionsRepo(db, 30*time.Minute, 12*time.Hour, 0)
+
+	require.NoError(t, repo.DeleteByID("i3odja", "sid"))
+	assert.Equal(t, ErrSessionNotFound, repo.DeleteByID("i3odja", "other"))
+	require.NoError(t, repo.DeleteOthers("i3odja", "sid"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,81 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lvl484/user-manager/token"
+	"github.com/pkg/errors"
+)
+
+const (
+	querySelectKeys     = `SELECT id, algorithm, private_key, activate_at FROM signing_keys`
+	queryInsertKey      = `INSERT INTO signing_keys(id, algorithm, private_key, activate_at, created_at) VALUES ($1,$2,$3,$4,$5)`
+	queryDeleteKey      = `DELETE FROM signing_keys WHERE id=$1`
+	msgErrorEncodingKey = "Error encoding signing key"
+	msgErrorReadingKey  = "Error reading signing key"
+	msgErrorParsingKey  = "Error parsing signing key"
+)
+
+// SigningKeysRepo stores token signing keys shared by all replicas
+type SigningKeysRepo struct {
+	db *sql.DB
+}
+
+// NewSigningKeysRepo returns SigningKeysRepo with db
+func NewSigningKeysRepo(data *sql.DB) *SigningKeysRepo {
+	return &SigningKeysRepo{db: data}
+}
+
+// Keys returns all stored keys
+func (kr *SigningKeysRepo) Keys() ([]*token.Key, error) {
+	rows, err := kr.db.Query(querySelectKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*token.Key
+
+	for rows.Next() {
+		var (
+			id, algorithm, private string
+			activateAt             time.Time
+		)
+
+		err = rows.Scan(&id, &algorithm, &private, &activateAt)
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorReadingKey)
+		}
+
+		key, err := token.ParseKey(id, algorithm, activateAt, []byte(private))
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorParsingKey)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// AddKey stores new key
+func (kr *SigningKeysRepo) AddKey(key *token.Key) error {
+	private, err := key.MarshalPrivate()
+	if err != nil {
+		return errors.Wrap(err, msgErrorEncodingKey)
+	}
+
+	_, err = kr.db.Exec(queryInsertKey, key.ID, key.Algorithm, string(private), key.ActivateAt, time.Now())
+
+	return err
+}
+
+// DeleteKey removes retired key
+func (kr *SigningKeysRepo) DeleteKey(id string) error {
+	_, err := kr.db.Exec(queryDeleteKey, id)
+
+	return err
+}
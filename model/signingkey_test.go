@@ -0,0 +1,54 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lvl484/user-manager/token"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigningKeysRepo(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	repo := NewSigningKeysRepo(db)
+
+	key, err := token.GenerateKey(token.AlgorithmEdDSA, time.Now())
+	require.NoError(t, err)
+
+	private, err := key.MarshalPrivate()
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertKey)).
+		WithArgs(key.ID, key.Algorithm, string(private), key.ActivateAt, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, repo.AddKey(key))
+
+	rows := sqlmock.NewRows([]string{"id", "algorithm", "private_key", "activate_at"}).
+		AddRow(key.ID, key.Algorithm, string(private), key.ActivateAt)
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectKeys)).WillReturnRows(rows)
+
+	keys, err := repo.Keys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.JWK(), keys[0].JWK())
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteKey)).
+		WithArgs(key.ID).
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, repo.DeleteKey(key.ID))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,50 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const queryInsertTokenExchange = `INSERT INTO token_exchanges(token_id, client_id, subject_id, subject_name, actor_id,
+	actor_name, impersonation, audience, scope, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`
+
+// TokenExchange is audit record of token issued by token exchange (RFC 8693)
+type TokenExchange struct {
+	// TokenID is jti of issued token
+	TokenID  string
+	ClientID string
+	// SubjectID and SubjectName identify user or client the token is issued for
+	SubjectID   string
+	SubjectName string
+	// ActorID and ActorName identify party which acts as the subject
+	ActorID       string
+	ActorName     string
+	Impersonation bool
+	Audience      []string
+	Scope         string
+	CreatedAt     time.Time
+}
+
+// TokenExchangesRepo is audit trail of token exchanges
+type TokenExchangesRepo struct {
+	db *sql.DB
+}
+
+// NewTokenExchangesRepo returns TokenExchangesRepo with db
+func NewTokenExchangesRepo(data *sql.DB) *TokenExchangesRepo {
+	return &TokenExchangesRepo{db: data}
+}
+
+// Record writes exchange to audit trail
+func (er *TokenExchangesRepo) Record(e *TokenExchange) error {
+	e.CreatedAt = time.Now()
+
+	_, err := er.db.Exec(queryInsertTokenExchange, e.TokenID, e.ClientID, e.SubjectID, e.SubjectName, e.ActorID,
+		e.ActorName, e.Impersonation, pq.Array(e.Audience), e.Scope, e.CreatedAt)
+
+	return err
+}
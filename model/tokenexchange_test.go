@@ -0,0 +1,40 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenExchangesRepoRecord(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	e := &TokenExchange{
+		TokenID:     "jti",
+		ClientID:    "gateway",
+		SubjectID:   "user-id",
+		SubjectName: "i3odja",
+		ActorID:     "gateway",
+		Audience:    []string{"https://billing.example.com"},
+		Scope:       "profile",
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertTokenExchange)).
+		WithArgs("jti", "gateway", "user-id", "i3odja", "gateway", "", false, pq.Array(e.Audience), "profile",
+			sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	assert.NoError(t, NewTokenExchangesRepo(db).Record(e))
+	assert.False(t, e.CreatedAt.IsZero())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
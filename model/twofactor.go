@@ -0,0 +1,469 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/token"
+	"github.com/lvl484/user-manager/totp"
+	"github.com/pkg/errors"
+)
+
+const (
+	// queryEnrollTOTP replaces secret of unconfirmed enrollment, confirmed secret is kept
+	queryEnrollTOTP = `INSERT INTO totp_secrets(user_id, secret, created_at) VALUES ($1,$2,$3)
+		ON CONFLICT (user_id) DO UPDATE SET secret=$2, created_at=$3, last_counter=0, failed_attempts=0,
+		locked_until=NULL WHERE totp_secrets.confirmed_at IS NULL`
+	querySelectTOTPForUpdate = `SELECT secret, last_counter, failed_attempts, locked_until, confirmed_at IS NOT NULL
+		FROM totp_secrets WHERE user_id=$1 FOR UPDATE`
+	queryConfirmTOTP = `UPDATE totp_secrets SET confirmed_at=$2, last_counter=$3 WHERE user_id=$1`
+	queryAcceptTOTP  = `UPDATE totp_secrets SET last_counter=$2, failed_attempts=0 WHERE user_id=$1`
+	queryFailTOTP    = `UPDATE totp_secrets SET failed_attempts=$2, locked_until=$3 WHERE user_id=$1`
+	// querySelectTwoFactor returns whether TOTP is confirmed, number of WebAuthn credentials and confirmed
+	// channel of one-time codes of user
+	querySelectTwoFactor = `SELECT EXISTS(SELECT 1 FROM totp_secrets WHERE user_id=$1 AND confirmed_at IS NOT NULL),
+		(SELECT count(*) FROM webauthn_credentials WHERE user_id=$1),
+		(SELECT channel FROM otp_factors WHERE user_id=$1 AND confirmed_at IS NOT NULL)`
+	// querySelectCodeFactor returns whether user has confirmed factor recovery codes stand in for
+	querySelectCodeFactor = `SELECT EXISTS(SELECT 1 FROM totp_secrets WHERE user_id=$1 AND confirmed_at IS NOT NULL)
+		OR EXISTS(SELECT 1 FROM otp_factors WHERE user_id=$1 AND confirmed_at IS NOT NULL)`
+	queryCountRecoveryCode = `SELECT count(*) FROM recovery_codes WHERE user_id=$1 AND used_at IS NULL`
+	queryUseRecoveryCode   = `UPDATE recovery_codes SET used_at=$3 WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`
+	queryDeleteRecovery    = `DELETE FROM recovery_codes WHERE user_id=$1`
+	queryInsertRecovery    = `INSERT INTO recovery_codes(user_id, code_hash) VALUES ($1,$2)`
+	queryDeleteTOTP        = `DELETE FROM totp_secrets WHERE user_id=$1`
+	queryResetTOTP         = `DELETE FROM totp_secrets WHERE user_id=(SELECT id FROM users WHERE user_name=$1)`
+	queryResetRecovery     = `DELETE FROM recovery_codes WHERE user_id=(SELECT id FROM users WHERE user_name=$1)`
+	queryResetWebAuthn     = `DELETE FROM webauthn_credentials WHERE user_id=(SELECT id FROM users WHERE user_name=$1)`
+
+	msgErrorEnrollingTOTP     = "Error enrolling TOTP"
+	msgErrorVerifyingFactor   = "Error verifying second factor"
+	msgErrorReadingFactor     = "Error reading second factor"
+	msgErrorGeneratingCodes   = "Error generating recovery codes"
+	msgErrorDeletingTwoFactor = "Error deleting second factor"
+
+	// recoveryCodeCount is number of recovery codes generated at once
+	recoveryCodeCount = 10
+	// recoveryCodeLength is number of random bytes in recovery code, 48 bits encoded as 10 characters
+	recoveryCodeLength = 6
+	// maxFactorAttempts is number of wrong codes after which second factor is locked for factorLockout
+	maxFactorAttempts = 5
+	factorLockout     = 5 * time.Minute
+)
+
+var (
+	// ErrTwoFactorEnabled is returned on enrollment when user already has confirmed second factor
+	ErrTwoFactorEnabled = errors.New("Two-factor authentication is already enabled")
+	// ErrTwoFactorNotEnrolled is returned when user has no second factor to confirm or verify
+	ErrTwoFactorNotEnrolled = errors.New("Two-factor authentication is not enrolled")
+	// ErrTwoFactorCodeInvalid is returned for wrong, expired or already used code
+	ErrTwoFactorCodeInvalid = errors.New("Two-factor authentication code is invalid")
+	// ErrTwoFactorLocked is returned after too many wrong codes until lockout ends
+	ErrTwoFactorLocked = errors.New("Two-factor authentication is locked")
+)
+
+// recoveryEncoding encodes recovery codes, they are typed by users, so case and padding do not matter
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorStatus describes second factor of user
+type TwoFactorStatus struct {
+	// TOTP is true when user confirmed TOTP enrollment
+	TOTP bool
+	// WebAuthnCredentials is number of registered WebAuthn credentials
+	WebAuthnCredentials int
+	// OTPChannel is confirmed channel of one-time codes, email or sms, empty when there is none
+	OTPChannel string
+	// RecoveryCodesLeft is number of unused recovery codes
+	RecoveryCodesLeft int
+}
+
+// Enabled reports whether user has any second factor
+func (s *TwoFactorStatus) Enabled() bool {
+	return s.TOTP || s.WebAuthnCredentials > 0 || s.OTPChannel != ""
+}
+
+// totpState is stored TOTP secret with its replay and brute force protection state
+type totpState struct {
+	secret      string
+	lastCounter int64
+	failed      int
+	lockedUntil *time.Time
+	confirmed   bool
+}
+
+// TwoFactorRepo stores TOTP secrets and hashes of one-time recovery codes
+type TwoFactorRepo struct {
+	db *sql.DB
+}
+
+// NewTwoFactorRepo returns TwoFactorRepo with db
+func NewTwoFactorRepo(data *sql.DB) *TwoFactorRepo {
+	return &TwoFactorRepo{db: data}
+}
+
+// EnrollTOTP generates new TOTP secret of user. Secret is not used for login until it is confirmed.
+func (tr *TwoFactorRepo) EnrollTOTP(userID string) (string, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+
+	res, err := tr.db.Exec(queryEnrollTOTP, userID, secret, time.Now())
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+
+	if n == 0 {
+		return "", ErrTwoFactorEnabled
+	}
+
+	return secret, nil
+}
+
+// ConfirmTOTP enables TOTP enrolled by user when code matches and returns new recovery codes
+func (tr *TwoFactorRepo) ConfirmTOTP(userID, code string) ([]string, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+	defer tx.Rollback()
+
+	state, err := selectTOTP(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if state.confirmed {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	now := time.Now()
+
+	counter, ok, err := totp.Validate(state.secret, code, now, state.lastCounter)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+
+	if !ok {
+		return nil, ErrTwoFactorCodeInvalid
+	}
+
+	_, err = tx.Exec(queryConfirmTOTP, userID, now, counter)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorEnrollingTOTP)
+	}
+
+	return codes, nil
+}
+
+// Enabled reports whether user has to pass second factor: TOTP, WebAuthn credential or code sent by email or SMS
+func (tr *TwoFactorRepo) Enabled(userID string) (bool, error) {
+	status, err := tr.selectStatus(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return status.Enabled(), nil
+}
+
+// Status returns second factors of user
+func (tr *TwoFactorRepo) Status(userID string) (*TwoFactorStatus, error) {
+	status, err := tr.selectStatus(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tr.db.QueryRow(queryCountRecoveryCode, userID).Scan(&status.RecoveryCodesLeft)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingFactor)
+	}
+
+	return status, nil
+}
+
+// Verify checks TOTP code, code sent by email or SMS, or recovery code of user. Every code is accepted
+// only once. After too many wrong codes second factor is locked for a while, so codes can not be guessed.
+func (tr *TwoFactorRepo) Verify(userID, code string) error {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, msgErrorVerifyingFactor)
+	}
+	defer tx.Rollback()
+
+	state, err := selectTOTP(tx, userID)
+
+	switch {
+	case err == ErrTwoFactorNotEnrolled:
+	case err != nil:
+		return err
+	case !state.confirmed:
+		state = nil
+	}
+
+	otp, err := selectOTP(tx, userID)
+	if err != nil {
+		return err
+	}
+
+	if otp != nil && !otp.confirmed {
+		otp = nil
+	}
+
+	if state == nil && otp == nil {
+		return ErrTwoFactorNotEnrolled
+	}
+
+	now := time.Now()
+
+	if state != nil && locked(state.lockedUntil, now) || otp != nil && locked(otp.lockedUntil, now) {
+		return ErrTwoFactorLocked
+	}
+
+	accepted, counter, err := tr.checkCode(tx, userID, code, state, otp, now)
+	if err != nil {
+		return err
+	}
+
+	// Successful code resets wrong attempts of all factors, wrong one counts for all of them
+	if state != nil {
+		if accepted {
+			_, err = tx.Exec(queryAcceptTOTP, userID, counter)
+		} else {
+			failed, lockedUntil := countFailure(state.failed, now)
+			_, err = tx.Exec(queryFailTOTP, userID, failed, lockedUntil)
+		}
+
+		if err != nil {
+			return errors.Wrap(err, msgErrorVerifyingFactor)
+		}
+	}
+
+	if otp != nil {
+		if accepted {
+			_, err = tx.Exec(queryAcceptOTP, userID)
+			err = errors.Wrap(err, msgErrorVerifyingFactor)
+		} else {
+			err = failOTP(tx, userID, otp, now)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, msgErrorVerifyingFactor)
+	}
+
+	if !accepted {
+		return ErrTwoFactorCodeInvalid
+	}
+
+	return nil
+}
+
+// checkCode reports whether code is TOTP code, code sent by email or SMS or recovery code of user.
+// It returns last used TOTP counter, which is the matched one for TOTP code.
+func (tr *TwoFactorRepo) checkCode(tx *sql.Tx, userID, code string, state *totpState, otp *otpState,
+	now time.Time) (bool, int64, error) {
+	var counter int64
+
+	if state != nil {
+		c, ok, err := totp.Validate(state.secret, code, now, state.lastCounter)
+		if err != nil {
+			return false, 0, errors.Wrap(err, msgErrorVerifyingFactor)
+		}
+
+		if ok {
+			return true, c, nil
+		}
+
+		counter = state.lastCounter
+	}
+
+	if otp != nil && otp.matches(code, now) {
+		return true, counter, nil
+	}
+
+	res, err := tx.Exec(queryUseRecoveryCode, userID, hashRecoveryCode(code), now)
+	if err != nil {
+		return false, 0, errors.Wrap(err, msgErrorVerifyingFactor)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, 0, errors.Wrap(err, msgErrorVerifyingFactor)
+	}
+
+	return n == 1, counter, nil
+}
+
+// RegenerateRecoveryCodes replaces recovery codes of user with second factor enabled
+func (tr *TwoFactorRepo) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorGeneratingCodes)
+	}
+	defer tx.Rollback()
+
+	var enabled bool
+
+	err = tx.QueryRow(querySelectCodeFactor, userID).Scan(&enabled)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingFactor)
+	}
+
+	if !enabled {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorGeneratingCodes)
+	}
+
+	return codes, nil
+}
+
+// Disable removes TOTP secret, email or SMS channel and recovery codes of user, WebAuthn credentials
+// are removed one by one
+func (tr *TwoFactorRepo) Disable(userID string) error {
+	return tr.delete(userID, queryDeleteTOTP, queryDeleteOTP, queryDeleteRecovery)
+}
+
+// Reset removes all second factors and recovery codes of user with login, so user can log in with password
+// and enroll again. It is used by admins when user lost authenticator and recovery codes.
+func (tr *TwoFactorRepo) Reset(login string) error {
+	return tr.delete(login, queryResetTOTP, queryResetOTP, queryResetRecovery, queryResetWebAuthn)
+}
+
+func (tr *TwoFactorRepo) selectStatus(userID string) (*TwoFactorStatus, error) {
+	var (
+		status  TwoFactorStatus
+		channel sql.NullString
+	)
+
+	err := tr.db.QueryRow(querySelectTwoFactor, userID).Scan(&status.TOTP, &status.WebAuthnCredentials, &channel)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingFactor)
+	}
+
+	status.OTPChannel = channel.String
+
+	return &status, nil
+}
+
+func (tr *TwoFactorRepo) delete(arg string, queries ...string) error {
+	tx, err := tr.db.Begin()
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingTwoFactor)
+	}
+	defer tx.Rollback()
+
+	for _, query := range queries {
+		_, err = tx.Exec(query, arg)
+		if err != nil {
+			return errors.Wrap(err, msgErrorDeletingTwoFactor)
+		}
+	}
+
+	return errors.Wrap(tx.Commit(), msgErrorDeletingTwoFactor)
+}
+
+// selectTOTP locks TOTP state of user within transaction
+func selectTOTP(tx *sql.Tx, userID string) (*totpState, error) {
+	var s totpState
+
+	err := tx.QueryRow(querySelectTOTPForUpdate, userID).Scan(&s.secret, &s.lastCounter, &s.failed, &s.lockedUntil,
+		&s.confirmed)
+	if err == sql.ErrNoRows {
+		return nil, ErrTwoFactorNotEnrolled
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingFactor)
+	}
+
+	return &s, nil
+}
+
+// locked reports whether lockout of factor after wrong codes lasts at now
+func locked(until *time.Time, now time.Time) bool {
+	return until != nil && until.After(now)
+}
+
+// countFailure returns wrong attempts after one more wrong code, the last allowed one locks factor
+// for factorLockout and starts counting again
+func countFailure(failed int, now time.Time) (int, *time.Time) {
+	failed++
+	if failed < maxFactorAttempts {
+		return failed, nil
+	}
+
+	until := now.Add(factorLockout)
+
+	return 0, &until
+}
+
+// replaceRecoveryCodes stores hashes of new recovery codes instead of old ones and returns the codes
+func replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	_, err := tx.Exec(queryDeleteRecovery, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorGeneratingCodes)
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+
+		_, err = rand.Read(b)
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorGeneratingCodes)
+		}
+
+		code := strings.ToLower(recoveryEncoding.EncodeToString(b))
+		code = code[:5] + "-" + code[5:]
+
+		_, err = tx.Exec(queryInsertRecovery, userID, hashRecoveryCode(code))
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorGeneratingCodes)
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes recovery code ignoring case, separators and surrounding spaces
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	return token.HashOpaque(code)
+}
@@ -0,0 +1,260 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lvl484/user-manager/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testFactorUser   = "5b5e8c7a-0000-4000-8000-000000000001"
+	testFactorSecret = "JBSWY3DPEHPK3PXP"
+)
+
+var totpColumns = []string{"secret", "last_counter", "failed_attempts", "locked_until", "confirmed"}
+
+func currentCode(t *testing.T) (string, int64) {
+	counter := totp.Counter(time.Now())
+
+	code, err := totp.Code(testFactorSecret, counter)
+	require.NoError(t, err)
+
+	return code, counter
+}
+
+func TestTwoFactorRepoEnrollTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryEnrollTOTP)).
+		WithArgs(testFactorUser, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryEnrollTOTP)).
+		WithArgs(testFactorUser, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+
+	repo := NewTwoFactorRepo(db)
+
+	secret, err := repo.EnrollTOTP(testFactorUser)
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	_, err = repo.EnrollTOTP(testFactorUser)
+	assert.Equal(t, ErrTwoFactorEnabled, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoConfirmTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	code, counter := currentCode(t)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, 0, 0, nil, false))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, 0, 0, nil, false))
+	mock.ExpectExec(regexp.QuoteMeta(queryConfirmTOTP)).
+		WithArgs(testFactorUser, sqlmock.AnyArg(), counter).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteRecovery)).
+		WithArgs(testFactorUser).
+		WillReturnResult(driver.RowsAffected(0))
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		mock.ExpectExec(regexp.QuoteMeta(queryInsertRecovery)).
+			WithArgs(testFactorUser, sqlmock.AnyArg()).
+			WillReturnResult(driver.RowsAffected(1))
+	}
+
+	mock.ExpectCommit()
+
+	repo := NewTwoFactorRepo(db)
+
+	_, err = repo.ConfirmTOTP(testFactorUser, "000000")
+	assert.Equal(t, ErrTwoFactorCodeInvalid, err)
+
+	codes, err := repo.ConfirmTOTP(testFactorUser, code)
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes[0])
+	assert.NotEqual(t, codes[0], codes[1])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoVerify(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	code, counter := currentCode(t)
+
+	// TOTP code is accepted once
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, counter-5, 2, nil, true))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectExec(regexp.QuoteMeta(queryAcceptTOTP)).
+		WithArgs(testFactorUser, counter).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Replayed code is not TOTP code any more and is not recovery code
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, counter+totp.Skew, 0, nil, true))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseRecoveryCode)).
+		WithArgs(testFactorUser, hashRecoveryCode(code), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryFailTOTP)).
+		WithArgs(testFactorUser, 1, nil).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Recovery code is accepted regardless of case and separator
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, counter+totp.Skew, 1, nil, true))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseRecoveryCode)).
+		WithArgs(testFactorUser, hashRecoveryCode("abcde-fghij"), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryAcceptTOTP)).
+		WithArgs(testFactorUser, counter+totp.Skew).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Last allowed wrong code locks second factor
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, 0, maxFactorAttempts-1, nil, true))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseRecoveryCode)).
+		WithArgs(testFactorUser, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryFailTOTP)).
+		WithArgs(testFactorUser, 0, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(totpColumns).AddRow(testFactorSecret, 0, 0, time.Now().Add(time.Minute), true))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectOTPForUpdate)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(otpColumns))
+	mock.ExpectRollback()
+
+	repo := NewTwoFactorRepo(db)
+
+	require.NoError(t, repo.Verify(testFactorUser, code))
+	assert.Equal(t, ErrTwoFactorCodeInvalid, repo.Verify(testFactorUser, code))
+	require.NoError(t, repo.Verify(testFactorUser, " ABCDEFGHIJ "))
+	assert.Equal(t, ErrTwoFactorCodeInvalid, repo.Verify(testFactorUser, "nope"))
+	assert.Equal(t, ErrTwoFactorLocked, repo.Verify(testFactorUser, code))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTwoFactor)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows([]string{"totp", "webauthn", "otp"}).AddRow(true, 2, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(queryCountRecoveryCode)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTwoFactor)).
+		WithArgs("other").
+		WillReturnRows(sqlmock.NewRows([]string{"totp", "webauthn", "otp"}).AddRow(false, 0, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTwoFactor)).
+		WithArgs("passkey").
+		WillReturnRows(sqlmock.NewRows([]string{"totp", "webauthn", "otp"}).AddRow(false, 1, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectTwoFactor)).
+		WithArgs("mailer").
+		WillReturnRows(sqlmock.NewRows([]string{"totp", "webauthn", "otp"}).AddRow(false, 0, "email"))
+
+	repo := NewTwoFactorRepo(db)
+
+	status, err := repo.Status(testFactorUser)
+	require.NoError(t, err)
+	assert.Equal(t, &TwoFactorStatus{TOTP: true, WebAuthnCredentials: 2, RecoveryCodesLeft: 7}, status)
+
+	enabled, err := repo.Enabled("other")
+	require.NoError(t, err)
+	assert.False(t, enabled)
+
+	enabled, err = repo.Enabled("passkey")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+
+	enabled, err = repo.Enabled("mailer")
+	require.NoError(t, err)
+	assert.True(t, enabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorRepoReset(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(queryResetTOTP)).
+		WithArgs("i3odja").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryResetOTP)).
+		WithArgs("i3odja").
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryResetRecovery)).
+		WithArgs("i3odja").
+		WillReturnResult(driver.RowsAffected(10))
+	mock.ExpectExec(regexp.QuoteMeta(queryResetWebAuthn)).
+		WithArgs("i3odja").
+		WillReturnResult(driver.RowsAffected(2))
+	mock.ExpectCommit()
+
+	require.NoError(t, NewTwoFactorRepo(db).Reset("i3odja"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -6,6 +6,13 @@ import (
 	"time"
 )
 
+// Statuses of user account
+const (
+	UserActive = "active"
+	// UserLocked is status of user locked after too many failed logins
+	UserLocked = "locked"
+)
+
 // User is the central model of the service.
 // It is struct with all necessary information about user
 type User struct {
@@ -13,7 +20,7 @@ type User struct {
 	ID string `json:"id"`
 	// Unique login
 	Username string `json:"user_name"`
-	// Strong enough password
+	// Password meeting password policy
 	Password string `json:"password"`
 	// Valid email
 	Email string `json:"email"`
@@ -27,6 +34,9 @@ type User struct {
 	CreatedAt *time.Time `json:"created_at"`
 	// Time of last changes made
 	UpdatedAt *time.Time `json:"updated_at"`
+	// UserActive, or UserLocked until LockedUntil after too many failed logins
+	Status      string     `json:"status"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"`
 }
 
 type Users interface {
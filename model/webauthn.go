@@ -0,0 +1,250 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lvl484/user-manager/webauthn"
+	"github.com/pkg/errors"
+)
+
+const (
+	queryInsertCredential = `INSERT INTO webauthn_credentials(id, user_id, name, public_key, algorithm, sign_count,
+		aaguid, format, created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) ON CONFLICT (id) DO NOTHING`
+	queryListCredentials = `SELECT c.id, c.user_id, u.user_name, c.name, c.public_key, c.algorithm, c.sign_count,
+		c.aaguid, c.format, c.created_at, c.last_used_at FROM webauthn_credentials c JOIN users u ON u.id = c.user_id
+		WHERE c.user_id=$1 ORDER BY c.created_at`
+	// querySelectCredential returns credential of enabled user only
+	querySelectCredential = `SELECT c.id, c.user_id, u.user_name, c.name, c.public_key, c.algorithm, c.sign_count,
+		c.aaguid, c.format, c.created_at, c.last_used_at FROM webauthn_credentials c JOIN users u ON u.id = c.user_id
+		WHERE c.id=$1 AND NOT u.salted`
+	// queryUseCredential stores new signature counter, it has to grow unless authenticator has no counter,
+	// so two concurrent assertions with the same counter can not both pass
+	queryUseCredential = `UPDATE webauthn_credentials SET sign_count=$2, last_used_at=$3
+		WHERE id=$1 AND (sign_count < $2 OR sign_count = 0 AND $2 = 0)`
+	queryDeleteCredential = `DELETE FROM webauthn_credentials WHERE user_id=$1 AND id=$2`
+	queryInsertChallenge  = `INSERT INTO webauthn_challenges(challenge, user_id, ceremony, expires_at)
+		VALUES ($1,$2,$3,$4)`
+	queryDeleteExpiredChallenges = `DELETE FROM webauthn_challenges WHERE expires_at <= $1`
+	queryConsumeChallenge        = `DELETE FROM webauthn_challenges WHERE challenge=$1 AND ceremony=$2
+		AND expires_at > $3 RETURNING user_id`
+
+	msgErrorAddingCredential   = "Error adding WebAuthn credential"
+	msgErrorReadingCredential  = "Error reading WebAuthn credential"
+	msgErrorUpdatingCredential = "Error updating WebAuthn credential"
+	msgErrorDeletingCredential = "Error deleting WebAuthn credential"
+	msgErrorCreatingChallenge  = "Error creating WebAuthn challenge"
+	msgErrorConsumingChallenge = "Error consuming WebAuthn challenge"
+
+	// ChallengeTTL is how long user has to complete WebAuthn ceremony
+	ChallengeTTL = 5 * time.Minute
+)
+
+// WebAuthn ceremonies challenges are issued for, challenge of one ceremony can not be used for another
+const (
+	CeremonyRegister     = "register"
+	CeremonyLogin        = "login"
+	CeremonySecondFactor = "second-factor"
+)
+
+var (
+	// ErrCredentialExists is returned when credential id is already registered
+	ErrCredentialExists = errors.New("WebAuthn credential is already registered")
+	// ErrCredentialNotFound is returned for unknown credential or credential of disabled user
+	ErrCredentialNotFound = errors.New("WebAuthn credential not found")
+	// ErrCredentialCloned is returned when signature counter of credential did not grow
+	ErrCredentialCloned = errors.New("WebAuthn credential signature counter did not increase")
+	// ErrChallengeInvalid is returned for unknown, expired or already used challenge
+	ErrChallengeInvalid = errors.New("WebAuthn challenge is invalid")
+)
+
+// WebAuthnCredential is public key credential registered by user with authenticator
+type WebAuthnCredential struct {
+	// ID is base64url encoded credential id
+	ID       string
+	UserID   string
+	Username string
+	Name     string
+	// PublicKey is COSE_Key of credential
+	PublicKey []byte
+	Algorithm int64
+	// SignCount is last signature counter returned by authenticator
+	SignCount uint32
+	// AAGUID identifies authenticator model
+	AAGUID     []byte
+	Format     string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+// WebAuthnRepo stores WebAuthn credentials and challenges of pending ceremonies
+type WebAuthnRepo struct {
+	db *sql.DB
+}
+
+// NewWebAuthnRepo returns WebAuthnRepo with db
+func NewWebAuthnRepo(data *sql.DB) *WebAuthnRepo {
+	return &WebAuthnRepo{db: data}
+}
+
+// Add stores credential registered by user
+func (wr *WebAuthnRepo) Add(c *WebAuthnCredential) error {
+	c.CreatedAt = time.Now()
+
+	res, err := wr.db.Exec(queryInsertCredential, c.ID, c.UserID, c.Name, c.PublicKey, c.Algorithm, int64(c.SignCount),
+		c.AAGUID, c.Format, c.CreatedAt)
+	if err != nil {
+		return errors.Wrap(err, msgErrorAddingCredential)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorAddingCredential)
+	}
+
+	if n == 0 {
+		return ErrCredentialExists
+	}
+
+	return nil
+}
+
+// List returns credentials of user in order of registration
+func (wr *WebAuthnRepo) List(userID string) ([]*WebAuthnCredential, error) {
+	rows, err := wr.db.Query(queryListCredentials, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingCredential)
+	}
+	defer rows.Close()
+
+	credentials := []*WebAuthnCredential{}
+
+	for rows.Next() {
+		c, err := scanCredential(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, msgErrorReadingCredential)
+		}
+
+		credentials = append(credentials, c)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingCredential)
+	}
+
+	return credentials, nil
+}
+
+// Get returns credential by id, credentials of disabled users are not found
+func (wr *WebAuthnRepo) Get(id string) (*WebAuthnCredential, error) {
+	c, err := scanCredential(wr.db.QueryRow(querySelectCredential, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrCredentialNotFound
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, msgErrorReadingCredential)
+	}
+
+	return c, nil
+}
+
+// Use records successful assertion with signature counter signCount
+func (wr *WebAuthnRepo) Use(id string, signCount uint32) error {
+	res, err := wr.db.Exec(queryUseCredential, id, int64(signCount), time.Now())
+	if err != nil {
+		return errors.Wrap(err, msgErrorUpdatingCredential)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorUpdatingCredential)
+	}
+
+	if n == 0 {
+		return ErrCredentialCloned
+	}
+
+	return nil
+}
+
+// Delete removes credential of user
+func (wr *WebAuthnRepo) Delete(userID, id string) error {
+	res, err := wr.db.Exec(queryDeleteCredential, userID, id)
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingCredential)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, msgErrorDeletingCredential)
+	}
+
+	if n == 0 {
+		return ErrCredentialNotFound
+	}
+
+	return nil
+}
+
+// CreateChallenge returns new challenge of ceremony, it expires after ChallengeTTL. Empty userID creates
+// challenge of login with discoverable credential, user is known only from its response.
+func (wr *WebAuthnRepo) CreateChallenge(userID, ceremony string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorCreatingChallenge)
+	}
+
+	now := time.Now()
+
+	_, err = wr.db.Exec(queryDeleteExpiredChallenges, now)
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorCreatingChallenge)
+	}
+
+	user := sql.NullString{String: userID, Valid: userID != ""}
+
+	_, err = wr.db.Exec(queryInsertChallenge, challenge, user, ceremony, now.Add(ChallengeTTL))
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorCreatingChallenge)
+	}
+
+	return challenge, nil
+}
+
+// ConsumeChallenge removes challenge of ceremony and returns id of user it was created for.
+// Challenge can be consumed only once.
+func (wr *WebAuthnRepo) ConsumeChallenge(challenge, ceremony string) (string, error) {
+	var user sql.NullString
+
+	err := wr.db.QueryRow(queryConsumeChallenge, challenge, ceremony, time.Now()).Scan(&user)
+	if err == sql.ErrNoRows {
+		return "", ErrChallengeInvalid
+	}
+
+	if err != nil {
+		return "", errors.Wrap(err, msgErrorConsumingChallenge)
+	}
+
+	return user.String, nil
+}
+
+func scanCredential(row scanner) (*WebAuthnCredential, error) {
+	var (
+		c         WebAuthnCredential
+		signCount int64
+	)
+
+	err := row.Scan(&c.ID, &c.UserID, &c.Username, &c.Name, &c.PublicKey, &c.Algorithm, &signCount, &c.AAGUID,
+		&c.Format, &c.CreatedAt, &c.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	c.SignCount = uint32(signCount)
+
+	return &c, nil
+}
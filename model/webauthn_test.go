@@ -0,0 +1,159 @@
+// Package model provides user-manager specific data structures,
+// which are meant to be used across the whole application.
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var credentialColumns = []string{"id", "user_id", "user_name", "name", "public_key", "algorithm", "sign_count", "aaguid",
+	"format", "created_at", "last_used_at"}
+
+func TestWebAuthnRepoAdd(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	c := &WebAuthnCredential{ID: "Y3JlZA", UserID: testFactorUser, Name: "Laptop", PublicKey: []byte{1}, Algorithm: -7,
+		SignCount: 3, AAGUID: make([]byte, 16), Format: "none"}
+
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertCredential)).
+		WithArgs("Y3JlZA", testFactorUser, "Laptop", []byte{1}, int64(-7), int64(3), make([]byte, 16), "none",
+			sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertCredential)).
+		WillReturnResult(driver.RowsAffected(0))
+
+	repo := NewWebAuthnRepo(db)
+
+	require.NoError(t, repo.Add(c))
+	assert.False(t, c.CreatedAt.IsZero())
+	assert.Equal(t, ErrCredentialExists, repo.Add(c))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebAuthnRepoGet(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectCredential)).
+		WithArgs("Y3JlZA").
+		WillReturnRows(sqlmock.NewRows(credentialColumns).
+			AddRow("Y3JlZA", testFactorUser, "i3odja", "Laptop", []byte{1}, -7, 3, make([]byte, 16), "none", now, nil))
+	mock.ExpectQuery(regexp.QuoteMeta(querySelectCredential)).
+		WithArgs("other").
+		WillReturnRows(sqlmock.NewRows(credentialColumns))
+
+	repo := NewWebAuthnRepo(db)
+
+	c, err := repo.Get("Y3JlZA")
+	require.NoError(t, err)
+	assert.Equal(t, &WebAuthnCredential{ID: "Y3JlZA", UserID: testFactorUser, Username: "i3odja", Name: "Laptop",
+		PublicKey: []byte{1}, Algorithm: -7, SignCount: 3, AAGUID: make([]byte, 16), Format: "none", CreatedAt: now}, c)
+
+	_, err = repo.Get("other")
+	assert.Equal(t, ErrCredentialNotFound, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebAuthnRepoList(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(queryListCredentials)).
+		WithArgs(testFactorUser).
+		WillReturnRows(sqlmock.NewRows(credentialColumns).
+			AddRow("a", testFactorUser, "i3odja", "Laptop", []byte{1}, -7, 3, []byte{}, "none", now, nil).
+			AddRow("b", testFactorUser, "i3odja", "Key", []byte{2}, -8, 0, []byte{}, "packed", now, now))
+
+	credentials, err := NewWebAuthnRepo(db).List(testFactorUser)
+	require.NoError(t, err)
+	require.Len(t, credentials, 2)
+	assert.Equal(t, "Key", credentials[1].Name)
+	assert.Equal(t, &now, credentials[1].LastUsedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebAuthnRepoUse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryUseCredential)).
+		WithArgs("Y3JlZA", int64(4), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryUseCredential)).
+		WithArgs("Y3JlZA", int64(4), sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteCredential)).
+		WithArgs(testFactorUser, "Y3JlZA").
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteCredential)).
+		WithArgs(testFactorUser, "Y3JlZA").
+		WillReturnResult(driver.RowsAffected(0))
+
+	repo := NewWebAuthnRepo(db)
+
+	require.NoError(t, repo.Use("Y3JlZA", 4))
+	assert.Equal(t, ErrCredentialCloned, repo.Use("Y3JlZA", 4))
+	require.NoError(t, repo.Delete(testFactorUser, "Y3JlZA"))
+	assert.Equal(t, ErrCredentialNotFound, repo.Delete(testFactorUser, "Y3JlZA"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWebAuthnRepoChallenge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(queryDeleteExpiredChallenges)).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(regexp.QuoteMeta(queryInsertChallenge)).
+		WithArgs(sqlmock.AnyArg(), sql.NullString{}, CeremonyLogin, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectQuery(regexp.QuoteMeta(queryConsumeChallenge)).
+		WithArgs("challenge", CeremonyRegister, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(testFactorUser))
+	mock.ExpectQuery(regexp.QuoteMeta(queryConsumeChallenge)).
+		WithArgs("challenge", CeremonyRegister, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+	repo := NewWebAuthnRepo(db)
+
+	challenge, err := repo.CreateChallenge("", CeremonyLogin)
+	require.NoError(t, err)
+	assert.Len(t, challenge, 43)
+
+	userID, err := repo.ConsumeChallenge("challenge", CeremonyRegister)
+	require.NoError(t, err)
+	assert.Equal(t, testFactorUser, userID)
+
+	_, err = repo.ConsumeChallenge("challenge", CeremonyRegister)
+	assert.Equal(t, ErrChallengeInvalid, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
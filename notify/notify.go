@@ -0,0 +1,132 @@
+// Package notify delivers short messages to users by email and SMS. Notifier is implemented by SMTP and
+// HTTPSMS senders, Codes renders one-time codes with templates and sends them over channel chosen by user.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+// Channels one-time codes are delivered over
+const (
+	Email = "email"
+	SMS   = "sms"
+)
+
+// Default templates of messages with one-time code, they get CodeData
+const (
+	DefaultEmailSubject = "{{.Issuer}} verification code"
+	DefaultEmailBody    = "Your {{.Issuer}} verification code is {{.Code}}.\n\n" +
+		"The code expires in {{.Minutes}} minutes. If you did not try to sign in, change your password.\n"
+	DefaultSMSBody = "{{.Code}} is your {{.Issuer}} verification code, it expires in {{.Minutes}} minutes."
+)
+
+// ErrUnsupportedChannel is returned for channel without configured notifier
+var ErrUnsupportedChannel = errors.New("notification channel is not configured")
+
+// Message is notification to recipient To, Subject is used by email only
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier sends message to its recipient
+type Notifier interface {
+	Notify(ctx context.Context, m *Message) error
+}
+
+// Template renders messages, text of subject and body is text/template
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+// NewTemplate parses subject and body templates, subject may be empty for channels without it
+func NewTemplate(subject, body string) (*Template, error) {
+	s, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, fmt.Errorf("parse subject template error: %w", err)
+	}
+
+	b, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parse body template error: %w", err)
+	}
+
+	return &Template{subject: s, body: b}, nil
+}
+
+// Message renders message to recipient with data
+func (t *Template) Message(to string, data interface{}) (*Message, error) {
+	var subject, body bytes.Buffer
+
+	err := t.subject.Execute(&subject, data)
+	if err != nil {
+		return nil, fmt.Errorf("render subject error: %w", err)
+	}
+
+	err = t.body.Execute(&body, data)
+	if err != nil {
+		return nil, fmt.Errorf("render body error: %w", err)
+	}
+
+	return &Message{To: to, Subject: subject.String(), Body: body.String()}, nil
+}
+
+// CodeData is passed to templates of one-time code messages
+type CodeData struct {
+	Code   string
+	Issuer string
+	// Minutes is how long the code is valid
+	Minutes int
+}
+
+type channel struct {
+	notifier Notifier
+	template *Template
+}
+
+// Codes sends one-time codes over registered channels
+type Codes struct {
+	// issuer is name of the service shown in messages
+	issuer   string
+	ttl      time.Duration
+	channels map[string]*channel
+}
+
+// NewCodes returns Codes without channels, issuer and ttl of codes are shown in messages
+func NewCodes(issuer string, ttl time.Duration) *Codes {
+	return &Codes{issuer: issuer, ttl: ttl, channels: make(map[string]*channel)}
+}
+
+// Register sends codes of channel name with notifier, messages are rendered with template
+func (c *Codes) Register(name string, notifier Notifier, template *Template) *Codes {
+	c.channels[name] = &channel{notifier: notifier, template: template}
+	return c
+}
+
+// Supports reports whether channel name is registered
+func (c *Codes) Supports(name string) bool {
+	_, ok := c.channels[name]
+	return ok
+}
+
+// Send delivers code to recipient over channel name
+func (c *Codes) Send(ctx context.Context, name, to, code string) error {
+	ch, ok := c.channels[name]
+	if !ok {
+		return ErrUnsupportedChannel
+	}
+
+	m, err := ch.template.Message(to, &CodeData{Code: code, Issuer: c.issuer, Minutes: int(c.ttl / time.Minute)})
+	if err != nil {
+		return err
+	}
+
+	return ch.notifier.Notify(ctx, m)
+}
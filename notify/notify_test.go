@@ -0,0 +1,67 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder remembers messages instead of sending them
+type recorder struct {
+	messages []*Message
+}
+
+func (r *recorder) Notify(ctx context.Context, m *Message) error {
+	r.messages = append(r.messages, m)
+	return nil
+}
+
+func TestCodesSend(t *testing.T) {
+	email, err := NewTemplate(DefaultEmailSubject, DefaultEmailBody)
+	require.NoError(t, err)
+
+	sms, err := NewTemplate("", DefaultSMSBody)
+	require.NoError(t, err)
+
+	var mail, phone recorder
+
+	codes := NewCodes("user-manager", 10*time.Minute).Register(Email, &mail, email).Register(SMS, &phone, sms)
+
+	assert.True(t, codes.Supports(Email))
+	assert.False(t, codes.Supports("fax"))
+
+	require.NoError(t, codes.Send(context.Background(), Email, "i3odja@example.com", "123456"))
+	require.NoError(t, codes.Send(context.Background(), SMS, "+380501234567", "654321"))
+	assert.Equal(t, ErrUnsupportedChannel, codes.Send(context.Background(), "fax", "+380501234567", "654321"))
+
+	require.Len(t, mail.messages, 1)
+	assert.Equal(t, &Message{
+		To:      "i3odja@example.com",
+		Subject: "user-manager verification code",
+		Body: "Your user-manager verification code is 123456.\n\n" +
+			"The code expires in 10 minutes. If you did not try to sign in, change your password.\n",
+	}, mail.messages[0])
+
+	require.Len(t, phone.messages, 1)
+	assert.Equal(t, &Message{
+		To:   "+380501234567",
+		Body: "654321 is your user-manager verification code, it expires in 10 minutes.",
+	}, phone.messages[0])
+}
+
+func TestNewTemplate(t *testing.T) {
+	_, err := NewTemplate("{{.Code", "body")
+	assert.Error(t, err)
+
+	_, err = NewTemplate("", "{{end}}")
+	assert.Error(t, err)
+
+	tmpl, err := NewTemplate("", "{{.Missing}}")
+	require.NoError(t, err)
+
+	_, err = tmpl.Message("to", &CodeData{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// SMSConfig is HTTP endpoint of SMS gateway
+type SMSConfig struct {
+	URL string
+	// Token is sent as bearer token when it is not empty
+	Token string
+	// From is sender name or number, gateway default is used when it is empty
+	From    string
+	Timeout time.Duration
+}
+
+// smsRequest is JSON body posted to SMS gateway
+type smsRequest struct {
+	From string `json:"from,omitempty"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// HTTPSMS sends messages as SMS with generic HTTP gateway. Message is posted as JSON object
+// with from, to and text fields, any 2xx response means it is accepted.
+type HTTPSMS struct {
+	cfg    SMSConfig
+	client *http.Client
+}
+
+// NewHTTPSMS returns HTTPSMS notifier with gateway from cfg
+func NewHTTPSMS(cfg SMSConfig) *HTTPSMS {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &HTTPSMS{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+// Notify sends body of message by SMS, subject is not used
+func (s *HTTPSMS) Notify(ctx context.Context, m *Message) error {
+	body, err := json.Marshal(&smsRequest{From: s.cfg.From, To: m.To, Text: m.Body})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("SMS request error: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if s.cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.cfg.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SMS gateway error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("SMS gateway responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSMSNotify(t *testing.T) {
+	var (
+		got  smsRequest
+		auth string
+	)
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&got)
+		if err != nil || got.To == "+380000000000" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer gateway.Close()
+
+	s := NewHTTPSMS(SMSConfig{URL: gateway.URL, Token: "gateway-token", From: "UM"})
+
+	err := s.Notify(context.Background(), &Message{To: "+380501234567", Subject: "ignored", Body: "Code 123456"})
+	require.NoError(t, err)
+	assert.Equal(t, smsRequest{From: "UM", To: "+380501234567", Text: "Code 123456"}, got)
+	assert.Equal(t, "Bearer gateway-token", auth)
+
+	err = s.Notify(context.Background(), &Message{To: "+380000000000", Body: "Code 123456"})
+	assert.EqualError(t, err, "SMS gateway responded with status 422")
+
+	err = NewHTTPSMS(SMSConfig{URL: gateway.URL}).Notify(context.Background(), &Message{To: "+1", Body: "x"})
+	require.NoError(t, err)
+	assert.Empty(t, auth)
+}
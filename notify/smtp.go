@@ -0,0 +1,165 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// defaultTimeout limits delivery when context has no deadline
+const defaultTimeout = 10 * time.Second
+
+var errHeaderInjection = errors.New("line break in message header")
+
+// SMTPConfig is address of mail server and account messages are sent from
+type SMTPConfig struct {
+	// Address is host:port of mail server
+	Address string
+	From    string
+	// Username and Password authenticate with PLAIN mechanism, only over TLS or to localhost
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// SMTP sends messages as plain text emails, connection is upgraded with STARTTLS when server supports it
+type SMTP struct {
+	cfg SMTPConfig
+}
+
+// NewSMTP returns SMTP notifier with mail server from cfg
+func NewSMTP(cfg SMTPConfig) *SMTP {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+
+	return &SMTP{cfg: cfg}
+}
+
+// Notify sends message by email
+func (s *SMTP) Notify(ctx context.Context, m *Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	msg, err := composeEmail(from, to, m, time.Now())
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(s.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP address: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", s.cfg.Address)
+	if err != nil {
+		return fmt.Errorf("connect to SMTP server error: %w", err)
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return fmt.Errorf("connect to SMTP server error: %w", err)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return fmt.Errorf("connect to SMTP server error: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		err = c.StartTLS(&tls.Config{ServerName: host})
+		if err != nil {
+			return fmt.Errorf("SMTP STARTTLS error: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host))
+		if err != nil {
+			return fmt.Errorf("SMTP authentication error: %w", err)
+		}
+	}
+
+	err = c.Mail(from.Address)
+	if err != nil {
+		return fmt.Errorf("SMTP sender error: %w", err)
+	}
+
+	err = c.Rcpt(to.Address)
+	if err != nil {
+		return fmt.Errorf("SMTP recipient error: %w", err)
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+
+	_, err = w.Write(msg)
+	if err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("SMTP data error: %w", err)
+	}
+
+	return c.Quit()
+}
+
+// composeEmail returns RFC 5322 message with quoted-printable UTF-8 body
+func composeEmail(from, to *mail.Address, m *Message, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return nil, errHeaderInjection
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from.String())
+	fmt.Fprintf(&buf, "To: %s\r\n", to.String())
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+
+	_, err := qp.Write([]byte(strings.Replace(m.Body, "\n", "\r\n", -1)))
+	if err != nil {
+		return nil, err
+	}
+
+	err = qp.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
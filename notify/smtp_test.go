@@ -0,0 +1,152 @@
+package notify
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"mime/quotedprintable"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is what local SMTP stand-in got from client
+type received struct {
+	auth string
+	from string
+	to   []string
+	data string
+}
+
+// serveSMTP accepts one connection and speaks just enough SMTP to receive a message,
+// recipients in reject are refused
+func serveSMTP(t *testing.T, reject string) (string, <-chan *received) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	done := make(chan *received, 1)
+
+	go func() {
+		defer l.Close()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		var (
+			tc  = textproto.NewConn(conn)
+			msg received
+		)
+
+		_ = tc.PrintfLine("220 localhost ESMTP stand-in")
+
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+			switch {
+			case cmd == "EHLO":
+				_ = tc.PrintfLine("250-localhost\r\n250-8BITMIME\r\n250 AUTH PLAIN")
+			case cmd == "AUTH":
+				msg.auth = strings.TrimPrefix(line, "AUTH PLAIN ")
+				_ = tc.PrintfLine("235 2.7.0 Authentication successful")
+			case cmd == "MAIL":
+				msg.from = line
+				_ = tc.PrintfLine("250 OK")
+			case cmd == "RCPT" && reject != "" && strings.Contains(line, reject):
+				_ = tc.PrintfLine("550 No such user")
+			case cmd == "RCPT":
+				msg.to = append(msg.to, line)
+				_ = tc.PrintfLine("250 OK")
+			case cmd == "DATA":
+				_ = tc.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+
+				data, err := ioutil.ReadAll(tc.DotReader())
+				if err != nil {
+					return
+				}
+
+				msg.data = string(data)
+				_ = tc.PrintfLine("250 OK")
+			case cmd == "QUIT":
+				_ = tc.PrintfLine("221 Bye")
+				done <- &msg
+
+				return
+			default:
+				_ = tc.PrintfLine("502 Command not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String(), done
+}
+
+func TestSMTPNotify(t *testing.T) {
+	addr, done := serveSMTP(t, "")
+
+	s := NewSMTP(SMTPConfig{Address: addr, From: "User Manager <noreply@example.com>", Username: "mailer",
+		Password: "secret"})
+
+	err := s.Notify(context.Background(), &Message{
+		To:      "i3odja@example.com",
+		Subject: "Verification code",
+		Body:    "Your code is 123456.\nIt expires soon.\n",
+	})
+	require.NoError(t, err)
+
+	msg := <-done
+
+	auth, err := base64.StdEncoding.DecodeString(msg.auth)
+	require.NoError(t, err)
+	assert.Equal(t, "\x00mailer\x00secret", string(auth))
+	assert.Equal(t, "MAIL FROM:<noreply@example.com> BODY=8BITMIME", msg.from)
+	assert.Equal(t, []string{"RCPT TO:<i3odja@example.com>"}, msg.to)
+
+	header, body := split(t, msg.data)
+	assert.Contains(t, header, "From: \"User Manager\" <noreply@example.com>\n")
+	assert.Contains(t, header, "To: <i3odja@example.com>\n")
+	assert.Contains(t, header, "Subject: Verification code\n")
+	assert.Contains(t, header, "Content-Type: text/plain; charset=utf-8\n")
+	assert.Equal(t, "Your code is 123456.\nIt expires soon.\n", body)
+}
+
+func TestSMTPNotifyRejected(t *testing.T) {
+	addr, _ := serveSMTP(t, "unknown@example.com")
+
+	err := NewSMTP(SMTPConfig{Address: addr, From: "noreply@example.com"}).Notify(context.Background(),
+		&Message{To: "unknown@example.com", Subject: "Code", Body: "123456"})
+	assert.Error(t, err)
+
+	err = NewSMTP(SMTPConfig{Address: addr, From: "noreply@example.com"}).Notify(context.Background(),
+		&Message{To: "not an address", Subject: "Code", Body: "123456"})
+	assert.Error(t, err)
+
+	err = NewSMTP(SMTPConfig{Address: addr, From: "noreply@example.com"}).Notify(context.Background(),
+		&Message{To: "i3odja@example.com", Subject: "Code\r\nBcc: other@example.com", Body: "123456"})
+	assert.Equal(t, errHeaderInjection, err)
+}
+
+// split returns header and decoded body of message with line endings normalized
+func split(t *testing.T, data string) (string, string) {
+	parts := strings.SplitN(data, "\n\n", 2)
+	require.Len(t, parts, 2)
+
+	body, err := ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(parts[1])))
+	require.NoError(t, err)
+
+	return parts[0] + "\n", strings.Replace(string(body), "\r\n", "\n", -1)
+}
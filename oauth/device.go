@@ -0,0 +1,65 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Error codes of device access token request defined by RFC 8628
+const (
+	ErrorAuthorizationPending = "authorization_pending"
+	ErrorSlowDown             = "slow_down"
+	ErrorExpiredToken         = "expired_token"
+)
+
+// userCodeAlphabet has no vowels and no characters which are easy to confuse,
+// user code is typed by hand on other device (RFC 8628 section 6.1)
+const (
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// NewUserCode returns random user code in normalized form
+func NewUserCode() (string, error) {
+	var (
+		b   strings.Builder
+		max = big.NewInt(int64(len(userCodeAlphabet)))
+	)
+
+	for i := 0; i < userCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate user code error: %w", err)
+		}
+
+		b.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// NormalizeUserCode converts user code typed by user to normalized form:
+// letters are upper-cased, separators and spaces are dropped
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+
+		return -1
+	}, code)
+}
+
+// FormatUserCode returns normalized user code split into halves for display, e.g. BCDF-GHJK
+func FormatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUserCode(t *testing.T) {
+	code, err := NewUserCode()
+	require.NoError(t, err)
+	require.Len(t, code, userCodeLength)
+
+	for _, r := range code {
+		assert.True(t, strings.ContainsRune(userCodeAlphabet, r), "unexpected character %q", r)
+	}
+
+	other, err := NewUserCode()
+	require.NoError(t, err)
+	assert.NotEqual(t, code, other)
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode("bcdf-ghjk"))
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode(" BCDF ghjk "))
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode(FormatUserCode("BCDFGHJK")))
+	assert.Equal(t, "", NormalizeUserCode("-"))
+}
+
+func TestFormatUserCode(t *testing.T) {
+	assert.Equal(t, "BCDF-GHJK", FormatUserCode("BCDFGHJK"))
+	assert.Equal(t, "BCD", FormatUserCode("BCD"))
+}
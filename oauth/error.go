@@ -0,0 +1,61 @@
+// Package oauth provides protocol level building blocks of OAuth 2.0 authorization server:
+// error responses, scopes, PKCE, redirect URI handling, device user codes, token exchange constants
+// and client registration metadata checks (RFC 6749, RFC 7636, RFC 8628, RFC 8693, RFC 7591).
+package oauth
+
+import (
+	"net/http"
+)
+
+// Error codes defined by RFC 6749
+const (
+	ErrorInvalidRequest          = "invalid_request"
+	ErrorInvalidClient           = "invalid_client"
+	ErrorInvalidGrant            = "invalid_grant"
+	ErrorUnauthorizedClient      = "unauthorized_client"
+	ErrorUnsupportedGrantType    = "unsupported_grant_type"
+	ErrorUnsupportedResponseType = "unsupported_response_type"
+	ErrorInvalidScope            = "invalid_scope"
+	ErrorAccessDenied            = "access_denied"
+	ErrorServerError             = "server_error"
+	ErrorTemporarilyUnavailable  = "temporarily_unavailable"
+)
+
+// Error codes of authentication request defined by OpenID Connect Core
+const (
+	ErrorLoginRequired   = "login_required"
+	ErrorConsentRequired = "consent_required"
+)
+
+// Error is an OAuth 2.0 error response
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// NewError returns error with code and human readable description
+func NewError(code, description string) *Error {
+	return &Error{Code: code, Description: description}
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+
+	return e.Code + ": " + e.Description
+}
+
+// Status returns HTTP status of the error returned from token endpoint
+func (e *Error) Status() int {
+	switch e.Code {
+	case ErrorInvalidClient:
+		return http.StatusUnauthorized
+	case ErrorServerError:
+		return http.StatusInternalServerError
+	case ErrorTemporarilyUnavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusBadRequest
+}
@@ -0,0 +1,7 @@
+package oauth
+
+// TokenTypeAccessToken is the only token type accepted and issued by token exchange (RFC 8693 section 3)
+const TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+
+// ErrorInvalidTarget is returned when requested audience is not allowed (RFC 8693 section 2.2.2)
+const ErrorInvalidTarget = "invalid_target"
@@ -0,0 +1,34 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// ChallengeMethodS256 is the only supported code challenge method, "plain" is not accepted
+const ChallengeMethodS256 = "S256"
+
+// verifierPattern is code verifier (and S256 challenge) alphabet and length defined by RFC 7636
+var verifierPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// ValidChallenge reports whether code challenge and its method are acceptable
+func ValidChallenge(challenge, method string) bool {
+	return method == ChallengeMethodS256 && verifierPattern.MatchString(challenge)
+}
+
+// S256Challenge returns code challenge derived from verifier
+func S256Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyChallenge checks code verifier against challenge sent in authorization request
+func VerifyChallenge(verifier, challenge, method string) bool {
+	if method != ChallengeMethodS256 || !verifierPattern.MatchString(verifier) {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(S256Challenge(verifier)), []byte(challenge)) == 1
+}
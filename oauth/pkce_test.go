@@ -0,0 +1,44 @@
+package oauth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS256Challenge(t *testing.T) {
+	// BASE64URL(SHA256(verifier)) without padding
+	assert.Equal(t, "ZtNPunH49FD35FWYhT5Tv8I7vRKQJ8uxMaL0_9eHjNA", S256Challenge(strings.Repeat("a", 43)))
+}
+
+func TestVerifyChallenge(t *testing.T) {
+	verifier := strings.Repeat("a", 43)
+	challenge := S256Challenge(verifier)
+
+	tests := []struct {
+		name     string
+		verifier string
+		method   string
+		ok       bool
+	}{
+		{name: "Match", verifier: verifier, method: ChallengeMethodS256, ok: true},
+		{name: "Other verifier", verifier: strings.Repeat("b", 43), method: ChallengeMethodS256},
+		{name: "Plain method", verifier: challenge, method: "plain"},
+		{name: "Short verifier", verifier: "abc", method: ChallengeMethodS256},
+		{name: "Empty verifier", method: ChallengeMethodS256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.ok, VerifyChallenge(tt.verifier, challenge, tt.method))
+		})
+	}
+}
+
+func TestValidChallenge(t *testing.T) {
+	assert.True(t, ValidChallenge(S256Challenge("verifier"), ChallengeMethodS256))
+	assert.False(t, ValidChallenge(S256Challenge("verifier"), "plain"))
+	assert.False(t, ValidChallenge("short", ChallengeMethodS256))
+	assert.False(t, ValidChallenge(S256Challenge("verifier")+"=", ChallengeMethodS256))
+}
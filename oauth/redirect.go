@@ -0,0 +1,27 @@
+package oauth
+
+import (
+	"net/url"
+)
+
+// RedirectURL adds params to query of redirect URI, existing query of registered URI is kept
+func RedirectURL(redirectURI string, params url.Values) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+
+	for k, values := range params {
+		for _, v := range values {
+			if v != "" {
+				q.Add(k, v)
+			}
+		}
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
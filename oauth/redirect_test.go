@@ -0,0 +1,31 @@
+package oauth
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirectURL(t *testing.T) {
+	location, err := RedirectURL("https://app.example.com/cb?tenant=1", url.Values{
+		"code":  {"abc"},
+		"state": {""},
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(location)
+	require.NoError(t, err)
+	assert.Equal(t, "app.example.com", u.Host)
+	assert.Equal(t, url.Values{"tenant": {"1"}, "code": {"abc"}}, u.Query())
+}
+
+func TestErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusUnauthorized, NewError(ErrorInvalidClient, "").Status())
+	assert.Equal(t, http.StatusBadRequest, NewError(ErrorInvalidGrant, "").Status())
+	assert.Equal(t, http.StatusInternalServerError, NewError(ErrorServerError, "").Status())
+	assert.Equal(t, http.StatusServiceUnavailable, NewError(ErrorTemporarilyUnavailable, "").Status())
+	assert.Equal(t, "invalid_grant: expired", NewError(ErrorInvalidGrant, "expired").Error())
+}
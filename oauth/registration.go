@@ -0,0 +1,49 @@
+package oauth
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Error codes of dynamic client registration (RFC 7591 section 3.2.2)
+const (
+	ErrorInvalidRedirectURI    = "invalid_redirect_uri"
+	ErrorInvalidClientMetadata = "invalid_client_metadata"
+)
+
+// Token endpoint authentication methods, none is used by public clients
+const (
+	AuthMethodNone              = "none"
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+)
+
+// ValidRedirectURI reports whether URI can be registered as redirect URI of client.
+// It must be absolute without fragment (RFC 6749 section 3.1.2). Plain http is allowed only for loopback
+// redirects of native applications, other schemes must be private-use ones like com.example.app (RFC 8252).
+func ValidRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return isLoopback(u.Hostname())
+	}
+
+	return strings.Contains(u.Scheme, ".")
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,31 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri   string
+		valid bool
+	}{
+		{uri: "https://app.example.com/cb", valid: true},
+		{uri: "https://app.example.com/cb?tenant=1", valid: true},
+		{uri: "http://localhost:8080/cb", valid: true},
+		{uri: "http://127.0.0.1/cb", valid: true},
+		{uri: "http://[::1]:3000/cb", valid: true},
+		{uri: "com.example.app:/cb", valid: true},
+		{uri: "http://app.example.com/cb", valid: false},
+		{uri: "https://app.example.com/cb#token", valid: false},
+		{uri: "/cb", valid: false},
+		{uri: "https:///cb", valid: false},
+		{uri: "javascript:alert(1)", valid: false},
+		{uri: "", valid: false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, ValidRedirectURI(tt.uri), tt.uri)
+	}
+}
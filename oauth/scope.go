@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"strings"
+)
+
+// Scopes defined by OpenID Connect, openid scope turns authorization request into authentication one
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
+// ParseScope splits space-delimited scope into unique scope tokens
+func ParseScope(scope string) []string {
+	var (
+		scopes []string
+		seen   = make(map[string]bool)
+	)
+
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+
+	return scopes
+}
+
+// FormatScope joins scope tokens into space-delimited scope
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// ScopeSubset reports whether all requested scopes are in allowed ones
+func ScopeSubset(requested, allowed []string) bool {
+	set := make(map[string]bool, len(allowed))
+	for _, s := range allowed {
+		set[s] = true
+	}
+
+	for _, s := range requested {
+		if !set[s] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ScopeUnion returns scopes from both lists without duplicates
+func ScopeUnion(a, b []string) []string {
+	return ParseScope(FormatScope(a) + " " + FormatScope(b))
+}
+
+// ScopeWithout returns scopes except s
+func ScopeWithout(scopes []string, s string) []string {
+	var result []string
+
+	for _, v := range scopes {
+		if v != s {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+// HasScope reports whether space-delimited scope contains s
+func HasScope(scope, s string) bool {
+	for _, v := range strings.Fields(scope) {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package oauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScope(t *testing.T) {
+	assert.Equal(t, []string{"openid", "profile"}, ParseScope(" openid  profile openid "))
+	assert.Empty(t, ParseScope(""))
+}
+
+func TestScopeSubset(t *testing.T) {
+	allowed := []string{"openid", "profile", "email"}
+
+	assert.True(t, ScopeSubset([]string{"openid", "email"}, allowed))
+	assert.True(t, ScopeSubset(nil, allowed))
+	assert.False(t, ScopeSubset([]string{"openid", "admin"}, allowed))
+	assert.False(t, ScopeSubset([]string{"openid"}, nil))
+}
+
+func TestScopeUnion(t *testing.T) {
+	assert.Equal(t, []string{"openid", "email", "profile"}, ScopeUnion([]string{"openid", "email"}, []string{"email", "profile"}))
+}
+
+func TestScopeWithout(t *testing.T) {
+	assert.Equal(t, []string{"profile", "email"}, ScopeWithout([]string{"openid", "profile", "email"}, "openid"))
+	assert.Empty(t, ScopeWithout([]string{"openid"}, "openid"))
+}
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, HasScope("openid profile", "profile"))
+	assert.False(t, HasScope("openid profile", "prof"))
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in memory of a single server, every replica counts its own requests
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]time.Time)}
+}
+
+// Take takes a token from bucket of key when bucket is not empty at now
+func (s *MemoryStore) Take(key string, rate Rate, now time.Time) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fullAt := s.buckets[key]
+	if fullAt.Before(now) {
+		fullAt = now
+	}
+
+	next := fullAt.Add(rate.Interval())
+	if next.Sub(now) > rate.Period {
+		return fullAt, false, nil
+	}
+
+	s.buckets[key] = next
+
+	return next, true, nil
+}
+
+// Sweep removes buckets which are full at now
+func (s *MemoryStore) Sweep(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, fullAt := range s.buckets {
+		if !fullAt.After(now) {
+			delete(s.buckets, key)
+		}
+	}
+
+	return nil
+}
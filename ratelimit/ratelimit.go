@@ -0,0 +1,154 @@
+// Package ratelimit limits how often requests are made with token buckets. Every key has a bucket of Limit
+// tokens, which is refilled at Limit tokens per Period, and every request takes one token from it.
+// The bucket is stored as the time it is full again, so stores keep a single timestamp per key.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+)
+
+// sweepInterval is how often buckets which are full again are removed from store
+const sweepInterval = time.Minute
+
+// Rate is number of requests allowed per period, requests can burst up to Limit at once
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate parses rate written as limit/period, e.g. 10/1m, empty string or 0 mean no limit
+func ParseRate(s string) (Rate, error) {
+	if s == "" || s == "0" {
+		return Rate{}, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("rate %q is not limit/period", s)
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil || limit < 0 {
+		return Rate{}, fmt.Errorf("rate %q has invalid limit", s)
+	}
+
+	period, err := time.ParseDuration(parts[1])
+	if err != nil || period <= 0 {
+		return Rate{}, fmt.Errorf("rate %q has invalid period", s)
+	}
+
+	return Rate{Limit: limit, Period: period}, nil
+}
+
+// Decode parses rate from environment variable
+func (r *Rate) Decode(value string) error {
+	rate, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+
+	*r = rate
+
+	return nil
+}
+
+func (r Rate) String() string {
+	if r.Unlimited() {
+		return "0"
+	}
+
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// Unlimited reports whether rate does not limit requests
+func (r Rate) Unlimited() bool {
+	return r.Limit <= 0 || r.Period <= 0
+}
+
+// Interval is time it takes to refill one token
+func (r Rate) Interval() time.Duration {
+	return r.Period / time.Duration(r.Limit)
+}
+
+// Store keeps token buckets. Take must be atomic, it is called concurrently by many requests
+// and with a shared store by many servers.
+type Store interface {
+	// Take takes a token from bucket of key when bucket is not empty at now.
+	// It returns time the bucket is full again and whether the token was taken.
+	Take(key string, rate Rate, now time.Time) (time.Time, bool, error)
+	// Sweep removes buckets which are full at now, they are the same as missing ones
+	Sweep(now time.Time) error
+}
+
+// Result is outcome of request counted by Limiter
+type Result struct {
+	Allowed bool
+	// Limit is size of bucket and Remaining is number of tokens left in it
+	Limit     int
+	Remaining int
+	// Reset is time until bucket is full again
+	Reset time.Duration
+	// RetryAfter is time until the next request is allowed when this one is not
+	RetryAfter time.Duration
+}
+
+// Limiter counts requests in buckets of store
+type Limiter struct {
+	store Store
+	now   func() time.Time
+}
+
+func NewLimiter(store Store) *Limiter {
+	return &Limiter{store: store, now: time.Now}
+}
+
+// Allow takes a token from bucket of key and tells whether the request is allowed
+func (l *Limiter) Allow(key string, rate Rate) (*Result, error) {
+	if rate.Unlimited() {
+		return &Result{Allowed: true}, nil
+	}
+
+	now := l.now()
+
+	fullAt, ok, err := l.store.Take(key, rate, now)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Allowed: ok, Limit: rate.Limit, Reset: fullAt.Sub(now)}
+	if res.Reset < 0 {
+		res.Reset = 0
+	}
+
+	if ok {
+		res.Remaining = int((rate.Period - res.Reset) / rate.Interval())
+	} else {
+		res.RetryAfter = res.Reset + rate.Interval() - rate.Period
+	}
+
+	return res, nil
+}
+
+// Run removes full buckets from store periodically until ctx is done
+func (l *Limiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := l.store.Sweep(l.now())
+			if err != nil {
+				logger.Component(logger.ComponentStorage).Errorf("Rate limit sweep failed: %v", err)
+			}
+		}
+	}
+}
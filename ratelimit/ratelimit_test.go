@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		rate Rate
+		err  bool
+	}{
+		{in: "10/1m", rate: Rate{Limit: 10, Period: time.Minute}},
+		{in: "300/1m30s", rate: Rate{Limit: 300, Period: 90 * time.Second}},
+		{in: "", rate: Rate{}},
+		{in: "0", rate: Rate{}},
+		{in: "10", err: true},
+		{in: "x/1m", err: true},
+		{in: "-1/1m", err: true},
+		{in: "10/0s", err: true},
+		{in: "10/minute", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rate, err := ParseRate(tt.in)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.rate, rate)
+		})
+	}
+
+	var r Rate
+	require.NoError(t, r.Decode("5/1h"))
+	assert.Equal(t, "5/1h0m0s", r.String())
+	assert.Equal(t, 12*time.Minute, r.Interval())
+	assert.True(t, Rate{}.Unlimited())
+}
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Now()
+	l := NewLimiter(NewMemoryStore())
+	l.now = func() time.Time { return now }
+
+	rate := Rate{Limit: 2, Period: time.Minute}
+
+	res, err := l.Allow("ip:10.0.0.1", rate)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second}, res)
+
+	res, err = l.Allow("ip:10.0.0.1", rate)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute}, res)
+
+	res, err = l.Allow("ip:10.0.0.1", rate)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Allowed: false, Limit: 2, Reset: time.Minute, RetryAfter: 30 * time.Second}, res)
+
+	// Other keys have their own buckets
+	res, err = l.Allow("ip:10.0.0.2", rate)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// A token is refilled every 30 seconds
+	now = now.Add(30 * time.Second)
+
+	res, err = l.Allow("ip:10.0.0.1", rate)
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute}, res)
+
+	res, err = l.Allow("ip:10.0.0.1", Rate{})
+	require.NoError(t, err)
+	assert.Equal(t, &Result{Allowed: true}, res)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	rate := Rate{Limit: 10, Period: time.Minute}
+
+	_, _, err := s.Take("a", rate, now)
+	require.NoError(t, err)
+	_, _, err = s.Take("b", rate, now.Add(time.Minute))
+	require.NoError(t, err)
+
+	require.NoError(t, s.Sweep(now.Add(30*time.Second)))
+	assert.Len(t, s.buckets, 1)
+	assert.Contains(t, s.buckets, "b")
+}
@@ -5,23 +5,69 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"net/http"
+	"time"
 
 	"github.com/lvl484/user-manager/config"
 	"github.com/lvl484/user-manager/logger"
 	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/notify"
+	"github.com/lvl484/user-manager/ratelimit"
+	"github.com/lvl484/user-manager/server/http/handlers"
 	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+	"github.com/lvl484/user-manager/webauthn"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 )
 
+// Repositories are storages used by HTTP handlers
+type Repositories struct {
+	Users          *model.UsersRepo
+	RefreshTokens  *model.RefreshTokensRepo
+	Clients        *model.ClientsRepo
+	AuthCodes      *model.AuthCodesRepo
+	Consents       *model.ConsentsRepo
+	RevokedTokens  *model.RevokedTokensRepo
+	DeviceCodes    *model.DeviceCodesRepo
+	TokenExchanges *model.TokenExchangesRepo
+	Sessions       *model.SessionsRepo
+	TwoFactor      *model.TwoFactorRepo
+	WebAuthn       *model.WebAuthnRepo
+	LoginAttempts  *model.LoginAttemptsRepo
+	RateLimits     *ratelimit.Limiter
+	Credentials    *model.CredentialCache
+}
+
 type HTTP struct {
-	srv *http.Server
-	ur  *model.UsersRepo
+	srv    *http.Server
+	repos  *Repositories
+	issuer *token.Issuer
+	admins []string
+	// registrationToken is initial access token of dynamic client registration
+	registrationToken string
+	// secureCookies restricts session cookies to HTTPS
+	secureCookies bool
+	// totpIssuer is name of the service shown by authenticator apps
+	totpIssuer string
+	// rp is relying party WebAuthn credentials are registered for
+	rp *webauthn.RelyingParty
+	// codes sends one-time codes of second factor by email and SMS
+	codes *notify.Codes
+	// stepUpMaxAge is how long after login sensitive operations are allowed, adminACR is class admins must reach
+	stepUpMaxAge time.Duration
+	adminACR     string
+	// Rates limit login and registration strictly, OAuth clients by client id, reads and writes leniently
+	loginRate        ratelimit.Rate
+	registrationRate ratelimit.Rate
+	apiKeyRate       ratelimit.Rate
+	readRate         ratelimit.Rate
+	writeRate        ratelimit.Rate
 }
 
-func NewHTTP(cfg *config.Config, ur *model.UsersRepo) *HTTP {
+func NewHTTP(cfg *config.Config, issuer *token.Issuer, codes *notify.Codes, repos *Repositories) *HTTP {
 	srv := &http.Server{
 		Addr:         cfg.ServerAddress(),
 		ReadTimeout:  cfg.ReadTimeout,
@@ -29,8 +75,22 @@ func NewHTTP(cfg *config.Config, ur *model.UsersRepo) *HTTP {
 	}
 
 	return &HTTP{
-		srv: srv,
-		ur:  ur,
+		srv:               srv,
+		repos:             repos,
+		issuer:            issuer,
+		admins:            cfg.AdminUsers,
+		registrationToken: cfg.ClientRegistrationToken,
+		secureCookies:     cfg.SessionCookieSecure,
+		totpIssuer:        cfg.TOTPIssuer,
+		rp:                cfg.RelyingParty(),
+		codes:             codes,
+		stepUpMaxAge:      cfg.StepUpMaxAge,
+		adminACR:          cfg.AdminACR,
+		loginRate:         cfg.RateLimitLogin,
+		registrationRate:  cfg.RateLimitRegistration,
+		apiKeyRate:        cfg.RateLimitAPIKey,
+		readRate:          cfg.RateLimitRead,
+		writeRate:         cfg.RateLimitWrite,
 	}
 }
 
@@ -41,14 +101,153 @@ func (h *HTTP) UUID(w http.ResponseWriter, r *http.Request) {
 
 // Start create all routes and starting server
 func (h *HTTP) Start() error {
+	basic := middleware.NewBasicAuthentication(h.repos.Users, h.repos.TwoFactor, h.codes, h.repos.LoginAttempts).
+		Cache(h.repos.Credentials).Middleware
+	bearer := middleware.NewBearerAuthentication(h.issuer, h.repos.RevokedTokens, h.repos.Users, h.repos.Clients).Middleware
+	// Requests without Authorization header are authenticated by session cookie of hosted login page
+	session := middleware.NewSessionAuthentication(h.repos.Sessions, basic, handlers.PathLogin).Middleware
+	authentication := middleware.NewAuthentication(session).Scheme("Basic", basic).Scheme("Bearer", bearer)
+	// Sensitive operations require recent login, user is challenged to authenticate again otherwise
+	recent := middleware.NewStepUp(h.stepUpMaxAge, "").Middleware
+
+	// Reads and writes are limited by IP address on all routes and by user on authenticated ones,
+	// login and registration are limited strictly and OAuth clients by their client id
+	reads := []string{http.MethodGet, http.MethodHead}
+	writes := []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	limit := func(key middleware.KeyFunc) mux.MiddlewareFunc {
+		return middleware.NewRateLimit(h.repos.RateLimits,
+			middleware.RateLimitPolicy{Name: "read", Rate: h.readRate, Key: key, Methods: reads},
+			middleware.RateLimitPolicy{Name: "write", Rate: h.writeRate, Key: key, Methods: writes}).Middleware
+	}
+	strict := middleware.NewRateLimit(h.repos.RateLimits,
+		middleware.RateLimitPolicy{Name: "login", Rate: h.loginRate, Key: middleware.ByIP}).Middleware
+	client := middleware.NewRateLimit(h.repos.RateLimits,
+		middleware.RateLimitPolicy{Name: "client", Rate: h.apiKeyRate, Key: middleware.ByAPIKey}).Middleware
+	registrationLimit := middleware.NewRateLimit(h.repos.RateLimits,
+		middleware.RateLimitPolicy{Name: "registration", Rate: h.registrationRate, Key: middleware.ByIP}).Middleware
+
 	mainRoute := mux.NewRouter()
-	mainRoute.Use(middleware.NewBasicAuthentication(h.ur).Middleware)
+	mainRoute.Use(limit(middleware.ByIP))
+
+	tokens := handlers.NewToken(h.issuer, h.repos.RefreshTokens)
+	mainRoute.HandleFunc(handlers.PathJWKS, tokens.JWKS).Methods(http.MethodGet)
+	// Possession of refresh token is enough to use or revoke it
+	mainRoute.HandleFunc("/token/refresh", tokens.Refresh).Methods(http.MethodPost)
+	mainRoute.HandleFunc("/token/revoke", tokens.Revoke).Methods(http.MethodPost)
+
+	admin := middleware.NewAdmin(h.admins)
+
+	oauth := handlers.NewOAuth(h.issuer, admin, &handlers.OAuthRepositories{
+		Clients:   h.repos.Clients,
+		Codes:     h.repos.AuthCodes,
+		Consents:  h.repos.Consents,
+		Refresh:   h.repos.RefreshTokens,
+		Users:     h.repos.Users,
+		Devices:   h.repos.DeviceCodes,
+		Revoked:   h.repos.RevokedTokens,
+		Exchanges: h.repos.TokenExchanges,
+		Sessions:  h.repos.Sessions,
+	})
+	mainRoute.HandleFunc(handlers.PathDiscovery, oauth.Discovery).Methods(http.MethodGet)
+	// Clients authenticate to token endpoint themselves
+	mainRoute.Handle(handlers.PathToken, client(http.HandlerFunc(oauth.Token))).Methods(http.MethodPost)
+	mainRoute.Handle(handlers.PathDeviceAuthorization,
+		client(http.HandlerFunc(oauth.DeviceAuthorization))).Methods(http.MethodPost)
+	mainRoute.HandleFunc(handlers.PathLogout, oauth.Logout).Methods(http.MethodGet, http.MethodPost)
+
+	introspection := handlers.NewIntrospection(h.issuer, h.repos.Clients, h.repos.RefreshTokens,
+		h.repos.RevokedTokens, h.repos.Users)
+	mainRoute.Handle(handlers.PathIntrospect, client(http.HandlerFunc(introspection.Introspect))).Methods(http.MethodPost)
+	mainRoute.Handle(handlers.PathRevoke, client(http.HandlerFunc(introspection.Revoke))).Methods(http.MethodPost)
+
+	// Login and logout pages check their CSRF tokens themselves
+	sessions := handlers.NewSession(h.repos.Users, h.repos.Sessions, h.repos.RefreshTokens, h.repos.TwoFactor,
+		h.repos.LoginAttempts, h.codes, h.secureCookies)
+	mainRoute.HandleFunc(handlers.PathLogin, sessions.LoginPage).Methods(http.MethodGet)
+	mainRoute.Handle(handlers.PathLogin, strict(http.HandlerFunc(sessions.Login))).Methods(http.MethodPost)
+	mainRoute.Handle(handlers.PathLoginVerify, strict(http.HandlerFunc(sessions.LoginVerify))).Methods(http.MethodPost)
+	mainRoute.Handle(handlers.PathLoginSendCode, strict(http.HandlerFunc(sessions.SendCode))).Methods(http.MethodPost)
+	mainRoute.HandleFunc(handlers.PathSignOut, sessions.Logout).Methods(http.MethodPost)
+
+	passkeys := handlers.NewWebAuthn(h.repos.Users, h.repos.WebAuthn, h.repos.Sessions, h.rp, h.secureCookies)
+	mainRoute.Handle(handlers.PathLoginWebAuthnBegin,
+		strict(http.HandlerFunc(passkeys.LoginBegin))).Methods(http.MethodPost)
+	mainRoute.Handle(handlers.PathLoginWebAuthnFinish,
+		strict(http.HandlerFunc(passkeys.LoginFinish))).Methods(http.MethodPost)
+
+	// Registration endpoint checks initial access token itself
+	registration := handlers.NewClientRegistration(h.repos.Clients, h.registrationToken)
+	mainRoute.Handle(handlers.PathRegister,
+		registrationLimit(http.HandlerFunc(registration.Register))).Methods(http.MethodPost)
+
+	// User info is released only for access tokens granted openid scope
+	userInfoRoute := mainRoute.Path(handlers.PathUserInfo).Subrouter()
+	userInfoRoute.Use(middleware.NewBearerAuthentication(h.issuer, h.repos.RevokedTokens, h.repos.Users,
+		h.repos.Clients).OAuth().Middleware)
+	userInfoRoute.Methods(http.MethodGet, http.MethodPost).HandlerFunc(oauth.UserInfo)
+
+	// Access tokens are issued only for credentials, not for other tokens
+	tokenRoute := mainRoute.Path("/token").Subrouter()
+	tokenRoute.Use(strict, basic)
+	tokenRoute.Methods(http.MethodPost).HandlerFunc(tokens.Issue)
+
+	authRoute := mainRoute.NewRoute().Subrouter()
+	authRoute.Use(authentication.Middleware, limit(middleware.ByUser))
 	// TODO: replace it with necessary REST APIs
-	mainRoute.HandleFunc("/uuid", h.UUID).Methods(http.MethodGet)
+	authRoute.HandleFunc("/uuid", h.UUID).Methods(http.MethodGet)
+	authRoute.HandleFunc("/account/tokens", tokens.RevokeOwn).Methods(http.MethodDelete)
+	authRoute.HandleFunc("/account/sessions", sessions.ListOwn).Methods(http.MethodGet)
+	authRoute.Handle("/account/sessions", recent(http.HandlerFunc(sessions.DeleteOwn))).Methods(http.MethodDelete)
+	authRoute.HandleFunc("/account/sessions/{id}", sessions.DeleteOwnByID).Methods(http.MethodDelete)
+
+	twoFactor := handlers.NewTwoFactor(h.repos.TwoFactor, h.repos.Users, h.codes, h.totpIssuer)
+	authRoute.HandleFunc("/account/2fa", twoFactor.Status).Methods(http.MethodGet)
+	authRoute.Handle("/account/2fa", recent(http.HandlerFunc(twoFactor.Disable))).Methods(http.MethodDelete)
+	authRoute.Handle("/account/2fa/totp", recent(http.HandlerFunc(twoFactor.EnrollTOTP))).Methods(http.MethodPost)
+	authRoute.HandleFunc("/account/2fa/totp/confirm", twoFactor.ConfirmTOTP).Methods(http.MethodPost)
+	authRoute.Handle("/account/2fa/otp", recent(http.HandlerFunc(twoFactor.EnrollOTP))).Methods(http.MethodPost)
+	authRoute.HandleFunc("/account/2fa/otp/confirm", twoFactor.ConfirmOTP).Methods(http.MethodPost)
+	authRoute.Handle("/account/2fa/recovery-codes",
+		recent(http.HandlerFunc(twoFactor.RegenerateRecoveryCodes))).Methods(http.MethodPost)
+
+	authRoute.Handle("/account/webauthn/register/begin",
+		recent(http.HandlerFunc(passkeys.RegisterBegin))).Methods(http.MethodPost)
+	authRoute.HandleFunc("/account/webauthn/register/finish", passkeys.RegisterFinish).Methods(http.MethodPost)
+	authRoute.HandleFunc("/account/webauthn/credentials", passkeys.ListCredentials).Methods(http.MethodGet)
+	authRoute.Handle("/account/webauthn/credentials/{id}",
+		recent(http.HandlerFunc(passkeys.DeleteCredential))).Methods(http.MethodDelete)
+
+	authRoute.HandleFunc(handlers.PathAuthorize, oauth.Authorize).Methods(http.MethodGet)
+	authRoute.HandleFunc(handlers.PathAuthorize, oauth.Decide).Methods(http.MethodPost)
+	authRoute.HandleFunc(handlers.PathDevice, oauth.Device).Methods(http.MethodGet)
+	authRoute.HandleFunc(handlers.PathDevice, oauth.DeviceDecide).Methods(http.MethodPost)
+
+	adminRoute := authRoute.PathPrefix("/admin").Subrouter()
+	adminRoute.Use(admin.Middleware, middleware.NewStepUp(h.stepUpMaxAge, h.adminACR).Middleware)
+
+	logLevel := handlers.NewLogLevel()
+	adminRoute.HandleFunc("/log/level", logLevel.Get).Methods(http.MethodGet)
+	adminRoute.HandleFunc("/log/level", logLevel.Set).Methods(http.MethodPut)
+	// Metrics published by expvar, e.g. password_hashing queue depth and wait time
+	adminRoute.Handle("/metrics", expvar.Handler()).Methods(http.MethodGet)
+
+	adminRoute.HandleFunc("/users/{login}/tokens", tokens.RevokeUser).Methods(http.MethodDelete)
+	adminRoute.HandleFunc("/users/{login}/sessions", sessions.ListUser).Methods(http.MethodGet)
+	adminRoute.HandleFunc("/users/{login}/sessions", sessions.DeleteUser).Methods(http.MethodDelete)
+	adminRoute.HandleFunc("/users/{login}/sessions/{id}", sessions.DeleteUserByID).Methods(http.MethodDelete)
+	adminRoute.HandleFunc("/users/{login}/2fa", twoFactor.Reset).Methods(http.MethodDelete)
+	adminRoute.HandleFunc("/users/{login}/lockout", sessions.Unlock).Methods(http.MethodDelete)
+
+	adminRoute.HandleFunc("/clients", registration.List).Methods(http.MethodGet)
+	adminRoute.HandleFunc("/clients", registration.Create).Methods(http.MethodPost)
+	adminRoute.HandleFunc("/clients/{id}", registration.Get).Methods(http.MethodGet)
+	adminRoute.HandleFunc("/clients/{id}", registration.Update).Methods(http.MethodPut)
+	adminRoute.HandleFunc("/clients/{id}", registration.Delete).Methods(http.MethodDelete)
+	adminRoute.HandleFunc("/clients/{id}/secret", registration.RotateSecret).Methods(http.MethodPost)
 
 	h.srv.Handler = mainRoute
 
-	logger.LogUM.Infof("Server Listening at %s...", h.srv.Addr)
+	logger.Component(logger.ComponentHTTP).Infof("Server Listening at %s...", h.srv.Addr)
 	return h.srv.ListenAndServe()
 }
 
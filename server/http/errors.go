@@ -4,14 +4,23 @@ import (
 	"encoding/json"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/lvl484/user-manager/logger"
 	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+
+	"github.com/pkg/errors"
 )
 
 const (
 	messageUnauthorized        = "Authenticate failed"
 	messageInternalServerError = "Internal server error"
+	messageForbidden           = "Access denied"
+	messageStepUpRequired      = "Authentication is not recent or strong enough, authenticate again"
+	messageLoginThrottled      = "Too many failed login attempts, try again later"
+	messageTooManyRequests     = "Too many requests, try again later"
+	messageServiceUnavailable  = "Service is busy, try again later"
 )
 
 func Unauthorized(w http.ResponseWriter) {
@@ -25,10 +34,22 @@ func Unauthorized(w http.ResponseWriter) {
 
 	err := json.NewEncoder(w).Encode(&authError)
 	if err != nil {
-		logger.LogUM.Errorf("Write Unauthorized response error: %v", err)
+		logger.Component(logger.ComponentHTTP).Errorf("Write Unauthorized response error: %v", err)
 	}
 
-	logger.LogUM.Info("Authentication failed! Invalid login or password")
+	logger.Component(logger.ComponentAuth).Info("Authentication failed! Invalid login or password")
+}
+
+// InvalidToken responds to request with missing, expired or malformed bearer token (RFC 6750)
+func InvalidToken(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="user-manager", error="invalid_token"`)
+
+	JSON(w, http.StatusUnauthorized, &model.Error{
+		Code:    strconv.Itoa(http.StatusUnauthorized),
+		Message: messageUnauthorized,
+	})
+
+	logger.Component(logger.ComponentAuth).Info("Authentication failed! Invalid access token")
 }
 
 func InternalServerError(w http.ResponseWriter, err error) {
@@ -40,8 +61,153 @@ func InternalServerError(w http.ResponseWriter, err error) {
 	}
 
 	if err := json.NewEncoder(w).Encode(&internalError); err != nil {
-		logger.LogUM.Errorf("Write internal server response error: %v", err)
+		logger.Component(logger.ComponentHTTP).Errorf("Write internal server response error: %v", err)
+	}
+
+	logger.Component(logger.ComponentHTTP).Errorf("Internal server error: %v", err)
+}
+
+// HashingError responds to request which failed to hash or verify password or client secret.
+// Overloaded password hashing is temporary, so clients are told when to retry, other errors are internal.
+func HashingError(w http.ResponseWriter, err error) {
+	if errors.Cause(err) == model.ErrHashingBusy {
+		ServiceUnavailable(w, model.HashingRetryAfter())
+		return
+	}
+
+	InternalServerError(w, err)
+}
+
+func BadRequest(w http.ResponseWriter, message string) {
+	JSON(w, http.StatusBadRequest, &model.Error{
+		Code:    strconv.Itoa(http.StatusBadRequest),
+		Message: message,
+	})
+}
+
+// NotFound responds to request for missing resource
+func NotFound(w http.ResponseWriter, message string) {
+	JSON(w, http.StatusNotFound, &model.Error{
+		Code:    strconv.Itoa(http.StatusNotFound),
+		Message: message,
+	})
+}
+
+// Conflict responds to request creating resource, which already exists
+func Conflict(w http.ResponseWriter, message string) {
+	JSON(w, http.StatusConflict, &model.Error{
+		Code:    strconv.Itoa(http.StatusConflict),
+		Message: message,
+	})
+}
+
+func Forbidden(w http.ResponseWriter) {
+	JSON(w, http.StatusForbidden, &model.Error{
+		Code:    strconv.Itoa(http.StatusForbidden),
+		Message: messageForbidden,
+	})
+
+	logger.Component(logger.ComponentAuth).Info("Access denied! Not enough rights")
+}
+
+// InsufficientScope responds to request with valid bearer token, which lacks required scope (RFC 6750)
+func InsufficientScope(w http.ResponseWriter, scope string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="user-manager", error="insufficient_scope", scope="`+scope+`"`)
+
+	JSON(w, http.StatusForbidden, &model.Error{
+		Code:    strconv.Itoa(http.StatusForbidden),
+		Message: messageForbidden,
+	})
+}
+
+// InsufficientUserAuthentication responds to request of user, who has to authenticate again within maxAge
+// or with methods reaching acr class, empty acr and zero maxAge are not required (RFC 9470)
+func InsufficientUserAuthentication(w http.ResponseWriter, acr string, maxAge time.Duration) {
+	challenge := `Bearer realm="user-manager", error="insufficient_user_authentication"`
+
+	if acr != "" {
+		challenge += `, acr_values="` + acr + `"`
+	}
+
+	if maxAge > 0 {
+		challenge += `, max_age=` + strconv.Itoa(int(maxAge.Seconds()))
 	}
 
-	logger.LogUM.Errorf("Internal server error: %v", err)
+	w.Header().Set("WWW-Authenticate", challenge)
+
+	JSON(w, http.StatusUnauthorized, &model.Error{
+		Code:    strconv.Itoa(http.StatusUnauthorized),
+		Message: messageStepUpRequired,
+	})
+
+	logger.Component(logger.ComponentAuth).Info("Authentication failed! Step-up authentication required")
+}
+
+// LoginThrottled responds to login of user or from IP address with too many failed logins,
+// which can be tried again after retryAfter
+func LoginThrottled(w http.ResponseWriter, retryAfter time.Duration) {
+	SetRetryAfter(w, retryAfter)
+
+	JSON(w, http.StatusTooManyRequests, &model.Error{
+		Code:    strconv.Itoa(http.StatusTooManyRequests),
+		Message: messageLoginThrottled,
+	})
+
+	logger.Component(logger.ComponentAuth).Info("Authentication failed! Too many failed logins")
+}
+
+// TooManyRequests responds to request over rate limit, which can be made again after retryAfter
+func TooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	SetRetryAfter(w, retryAfter)
+
+	JSON(w, http.StatusTooManyRequests, &model.Error{
+		Code:    strconv.Itoa(http.StatusTooManyRequests),
+		Message: messageTooManyRequests,
+	})
+}
+
+// ServiceUnavailable responds to request which can not be served now because of load,
+// it can be made again after retryAfter
+func ServiceUnavailable(w http.ResponseWriter, retryAfter time.Duration) {
+	SetRetryAfter(w, retryAfter)
+
+	JSON(w, http.StatusServiceUnavailable, &model.Error{
+		Code:    strconv.Itoa(http.StatusServiceUnavailable),
+		Message: messageServiceUnavailable,
+	})
+
+	logger.Component(logger.ComponentHTTP).Warn("Request rejected, password hashing is busy")
+}
+
+// SetRetryAfter sets Retry-After header to d rounded up to whole seconds
+func SetRetryAfter(w http.ResponseWriter, d time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((d+time.Second-1)/time.Second)))
+}
+
+// OAuthError writes OAuth 2.0 error response (RFC 6749 section 5.2)
+func OAuthError(w http.ResponseWriter, e *oauth.Error) {
+	if e.Code == oauth.ErrorInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="user-manager"`)
+	}
+
+	if e.Code == oauth.ErrorTemporarilyUnavailable {
+		SetRetryAfter(w, model.HashingRetryAfter())
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	JSON(w, e.Status(), e)
+
+	logger.Component(logger.ComponentAuth).WithField("error", e.Code).Info("OAuth request rejected")
+}
+
+// JSON writes v as response body with status code
+func JSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Component(logger.ComponentHTTP).Errorf("Write response error: %v", err)
+	}
 }
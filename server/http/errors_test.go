@@ -0,0 +1,31 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashingError(t *testing.T) {
+	w := httptest.NewRecorder()
+	HashingError(w, errors.Wrap(model.ErrHashingBusy, "hashing client secret"))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	HashingError(w, errors.New("connection refused"))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// Only handlers which hash passwords tell clients to retry
+	w = httptest.NewRecorder()
+	InternalServerError(w, model.ErrHashingBusy)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// PathRegister is dynamic client registration endpoint (RFC 7591)
+const PathRegister = "/oauth/register"
+
+const (
+	messageClientNotFound   = "Client not found"
+	messageClientExists     = "Client already exists"
+	messageInvalidClientID  = "Invalid client id"
+	messagePublicClient     = "Public client has no secret"
+	messageAuthMethodChange = "token_endpoint_auth_method can not be changed, register a new client instead"
+)
+
+// clientIDPattern limits ids chosen by administrators to URL safe characters fitting the column
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]{1,64}$`)
+
+// ClientMetadata is client representation of registration and management endpoints (RFC 7591 section 2)
+type ClientMetadata struct {
+	ClientID string `json:"client_id,omitempty"`
+	// ClientSecret is returned only when it is generated, it is never stored in plain text
+	ClientSecret     string `json:"client_secret,omitempty"`
+	ClientIDIssuedAt int64  `json:"client_id_issued_at,omitempty"`
+	// ClientSecretExpiresAt is zero, because secrets do not expire until rotated
+	ClientSecretExpiresAt  *int64   `json:"client_secret_expires_at,omitempty"`
+	ClientName             string   `json:"client_name,omitempty"`
+	RedirectURIs           []string `json:"redirect_uris,omitempty"`
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+	GrantTypes             []string `json:"grant_types,omitempty"`
+	// TokenEndpointAuthMethod is none for public clients, which get no secret
+	TokenEndpointAuthMethod string `json:"token_endpoint_auth_method,omitempty"`
+	Scope                   string `json:"scope,omitempty"`
+	// ExchangeAudiences, Impersonation and Introspection can be set only by administrators
+	ExchangeAudiences []string `json:"exchange_audiences,omitempty"`
+	Impersonation     bool     `json:"impersonation,omitempty"`
+	// Introspection allows confidential client to introspect access tokens issued to other clients
+	Introspection bool `json:"introspection,omitempty"`
+}
+
+// ClientRegistration handles dynamic registration of clients and their management by administrators
+type ClientRegistration struct {
+	clients ClientRegistry
+	// initialToken is initial access token required by registration endpoint, registration is disabled when empty
+	initialToken string
+}
+
+func NewClientRegistration(clients ClientRegistry, initialToken string) *ClientRegistration {
+	return &ClientRegistration{clients: clients, initialToken: initialToken}
+}
+
+// Register registers client with metadata chosen by the client itself (RFC 7591 section 3).
+// Client id is generated, confidential clients get generated secret.
+func (h *ClientRegistration) Register(w http.ResponseWriter, r *http.Request) {
+	if h.initialToken == "" {
+		Forbidden(w)
+		return
+	}
+
+	raw, ok := middleware.BearerToken(r)
+	if !ok || subtle.ConstantTimeCompare([]byte(raw), []byte(h.initialToken)) != 1 {
+		InvalidToken(w)
+		return
+	}
+
+	var m ClientMetadata
+
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidClientMetadata, messageInvalidBody))
+		return
+	}
+
+	if m.ClientID != "" || m.ClientSecret != "" || len(m.ExchangeAudiences) > 0 || m.Impersonation ||
+		m.Introspection || (&model.Client{GrantTypes: m.GrantTypes}).AllowsGrant(model.GrantTokenExchange) {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidClientMetadata,
+			"client_id, client_secret, token exchange and introspection can be set only by administrators"))
+		return
+	}
+
+	client, public, oerr := clientFromMetadata(&m)
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	client.ID = uuid.New().String()
+
+	resp, err := h.add(client, public)
+	if err != nil {
+		HashingError(w, err)
+		return
+	}
+
+	writeClient(w, http.StatusCreated, resp)
+}
+
+// List returns all registered clients
+func (h *ClientRegistration) List(w http.ResponseWriter, r *http.Request) {
+	clients, err := h.clients.List()
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	resp := make([]*ClientMetadata, 0, len(clients))
+	for _, c := range clients {
+		resp = append(resp, clientMetadata(c))
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// Get returns client with id from path
+func (h *ClientRegistration) Get(w http.ResponseWriter, r *http.Request) {
+	client, err := h.clients.Get(mux.Vars(r)["id"])
+
+	switch {
+	case err == model.ErrClientNotFound:
+		NotFound(w, messageClientNotFound)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	JSON(w, http.StatusOK, clientMetadata(client))
+}
+
+// Create registers client on behalf of administrator, who may choose its id and allow token exchange
+func (h *ClientRegistration) Create(w http.ResponseWriter, r *http.Request) {
+	var m ClientMetadata
+
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	if m.ClientSecret != "" {
+		BadRequest(w, "client_secret is always generated")
+		return
+	}
+
+	if m.ClientID != "" && !clientIDPattern.MatchString(m.ClientID) {
+		BadRequest(w, messageInvalidClientID)
+		return
+	}
+
+	client, public, oerr := clientFromMetadata(&m)
+	if oerr != nil {
+		BadRequest(w, oerr.Description)
+		return
+	}
+
+	client.ID = m.ClientID
+	if client.ID == "" {
+		client.ID = uuid.New().String()
+	}
+
+	resp, err := h.add(client, public)
+
+	switch {
+	case err == model.ErrClientExists:
+		Conflict(w, messageClientExists)
+		return
+	case err != nil:
+		HashingError(w, err)
+		return
+	}
+
+	writeClient(w, http.StatusCreated, resp)
+}
+
+// Update replaces metadata of client with id from path. Public client can not become confidential or vice versa.
+func (h *ClientRegistration) Update(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var m ClientMetadata
+
+	err := json.NewDecoder(r.Body).Decode(&m)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	if m.ClientID != "" && m.ClientID != id {
+		BadRequest(w, messageInvalidClientID)
+		return
+	}
+
+	client, public, oerr := clientFromMetadata(&m)
+	if oerr != nil {
+		BadRequest(w, oerr.Description)
+		return
+	}
+
+	existing, err := h.clients.Get(id)
+
+	switch {
+	case err == model.ErrClientNotFound:
+		NotFound(w, messageClientNotFound)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	if public != existing.Public() {
+		BadRequest(w, messageAuthMethodChange)
+		return
+	}
+
+	client.ID, client.SecretHash, client.CreatedAt = id, existing.SecretHash, existing.CreatedAt
+
+	err = h.clients.Update(client)
+
+	switch {
+	case err == model.ErrClientNotFound:
+		NotFound(w, messageClientNotFound)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", id).Info("Client updated")
+
+	JSON(w, http.StatusOK, clientMetadata(client))
+}
+
+// Delete removes client with id from path, refresh tokens issued to it are revoked
+func (h *ClientRegistration) Delete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	err := h.clients.Delete(id)
+
+	switch {
+	case err == model.ErrClientNotFound:
+		NotFound(w, messageClientNotFound)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", id).Info("Client deleted")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateSecret generates a new secret of confidential client with id from path, the old one stops working
+func (h *ClientRegistration) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	secret, err := h.clients.RotateSecret(id)
+
+	switch {
+	case err == model.ErrClientNotFound:
+		NotFound(w, messageClientNotFound)
+		return
+	case err == model.ErrClientPublic:
+		BadRequest(w, messagePublicClient)
+		return
+	case err != nil:
+		HashingError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", id).Warn("Client secret rotated")
+
+	var expiresAt int64
+
+	writeClient(w, http.StatusOK, &ClientMetadata{ClientID: id, ClientSecret: secret, ClientSecretExpiresAt: &expiresAt})
+}
+
+// add stores client with generated secret, unless it is public, and returns its metadata with the secret
+func (h *ClientRegistration) add(client *model.Client, public bool) (*ClientMetadata, error) {
+	var secret string
+
+	if !public {
+		var err error
+
+		secret, err = model.NewClientSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := h.clients.Add(client, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", client.ID).Info("Client registered")
+
+	resp := clientMetadata(client)
+
+	if secret != "" {
+		var expiresAt int64
+		resp.ClientSecret, resp.ClientSecretExpiresAt = secret, &expiresAt
+		resp.TokenEndpointAuthMethod = oauth.AuthMethodClientSecretBasic
+	}
+
+	return resp, nil
+}
+
+// writeClient writes client metadata, which may contain secret, so it must not be cached
+func writeClient(w http.ResponseWriter, code int, m *ClientMetadata) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	JSON(w, code, m)
+}
+
+// clientFromMetadata validates metadata and returns client without id, and whether it is public.
+// Authorization code grant is used when grant types are not set.
+func clientFromMetadata(m *ClientMetadata) (*model.Client, bool, *oauth.Error) {
+	switch m.TokenEndpointAuthMethod {
+	case "", oauth.AuthMethodNone, oauth.AuthMethodClientSecretBasic, oauth.AuthMethodClientSecretPost:
+	default:
+		return nil, false, oauth.NewError(oauth.ErrorInvalidClientMetadata, "token_endpoint_auth_method is not supported")
+	}
+
+	public := m.TokenEndpointAuthMethod == oauth.AuthMethodNone
+
+	client := &model.Client{
+		Name:                   m.ClientName,
+		RedirectURIs:           m.RedirectURIs,
+		PostLogoutRedirectURIs: m.PostLogoutRedirectURIs,
+		GrantTypes:             m.GrantTypes,
+		Scopes:                 oauth.ParseScope(m.Scope),
+		ExchangeAudiences:      m.ExchangeAudiences,
+		Impersonation:          m.Impersonation,
+		Introspection:          m.Introspection,
+	}
+
+	if len(client.GrantTypes) == 0 {
+		client.GrantTypes = []string{model.GrantAuthorizationCode}
+	}
+
+	for _, g := range client.GrantTypes {
+		if !(&model.Client{GrantTypes: grantTypesSupported}).AllowsGrant(g) {
+			return nil, false, oauth.NewError(oauth.ErrorInvalidClientMetadata, "grant type "+g+" is not supported")
+		}
+
+		if public && (g == model.GrantClientCredentials || g == model.GrantTokenExchange) {
+			return nil, false, oauth.NewError(oauth.ErrorInvalidClientMetadata,
+				"public client can not use grant type "+g)
+		}
+	}
+
+	if client.AllowsGrant(model.GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		return nil, false, oauth.NewError(oauth.ErrorInvalidRedirectURI,
+			"redirect_uris are required for authorization code grant")
+	}
+
+	for _, uri := range append(append([]string{}, client.RedirectURIs...), client.PostLogoutRedirectURIs...) {
+		if !oauth.ValidRedirectURI(uri) {
+			return nil, false, oauth.NewError(oauth.ErrorInvalidRedirectURI, "redirect URI "+uri+" is not allowed")
+		}
+	}
+
+	if public && client.Introspection {
+		return nil, false, oauth.NewError(oauth.ErrorInvalidClientMetadata, "public client can not introspect tokens")
+	}
+
+	if (len(client.ExchangeAudiences) > 0 || client.Impersonation) && !client.AllowsGrant(model.GrantTokenExchange) {
+		return nil, false, oauth.NewError(oauth.ErrorInvalidClientMetadata,
+			"exchange_audiences and impersonation require token exchange grant")
+	}
+
+	return client, public, nil
+}
+
+// clientMetadata returns metadata of registered client without secret
+func clientMetadata(c *model.Client) *ClientMetadata {
+	m := &ClientMetadata{
+		ClientID:                c.ID,
+		ClientName:              c.Name,
+		RedirectURIs:            c.RedirectURIs,
+		PostLogoutRedirectURIs:  c.PostLogoutRedirectURIs,
+		GrantTypes:              c.GrantTypes,
+		TokenEndpointAuthMethod: oauth.AuthMethodClientSecretBasic,
+		Scope:                   oauth.FormatScope(c.Scopes),
+		ExchangeAudiences:       c.ExchangeAudiences,
+		Impersonation:           c.Impersonation,
+		Introspection:           c.Introspection,
+	}
+
+	if c.Public() {
+		m.TokenEndpointAuthMethod = oauth.AuthMethodNone
+	}
+
+	if c.CreatedAt != nil {
+		m.ClientIDIssuedAt = c.CreatedAt.Unix()
+	}
+
+	return m
+}
@@ -0,0 +1,307 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInitialToken = "initial-access-token"
+
+func jsonRequest(method, target, body string, vars map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	return mux.SetURLVars(r, vars)
+}
+
+func register(h *handlers.ClientRegistration, body string) *httptest.ResponseRecorder {
+	r := jsonRequest(http.MethodPost, handlers.PathRegister, body, nil)
+	r.Header.Set("Authorization", "Bearer "+testInitialToken)
+
+	w := httptest.NewRecorder()
+	h.Register(w, r)
+
+	return w
+}
+
+func decodeClient(t *testing.T, w *httptest.ResponseRecorder) *handlers.ClientMetadata {
+	var m handlers.ClientMetadata
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &m))
+
+	return &m
+}
+
+func TestClientRegistrationRegister(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clients := mock.NewMockClientRegistry(ctrl)
+	h := handlers.NewClientRegistration(clients, testInitialToken)
+
+	var secret string
+
+	clients.EXPECT().Add(gomock.Any(), gomock.Any()).DoAndReturn(func(c *model.Client, s string) error {
+		assert.NotEmpty(t, c.ID)
+		assert.Equal(t, []string{model.GrantAuthorizationCode}, c.GrantTypes)
+		assert.Equal(t, []string{"profile", "email"}, c.Scopes)
+		secret = s
+		return nil
+	})
+
+	w := register(h, `{"client_name":"Web","redirect_uris":["https://app.example.com/cb"],"scope":"profile email"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	m := decodeClient(t, w)
+	assert.NotEmpty(t, m.ClientID)
+	assert.NotEmpty(t, m.ClientSecret)
+	assert.Equal(t, secret, m.ClientSecret)
+	require.NotNil(t, m.ClientSecretExpiresAt)
+	assert.Zero(t, *m.ClientSecretExpiresAt)
+	assert.Equal(t, oauth.AuthMethodClientSecretBasic, m.TokenEndpointAuthMethod)
+
+	// Public clients get no secret
+	clients.EXPECT().Add(gomock.Any(), "").Return(nil)
+
+	w = register(h, `{"redirect_uris":["http://127.0.0.1:8080/cb"],"token_endpoint_auth_method":"none",
+		"grant_types":["authorization_code","refresh_token"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	m = decodeClient(t, w)
+	assert.Empty(t, m.ClientSecret)
+	assert.Nil(t, m.ClientSecretExpiresAt)
+	assert.Equal(t, oauth.AuthMethodNone, m.TokenEndpointAuthMethod)
+}
+
+func TestClientRegistrationRegisterRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h := handlers.NewClientRegistration(mock.NewMockClientRegistry(ctrl), testInitialToken)
+
+	tests := []struct {
+		name string
+		body string
+		code string
+	}{
+		{
+			name: "MissingRedirectURI",
+			body: `{"client_name":"Web"}`,
+			code: oauth.ErrorInvalidRedirectURI,
+		}, {
+			name: "InsecureRedirectURI",
+			body: `{"redirect_uris":["http://app.example.com/cb"]}`,
+			code: oauth.ErrorInvalidRedirectURI,
+		}, {
+			name: "FragmentRedirectURI",
+			body: `{"redirect_uris":["https://app.example.com/cb#x"]}`,
+			code: oauth.ErrorInvalidRedirectURI,
+		}, {
+			name: "UnsupportedGrant",
+			body: `{"grant_types":["password"]}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "PublicClientCredentials",
+			body: `{"grant_types":["client_credentials"],"token_endpoint_auth_method":"none"}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "AuthMethod",
+			body: `{"grant_types":["client_credentials"],"token_endpoint_auth_method":"private_key_jwt"}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "ClientID",
+			body: `{"client_id":"billing","grant_types":["client_credentials"]}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "TokenExchange",
+			body: `{"grant_types":["` + model.GrantTokenExchange + `"]}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "Impersonation",
+			body: `{"grant_types":["client_credentials"],"impersonation":true}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "Introspection",
+			body: `{"grant_types":["client_credentials"],"introspection":true}`,
+			code: oauth.ErrorInvalidClientMetadata,
+		}, {
+			name: "Body",
+			body: `{`,
+			code: oauth.ErrorInvalidClientMetadata,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := register(h, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, tt.code, decodeOAuthError(t, w).Code)
+		})
+	}
+
+	// Initial access token is required
+	r := jsonRequest(http.MethodPost, handlers.PathRegister, `{}`, nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+
+	w := httptest.NewRecorder()
+	h.Register(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Registration is disabled without initial access token
+	w = httptest.NewRecorder()
+	handlers.NewClientRegistration(nil, "").Register(w, jsonRequest(http.MethodPost, handlers.PathRegister, `{}`, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestClientRegistrationAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clients := mock.NewMockClientRegistry(ctrl)
+	h := handlers.NewClientRegistration(clients, "")
+
+	// Administrator chooses id and allows token exchange
+	clients.EXPECT().Add(gomock.Any(), gomock.Any()).DoAndReturn(func(c *model.Client, s string) error {
+		assert.Equal(t, "gateway", c.ID)
+		assert.True(t, c.AllowsAudience(testBillingAudience))
+		assert.NotEmpty(t, s)
+		return nil
+	})
+
+	body := `{"client_id":"gateway","grant_types":["` + model.GrantTokenExchange + `"],"exchange_audiences":["` +
+		testBillingAudience + `"]}`
+
+	w := httptest.NewRecorder()
+	h.Create(w, jsonRequest(http.MethodPost, "/admin/clients", body, nil))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotEmpty(t, decodeClient(t, w).ClientSecret)
+
+	clients.EXPECT().Add(gomock.Any(), gomock.Any()).Return(model.ErrClientExists)
+
+	w = httptest.NewRecorder()
+	h.Create(w, jsonRequest(http.MethodPost, "/admin/clients", body, nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	h.Create(w, jsonRequest(http.MethodPost, "/admin/clients", `{"client_id":"a/b","grant_types":["client_credentials"]}`, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Resource server is allowed to introspect tokens of other clients, public clients can not introspect
+	clients.EXPECT().Add(gomock.Any(), gomock.Any()).DoAndReturn(func(c *model.Client, s string) error {
+		assert.True(t, c.AllowsIntrospection("spa"))
+		return nil
+	})
+
+	w = httptest.NewRecorder()
+	h.Create(w, jsonRequest(http.MethodPost, "/admin/clients",
+		`{"client_id":"api","grant_types":["client_credentials"],"introspection":true}`, nil))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.True(t, decodeClient(t, w).Introspection)
+
+	w = httptest.NewRecorder()
+	h.Create(w, jsonRequest(http.MethodPost, "/admin/clients", `{"client_id":"app","redirect_uris":["https://app.example.com/cb"],`+
+		`"token_endpoint_auth_method":"none","introspection":true}`, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// List and get never return secrets
+	clients.EXPECT().List().Return([]*model.Client{testConfidentialClient(t), testPublicClient()}, nil)
+
+	w = httptest.NewRecorder()
+	h.List(w, httptest.NewRequest(http.MethodGet, "/admin/clients", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var list []handlers.ClientMetadata
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list, 2)
+	assert.Equal(t, oauth.AuthMethodClientSecretBasic, list[0].TokenEndpointAuthMethod)
+	assert.Equal(t, oauth.AuthMethodNone, list[1].TokenEndpointAuthMethod)
+	assert.NotContains(t, w.Body.String(), "argon2")
+
+	clients.EXPECT().Get("unknown").Return(nil, model.ErrClientNotFound)
+
+	w = httptest.NewRecorder()
+	h.Get(w, jsonRequest(http.MethodGet, "/admin/clients/unknown", "", map[string]string{"id": "unknown"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestClientRegistrationUpdate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clients := mock.NewMockClientRegistry(ctrl)
+	h := handlers.NewClientRegistration(clients, "")
+	vars := map[string]string{"id": "spa"}
+
+	clients.EXPECT().Get("spa").Return(testPublicClient(), nil).Times(2)
+	clients.EXPECT().Update(gomock.Any()).DoAndReturn(func(c *model.Client) error {
+		assert.Equal(t, "spa", c.ID)
+		assert.True(t, c.Public())
+		assert.Equal(t, []string{"https://spa.example.com/cb2"}, c.RedirectURIs)
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	h.Update(w, jsonRequest(http.MethodPut, "/admin/clients/spa", `{"redirect_uris":["https://spa.example.com/cb2"],
+		"token_endpoint_auth_method":"none"}`, vars))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "spa", decodeClient(t, w).ClientID)
+
+	// Public client can not become confidential by update
+	w = httptest.NewRecorder()
+	h.Update(w, jsonRequest(http.MethodPut, "/admin/clients/spa", `{"grant_types":["client_credentials"]}`, vars))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestClientRegistrationRotateSecretAndDelete(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	clients := mock.NewMockClientRegistry(ctrl)
+	h := handlers.NewClientRegistration(clients, "")
+
+	clients.EXPECT().RotateSecret("billing").Return("new-secret", nil)
+	clients.EXPECT().RotateSecret("spa").Return("", model.ErrClientPublic)
+
+	w := httptest.NewRecorder()
+	h.RotateSecret(w, jsonRequest(http.MethodPost, "/admin/clients/billing/secret", "", map[string]string{"id": "billing"}))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "new-secret", decodeClient(t, w).ClientSecret)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	w = httptest.NewRecorder()
+	h.RotateSecret(w, jsonRequest(http.MethodPost, "/admin/clients/spa/secret", "", map[string]string{"id": "spa"}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Secret is not hashed while password hashing is overloaded
+	clients.EXPECT().RotateSecret("busy").Return("", errors.Wrap(model.ErrHashingBusy, "Error hashing client secret"))
+
+	w = httptest.NewRecorder()
+	h.RotateSecret(w, jsonRequest(http.MethodPost, "/admin/clients/busy/secret", "", map[string]string{"id": "busy"}))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	clients.EXPECT().Delete("billing").Return(nil)
+	clients.EXPECT().Delete("unknown").Return(model.ErrClientNotFound)
+
+	w = httptest.NewRecorder()
+	h.Delete(w, jsonRequest(http.MethodDelete, "/admin/clients/billing", "", map[string]string{"id": "billing"}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.Delete(w, jsonRequest(http.MethodDelete, "/admin/clients/unknown", "", map[string]string{"id": "unknown"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
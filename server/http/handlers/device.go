@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+)
+
+// PathDevice is verification page where user enters code shown on device
+const PathDevice = "/device"
+
+// devicePage asks user to enter code shown on device and to approve its authorization request
+var devicePage = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+<h1>Connect a device</h1>
+<p>Signed in as {{.Username}}</p>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+{{if .DeviceToken}}
+<p>{{.Client}} on your device wants to access your account. Make sure the device shows code <b>{{.UserCode}}</b>.</p>
+{{if .Scopes}}<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="device_token" value="{{.DeviceToken}}">
+{{with .CSRFToken}}<input type="hidden" name="csrf_token" value="{{.}}">{{end}}
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+{{else if not .Done}}
+<form method="get" action="{{.Action}}">
+<input type="text" name="user_code" placeholder="XXXX-XXXX" autocomplete="off" autofocus>
+<button type="submit">Continue</button>
+</form>
+{{end}}
+</body>
+</html>
+`))
+
+// deviceApproval is carried through verification page as signed token,
+// so the decision is accepted only from the user the request was shown to
+type deviceApproval struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	UserCode  string `json:"user_code"`
+}
+
+// DeviceAuthorizationResponse is response of device authorization endpoint (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceAuthorization starts device authorization grant: device gets device code to poll token endpoint with
+// and user code, which user enters on verification page on other device
+func (h *OAuth) DeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	client, oerr := authenticateClient(h.clients, r)
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	if !client.AllowsGrant(model.GrantDeviceCode) {
+		OAuthError(w, oauth.NewError(oauth.ErrorUnauthorizedClient, "client is not allowed to use device authorization"))
+		return
+	}
+
+	scopes := oauth.ParseScope(r.PostFormValue("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	if !oauth.ScopeSubset(scopes, client.Scopes) {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidScope, "scope is not allowed for the client"))
+		return
+	}
+
+	raw, code, err := h.devices.Create(client.ID, oauth.FormatScope(scopes))
+	if err != nil {
+		OAuthError(w, serverError(err))
+		return
+	}
+
+	verificationURI := strings.TrimSuffix(h.issuer.Issuer(), "/") + PathDevice
+	userCode := oauth.FormatUserCode(code.UserCode)
+
+	logger.Component(logger.ComponentAuth).WithField("client", client.ID).Debug("Device code issued")
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, &DeviceAuthorizationResponse{
+		DeviceCode:              raw,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int(time.Until(code.ExpiresAt).Seconds()),
+		Interval:                int(code.Interval.Seconds()),
+	})
+}
+
+// Device is verification page of authenticated user. Without user code it asks to enter one,
+// for valid code it shows client and requested scopes to approve.
+func (h *OAuth) Device(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	page := map[string]interface{}{
+		"Username":  user.Username,
+		"Action":    r.URL.Path,
+		"CSRFToken": csrfToken(r),
+	}
+
+	userCode := oauth.NormalizeUserCode(r.URL.Query().Get("user_code"))
+	if userCode == "" {
+		renderDevicePage(w, http.StatusOK, page)
+		return
+	}
+
+	code, err := h.devices.Find(userCode)
+	if err == model.ErrDeviceCodeInvalid {
+		page["Message"] = "The code is invalid or expired, check the code shown on your device."
+		renderDevicePage(w, http.StatusBadRequest, page)
+		return
+	}
+
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	client, err := h.clients.Get(code.ClientID)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	deviceToken, err := h.issuer.Keys().Sign(token.TypeDevice, &deviceApproval{
+		Subject:   user.ID,
+		ExpiresAt: time.Now().Add(consentTTL).Unix(),
+		UserCode:  code.UserCode,
+	})
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	name := client.Name
+	if name == "" {
+		name = client.ID
+	}
+
+	page["Client"] = name
+	page["UserCode"] = oauth.FormatUserCode(code.UserCode)
+	page["Scopes"] = oauth.ParseScope(code.Scope)
+	page["DeviceToken"] = deviceToken
+
+	renderDevicePage(w, http.StatusOK, page)
+}
+
+// DeviceDecide records user decision made on verification page
+func (h *OAuth) DeviceDecide(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	page := map[string]interface{}{
+		"Username":  user.Username,
+		"Action":    r.URL.Path,
+		"CSRFToken": csrfToken(r),
+	}
+
+	var a deviceApproval
+
+	err := h.issuer.Keys().Verify(r.PostFormValue("device_token"), token.TypeDevice, &a)
+	if err != nil || a.Subject != user.ID || time.Now().Unix() >= a.ExpiresAt {
+		page["Message"] = "The request is invalid or expired, enter the code again."
+		renderDevicePage(w, http.StatusBadRequest, page)
+		return
+	}
+
+	approve := r.PostFormValue("decision") == decisionAllow
+
+	auth := authContext(r)
+
+	err = h.devices.Decide(a.UserCode, user.ID, approve, auth.Time, auth.Methods)
+	if err == model.ErrDeviceCodeInvalid {
+		page["Message"] = "The code is invalid or expired, check the code shown on your device."
+		renderDevicePage(w, http.StatusBadRequest, page)
+		return
+	}
+
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithFields(map[string]interface{}{
+		"user":     user.Username,
+		"approved": approve,
+	}).Info("Device authorization decided")
+
+	page["Done"] = true
+	page["Message"] = "Access denied. You can close this page."
+
+	if approve {
+		page["Message"] = "Device connected. You can close this page and return to your device."
+	}
+
+	renderDevicePage(w, http.StatusOK, page)
+}
+
+func renderDevicePage(w http.ResponseWriter, status int, page map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Verification page must not be framed by other sites, it could trick user into clicking Allow
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	err := devicePage.Execute(w, page)
+	if err != nil {
+		logger.Component(logger.ComponentHTTP).Errorf("Render device page error: %v", err)
+	}
+}
+
+// deviceCode issues tokens for device authorization request once user approved it
+func (h *OAuth) deviceCode(r *http.Request, client *model.Client) (*grant, *oauth.Error) {
+	code, err := h.devices.Poll(r.PostFormValue("device_code"), client.ID)
+
+	switch {
+	case err == model.ErrDeviceCodePending:
+		return nil, oauth.NewError(oauth.ErrorAuthorizationPending, "")
+	case err == model.ErrDeviceSlowDown:
+		return nil, oauth.NewError(oauth.ErrorSlowDown, "")
+	case err == model.ErrDeviceCodeDenied:
+		return nil, oauth.NewError(oauth.ErrorAccessDenied, "user denied access")
+	case err == model.ErrDeviceCodeExpired:
+		return nil, oauth.NewError(oauth.ErrorExpiredToken, "device code is expired")
+	case err == model.ErrDeviceCodeInvalid:
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "device code is invalid")
+	case err != nil:
+		return nil, serverError(err)
+	}
+
+	g := &grant{
+		claims: &token.Claims{
+			Subject:  code.UserID,
+			Username: code.Username,
+			Scope:    code.Scope,
+			ClientID: client.ID,
+		},
+	}
+
+	g.claims.Authenticated(code.AuthTime, code.AMR)
+
+	if client.AllowsGrant(model.GrantRefreshToken) {
+		g.refresh, err = h.refresh.Create(code.UserID, client.ID, code.Scope, code.AuthTime, code.AMR, r.UserAgent(),
+			ClientIP(r))
+		if err != nil {
+			return nil, serverError(err)
+		}
+	}
+
+	return g, nil
+}
@@ -0,0 +1,191 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var deviceTokenExpr = regexp.MustCompile(`name="device_token" value="([^"]+)"`)
+
+func testDeviceClient() *model.Client {
+	return &model.Client{
+		ID:         "umcli",
+		Name:       "Admin CLI",
+		GrantTypes: []string{model.GrantDeviceCode, model.GrantRefreshToken},
+		Scopes:     []string{"profile"},
+	}
+}
+
+func TestOAuthDeviceAuthorization(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("umcli").Return(testDeviceClient(), nil).AnyTimes()
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+	m.devices.EXPECT().Create("umcli", "profile").Return("device-code", &model.DeviceCode{
+		ClientID:  "umcli",
+		Scope:     "profile",
+		UserCode:  "BCDFGHJK",
+		Interval:  5 * time.Second,
+		ExpiresAt: time.Now().Add(10 * time.Minute),
+	}, nil)
+
+	authorize := func(form url.Values) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.DeviceAuthorization(w, formRequest(http.MethodPost, "/oauth/device", form))
+
+		return w
+	}
+
+	w := authorize(url.Values{"client_id": {"umcli"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.DeviceAuthorizationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "device-code", resp.DeviceCode)
+	assert.Equal(t, "BCDF-GHJK", resp.UserCode)
+	assert.Equal(t, "user-manager/device", resp.VerificationURI)
+	assert.Equal(t, "user-manager/device?user_code=BCDF-GHJK", resp.VerificationURIComplete)
+	assert.Equal(t, 5, resp.Interval)
+	assert.InDelta(t, 600, resp.ExpiresIn, 1)
+
+	w = authorize(url.Values{"client_id": {"umcli"}, "scope": {"email"}})
+	assert.Equal(t, oauth.ErrorInvalidScope, decodeOAuthError(t, w).Code)
+
+	w = authorize(url.Values{"client_id": {"spa"}})
+	assert.Equal(t, oauth.ErrorUnauthorizedClient, decodeOAuthError(t, w).Code)
+}
+
+func TestOAuthDeviceVerification(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestOAuth(t, ctrl)
+	loginTime := time.Now().Add(-time.Minute)
+
+	m.clients.EXPECT().Get("umcli").Return(testDeviceClient(), nil)
+	m.devices.EXPECT().Find("BCDFGHJK").Return(&model.DeviceCode{ClientID: "umcli", Scope: "profile", UserCode: "BCDFGHJK"}, nil)
+	m.devices.EXPECT().Find("ZZZZZZZZ").Return(nil, model.ErrDeviceCodeInvalid)
+	m.devices.EXPECT().Decide("BCDFGHJK", testUser.ID, true, loginTime, []string{token.AMRPassword}).Return(nil)
+
+	show := func(userCode string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/device?"+url.Values{"user_code": {userCode}}.Encode(), nil)
+		w := httptest.NewRecorder()
+		h.Device(w, r.WithContext(middleware.WithUser(r.Context(), testUser)))
+
+		return w
+	}
+
+	w := show("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `name="user_code"`)
+
+	w = show("zzzz-zzzz")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = show("bcdf-ghjk")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Contains(t, w.Body.String(), "Admin CLI")
+	assert.Contains(t, w.Body.String(), "BCDF-GHJK")
+
+	match := deviceTokenExpr.FindStringSubmatch(w.Body.String())
+	require.Len(t, match, 2)
+
+	decide := func(user *model.User, form url.Values) *httptest.ResponseRecorder {
+		r := formRequest(http.MethodPost, "/device", form)
+		w := httptest.NewRecorder()
+		ctx := middleware.WithUser(r.Context(), user)
+		ctx = middleware.WithAuthContext(ctx, &middleware.AuthContext{Time: loginTime, Methods: []string{token.AMRPassword}})
+		h.DeviceDecide(w, r.WithContext(ctx))
+
+		return w
+	}
+
+	// Approval can not be forged without token shown to the user
+	w = decide(testUser, url.Values{"user_code": {"BCDFGHJK"}, "decision": {"allow"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = decide(&model.User{ID: "other-user-id", Username: "other"}, url.Values{"device_token": {match[1]}, "decision": {"allow"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = decide(testUser, url.Values{"device_token": {match[1]}, "decision": {"allow"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Device connected")
+}
+
+func TestOAuthTokenDeviceCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("umcli").Return(testDeviceClient(), nil).AnyTimes()
+
+	poll := func(deviceCode string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Token(w, formRequest(http.MethodPost, "/oauth/token", url.Values{
+			"grant_type":  {model.GrantDeviceCode},
+			"client_id":   {"umcli"},
+			"device_code": {deviceCode},
+		}))
+
+		return w
+	}
+
+	errorCases := map[error]string{
+		model.ErrDeviceCodePending: oauth.ErrorAuthorizationPending,
+		model.ErrDeviceSlowDown:    oauth.ErrorSlowDown,
+		model.ErrDeviceCodeDenied:  oauth.ErrorAccessDenied,
+		model.ErrDeviceCodeExpired: oauth.ErrorExpiredToken,
+		model.ErrDeviceCodeInvalid: oauth.ErrorInvalidGrant,
+	}
+
+	for err, code := range errorCases {
+		m.devices.EXPECT().Poll("device-code", "umcli").Return(nil, err)
+
+		w := poll("device-code")
+		assert.Equal(t, http.StatusBadRequest, w.Code, code)
+		assert.Equal(t, code, decodeOAuthError(t, w).Code)
+	}
+
+	m.devices.EXPECT().Poll("device-code", "umcli").Return(&model.DeviceCode{
+		ClientID: "umcli",
+		Scope:    "profile",
+		UserID:   testUser.ID,
+		Username: testUser.Username,
+		AuthTime: time.Unix(1600000000, 0),
+		AMR:      []string{token.AMRPassword},
+	}, nil)
+	m.refresh.EXPECT().Create(testUser.ID, "umcli", "profile", time.Unix(1600000000, 0), []string{token.AMRPassword},
+		gomock.Any(), gomock.Any()).Return("refresh", nil)
+
+	w := poll("device-code")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "refresh", resp.RefreshToken)
+
+	claims, err := issuer.Validate(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, testUser.Username, claims.Username)
+	assert.Equal(t, "umcli", claims.ClientID)
+	assert.Equal(t, int64(1600000000), claims.AuthTime)
+	assert.Equal(t, token.ACRSingleFactor, claims.ACR)
+}
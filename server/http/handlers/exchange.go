@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/token"
+
+	"github.com/google/uuid"
+)
+
+// exchangeToken issues token for the subject of subject_token (RFC 8693).
+//
+// Without requested_subject it is delegation: issued token keeps the subject, its scope can only be narrowed,
+// and act claim names the actor, which is the subject of actor_token or the client itself.
+//
+// With requested_subject it is impersonation: administrator presents own token issued to client allowed
+// to impersonate and gets token of other user without act claim.
+//
+// Either way audience is required and must be registered for the client, audience of subject token is never
+// passed on, so exchanged token is accepted only by the service it was requested for.
+//
+// Every issued token is recorded to audit trail.
+func (h *OAuth) exchangeToken(r *http.Request, client *model.Client) (*grant, *oauth.Error) {
+	if client.Public() {
+		return nil, oauth.NewError(oauth.ErrorUnauthorizedClient, "public client can not exchange tokens")
+	}
+
+	if typ := r.PostFormValue("requested_token_type"); typ != "" && typ != oauth.TokenTypeAccessToken {
+		return nil, oauth.NewError(oauth.ErrorInvalidRequest, "only access token can be requested")
+	}
+
+	subject, oerr := h.exchangedToken(r, "subject_token")
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	audience := r.PostFormValue("audience")
+
+	switch {
+	case audience == "":
+		return nil, oauth.NewError(oauth.ErrorInvalidRequest, "audience is required")
+	case !client.AllowsAudience(audience):
+		return nil, oauth.NewError(oauth.ErrorInvalidTarget, "audience is not allowed for the client")
+	}
+
+	claims := &token.Claims{
+		ID:       uuid.New().String(),
+		ClientID: client.ID,
+		Audience: token.Audience{audience},
+	}
+
+	audit := &model.TokenExchange{
+		TokenID:  claims.ID,
+		ClientID: client.ID,
+	}
+
+	if requested := r.PostFormValue("requested_subject"); requested != "" {
+		oerr = h.impersonate(r, client, subject, requested, claims, audit)
+	} else {
+		oerr = h.delegate(r, client, subject, claims, audit)
+	}
+
+	if oerr != nil {
+		return nil, oerr
+	}
+
+	audit.SubjectID, audit.SubjectName, audit.Scope, audit.Audience = claims.Subject, claims.Username, claims.Scope,
+		claims.Audience
+
+	err := h.exchanges.Record(audit)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	logger.Component(logger.ComponentAuth).WithFields(map[string]interface{}{
+		"client":        client.ID,
+		"subject":       audit.SubjectName,
+		"actor":         audit.ActorName,
+		"impersonation": audit.Impersonation,
+	}).Info("Token exchanged")
+
+	return &grant{claims: claims, issuedTokenType: oauth.TokenTypeAccessToken}, nil
+}
+
+// delegate fills claims of token issued to actor on behalf of subject
+func (h *OAuth) delegate(r *http.Request, client *model.Client, subject, claims *token.Claims,
+	audit *model.TokenExchange) *oauth.Error {
+	scopes, oerr := exchangeScope(r, oauth.ParseScope(subject.Scope))
+	if oerr != nil {
+		return oerr
+	}
+
+	actor := &token.Actor{Subject: client.ID, ClientID: client.ID}
+	expiresAt := subject.ExpiresAt
+
+	if r.PostFormValue("actor_token") != "" {
+		actorClaims, oerr := h.exchangedToken(r, "actor_token")
+		if oerr != nil {
+			return oerr
+		}
+
+		if actorClaims.ClientID != client.ID {
+			return oauth.NewError(oauth.ErrorInvalidGrant, "actor_token was issued to other client")
+		}
+
+		actor = &token.Actor{Subject: actorClaims.Subject, Username: actorClaims.Username, ClientID: client.ID}
+
+		if actorClaims.ExpiresAt < expiresAt {
+			expiresAt = actorClaims.ExpiresAt
+		}
+	}
+
+	// Prior actors of delegated subject token are kept in the chain
+	actor.Actor = subject.Actor
+
+	claims.Subject, claims.Username, claims.Scope, claims.Actor = subject.Subject, subject.Username,
+		oauth.FormatScope(scopes), actor
+
+	// Delegated token keeps authentication of subject, so it can not pass step-up checks subject token would fail
+	claims.AuthTime, claims.AMR, claims.ACR = subject.AuthTime, subject.AMR, subject.ACR
+
+	// Exchanged token does not outlive tokens it was exchanged for
+	if limit := time.Now().Add(h.issuer.TTL()).Unix(); expiresAt < limit {
+		claims.ExpiresAt = expiresAt
+	}
+
+	audit.ActorID, audit.ActorName = actor.Subject, actor.Username
+
+	return nil
+}
+
+// impersonate fills claims of token of requested user issued to administrator
+func (h *OAuth) impersonate(r *http.Request, client *model.Client, subject *token.Claims, requested string,
+	claims *token.Claims, audit *model.TokenExchange) *oauth.Error {
+	switch {
+	case !client.Impersonation:
+		return oauth.NewError(oauth.ErrorUnauthorizedClient, "client is not allowed to impersonate users")
+	case r.PostFormValue("actor_token") != "":
+		return oauth.NewError(oauth.ErrorInvalidRequest, "actor_token can not be used with requested_subject")
+	case subject.ClientID != client.ID:
+		return oauth.NewError(oauth.ErrorInvalidGrant, "subject_token was issued to other client")
+	case subject.Username == "" || !h.admins.IsAdmin(subject.Username):
+		return oauth.NewError(oauth.ErrorInvalidGrant, "only administrators can impersonate users")
+	case h.admins.IsAdmin(requested):
+		return oauth.NewError(oauth.ErrorInvalidGrant, "administrators can not be impersonated")
+	}
+
+	user, err := h.users.GetInfo(requested)
+
+	switch {
+	case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+		return oauth.NewError(oauth.ErrorInvalidRequest, "requested subject is not active")
+	case err != nil:
+		return serverError(err)
+	}
+
+	scopes, oerr := exchangeScope(r, client.Scopes)
+	if oerr != nil {
+		return oerr
+	}
+
+	// Impersonated user did not authenticate, so the token carries no authentication context
+	claims.Subject, claims.Username, claims.Scope = user.ID, user.Username, oauth.FormatScope(scopes)
+
+	audit.ActorID, audit.ActorName, audit.Impersonation = subject.Subject, subject.Username, true
+
+	logger.Component(logger.ComponentAuth).WithFields(map[string]interface{}{
+		"client": client.ID,
+		"admin":  subject.Username,
+		"user":   user.Username,
+	}).Warn("User impersonated")
+
+	return nil
+}
+
+// exchangedToken validates subject or actor token of token exchange request, it must be active access token
+func (h *OAuth) exchangedToken(r *http.Request, param string) (*token.Claims, *oauth.Error) {
+	raw := r.PostFormValue(param)
+	if raw == "" {
+		return nil, oauth.NewError(oauth.ErrorInvalidRequest, param+" is required")
+	}
+
+	if r.PostFormValue(param+"_type") != oauth.TokenTypeAccessToken {
+		return nil, oauth.NewError(oauth.ErrorInvalidRequest, param+"_type must be access token")
+	}
+
+	claims, err := activeToken(h.issuer, h.revoked, h.users, h.clients, raw)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	if claims == nil {
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, param+" is invalid or expired")
+	}
+
+	return claims, nil
+}
+
+// exchangeScope returns requested scope, it must be within allowed one. ID token is never issued by exchange.
+func exchangeScope(r *http.Request, allowed []string) ([]string, *oauth.Error) {
+	allowed = oauth.ScopeWithout(allowed, oauth.ScopeOpenID)
+
+	scopes := oauth.ParseScope(r.PostFormValue("scope"))
+	if len(scopes) == 0 {
+		return allowed, nil
+	}
+
+	if !oauth.ScopeSubset(scopes, allowed) {
+		return nil, oauth.NewError(oauth.ErrorInvalidScope, "scope exceeds the allowed one")
+	}
+
+	return scopes, nil
+}
@@ -0,0 +1,281 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/token"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBillingAudience = "https://billing.example.com"
+
+var testAdmin = &model.User{
+	ID:       "0b5ca0f6-9a43-4f5e-8c3c-6c5f1f1b9c11",
+	Username: "support",
+}
+
+func testGatewayClient(t *testing.T) *model.Client {
+	client := testConfidentialClient(t)
+	client.ID = "gateway"
+	client.GrantTypes = []string{model.GrantTokenExchange}
+	client.Scopes = []string{"profile"}
+	client.ExchangeAudiences = []string{testBillingAudience}
+
+	return client
+}
+
+func testSupportClient(t *testing.T) *model.Client {
+	client := testConfidentialClient(t)
+	client.ID = "support"
+	client.GrantTypes = []string{model.GrantTokenExchange}
+	client.Scopes = []string{"profile"}
+	client.ExchangeAudiences = []string{testBillingAudience}
+	client.Impersonation = true
+
+	return client
+}
+
+func exchange(h *handlers.OAuth, clientID string, form url.Values) *httptest.ResponseRecorder {
+	form.Set("grant_type", model.GrantTokenExchange)
+
+	r := formRequest(http.MethodPost, "/oauth/token", form)
+	r.SetBasicAuth(clientID, "s3cret")
+
+	w := httptest.NewRecorder()
+	h.Token(w, r)
+
+	return w
+}
+
+func decodeExchange(t *testing.T, w *httptest.ResponseRecorder, issuer *token.Issuer) *token.Claims {
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, oauth.TokenTypeAccessToken, resp.IssuedTokenType)
+	assert.Empty(t, resp.RefreshToken)
+	assert.Empty(t, resp.IDToken)
+
+	claims, err := issuer.Validate(resp.AccessToken)
+	require.NoError(t, err)
+
+	return claims
+}
+
+func TestOAuthTokenExchangeDelegation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("gateway").Return(testGatewayClient(t), nil).AnyTimes()
+	m.revoked.EXPECT().IsRevoked(gomock.Any()).Return(false, nil).AnyTimes()
+	m.users.EXPECT().GetInfo(testUser.Username).Return(testUser, nil).AnyTimes()
+
+	subjectToken, err := issuer.Issue(&token.Claims{
+		Subject:  testUser.ID,
+		Username: testUser.Username,
+		ClientID: "spa",
+		Scope:    "openid profile email",
+		Actor:    &token.Actor{Subject: "edge"},
+	})
+	require.NoError(t, err)
+
+	subject, err := issuer.Validate(subjectToken)
+	require.NoError(t, err)
+
+	m.exchanges.EXPECT().Record(gomock.Any()).DoAndReturn(func(e *model.TokenExchange) error {
+		assert.Equal(t, "gateway", e.ClientID)
+		assert.Equal(t, testUser.ID, e.SubjectID)
+		assert.Equal(t, "gateway", e.ActorID)
+		assert.False(t, e.Impersonation)
+		assert.Equal(t, []string{testBillingAudience}, e.Audience)
+		return nil
+	})
+
+	claims := decodeExchange(t, exchange(h, "gateway", url.Values{
+		"subject_token":      {subjectToken},
+		"subject_token_type": {oauth.TokenTypeAccessToken},
+		"audience":           {testBillingAudience},
+		"scope":              {"profile"},
+	}), issuer)
+
+	assert.Equal(t, testUser.ID, claims.Subject)
+	assert.Equal(t, testUser.Username, claims.Username)
+	assert.Equal(t, "profile", claims.Scope)
+	assert.Equal(t, "gateway", claims.ClientID)
+	assert.Equal(t, token.Audience{testBillingAudience}, claims.Audience)
+	assert.LessOrEqual(t, claims.ExpiresAt, subject.ExpiresAt)
+	require.NotNil(t, claims.Actor)
+	assert.Equal(t, "gateway", claims.Actor.Subject)
+	require.NotNil(t, claims.Actor.Actor)
+	assert.Equal(t, "edge", claims.Actor.Actor.Subject)
+
+	// Actor token names the actor instead of the client
+	actorToken, err := issuer.Issue(&token.Claims{Subject: "gateway", ClientID: "gateway"})
+	require.NoError(t, err)
+
+	m.exchanges.EXPECT().Record(gomock.Any()).Return(nil)
+
+	claims = decodeExchange(t, exchange(h, "gateway", url.Values{
+		"subject_token":      {subjectToken},
+		"subject_token_type": {oauth.TokenTypeAccessToken},
+		"actor_token":        {actorToken},
+		"actor_token_type":   {oauth.TokenTypeAccessToken},
+		"audience":           {testBillingAudience},
+	}), issuer)
+
+	assert.Equal(t, "profile email", claims.Scope)
+	assert.Equal(t, "gateway", claims.Actor.Subject)
+}
+
+func TestOAuthTokenExchangeRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("gateway").Return(testGatewayClient(t), nil).AnyTimes()
+	m.revoked.EXPECT().IsRevoked(gomock.Any()).Return(false, nil).AnyTimes()
+
+	subjectToken, err := issuer.Issue(&token.Claims{Subject: testUser.ID, Username: testUser.Username, Scope: "profile",
+		Audience: token.Audience{"https://admin.example.com"}})
+	require.NoError(t, err)
+
+	foreignActor, err := issuer.Issue(&token.Claims{Subject: "other", ClientID: "other"})
+	require.NoError(t, err)
+
+	m.users.EXPECT().GetInfo(testUser.Username).Return(testUser, nil).Times(5)
+	m.clients.EXPECT().Get("other").Return(&model.Client{ID: "other"}, nil)
+
+	tests := []struct {
+		name string
+		form url.Values
+		code string
+	}{
+		{
+			name: "TokenType",
+			form: url.Values{"subject_token": {subjectToken}},
+			code: oauth.ErrorInvalidRequest,
+		}, {
+			name: "Audience",
+			form: url.Values{"subject_token": {subjectToken}, "audience": {"https://admin.example.com"}},
+			code: oauth.ErrorInvalidTarget,
+		}, {
+			// Audience of subject token is not passed on to exchanged token
+			name: "NoAudience",
+			form: url.Values{"subject_token": {subjectToken}},
+			code: oauth.ErrorInvalidRequest,
+		}, {
+			name: "Scope",
+			form: url.Values{"subject_token": {subjectToken}, "audience": {testBillingAudience},
+				"scope": {"profile email"}},
+			code: oauth.ErrorInvalidScope,
+		}, {
+			name: "ForeignActor",
+			form: url.Values{"subject_token": {subjectToken}, "audience": {testBillingAudience},
+				"actor_token": {foreignActor}, "actor_token_type": {oauth.TokenTypeAccessToken}},
+			code: oauth.ErrorInvalidGrant,
+		}, {
+			name: "Impersonation",
+			form: url.Values{"subject_token": {subjectToken}, "audience": {testBillingAudience},
+				"requested_subject": {"victim"}},
+			code: oauth.ErrorUnauthorizedClient,
+		}, {
+			name: "InvalidToken",
+			form: url.Values{"subject_token": {subjectToken + "x"}},
+			code: oauth.ErrorInvalidGrant,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name != "TokenType" {
+				tt.form.Set("subject_token_type", oauth.TokenTypeAccessToken)
+			}
+
+			w := exchange(h, "gateway", tt.form)
+			assert.Equal(t, tt.code, decodeOAuthError(t, w).Code)
+		})
+	}
+
+	// Token of disabled user can not be exchanged
+	m.users.EXPECT().GetInfo(testUser.Username).Return(nil, model.ErrUserDisabled)
+
+	w := exchange(h, "gateway", url.Values{"subject_token": {subjectToken}, "subject_token_type": {oauth.TokenTypeAccessToken},
+		"audience": {testBillingAudience}})
+	assert.Equal(t, oauth.ErrorInvalidGrant, decodeOAuthError(t, w).Code)
+}
+
+func TestOAuthTokenExchangeImpersonation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("support").Return(testSupportClient(t), nil).AnyTimes()
+	m.revoked.EXPECT().IsRevoked(gomock.Any()).Return(false, nil).AnyTimes()
+	m.users.EXPECT().GetInfo(testAdmin.Username).Return(testAdmin, nil).AnyTimes()
+	m.admins.EXPECT().IsAdmin(testAdmin.Username).Return(true).AnyTimes()
+	m.admins.EXPECT().IsAdmin(testUser.Username).Return(false).AnyTimes()
+
+	adminToken, err := issuer.Issue(&token.Claims{Subject: testAdmin.ID, Username: testAdmin.Username, ClientID: "support"})
+	require.NoError(t, err)
+
+	m.users.EXPECT().GetInfo(testUser.Username).Return(testUser, nil).AnyTimes()
+	m.exchanges.EXPECT().Record(gomock.Any()).DoAndReturn(func(e *model.TokenExchange) error {
+		assert.True(t, e.Impersonation)
+		assert.Equal(t, testAdmin.ID, e.ActorID)
+		assert.Equal(t, testAdmin.Username, e.ActorName)
+		assert.Equal(t, testUser.Username, e.SubjectName)
+		return nil
+	})
+
+	claims := decodeExchange(t, exchange(h, "support", url.Values{
+		"subject_token":      {adminToken},
+		"subject_token_type": {oauth.TokenTypeAccessToken},
+		"requested_subject":  {testUser.Username},
+		"audience":           {testBillingAudience},
+	}), issuer)
+
+	assert.Equal(t, testUser.ID, claims.Subject)
+	assert.Equal(t, testUser.Username, claims.Username)
+	assert.Equal(t, "profile", claims.Scope)
+	assert.Equal(t, token.Audience{testBillingAudience}, claims.Audience)
+	assert.Nil(t, claims.Actor)
+
+	// Impersonation token is issued only for registered audience
+	w := exchange(h, "support", url.Values{
+		"subject_token":      {adminToken},
+		"subject_token_type": {oauth.TokenTypeAccessToken},
+		"requested_subject":  {testUser.Username},
+	})
+	assert.Equal(t, oauth.ErrorInvalidRequest, decodeOAuthError(t, w).Code)
+
+	// Users can not impersonate others, and administrators can not be impersonated
+	userToken, err := issuer.Issue(&token.Claims{Subject: testUser.ID, Username: testUser.Username, ClientID: "support"})
+	require.NoError(t, err)
+
+	w = exchange(h, "support", url.Values{
+		"subject_token":      {userToken},
+		"subject_token_type": {oauth.TokenTypeAccessToken},
+		"requested_subject":  {testAdmin.Username},
+		"audience":           {testBillingAudience},
+	})
+	assert.Equal(t, oauth.ErrorInvalidGrant, decodeOAuthError(t, w).Code)
+
+	w = exchange(h, "support", url.Values{
+		"subject_token":      {adminToken},
+		"subject_token_type": {oauth.TokenTypeAccessToken},
+		"requested_subject":  {testAdmin.Username},
+		"audience":           {testBillingAudience},
+	})
+	assert.Equal(t, oauth.ErrorInvalidGrant, decodeOAuthError(t, w).Code)
+}
@@ -0,0 +1,125 @@
+// Package handlers provides HTTP handlers of user-manager REST API.
+// Each group of endpoints is a structure with its dependencies,
+// and every endpoint is a method of type http.HandlerFunc.
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+)
+
+type RefreshTokens interface {
+	Create(userID, clientID, scope string, authTime time.Time, amr []string, userAgent, ip string) (string, error)
+	Rotate(raw, clientID, userAgent, ip string) (*model.RefreshToken, string, error)
+	Find(raw string) (*model.RefreshToken, error)
+	Revoke(raw string) error
+	RevokeClient(userID, clientID string) error
+	RevokeUser(login string) error
+	List(login string) ([]*model.RefreshToken, error)
+	RevokeFamily(login, id string) error
+}
+
+type Users interface {
+	GetInfo(login string) (*model.User, error)
+	VerifyAndUpgrade(user *model.User, password string) (bool, error)
+}
+
+type Clients interface {
+	Get(id string) (*model.Client, error)
+}
+
+// ClientRegistry manages registered clients
+type ClientRegistry interface {
+	Add(client *model.Client, secret string) error
+	Get(id string) (*model.Client, error)
+	List() ([]*model.Client, error)
+	Update(client *model.Client) error
+	RotateSecret(id string) (string, error)
+	Delete(id string) error
+}
+
+type AuthCodes interface {
+	Create(code *model.AuthCode) (string, error)
+	Consume(raw string) (*model.AuthCode, error)
+}
+
+type Consents interface {
+	Get(userID, clientID string) ([]string, error)
+	Grant(userID, clientID string, scopes []string) error
+	CreateRequest(userID string, expiresAt time.Time) (string, error)
+	ConsumeRequest(id, userID string) error
+}
+
+type RevokedTokens interface {
+	Revoke(id string, expiresAt time.Time) error
+	IsRevoked(id string) (bool, error)
+}
+
+type DeviceCodes interface {
+	Create(clientID, scope string) (string, *model.DeviceCode, error)
+	Find(userCode string) (*model.DeviceCode, error)
+	Decide(userCode, userID string, approve bool, authTime time.Time, amr []string) error
+	Poll(raw, clientID string) (*model.DeviceCode, error)
+}
+
+type TokenExchanges interface {
+	Record(e *model.TokenExchange) error
+}
+
+// Sessions stores browser sessions started on login page
+type Sessions interface {
+	Create(user *model.User, userAgent, ip, method string, pending bool) (string, *model.Session, error)
+	Touch(raw string) (*model.Session, error)
+	TouchPending(raw string) (*model.Session, error)
+	Complete(raw, method string) error
+	Delete(raw string) error
+	List(login string) ([]*model.Session, error)
+	DeleteByID(login, id string) error
+	DeleteOthers(login, keep string) error
+}
+
+// LoginAttempts counts failed logins of users and IP addresses, which are locked after too many of them
+type LoginAttempts interface {
+	Check(login, ip string) (time.Duration, error)
+	Fail(login, ip string) error
+	Reset(login string) error
+}
+
+// SecondFactors stores TOTP secrets, email and SMS channels and recovery codes of users with two-factor
+// authentication
+type SecondFactors interface {
+	EnrollTOTP(userID string) (string, error)
+	ConfirmTOTP(userID, code string) ([]string, error)
+	EnrollOTP(userID, channel, destination string) (*model.OTPDelivery, error)
+	ConfirmOTP(userID, code string) ([]string, error)
+	IssueOTP(userID string) (*model.OTPDelivery, error)
+	Enabled(userID string) (bool, error)
+	Status(userID string) (*model.TwoFactorStatus, error)
+	Verify(userID, code string) error
+	RegenerateRecoveryCodes(userID string) ([]string, error)
+	Disable(userID string) error
+	Reset(login string) error
+}
+
+// CodeSender delivers one-time codes by email or SMS
+type CodeSender interface {
+	Supports(channel string) bool
+	Send(ctx context.Context, channel, to, code string) error
+}
+
+// WebAuthnCredentials stores WebAuthn credentials of users and challenges of their ceremonies
+type WebAuthnCredentials interface {
+	Add(c *model.WebAuthnCredential) error
+	List(userID string) ([]*model.WebAuthnCredential, error)
+	Get(id string) (*model.WebAuthnCredential, error)
+	Use(id string, signCount uint32) error
+	Delete(userID, id string) error
+	CreateChallenge(userID, ceremony string) (string, error)
+	ConsumeChallenge(challenge, ceremony string) (string, error)
+}
+
+type Admins interface {
+	IsAdmin(username string) bool
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+)
+
+// IntrospectionResponse describes state of presented token (RFC 7662 section 2.2)
+type IntrospectionResponse struct {
+	Active    bool           `json:"active"`
+	Scope     string         `json:"scope,omitempty"`
+	ClientID  string         `json:"client_id,omitempty"`
+	Username  string         `json:"username,omitempty"`
+	TokenType string         `json:"token_type,omitempty"`
+	ExpiresAt int64          `json:"exp,omitempty"`
+	IssuedAt  int64          `json:"iat,omitempty"`
+	NotBefore int64          `json:"nbf,omitempty"`
+	Subject   string         `json:"sub,omitempty"`
+	Audience  token.Audience `json:"aud,omitempty"`
+	Issuer    string         `json:"iss,omitempty"`
+	ID        string         `json:"jti,omitempty"`
+	// Actor is acting party of delegated token (RFC 8693 section 4.1)
+	Actor *token.Actor `json:"act,omitempty"`
+}
+
+// Introspection lets clients check and revoke access and refresh tokens on the server side
+type Introspection struct {
+	issuer  *token.Issuer
+	clients Clients
+	refresh RefreshTokens
+	revoked RevokedTokens
+	users   Users
+}
+
+func NewIntrospection(issuer *token.Issuer, clients Clients, refresh RefreshTokens, revoked RevokedTokens,
+	users Users) *Introspection {
+	return &Introspection{
+		issuer:  issuer,
+		clients: clients,
+		refresh: refresh,
+		revoked: revoked,
+		users:   users,
+	}
+}
+
+// isJWT reports whether raw token looks like signed JWT, refresh tokens are opaque
+func isJWT(raw string) bool {
+	return strings.Count(raw, ".") == 2
+}
+
+// Introspect returns state of the token (RFC 7662). Only confidential clients can introspect tokens.
+// Token type hint is not needed, access tokens are JWT and refresh tokens are opaque.
+// Tokens issued to other clients are reported inactive, unless the client is allowed to introspect
+// access tokens of other clients.
+func (h *Introspection) Introspect(w http.ResponseWriter, r *http.Request) {
+	client, oerr := authenticateClient(h.clients, r)
+	if oerr == nil && client.Public() {
+		oerr = oauth.NewError(oauth.ErrorInvalidClient, "public client can not introspect tokens")
+	}
+
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	raw := r.PostFormValue("token")
+	if raw == "" {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "token is required"))
+		return
+	}
+
+	var (
+		resp *IntrospectionResponse
+		err  error
+	)
+
+	if isJWT(raw) {
+		resp, err = h.accessToken(client, raw)
+	} else {
+		resp, err = h.refreshToken(client, raw)
+	}
+
+	if err != nil {
+		OAuthError(w, serverError(err))
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", client.ID).Debugf("Token introspected, active: %t", resp.Active)
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// activeToken validates access token and checks it was not revoked and its user or client
+// has not lost access after it was issued. Nil claims are returned for inactive token.
+func activeToken(issuer *token.Issuer, revoked RevokedTokens, users Users, clients Clients, raw string) (*token.Claims, error) {
+	claims, err := issuer.Validate(raw)
+	if err != nil {
+		return nil, nil
+	}
+
+	active, err := middleware.ActiveClaims(claims, revoked, users, clients)
+	if err != nil || !active {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// accessToken introspects access token issued to client or, when client is allowed, to other clients
+func (h *Introspection) accessToken(client *model.Client, raw string) (*IntrospectionResponse, error) {
+	claims, err := activeToken(h.issuer, h.revoked, h.users, h.clients, raw)
+	if err != nil || claims == nil || !client.AllowsIntrospection(claims.ClientID) {
+		return &IntrospectionResponse{}, err
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: tokenTypeBearer,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		ID:        claims.ID,
+		Actor:     claims.Actor,
+	}, nil
+}
+
+// refreshToken introspects refresh token issued to client, tokens of disabled users are inactive.
+// Refresh tokens are never sent to resource servers, so other clients can not introspect them.
+func (h *Introspection) refreshToken(client *model.Client, raw string) (*IntrospectionResponse, error) {
+	rt, err := h.refresh.Find(raw)
+
+	switch {
+	case err == model.ErrRefreshTokenInvalid || err == nil && rt.ClientID != client.ID:
+		return &IntrospectionResponse{}, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return &IntrospectionResponse{
+		Active:    true,
+		Scope:     rt.Scope,
+		ClientID:  rt.ClientID,
+		Username:  rt.Username,
+		ExpiresAt: rt.ExpiresAt.Unix(),
+		Subject:   rt.UserID,
+		Issuer:    h.issuer.Issuer(),
+	}, nil
+}
+
+// Revoke revokes access or refresh token of the client (RFC 7009).
+// Response is the same for invalid, expired and already revoked tokens.
+func (h *Introspection) Revoke(w http.ResponseWriter, r *http.Request) {
+	client, oerr := authenticateClient(h.clients, r)
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	raw := r.PostFormValue("token")
+	if raw == "" {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "token is required"))
+		return
+	}
+
+	if isJWT(raw) {
+		oerr = h.revokeAccessToken(client, raw)
+	} else {
+		oerr = h.revokeRefreshToken(client, raw)
+	}
+
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// revokeAccessToken records id of access token issued to client until the token expires
+func (h *Introspection) revokeAccessToken(client *model.Client, raw string) *oauth.Error {
+	claims, err := h.issuer.Validate(raw)
+	if err != nil {
+		return nil
+	}
+
+	if claims.ClientID != client.ID {
+		return oauth.NewError(oauth.ErrorUnauthorizedClient, "token was issued to other client")
+	}
+
+	err = h.revoked.Revoke(claims.ID, time.Unix(claims.ExpiresAt, 0))
+	if err != nil {
+		return serverError(err)
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", client.ID).Info("Access token revoked")
+
+	return nil
+}
+
+// revokeRefreshToken revokes refresh token issued to client with its family
+func (h *Introspection) revokeRefreshToken(client *model.Client, raw string) *oauth.Error {
+	rt, err := h.refresh.Find(raw)
+
+	switch {
+	case err == model.ErrRefreshTokenInvalid:
+		return nil
+	case err != nil:
+		return serverError(err)
+	case rt.ClientID != client.ID:
+		return oauth.NewError(oauth.ErrorUnauthorizedClient, "token was issued to other client")
+	}
+
+	err = h.refresh.Revoke(raw)
+	if err != nil {
+		return serverError(err)
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("client", client.ID).Info("Refresh token revoked")
+
+	return nil
+}
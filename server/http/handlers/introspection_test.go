@@ -0,0 +1,240 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/token"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type introspectionMocks struct {
+	clients *mock.MockClients
+	refresh *mock.MockRefreshTokens
+	revoked *mock.MockRevokedTokens
+	users   *mock.MockUsers
+}
+
+func newTestIntrospection(t *testing.T, ctrl *gomock.Controller) (*handlers.Introspection, *introspectionMocks, *token.Issuer) {
+	m := &introspectionMocks{
+		clients: mock.NewMockClients(ctrl),
+		refresh: mock.NewMockRefreshTokens(ctrl),
+		revoked: mock.NewMockRevokedTokens(ctrl),
+		users:   mock.NewMockUsers(ctrl),
+	}
+
+	issuer := newTestIssuer(t)
+
+	return handlers.NewIntrospection(issuer, m.clients, m.refresh, m.revoked, m.users), m, issuer
+}
+
+func introspect(h *handlers.Introspection, clientID, secret, raw string) *httptest.ResponseRecorder {
+	r := formRequest(http.MethodPost, "/oauth/introspect", url.Values{"token": {raw}})
+	r.SetBasicAuth(clientID, secret)
+
+	w := httptest.NewRecorder()
+	h.Introspect(w, r)
+
+	return w
+}
+
+func decodeIntrospection(t *testing.T, w *httptest.ResponseRecorder) *handlers.IntrospectionResponse {
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var resp handlers.IntrospectionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	return &resp
+}
+
+// testResourceServer is confidential client allowed to introspect access tokens of other clients
+func testResourceServer(t *testing.T) *model.Client {
+	client := testConfidentialClient(t)
+	client.ID = "api"
+	client.Introspection = true
+
+	return client
+}
+
+func TestIntrospectionIntrospectAccessToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestIntrospection(t, ctrl)
+	m.clients.EXPECT().Get("api").Return(testResourceServer(t), nil).AnyTimes()
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil).AnyTimes()
+
+	raw, err := issuer.Issue(&token.Claims{
+		Subject:  testUser.ID,
+		Username: testUser.Username,
+		ClientID: "spa",
+		Scope:    "profile",
+	})
+	require.NoError(t, err)
+
+	claims, err := issuer.Validate(raw)
+	require.NoError(t, err)
+
+	m.revoked.EXPECT().IsRevoked(claims.ID).Return(false, nil).Times(3)
+	m.users.EXPECT().GetInfo(testUser.Username).Return(testUser, nil).Times(2)
+
+	// Token of other client is not disclosed to client which is not allowed to introspect it
+	resp := decodeIntrospection(t, introspect(h, "billing", "s3cret", raw))
+	assert.Equal(t, &handlers.IntrospectionResponse{}, resp)
+
+	resp = decodeIntrospection(t, introspect(h, "api", "s3cret", raw))
+	assert.True(t, resp.Active)
+	assert.Equal(t, "profile", resp.Scope)
+	assert.Equal(t, "spa", resp.ClientID)
+	assert.Equal(t, testUser.Username, resp.Username)
+	assert.Equal(t, testUser.ID, resp.Subject)
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, claims.ExpiresAt, resp.ExpiresAt)
+	assert.Equal(t, claims.ID, resp.ID)
+
+	// Disabled user loses access immediately, though token is not expired yet
+	m.users.EXPECT().GetInfo(testUser.Username).Return(nil, model.ErrUserDisabled)
+
+	resp = decodeIntrospection(t, introspect(h, "api", "s3cret", raw))
+	assert.Equal(t, &handlers.IntrospectionResponse{}, resp)
+
+	m.revoked.EXPECT().IsRevoked(claims.ID).Return(true, nil)
+
+	resp = decodeIntrospection(t, introspect(h, "api", "s3cret", raw))
+	assert.False(t, resp.Active)
+
+	resp = decodeIntrospection(t, introspect(h, "api", "s3cret", raw+"x"))
+	assert.False(t, resp.Active)
+}
+
+func TestIntrospectionIntrospectClientToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestIntrospection(t, ctrl)
+
+	raw, err := issuer.Issue(&token.Claims{Subject: "billing", ClientID: "billing", Scope: "users:read"})
+	require.NoError(t, err)
+
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil).Times(2)
+	m.revoked.EXPECT().IsRevoked(gomock.Any()).Return(false, nil).Times(2)
+
+	resp := decodeIntrospection(t, introspect(h, "billing", "s3cret", raw))
+	assert.True(t, resp.Active)
+	assert.Equal(t, "users:read", resp.Scope)
+
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil)
+	m.clients.EXPECT().Get("billing").Return(nil, model.ErrClientNotFound)
+
+	resp = decodeIntrospection(t, introspect(h, "billing", "s3cret", raw))
+	assert.False(t, resp.Active)
+}
+
+func TestIntrospectionIntrospectRefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestIntrospection(t, ctrl)
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil).AnyTimes()
+
+	m.clients.EXPECT().Get("api").Return(testResourceServer(t), nil)
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	m.refresh.EXPECT().Find("refresh").Return(&model.RefreshToken{
+		UserID:    testUser.ID,
+		Username:  testUser.Username,
+		ClientID:  "billing",
+		Scope:     "profile",
+		ExpiresAt: expiresAt,
+	}, nil).Times(2)
+	m.refresh.EXPECT().Find("used").Return(nil, model.ErrRefreshTokenInvalid)
+
+	resp := decodeIntrospection(t, introspect(h, "billing", "s3cret", "refresh"))
+	assert.True(t, resp.Active)
+	assert.Equal(t, "billing", resp.ClientID)
+	assert.Equal(t, testUser.ID, resp.Subject)
+	assert.Equal(t, expiresAt.Unix(), resp.ExpiresAt)
+
+	resp = decodeIntrospection(t, introspect(h, "billing", "s3cret", "used"))
+	assert.False(t, resp.Active)
+
+	// Refresh tokens of other clients are not disclosed even to clients allowed to introspect access tokens
+	resp = decodeIntrospection(t, introspect(h, "api", "s3cret", "refresh"))
+	assert.Equal(t, &handlers.IntrospectionResponse{}, resp)
+}
+
+func TestIntrospectionIntrospectUnauthorized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestIntrospection(t, ctrl)
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil).AnyTimes()
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+
+	w := introspect(h, "billing", "wrong", "refresh")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidClient, decodeOAuthError(t, w).Code)
+
+	w = introspect(h, "spa", "", "refresh")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidClient, decodeOAuthError(t, w).Code)
+
+	w = introspect(h, "billing", "s3cret", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidRequest, decodeOAuthError(t, w).Code)
+}
+
+func TestIntrospectionRevoke(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestIntrospection(t, ctrl)
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil).AnyTimes()
+
+	revoke := func(raw string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Revoke(w, formRequest(http.MethodPost, "/oauth/revoke", url.Values{"client_id": {"spa"}, "token": {raw}}))
+
+		return w
+	}
+
+	own, err := issuer.Issue(&token.Claims{Subject: testUser.ID, Username: testUser.Username, ClientID: "spa"})
+	require.NoError(t, err)
+
+	claims, err := issuer.Validate(own)
+	require.NoError(t, err)
+
+	m.revoked.EXPECT().Revoke(claims.ID, time.Unix(claims.ExpiresAt, 0)).Return(nil)
+	assert.Equal(t, http.StatusOK, revoke(own).Code)
+
+	other, err := issuer.Issue(&token.Claims{Subject: testUser.ID, Username: testUser.Username, ClientID: "other"})
+	require.NoError(t, err)
+
+	w := revoke(other)
+	assert.Equal(t, oauth.ErrorUnauthorizedClient, decodeOAuthError(t, w).Code)
+
+	m.refresh.EXPECT().Find("refresh").Return(&model.RefreshToken{ClientID: "spa"}, nil)
+	m.refresh.EXPECT().Revoke("refresh").Return(nil)
+	assert.Equal(t, http.StatusOK, revoke("refresh").Code)
+
+	m.refresh.EXPECT().Find("foreign").Return(&model.RefreshToken{ClientID: "other"}, nil)
+	w = revoke("foreign")
+	assert.Equal(t, oauth.ErrorUnauthorizedClient, decodeOAuthError(t, w).Code)
+
+	// Unknown and already revoked tokens are not reported to the client
+	m.refresh.EXPECT().Find("unknown").Return(nil, model.ErrRefreshTokenInvalid)
+	assert.Equal(t, http.StatusOK, revoke("unknown").Code)
+	assert.Equal(t, http.StatusOK, revoke(own+"x").Code)
+}
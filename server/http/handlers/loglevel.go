@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	. "github.com/lvl484/user-manager/server/http"
+)
+
+const (
+	messageInvalidBody     = "Invalid request body"
+	messageInvalidLevel    = "Invalid log level"
+	messageInvalidDuration = "Invalid duration"
+	messageUnknownComp     = "Unknown log component"
+)
+
+// LogLevelRequest changes level of one or all components, optionally for limited duration
+type LogLevelRequest struct {
+	Component string `json:"component"`
+	Level     string `json:"level"`
+	Duration  string `json:"duration"`
+}
+
+// LogLevel handles runtime log level control
+type LogLevel struct{}
+
+func NewLogLevel() *LogLevel {
+	return &LogLevel{}
+}
+
+// Get returns current log level of every component
+func (h *LogLevel) Get(w http.ResponseWriter, r *http.Request) {
+	JSON(w, http.StatusOK, logger.Levels())
+}
+
+// Set changes log level and returns levels of all components
+func (h *LogLevel) Set(w http.ResponseWriter, r *http.Request) {
+	var req LogLevelRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	var duration time.Duration
+
+	if req.Duration != "" {
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil || duration < 0 {
+			BadRequest(w, messageInvalidDuration)
+			return
+		}
+	}
+
+	err = logger.SetLevel(req.Component, req.Level, duration)
+
+	switch {
+	case errors.Is(err, logger.ErrUnknownComponent):
+		BadRequest(w, messageUnknownComp)
+		return
+	case err != nil:
+		BadRequest(w, messageInvalidLevel)
+		return
+	}
+
+	logger.Component(logger.ComponentMain).Warnf("Log level of %q changed to %s for %q", req.Component, req.Level, req.Duration)
+
+	JSON(w, http.StatusOK, logger.Levels())
+}
@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/server/http/handlers"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	logger.SetLogger(&logger.LogConfig{Output: "Stdout", Level: "debug"})
+
+	code := m.Run()
+
+	os.Exit(code)
+}
+
+func TestLogLevelGet(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/admin/log/level", nil)
+	w := httptest.NewRecorder()
+
+	handlers.NewLogLevel().Get(w, r)
+
+	var levels []logger.ComponentLevel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &levels))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, levels)
+}
+
+func TestLogLevelSet(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{
+			name: "Component",
+			body: `{"component":"auth","level":"trace"}`,
+			code: http.StatusOK,
+		}, {
+			name: "Component for duration",
+			body: `{"component":"storage","level":"trace","duration":"1m"}`,
+			code: http.StatusOK,
+		}, {
+			name: "All components",
+			body: `{"level":"debug"}`,
+			code: http.StatusOK,
+		}, {
+			name: "Invalid body",
+			body: `{"level":`,
+			code: http.StatusBadRequest,
+		}, {
+			name: "Invalid level",
+			body: `{"component":"auth","level":"loud"}`,
+			code: http.StatusBadRequest,
+		}, {
+			name: "Invalid duration",
+			body: `{"component":"auth","level":"debug","duration":"forever"}`,
+			code: http.StatusBadRequest,
+		}, {
+			name: "Unknown component",
+			body: `{"component":"kafka","level":"debug"}`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/admin/log/level", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handlers.NewLogLevel().Set(w, r)
+
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
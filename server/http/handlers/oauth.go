@@ -0,0 +1,707 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	responseTypeCode = "code"
+	decisionAllow    = "allow"
+	promptNone       = "none"
+	promptConsent    = "consent"
+	// promptLogin asks to authenticate user again, login page shows form even to signed in user then
+	promptLogin = "login"
+	// consentTTL is how long user has to decide on consent page
+	consentTTL = 10 * time.Minute
+)
+
+// consentPage asks user to grant requested scopes to client
+var consentPage = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.Client}}</title></head>
+<body>
+<h1>{{.Client}} wants to access your account</h1>
+<p>Signed in as {{.Username}}</p>
+{{if .Scopes}}<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="consent_token" value="{{.ConsentToken}}">
+{{with .CSRFToken}}<input type="hidden" name="csrf_token" value="{{.}}">{{end}}
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// authorization is validated authorization request. It is carried through consent page as signed token,
+// so the decision can be accepted only for the request shown to the same user. ID is of stored consent request,
+// which is consumed by the decision, so the token can not be replayed.
+type authorization struct {
+	ID                  string `json:"jti,omitempty"`
+	Subject             string `json:"sub"`
+	ExpiresAt           int64  `json:"exp"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope,omitempty"`
+	State               string `json:"state,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
+}
+
+// OAuthRepositories are storages used by OAuth handlers
+type OAuthRepositories struct {
+	Clients   Clients
+	Codes     AuthCodes
+	Consents  Consents
+	Refresh   RefreshTokens
+	Users     Users
+	Devices   DeviceCodes
+	Revoked   RevokedTokens
+	Exchanges TokenExchanges
+	Sessions  Sessions
+}
+
+// OAuth is OAuth 2.0 authorization server: authorization endpoint with consent and token endpoint
+type OAuth struct {
+	issuer    *token.Issuer
+	admins    Admins
+	clients   Clients
+	codes     AuthCodes
+	consents  Consents
+	refresh   RefreshTokens
+	users     Users
+	devices   DeviceCodes
+	revoked   RevokedTokens
+	exchanges TokenExchanges
+	sessions  Sessions
+}
+
+func NewOAuth(issuer *token.Issuer, admins Admins, repos *OAuthRepositories) *OAuth {
+	return &OAuth{
+		issuer:    issuer,
+		admins:    admins,
+		clients:   repos.Clients,
+		codes:     repos.Codes,
+		consents:  repos.Consents,
+		refresh:   repos.Refresh,
+		users:     repos.Users,
+		devices:   repos.Devices,
+		revoked:   repos.Revoked,
+		exchanges: repos.Exchanges,
+		sessions:  repos.Sessions,
+	}
+}
+
+// Authorize validates authorization request of authenticated user.
+// Code is issued at once when user already granted requested scopes, otherwise consent page is shown.
+func (h *OAuth) Authorize(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	q := r.URL.Query()
+
+	// Errors in client or redirect URI are not redirected, the URI can not be trusted
+	client, oerr := findClient(h.clients, q.Get("client_id"))
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	a := &authorization{
+		ClientID:            client.ID,
+		RedirectURI:         q.Get("redirect_uri"),
+		State:               q.Get("state"),
+		Nonce:               q.Get("nonce"),
+		CodeChallenge:       q.Get("code_challenge"),
+		CodeChallengeMethod: q.Get("code_challenge_method"),
+	}
+
+	if !client.AllowsRedirect(a.RedirectURI) {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "redirect_uri is not registered for the client"))
+		return
+	}
+
+	scopes, oerr := validateAuthorization(client, q.Get("response_type"), q.Get("scope"), a)
+	if oerr != nil {
+		h.redirectError(w, r, a, oerr)
+		return
+	}
+
+	a.Scope = oauth.FormatScope(scopes)
+
+	prompt := q.Get("prompt")
+
+	reauthenticate, oerr := reauthenticationRequired(q, authContext(r), time.Now())
+	if oerr != nil {
+		h.redirectError(w, r, a, oerr)
+		return
+	}
+
+	if reauthenticate {
+		h.reauthenticate(w, r, a, prompt)
+		return
+	}
+
+	granted, err := h.consents.Get(user.ID, client.ID)
+	if err != nil {
+		h.redirectError(w, r, a, serverError(err))
+		return
+	}
+
+	if prompt != promptConsent && granted != nil && oauth.ScopeSubset(scopes, granted) {
+		h.issueCode(w, r, user, a)
+		return
+	}
+
+	// Client asked not to show any page, so consent can not be obtained
+	if prompt == promptNone {
+		h.redirectError(w, r, a, oauth.NewError(oauth.ErrorConsentRequired, "user has not granted requested scopes"))
+		return
+	}
+
+	h.askConsent(w, r, user, client, a, scopes)
+}
+
+// validateAuthorization checks request against client registration and returns requested scopes
+func validateAuthorization(client *model.Client, responseType, scope string, a *authorization) ([]string, *oauth.Error) {
+	if responseType != responseTypeCode {
+		return nil, oauth.NewError(oauth.ErrorUnsupportedResponseType, "only code response type is supported")
+	}
+
+	if !client.AllowsGrant(model.GrantAuthorizationCode) {
+		return nil, oauth.NewError(oauth.ErrorUnauthorizedClient, "client is not allowed to use authorization code")
+	}
+
+	scopes := oauth.ParseScope(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	if !oauth.ScopeSubset(scopes, client.Scopes) {
+		return nil, oauth.NewError(oauth.ErrorInvalidScope, "scope is not allowed for the client")
+	}
+
+	switch {
+	case a.CodeChallenge != "" || a.CodeChallengeMethod != "":
+		if !oauth.ValidChallenge(a.CodeChallenge, a.CodeChallengeMethod) {
+			return nil, oauth.NewError(oauth.ErrorInvalidRequest, "code_challenge must be S256 challenge")
+		}
+	case client.Public():
+		return nil, oauth.NewError(oauth.ErrorInvalidRequest, "code_challenge is required for public clients")
+	}
+
+	return scopes, nil
+}
+
+// reauthenticationRequired reports whether user has to authenticate again for request with max_age, acr_values
+// or prompt=login (OpenID Connect Core section 3.1.2.1). User who has just authenticated is not asked again,
+// even when none of requested classes was reached, client learns reached class from acr claim.
+func reauthenticationRequired(q url.Values, auth *middleware.AuthContext, now time.Time) (bool, *oauth.Error) {
+	maxAge := time.Duration(-1)
+
+	if q.Get("prompt") == promptLogin {
+		maxAge = 0
+	}
+
+	if v := q.Get("max_age"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			return false, oauth.NewError(oauth.ErrorInvalidRequest, "max_age must be non-negative number of seconds")
+		}
+
+		if d := time.Duration(seconds) * time.Second; maxAge < 0 || d < maxAge {
+			maxAge = d
+		}
+	}
+
+	if maxAge >= 0 && !token.AuthenticatedWithin(auth.Time, maxAge, now) {
+		return true, nil
+	}
+
+	return !acrSatisfied(auth.ACR(), q.Get("acr_values")) && !token.AuthenticatedWithin(auth.Time, 0, now), nil
+}
+
+// acrSatisfied reports whether acr satisfies one of space-separated requested classes, unknown classes are ignored
+func acrSatisfied(acr, values string) bool {
+	requested := false
+
+	for _, v := range strings.Fields(values) {
+		if !token.ValidACR(v) {
+			continue
+		}
+
+		if token.SatisfiesACR(acr, v) {
+			return true
+		}
+
+		requested = true
+	}
+
+	return !requested
+}
+
+// authContext returns authentication context of request, it is empty when it is not known
+func authContext(r *http.Request) *middleware.AuthContext {
+	if auth, ok := middleware.AuthContextFromContext(r.Context()); ok {
+		return auth
+	}
+
+	return &middleware.AuthContext{}
+}
+
+// reauthenticate sends browser to login page, which signs user in again and returns to authorization request.
+// User authenticated without session can not be sent there, so client gets login_required error.
+func (h *OAuth) reauthenticate(w http.ResponseWriter, r *http.Request, a *authorization, prompt string) {
+	if _, ok := middleware.SessionFromContext(r.Context()); !ok || prompt == promptNone {
+		h.redirectError(w, r, a, oauth.NewError(oauth.ErrorLoginRequired, "user has to authenticate again"))
+		return
+	}
+
+	http.Redirect(w, r, PathLogin+"?"+url.Values{
+		"prompt":                 {promptLogin},
+		middleware.ReturnToParam: {r.URL.RequestURI()},
+	}.Encode(), http.StatusFound)
+}
+
+// askConsent renders consent page with signed authorization request
+func (h *OAuth) askConsent(w http.ResponseWriter, r *http.Request, user *model.User, client *model.Client,
+	a *authorization, scopes []string) {
+	expiresAt := time.Now().Add(consentTTL)
+
+	id, err := h.consents.CreateRequest(user.ID, expiresAt)
+	if err != nil {
+		h.redirectError(w, r, a, serverError(err))
+		return
+	}
+
+	a.ID = id
+	a.Subject = user.ID
+	a.ExpiresAt = expiresAt.Unix()
+
+	consentToken, err := h.issuer.Keys().Sign(token.TypeConsent, a)
+	if err != nil {
+		h.redirectError(w, r, a, serverError(err))
+		return
+	}
+
+	name := client.Name
+	if name == "" {
+		name = client.ID
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Consent page must not be framed by other sites, it could trick user into clicking Allow
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+
+	err = consentPage.Execute(w, map[string]interface{}{
+		"Client":       name,
+		"Username":     user.Username,
+		"Scopes":       scopes,
+		"Action":       r.URL.Path,
+		"ConsentToken": consentToken,
+		"CSRFToken":    csrfToken(r),
+	})
+	if err != nil {
+		logger.Component(logger.ComponentHTTP).Errorf("Render consent page error: %v", err)
+	}
+}
+
+// Decide handles user decision made on consent page
+func (h *OAuth) Decide(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	var a authorization
+
+	err := h.issuer.Keys().Verify(r.PostFormValue("consent_token"), token.TypeConsent, &a)
+	if err != nil || a.Subject != user.ID || time.Now().Unix() >= a.ExpiresAt {
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "consent is invalid or expired"))
+		return
+	}
+
+	// Either decision consumes the request, consent form can not be submitted again
+	err = h.consents.ConsumeRequest(a.ID, user.ID)
+
+	switch {
+	case err == model.ErrConsentRequestInvalid:
+		OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "consent is invalid or expired"))
+		return
+	case err != nil:
+		OAuthError(w, serverError(err))
+		return
+	}
+
+	if r.PostFormValue("decision") != decisionAllow {
+		h.redirectError(w, r, &a, oauth.NewError(oauth.ErrorAccessDenied, "user denied access"))
+		return
+	}
+
+	granted, err := h.consents.Get(user.ID, a.ClientID)
+	if err != nil {
+		h.redirectError(w, r, &a, serverError(err))
+		return
+	}
+
+	err = h.consents.Grant(user.ID, a.ClientID, oauth.ScopeUnion(granted, oauth.ParseScope(a.Scope)))
+	if err != nil {
+		h.redirectError(w, r, &a, serverError(err))
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithFields(map[string]interface{}{
+		"user":   user.Username,
+		"client": a.ClientID,
+		"scope":  a.Scope,
+	}).Info("Consent granted")
+
+	h.issueCode(w, r, user, &a)
+}
+
+// issueCode redirects user agent back to client with authorization code
+func (h *OAuth) issueCode(w http.ResponseWriter, r *http.Request, user *model.User, a *authorization) {
+	auth := authContext(r)
+
+	code, err := h.codes.Create(&model.AuthCode{
+		ClientID:            a.ClientID,
+		UserID:              user.ID,
+		Username:            user.Username,
+		RedirectURI:         a.RedirectURI,
+		Scope:               a.Scope,
+		Nonce:               a.Nonce,
+		CodeChallenge:       a.CodeChallenge,
+		CodeChallengeMethod: a.CodeChallengeMethod,
+		AuthTime:            auth.Time,
+		AMR:                 auth.Methods,
+	})
+	if err != nil {
+		h.redirectError(w, r, a, serverError(err))
+		return
+	}
+
+	h.redirect(w, r, a.RedirectURI, url.Values{"code": {code}, "state": {a.State}})
+}
+
+// redirectError returns error to client through user agent
+func (h *OAuth) redirectError(w http.ResponseWriter, r *http.Request, a *authorization, e *oauth.Error) {
+	h.redirect(w, r, a.RedirectURI, url.Values{
+		"error":             {e.Code},
+		"error_description": {e.Description},
+		"state":             {a.State},
+	})
+}
+
+func (h *OAuth) redirect(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	location, err := oauth.RedirectURL(redirectURI, params)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, location, http.StatusFound)
+}
+
+// findClient returns registered client by id
+func findClient(clients Clients, id string) (*model.Client, *oauth.Error) {
+	if id == "" {
+		return nil, oauth.NewError(oauth.ErrorInvalidRequest, "client_id is required")
+	}
+
+	client, err := clients.Get(id)
+	if err == model.ErrClientNotFound {
+		return nil, oauth.NewError(oauth.ErrorInvalidClient, "unknown client")
+	}
+
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	return client, nil
+}
+
+// authenticateClient authenticates client of token request with HTTP Basic scheme or form parameters.
+// Public clients are identified by client_id only.
+func authenticateClient(clients Clients, r *http.Request) (*model.Client, *oauth.Error) {
+	id, secret, basic := r.BasicAuth()
+	if basic {
+		// Credentials are form-urlencoded before they are put into Basic scheme (RFC 6749 section 2.3.1)
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	client, oerr := findClient(clients, id)
+	if oerr != nil {
+		if oerr.Code == oauth.ErrorInvalidRequest {
+			oerr = oauth.NewError(oauth.ErrorInvalidClient, "client authentication is required")
+		}
+
+		return nil, oerr
+	}
+
+	if client.Public() {
+		if secret != "" {
+			return nil, oauth.NewError(oauth.ErrorInvalidClient, "public client can not use secret")
+		}
+
+		return client, nil
+	}
+
+	ok, err := client.VerifySecret(secret)
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	if !ok {
+		return nil, oauth.NewError(oauth.ErrorInvalidClient, "client authentication failed")
+	}
+
+	return client, nil
+}
+
+// grant is result of token request: claims of access token, refresh token and nonce of ID token
+type grant struct {
+	claims  *token.Claims
+	refresh string
+	nonce   string
+	// issuedTokenType is set for token exchange
+	issuedTokenType string
+}
+
+// Token is token endpoint, it exchanges grants for access tokens
+func (h *OAuth) Token(w http.ResponseWriter, r *http.Request) {
+	client, oerr := authenticateClient(h.clients, r)
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	grantType := r.PostFormValue("grant_type")
+
+	switch grantType {
+	case model.GrantAuthorizationCode, model.GrantClientCredentials, model.GrantRefreshToken, model.GrantDeviceCode,
+		model.GrantTokenExchange:
+	default:
+		OAuthError(w, oauth.NewError(oauth.ErrorUnsupportedGrantType, ""))
+		return
+	}
+
+	if !client.AllowsGrant(grantType) {
+		OAuthError(w, oauth.NewError(oauth.ErrorUnauthorizedClient, "grant type is not allowed for the client"))
+		return
+	}
+
+	var g *grant
+
+	switch grantType {
+	case model.GrantAuthorizationCode:
+		g, oerr = h.exchangeCode(r, client)
+	case model.GrantClientCredentials:
+		g, oerr = clientCredentials(r, client)
+	case model.GrantRefreshToken:
+		g, oerr = h.refreshToken(r, client)
+	case model.GrantDeviceCode:
+		g, oerr = h.deviceCode(r, client)
+	case model.GrantTokenExchange:
+		g, oerr = h.exchangeToken(r, client)
+	}
+
+	if oerr != nil {
+		OAuthError(w, oerr)
+		return
+	}
+
+	h.respond(w, g)
+}
+
+// exchangeCode redeems authorization code issued to client
+func (h *OAuth) exchangeCode(r *http.Request, client *model.Client) (*grant, *oauth.Error) {
+	code, err := h.codes.Consume(r.PostFormValue("code"))
+	if err == model.ErrAuthCodeInvalid {
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "authorization code is invalid or expired")
+	}
+
+	if err != nil {
+		return nil, serverError(err)
+	}
+
+	switch {
+	case code.ClientID != client.ID:
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "authorization code was issued to other client")
+	case code.RedirectURI != r.PostFormValue("redirect_uri"):
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "redirect_uri does not match authorization request")
+	case code.CodeChallenge != "" &&
+		!oauth.VerifyChallenge(r.PostFormValue("code_verifier"), code.CodeChallenge, code.CodeChallengeMethod):
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "code_verifier does not match code_challenge")
+	}
+
+	g := &grant{
+		claims: &token.Claims{
+			Subject:  code.UserID,
+			Username: code.Username,
+			Scope:    code.Scope,
+			ClientID: client.ID,
+		},
+		nonce: code.Nonce,
+	}
+
+	g.claims.Authenticated(code.AuthTime, code.AMR)
+
+	if client.AllowsGrant(model.GrantRefreshToken) {
+		g.refresh, err = h.refresh.Create(code.UserID, client.ID, code.Scope, code.AuthTime, code.AMR, r.UserAgent(),
+			ClientIP(r))
+		if err != nil {
+			return nil, serverError(err)
+		}
+	}
+
+	return g, nil
+}
+
+// clientCredentials issues token to confidential client acting on its own behalf
+func clientCredentials(r *http.Request, client *model.Client) (*grant, *oauth.Error) {
+	if client.Public() {
+		return nil, oauth.NewError(oauth.ErrorUnauthorizedClient, "public client can not use client credentials")
+	}
+
+	// There is no user to authenticate, so ID token can not be issued
+	scopes := oauth.ParseScope(r.PostFormValue("scope"))
+	if len(scopes) == 0 {
+		scopes = oauth.ScopeWithout(client.Scopes, oauth.ScopeOpenID)
+	}
+
+	if !oauth.ScopeSubset(scopes, client.Scopes) || oauth.HasScope(oauth.FormatScope(scopes), oauth.ScopeOpenID) {
+		return nil, oauth.NewError(oauth.ErrorInvalidScope, "scope is not allowed for the client")
+	}
+
+	return &grant{
+		claims: &token.Claims{
+			Subject:  client.ID,
+			Scope:    oauth.FormatScope(scopes),
+			ClientID: client.ID,
+		},
+	}, nil
+}
+
+// refreshToken rotates refresh token, requested scope can only narrow the originally granted one
+func (h *OAuth) refreshToken(r *http.Request, client *model.Client) (*grant, *oauth.Error) {
+	rt, next, err := h.refresh.Rotate(r.PostFormValue("refresh_token"), client.ID, r.UserAgent(), ClientIP(r))
+
+	switch {
+	case err == model.ErrRefreshTokenReused:
+		logger.Component(logger.ComponentAuth).WithField("client", client.ID).
+			Warn("Refresh token reuse detected, token family revoked")
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "refresh token is invalid")
+	case err == model.ErrRefreshTokenInvalid:
+		return nil, oauth.NewError(oauth.ErrorInvalidGrant, "refresh token is invalid")
+	case err != nil:
+		return nil, serverError(err)
+	}
+
+	scope := rt.Scope
+
+	if requested := oauth.ParseScope(r.PostFormValue("scope")); len(requested) > 0 {
+		if !oauth.ScopeSubset(requested, oauth.ParseScope(rt.Scope)) {
+			return nil, oauth.NewError(oauth.ErrorInvalidScope, "scope exceeds the granted one")
+		}
+
+		scope = oauth.FormatScope(requested)
+	}
+
+	g := &grant{
+		claims: &token.Claims{
+			Subject:  rt.UserID,
+			Username: rt.Username,
+			Scope:    scope,
+			ClientID: client.ID,
+		},
+		refresh: next,
+	}
+
+	// Refreshed tokens keep authentication time and methods of the original login (OpenID Connect Core 12.2)
+	g.claims.Authenticated(rt.AuthTime, rt.AMR)
+
+	return g, nil
+}
+
+// respond issues access token, and ID token when openid scope is granted, and writes successful token response
+func (h *OAuth) respond(w http.ResponseWriter, g *grant) {
+	resp := &TokenResponse{
+		TokenType:       tokenTypeBearer,
+		ExpiresIn:       int(h.issuer.TTL().Seconds()),
+		RefreshToken:    g.refresh,
+		Scope:           g.claims.Scope,
+		IssuedTokenType: g.issuedTokenType,
+	}
+
+	// Lifetime of exchanged token is limited by lifetime of the token it was exchanged for
+	if g.claims.ExpiresAt != 0 {
+		resp.ExpiresIn = int(time.Until(time.Unix(g.claims.ExpiresAt, 0)).Seconds())
+	}
+
+	if oauth.HasScope(g.claims.Scope, oauth.ScopeOpenID) {
+		idToken, oerr := h.idToken(g)
+		if oerr != nil {
+			OAuthError(w, oerr)
+			return
+		}
+
+		resp.IDToken = idToken
+	}
+
+	// Tokens of OAuth clients are not accepted by account and admin APIs of the service
+	if len(g.claims.Audience) == 0 {
+		g.claims.Audience = token.Audience{h.issuer.OAuthAudience()}
+	}
+
+	accessToken, err := h.issuer.Issue(g.claims)
+	if err != nil {
+		OAuthError(w, serverError(err))
+		return
+	}
+
+	resp.AccessToken = accessToken
+
+	logger.Component(logger.ComponentAuth).WithField("client", g.claims.ClientID).Debug("Access token issued")
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// serverError logs unexpected error and returns server_error without details,
+// or temporarily_unavailable when password hashing is busy
+func serverError(err error) *oauth.Error {
+	if errors.Cause(err) == model.ErrHashingBusy {
+		return oauth.NewError(oauth.ErrorTemporarilyUnavailable, "server is busy, try again later")
+	}
+
+	logger.Component(logger.ComponentHTTP).Errorf("OAuth server error: %v", err)
+
+	return oauth.NewError(oauth.ErrorServerError, "")
+}
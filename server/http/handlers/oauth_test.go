@@ -0,0 +1,594 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURI = "https://spa.example.com/callback"
+
+var (
+	testVerifier     = strings.Repeat("v", 43)
+	consentTokenExpr = regexp.MustCompile(`name="consent_token" value="([^"]+)"`)
+)
+
+func testPublicClient() *model.Client {
+	return &model.Client{
+		ID:           "spa",
+		Name:         "Single Page App",
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{model.GrantAuthorizationCode, model.GrantRefreshToken},
+		Scopes:       []string{"profile", "email"},
+	}
+}
+
+func testConfidentialClient(t *testing.T) *model.Client {
+	hash, err := model.EncodePassword(model.NewPasswordConfig(), "s3cret")
+	require.NoError(t, err)
+
+	return &model.Client{
+		ID:         "billing",
+		SecretHash: hash,
+		GrantTypes: []string{model.GrantClientCredentials},
+		Scopes:     []string{"users:read", "users:write"},
+	}
+}
+
+type oauthMocks struct {
+	admins    *mock.MockAdmins
+	clients   *mock.MockClients
+	codes     *mock.MockAuthCodes
+	consents  *mock.MockConsents
+	refresh   *mock.MockRefreshTokens
+	users     *mock.MockUsers
+	devices   *mock.MockDeviceCodes
+	revoked   *mock.MockRevokedTokens
+	exchanges *mock.MockTokenExchanges
+	sessions  *mock.MockSessions
+}
+
+func newTestOAuth(t *testing.T, ctrl *gomock.Controller) (*handlers.OAuth, *oauthMocks, *token.Issuer) {
+	m := &oauthMocks{
+		admins:    mock.NewMockAdmins(ctrl),
+		clients:   mock.NewMockClients(ctrl),
+		codes:     mock.NewMockAuthCodes(ctrl),
+		consents:  mock.NewMockConsents(ctrl),
+		refresh:   mock.NewMockRefreshTokens(ctrl),
+		users:     mock.NewMockUsers(ctrl),
+		devices:   mock.NewMockDeviceCodes(ctrl),
+		revoked:   mock.NewMockRevokedTokens(ctrl),
+		exchanges: mock.NewMockTokenExchanges(ctrl),
+		sessions:  mock.NewMockSessions(ctrl),
+	}
+
+	issuer := newTestIssuer(t)
+
+	return handlers.NewOAuth(issuer, m.admins, &handlers.OAuthRepositories{
+		Clients:   m.clients,
+		Codes:     m.codes,
+		Consents:  m.consents,
+		Refresh:   m.refresh,
+		Users:     m.users,
+		Devices:   m.devices,
+		Revoked:   m.revoked,
+		Exchanges: m.exchanges,
+		Sessions:  m.sessions,
+	}), m, issuer
+}
+
+func authorizeRequest(params url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+params.Encode(), nil)
+	return r.WithContext(middleware.WithUser(r.Context(), testUser))
+}
+
+func authorizeParams() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {oauth.S256Challenge(testVerifier)},
+		"code_challenge_method": {oauth.ChallengeMethodS256},
+	}
+}
+
+func decodeOAuthError(t *testing.T, w *httptest.ResponseRecorder) *oauth.Error {
+	var e oauth.Error
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &e))
+
+	return &e
+}
+
+func redirectQuery(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	require.Equal(t, http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), testRedirectURI))
+
+	return location.Query()
+}
+
+func TestOAuthAuthorizeNotRedirected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("unknown").Return(nil, model.ErrClientNotFound)
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+
+	params := authorizeParams()
+	params.Set("client_id", "unknown")
+
+	w := httptest.NewRecorder()
+	h.Authorize(w, authorizeRequest(params))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidClient, decodeOAuthError(t, w).Code)
+
+	params = authorizeParams()
+	params.Set("redirect_uri", "https://evil.example.com/callback")
+
+	w = httptest.NewRecorder()
+	h.Authorize(w, authorizeRequest(params))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Equal(t, oauth.ErrorInvalidRequest, decodeOAuthError(t, w).Code)
+}
+
+func TestOAuthAuthorizeRedirectedErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		value string
+		code  string
+	}{
+		{name: "Response type", param: "response_type", value: "token", code: oauth.ErrorUnsupportedResponseType},
+		{name: "Scope", param: "scope", value: "profile admin", code: oauth.ErrorInvalidScope},
+		{name: "No PKCE", param: "code_challenge", value: "", code: oauth.ErrorInvalidRequest},
+		{name: "Plain PKCE", param: "code_challenge_method", value: "plain", code: oauth.ErrorInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			h, m, _ := newTestOAuth(t, ctrl)
+			m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+
+			params := authorizeParams()
+			params.Set(tt.param, tt.value)
+
+			w := httptest.NewRecorder()
+			h.Authorize(w, authorizeRequest(params))
+
+			q := redirectQuery(t, w)
+			assert.Equal(t, tt.code, q.Get("error"))
+			assert.Equal(t, "xyz", q.Get("state"))
+			assert.Empty(t, q.Get("code"))
+		})
+	}
+}
+
+func TestOAuthAuthorizeConsented(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+	m.consents.EXPECT().Get(testUser.ID, "spa").Return([]string{"profile", "email"}, nil)
+	m.codes.EXPECT().Create(gomock.Any()).DoAndReturn(func(code *model.AuthCode) (string, error) {
+		assert.Equal(t, testUser.ID, code.UserID)
+		assert.Equal(t, "profile", code.Scope)
+		assert.Equal(t, oauth.ChallengeMethodS256, code.CodeChallengeMethod)
+		return "the-code", nil
+	})
+
+	w := httptest.NewRecorder()
+	h.Authorize(w, authorizeRequest(authorizeParams()))
+
+	q := redirectQuery(t, w)
+	assert.Equal(t, "the-code", q.Get("code"))
+	assert.Equal(t, "xyz", q.Get("state"))
+}
+
+func TestOAuthAuthorizeReauthenticate(t *testing.T) {
+	session := testSession()
+	old := &middleware.AuthContext{Time: time.Now().Add(-time.Hour), Methods: []string{token.AMRPassword}}
+	fresh := &middleware.AuthContext{Time: time.Now(), Methods: []string{token.AMRPassword}}
+
+	tests := []struct {
+		name    string
+		params  url.Values
+		auth    *middleware.AuthContext
+		session bool
+		login   bool
+		error   string
+	}{
+		{
+			name:    "Old login",
+			params:  url.Values{"max_age": {"600"}},
+			auth:    old,
+			session: true,
+			login:   true,
+		}, {
+			name:    "Prompt login",
+			params:  url.Values{"prompt": {"login"}},
+			auth:    old,
+			session: true,
+			login:   true,
+		}, {
+			name:    "Stronger class",
+			params:  url.Values{"acr_values": {token.ACRMultiFactor}},
+			auth:    old,
+			session: true,
+			login:   true,
+		}, {
+			name:   "Without session",
+			params: url.Values{"max_age": {"600"}},
+			auth:   old,
+			error:  oauth.ErrorLoginRequired,
+		}, {
+			name:    "Prompt none",
+			params:  url.Values{"max_age": {"600"}, "prompt": {"none"}},
+			auth:    old,
+			session: true,
+			error:   oauth.ErrorLoginRequired,
+		}, {
+			name:   "Invalid max age",
+			params: url.Values{"max_age": {"-1"}},
+			auth:   fresh,
+			error:  oauth.ErrorInvalidRequest,
+		}, {
+			name:    "Just signed in",
+			params:  url.Values{"max_age": {"0"}, "acr_values": {token.ACRMultiFactor}},
+			auth:    fresh,
+			session: true,
+		}, {
+			name:   "Unknown class",
+			params: url.Values{"acr_values": {"urn:other:acr"}},
+			auth:   old,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			h, m, _ := newTestOAuth(t, ctrl)
+			m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+
+			if !tt.login && tt.error == "" {
+				m.consents.EXPECT().Get(testUser.ID, "spa").Return([]string{"profile"}, nil)
+				m.codes.EXPECT().Create(gomock.Any()).DoAndReturn(func(code *model.AuthCode) (string, error) {
+					assert.Equal(t, tt.auth.Time, code.AuthTime)
+					assert.Equal(t, tt.auth.Methods, code.AMR)
+					return "the-code", nil
+				})
+			}
+
+			params := authorizeParams()
+			for k, v := range tt.params {
+				params[k] = v
+			}
+
+			r := authorizeRequest(params)
+			ctx := middleware.WithAuthContext(r.Context(), tt.auth)
+
+			if tt.session {
+				ctx = middleware.WithSession(ctx, session)
+			}
+
+			w := httptest.NewRecorder()
+			h.Authorize(w, r.WithContext(ctx))
+
+			if tt.login {
+				require.Equal(t, http.StatusFound, w.Code)
+
+				location, err := url.Parse(w.Header().Get("Location"))
+				require.NoError(t, err)
+				assert.Equal(t, handlers.PathLogin, location.Path)
+				assert.Equal(t, "login", location.Query().Get("prompt"))
+				assert.Equal(t, r.URL.RequestURI(), location.Query().Get(middleware.ReturnToParam))
+
+				return
+			}
+
+			q := redirectQuery(t, w)
+			assert.Equal(t, tt.error, q.Get("error"))
+
+			if tt.error == "" {
+				assert.Equal(t, "the-code", q.Get("code"))
+			}
+		})
+	}
+}
+
+func TestOAuthConsent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, _ := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+	m.consents.EXPECT().Get(testUser.ID, "spa").Return([]string{"email"}, nil).Times(2)
+	m.consents.EXPECT().Grant(testUser.ID, "spa", []string{"email", "profile"}).Return(nil)
+	m.consents.EXPECT().CreateRequest(testUser.ID, gomock.Any()).Return("request-id", nil)
+	m.consents.EXPECT().ConsumeRequest("request-id", testUser.ID).Return(nil).Times(2)
+	m.consents.EXPECT().ConsumeRequest("request-id", testUser.ID).Return(model.ErrConsentRequestInvalid)
+	m.codes.EXPECT().Create(gomock.Any()).Return("the-code", nil)
+
+	w := httptest.NewRecorder()
+	h.Authorize(w, authorizeRequest(authorizeParams()))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Contains(t, w.Body.String(), "Single Page App")
+	assert.NotContains(t, w.Body.String(), "csrf_token")
+
+	match := consentTokenExpr.FindStringSubmatch(w.Body.String())
+	require.Len(t, match, 2)
+
+	decide := func(user *model.User, decision string) *httptest.ResponseRecorder {
+		r := formRequest(http.MethodPost, "/oauth/authorize", url.Values{"consent_token": {match[1]}, "decision": {decision}})
+		w := httptest.NewRecorder()
+		h.Decide(w, r.WithContext(middleware.WithUser(r.Context(), user)))
+
+		return w
+	}
+
+	w = decide(&model.User{ID: "other-user-id", Username: "other"}, "allow")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	q := redirectQuery(t, decide(testUser, "deny"))
+	assert.Equal(t, oauth.ErrorAccessDenied, q.Get("error"))
+	assert.Equal(t, "xyz", q.Get("state"))
+
+	q = redirectQuery(t, decide(testUser, "allow"))
+	assert.Equal(t, "the-code", q.Get("code"))
+	assert.Equal(t, "xyz", q.Get("state"))
+
+	// Consent form can not be replayed for another code
+	w = decide(testUser, "allow")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidRequest, decodeOAuthError(t, w).Code)
+
+	// Page shown within browser session carries its CSRF token
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+	m.consents.EXPECT().Get(testUser.ID, "spa").Return([]string{"email"}, nil)
+	m.consents.EXPECT().CreateRequest(testUser.ID, gomock.Any()).Return("session-request-id", nil)
+
+	r := authorizeRequest(authorizeParams())
+	w = httptest.NewRecorder()
+	h.Authorize(w, r.WithContext(middleware.WithSession(r.Context(), testSession())))
+	assert.Contains(t, w.Body.String(), `name="csrf_token" value="session-csrf"`)
+}
+
+func TestOAuthTokenAuthorizationCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+
+	code := &model.AuthCode{
+		ClientID:            "spa",
+		UserID:              testUser.ID,
+		Username:            testUser.Username,
+		RedirectURI:         testRedirectURI,
+		Scope:               "profile",
+		CodeChallenge:       oauth.S256Challenge(testVerifier),
+		CodeChallengeMethod: oauth.ChallengeMethodS256,
+		AuthTime:            time.Unix(1600000000, 0),
+		AMR:                 []string{token.AMRPassword, token.AMRWebAuthn},
+	}
+
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil).AnyTimes()
+	m.codes.EXPECT().Consume("good").Return(code, nil)
+	m.codes.EXPECT().Consume("stolen").Return(code, nil)
+	m.codes.EXPECT().Consume("used").Return(nil, model.ErrAuthCodeInvalid)
+	m.refresh.EXPECT().Create(testUser.ID, "spa", "profile", code.AuthTime, code.AMR, gomock.Any(), gomock.Any()).
+		Return("refresh", nil)
+
+	exchange := func(code, verifier string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Token(w, formRequest(http.MethodPost, "/oauth/token", url.Values{
+			"grant_type":    {model.GrantAuthorizationCode},
+			"client_id":     {"spa"},
+			"code":          {code},
+			"redirect_uri":  {testRedirectURI},
+			"code_verifier": {verifier},
+		}))
+
+		return w
+	}
+
+	w := exchange("good", testVerifier)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "refresh", resp.RefreshToken)
+	assert.Equal(t, "profile", resp.Scope)
+
+	claims, err := issuer.Validate(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, testUser.ID, claims.Subject)
+	assert.Equal(t, "spa", claims.ClientID)
+	assert.Equal(t, "profile", claims.Scope)
+	assert.Equal(t, int64(1600000000), claims.AuthTime)
+	assert.Equal(t, token.ACRMultiFactor, claims.ACR)
+
+	w = exchange("stolen", strings.Repeat("x", 43))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidGrant, decodeOAuthError(t, w).Code)
+
+	w = exchange("used", testVerifier)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, oauth.ErrorInvalidGrant, decodeOAuthError(t, w).Code)
+}
+
+func TestOAuthTokenClientCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil).AnyTimes()
+
+	request := func(secret string, form url.Values) *httptest.ResponseRecorder {
+		r := formRequest(http.MethodPost, "/oauth/token", form)
+		r.SetBasicAuth("billing", secret)
+
+		w := httptest.NewRecorder()
+		h.Token(w, r)
+
+		return w
+	}
+
+	w := request("s3cret", url.Values{"grant_type": {model.GrantClientCredentials}, "scope": {"users:read"}})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Empty(t, resp.RefreshToken)
+
+	claims, err := issuer.Validate(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "billing", claims.Subject)
+	assert.Equal(t, "users:read", claims.Scope)
+
+	w = request("wrong", url.Values{"grant_type": {model.GrantClientCredentials}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, oauth.ErrorInvalidClient, decodeOAuthError(t, w).Code)
+
+	w = request("s3cret", url.Values{"grant_type": {model.GrantClientCredentials}, "scope": {"users:delete"}})
+	assert.Equal(t, oauth.ErrorInvalidScope, decodeOAuthError(t, w).Code)
+
+	w = request("s3cret", url.Values{"grant_type": {model.GrantAuthorizationCode}})
+	assert.Equal(t, oauth.ErrorUnauthorizedClient, decodeOAuthError(t, w).Code)
+
+	w = request("s3cret", url.Values{"grant_type": {"password"}})
+	assert.Equal(t, oauth.ErrorUnsupportedGrantType, decodeOAuthError(t, w).Code)
+}
+
+func TestOAuthTokenRejectedByAccountAPI(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+
+	code := &model.AuthCode{
+		ClientID:    "spa",
+		UserID:      testUser.ID,
+		Username:    testUser.Username,
+		RedirectURI: testRedirectURI,
+		Scope:       oauth.ScopeOpenID,
+	}
+
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil)
+	m.clients.EXPECT().Get("billing").Return(testConfidentialClient(t), nil).Times(2)
+	m.codes.EXPECT().Consume("good").Return(code, nil)
+	m.refresh.EXPECT().Create(testUser.ID, "spa", oauth.ScopeOpenID, gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any()).Return("refresh", nil)
+	m.users.EXPECT().GetInfo(testUser.Username).Return(testUser, nil).Times(2)
+	m.revoked.EXPECT().IsRevoked(gomock.Any()).Return(false, nil).Times(2)
+
+	accessToken := func(r *http.Request) string {
+		w := httptest.NewRecorder()
+		h.Token(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var resp handlers.TokenResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+		return resp.AccessToken
+	}
+
+	codeToken := accessToken(formRequest(http.MethodPost, "/oauth/token", url.Values{
+		"grant_type":   {model.GrantAuthorizationCode},
+		"client_id":    {"spa"},
+		"code":         {"good"},
+		"redirect_uri": {testRedirectURI},
+	}))
+
+	r := formRequest(http.MethodPost, "/oauth/token", url.Values{"grant_type": {model.GrantClientCredentials}})
+	r.SetBasicAuth("billing", "s3cret")
+	clientToken := accessToken(r)
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	account := middleware.NewBearerAuthentication(issuer, m.revoked, m.users, m.clients).Middleware(ok)
+	userInfo := middleware.NewBearerAuthentication(issuer, m.revoked, m.users, m.clients).OAuth().Middleware(ok)
+
+	for _, raw := range []string{codeToken, clientToken} {
+		r := httptest.NewRequest(http.MethodPost, "/account/2fa", nil)
+		r.Header.Set("Authorization", "Bearer "+raw)
+
+		w := httptest.NewRecorder()
+		account.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		r = httptest.NewRequest(http.MethodGet, handlers.PathUserInfo, nil)
+		r.Header.Set("Authorization", "Bearer "+raw)
+
+		w = httptest.NewRecorder()
+		userInfo.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+}
+
+func TestOAuthTokenRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+
+	rotated := &model.RefreshToken{UserID: testUser.ID, Username: testUser.Username, ClientID: "spa", Scope: "profile email"}
+
+	m.clients.EXPECT().Get("spa").Return(testPublicClient(), nil).AnyTimes()
+	m.refresh.EXPECT().Rotate("valid", "spa", gomock.Any(), gomock.Any()).Return(rotated, "next", nil)
+	m.refresh.EXPECT().Rotate("reused", "spa", gomock.Any(), gomock.Any()).Return(nil, "", model.ErrRefreshTokenReused)
+
+	w := httptest.NewRecorder()
+	h.Token(w, formRequest(http.MethodPost, "/oauth/token", url.Values{
+		"grant_type":    {model.GrantRefreshToken},
+		"client_id":     {"spa"},
+		"refresh_token": {"valid"},
+		"scope":         {"email"},
+	}))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "next", resp.RefreshToken)
+
+	claims, err := issuer.Validate(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "email", claims.Scope)
+
+	w = httptest.NewRecorder()
+	h.Token(w, formRequest(http.MethodPost, "/oauth/token", url.Values{
+		"grant_type":    {model.GrantRefreshToken},
+		"client_id":     {"spa"},
+		"refresh_token": {"reused"},
+	}))
+	assert.Equal(t, oauth.ErrorInvalidGrant, decodeOAuthError(t, w).Code)
+}
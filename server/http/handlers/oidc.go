@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+)
+
+// Paths of endpoints published in discovery document
+const (
+	PathAuthorize           = "/oauth/authorize"
+	PathToken               = "/oauth/token"
+	PathUserInfo            = "/userinfo"
+	PathLogout              = "/oauth/logout"
+	PathIntrospect          = "/oauth/introspect"
+	PathRevoke              = "/oauth/revoke"
+	PathDeviceAuthorization = "/oauth/device"
+	PathJWKS                = "/.well-known/jwks.json"
+	PathDiscovery           = "/.well-known/openid-configuration"
+)
+
+// grantTypesSupported are grant types token endpoint accepts and clients can be registered with
+var grantTypesSupported = []string{model.GrantAuthorizationCode, model.GrantClientCredentials, model.GrantRefreshToken,
+	model.GrantDeviceCode, model.GrantTokenExchange}
+
+// signedOutPage is shown after logout when client did not ask to redirect back
+var signedOutPage = template.Must(template.New("signed-out").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Signed out</title></head>
+<body><h1>You have been signed out</h1></body>
+</html>
+`))
+
+// Discovery is OpenID Provider metadata (OpenID Connect Discovery section 3)
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ACRValuesSupported                []string `json:"acr_values_supported"`
+}
+
+// UserInfoResponse is response of userinfo endpoint
+type UserInfoResponse struct {
+	Subject string `json:"sub"`
+	token.UserInfo
+}
+
+// Discovery publishes OpenID Provider metadata. Endpoints are relative to issuer,
+// so issuer has to be the public URL of the service.
+func (h *OAuth) Discovery(w http.ResponseWriter, r *http.Request) {
+	base := strings.TrimSuffix(h.issuer.Issuer(), "/")
+
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+
+	JSON(w, http.StatusOK, &Discovery{
+		Issuer:                           h.issuer.Issuer(),
+		AuthorizationEndpoint:            base + PathAuthorize,
+		TokenEndpoint:                    base + PathToken,
+		UserInfoEndpoint:                 base + PathUserInfo,
+		JWKSURI:                          base + PathJWKS,
+		EndSessionEndpoint:               base + PathLogout,
+		IntrospectionEndpoint:            base + PathIntrospect,
+		RevocationEndpoint:               base + PathRevoke,
+		DeviceAuthorizationEndpoint:      base + PathDeviceAuthorization,
+		ScopesSupported:                  []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopePhone},
+		ResponseTypesSupported:           []string{responseTypeCode},
+		GrantTypesSupported:              grantTypesSupported,
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{h.issuer.Keys().Algorithm()},
+		TokenEndpointAuthMethodsSupported: []string{oauth.AuthMethodClientSecretBasic, oauth.AuthMethodClientSecretPost,
+			oauth.AuthMethodNone},
+		CodeChallengeMethodsSupported: []string{oauth.ChallengeMethodS256},
+		ClaimsSupported: []string{"sub", "iss", "aud", "exp", "iat", "nonce", "auth_time", "amr", "acr",
+			"preferred_username", "given_name", "family_name", "email", "phone_number"},
+		ACRValuesSupported: []string{token.ACRSingleFactor, token.ACRMultiFactor},
+	})
+}
+
+// userInfo returns claims about user released for granted scopes
+func userInfo(user *model.User, scope string) token.UserInfo {
+	var info token.UserInfo
+
+	if oauth.HasScope(scope, oauth.ScopeProfile) {
+		info.PreferredUsername = user.Username
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+	}
+
+	if oauth.HasScope(scope, oauth.ScopeEmail) {
+		info.Email = user.Email
+	}
+
+	if oauth.HasScope(scope, oauth.ScopePhone) {
+		info.PhoneNumber = user.Phone
+	}
+
+	return info
+}
+
+// idToken issues ID token for user of the grant
+func (h *OAuth) idToken(g *grant) (string, *oauth.Error) {
+	user, err := h.users.GetInfo(g.claims.Username)
+
+	switch {
+	case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+		return "", oauth.NewError(oauth.ErrorInvalidGrant, "user is not active")
+	case err != nil:
+		return "", serverError(err)
+	}
+
+	idToken, err := h.issuer.IssueID(&token.IDClaims{
+		Claims: token.Claims{
+			Subject:  user.ID,
+			Audience: token.Audience{g.claims.ClientID},
+			AuthTime: g.claims.AuthTime,
+			AMR:      g.claims.AMR,
+			ACR:      g.claims.ACR,
+		},
+		Nonce:    g.nonce,
+		UserInfo: userInfo(user, g.claims.Scope),
+	})
+	if err != nil {
+		return "", serverError(err)
+	}
+
+	return idToken, nil
+}
+
+// UserInfo returns claims about user authenticated with access token granted openid scope
+func (h *OAuth) UserInfo(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.ClaimsFromContext(r.Context())
+	if !ok {
+		InvalidToken(w)
+		return
+	}
+
+	if !oauth.HasScope(claims.Scope, oauth.ScopeOpenID) {
+		InsufficientScope(w, oauth.ScopeOpenID)
+		return
+	}
+
+	user, err := h.users.GetInfo(claims.Username)
+
+	switch {
+	case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+		InvalidToken(w)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, &UserInfoResponse{
+		Subject:  user.ID,
+		UserInfo: userInfo(user, claims.Scope),
+	})
+}
+
+// endSession ends browser session of user from id_token_hint, session of other user is kept
+func (h *OAuth) endSession(w http.ResponseWriter, r *http.Request, userID string) error {
+	raw, ok := middleware.SessionToken(r)
+	if !ok {
+		return nil
+	}
+
+	session, err := h.sessions.Touch(raw)
+
+	switch {
+	case err == model.ErrSessionInvalid:
+		return nil
+	case err != nil:
+		return err
+	case session.UserID != userID:
+		return nil
+	}
+
+	err = h.sessions.Delete(raw)
+	if err != nil {
+		return err
+	}
+
+	middleware.ClearSessionCookie(w)
+
+	return nil
+}
+
+// Logout is RP-initiated logout. Refresh tokens the client holds for user identified by id_token_hint are revoked
+// and user agent is redirected to registered post_logout_redirect_uri.
+func (h *OAuth) Logout(w http.ResponseWriter, r *http.Request) {
+	var (
+		clientID = r.FormValue("client_id")
+		hint     *token.IDClaims
+		err      error
+	)
+
+	if raw := r.FormValue("id_token_hint"); raw != "" {
+		hint, err = h.issuer.VerifyID(raw)
+		if err != nil || len(hint.Audience) != 1 || (clientID != "" && hint.Audience[0] != clientID) {
+			OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "id_token_hint is invalid"))
+			return
+		}
+
+		clientID = hint.Audience[0]
+	}
+
+	redirectURI := r.FormValue("post_logout_redirect_uri")
+
+	if redirectURI != "" {
+		client, oerr := findClient(h.clients, clientID)
+		if oerr != nil {
+			OAuthError(w, oerr)
+			return
+		}
+
+		if !client.AllowsPostLogoutRedirect(redirectURI) {
+			OAuthError(w, oauth.NewError(oauth.ErrorInvalidRequest, "post_logout_redirect_uri is not registered for the client"))
+			return
+		}
+	}
+
+	if hint != nil {
+		err = h.refresh.RevokeClient(hint.Subject, clientID)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		err = h.endSession(w, r, hint.Subject)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		logger.Component(logger.ComponentAuth).WithField("client", clientID).Info("User logged out by client")
+	}
+
+	if redirectURI != "" {
+		h.redirect(w, r, redirectURI, url.Values{"state": {r.FormValue("state")}})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	err = signedOutPage.Execute(w, nil)
+	if err != nil {
+		logger.Component(logger.ComponentHTTP).Errorf("Render signed out page error: %v", err)
+	}
+}
@@ -0,0 +1,673 @@
+package handlers_test
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/oauth"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The test suite below runs OpenID Connect flows of a relying party against the provider
+// served over HTTP. Storage is kept in memory, the client knows only discovery document.
+
+const (
+	rpClientID        = "rp"
+	rpRedirectURI     = "https://rp.example.com/callback"
+	rpPostLogoutURI   = "https://rp.example.com/signed-out"
+	rpUserPassword    = "password"
+	rpAuthorizedScope = "openid profile email"
+
+	pathFirstPartyRefresh = "/token/refresh"
+)
+
+var oidcUser = &model.User{
+	ID:        testUser.ID,
+	Username:  testUser.Username,
+	Email:     "i3odja@example.com",
+	FirstName: "Ivan",
+	LastName:  "Petrenko",
+	Phone:     "+380501234567",
+}
+
+type memStore struct {
+	mu       sync.Mutex
+	clients  map[string]*model.Client
+	codes    map[string]*model.AuthCode
+	consents map[string][]string
+	requests map[string]string
+	refresh  map[string]*model.RefreshToken
+	revoked  map[string]bool
+	seq      int
+}
+
+func (s *memStore) next(prefix string) string {
+	s.seq++
+	return prefix + "-" + strconv.Itoa(s.seq)
+}
+
+func (s *memStore) Get(id string) (*model.Client, error) {
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, model.ErrClientNotFound
+	}
+
+	return c, nil
+}
+
+type memCodes struct{ *memStore }
+
+func (s memCodes) Create(code *model.AuthCode) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw := s.next("code")
+	s.codes[raw] = code
+
+	return raw, nil
+}
+
+func (s memCodes) Consume(raw string) (*model.AuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.codes[raw]
+	if !ok {
+		return nil, model.ErrAuthCodeInvalid
+	}
+
+	delete(s.codes, raw)
+
+	return code, nil
+}
+
+type memConsents struct{ *memStore }
+
+func (s memConsents) Get(userID, clientID string) ([]string, error) {
+	return s.consents[userID+"/"+clientID], nil
+}
+
+func (s memConsents) Grant(userID, clientID string, scopes []string) error {
+	s.consents[userID+"/"+clientID] = scopes
+	return nil
+}
+
+func (s memConsents) CreateRequest(userID string, expiresAt time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.next("consent")
+	s.requests[id] = userID
+
+	return id, nil
+}
+
+func (s memConsents) ConsumeRequest(id, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.requests[id] != userID {
+		return model.ErrConsentRequestInvalid
+	}
+
+	delete(s.requests, id)
+
+	return nil
+}
+
+type memRefresh struct{ *memStore }
+
+func (s memRefresh) Create(userID, clientID, scope string, authTime time.Time, amr []string,
+	userAgent, ip string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw := s.next("refresh")
+	s.refresh[raw] = &model.RefreshToken{UserID: userID, Username: oidcUser.Username, ClientID: clientID, Scope: scope,
+		AuthTime: authTime, AMR: amr}
+
+	return raw, nil
+}
+
+func (s memRefresh) Rotate(raw, clientID, userAgent, ip string) (*model.RefreshToken, string, error) {
+	rt, ok := s.refresh[raw]
+	if !ok || rt.ClientID != clientID || s.revoked[raw] {
+		return nil, "", model.ErrRefreshTokenInvalid
+	}
+
+	delete(s.refresh, raw)
+
+	next, err := s.Create(rt.UserID, rt.ClientID, rt.Scope, rt.AuthTime, rt.AMR, userAgent, ip)
+
+	return rt, next, err
+}
+
+func (s memRefresh) Find(raw string) (*model.RefreshToken, error) {
+	rt, ok := s.refresh[raw]
+	if !ok || s.revoked[raw] {
+		return nil, model.ErrRefreshTokenInvalid
+	}
+
+	return rt, nil
+}
+
+func (s memRefresh) Revoke(raw string) error {
+	s.revoked[raw] = true
+	return nil
+}
+
+func (s memRefresh) RevokeClient(userID, clientID string) error {
+	for raw, rt := range s.refresh {
+		if rt.UserID == userID && rt.ClientID == clientID {
+			s.revoked[raw] = true
+		}
+	}
+
+	return nil
+}
+
+func (s memRefresh) RevokeUser(login string) error {
+	return nil
+}
+
+func (s memRefresh) List(login string) ([]*model.RefreshToken, error) {
+	return nil, nil
+}
+
+func (s memRefresh) RevokeFamily(login, id string) error {
+	return model.ErrRefreshTokenNotFound
+}
+
+type memRevoked struct{ *memStore }
+
+func (s memRevoked) IsRevoked(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.revoked[id], nil
+}
+
+type memUsers struct{}
+
+func (memUsers) GetInfo(login string) (*model.User, error) {
+	if login != oidcUser.Username {
+		return nil, model.ErrUserNotFound
+	}
+
+	return oidcUser, nil
+}
+
+func (memUsers) VerifyAndUpgrade(user *model.User, password string) (bool, error) {
+	return model.ComparePassword(password, user.Password)
+}
+
+// testBasic authenticates the only user of the suite
+func testBasic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != oidcUser.Username || password != rpUserPassword {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ctx := middleware.WithUser(r.Context(), oidcUser)
+		ctx = middleware.WithAuthContext(ctx, &middleware.AuthContext{Time: time.Now(), Methods: []string{token.AMRPassword}})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newTestProvider serves provider with routes of the service
+func newTestProvider(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(nil)
+
+	keys, err := token.NewKeyRing(token.KeyRingConfig{
+		Algorithm: token.AlgorithmEdDSA,
+		Rotation:  time.Hour,
+		Overlap:   time.Hour,
+	}, token.NewMemoryKeyStore())
+	require.NoError(t, err)
+
+	issuer, err := token.NewIssuer(keys, &token.Config{Issuer: srv.URL, TTL: 5 * time.Minute})
+	require.NoError(t, err)
+
+	store := &memStore{
+		clients: map[string]*model.Client{rpClientID: {
+			ID:                     rpClientID,
+			Name:                   "Relying Party",
+			RedirectURIs:           []string{rpRedirectURI},
+			PostLogoutRedirectURIs: []string{rpPostLogoutURI},
+			GrantTypes:             []string{model.GrantAuthorizationCode, model.GrantRefreshToken},
+			Scopes:                 []string{oauth.ScopeOpenID, oauth.ScopeProfile, oauth.ScopeEmail, oauth.ScopePhone},
+		}},
+		codes:    make(map[string]*model.AuthCode),
+		consents: make(map[string][]string),
+		requests: make(map[string]string),
+		refresh:  make(map[string]*model.RefreshToken),
+		revoked:  make(map[string]bool),
+	}
+
+	h := handlers.NewOAuth(issuer, nil, &handlers.OAuthRepositories{
+		Clients:  store,
+		Codes:    memCodes{store},
+		Consents: memConsents{store},
+		Refresh:  memRefresh{store},
+		Users:    memUsers{},
+	})
+	tokens := handlers.NewToken(issuer, memRefresh{store})
+
+	router := mux.NewRouter()
+	router.HandleFunc(handlers.PathDiscovery, h.Discovery).Methods(http.MethodGet)
+	router.HandleFunc(handlers.PathJWKS, tokens.JWKS).Methods(http.MethodGet)
+	router.HandleFunc(handlers.PathToken, h.Token).Methods(http.MethodPost)
+	router.HandleFunc(pathFirstPartyRefresh, tokens.Refresh).Methods(http.MethodPost)
+	router.HandleFunc(handlers.PathLogout, h.Logout).Methods(http.MethodGet, http.MethodPost)
+
+	userInfo := router.Path(handlers.PathUserInfo).Subrouter()
+	userInfo.Use(middleware.NewBearerAuthentication(issuer, memRevoked{store}, memUsers{}, store).OAuth().Middleware)
+	userInfo.Methods(http.MethodGet, http.MethodPost).HandlerFunc(h.UserInfo)
+
+	authorize := router.Path(handlers.PathAuthorize).Subrouter()
+	authorize.Use(testBasic)
+	authorize.Methods(http.MethodGet).HandlerFunc(h.Authorize)
+	authorize.Methods(http.MethodPost).HandlerFunc(h.Decide)
+
+	srv.Config.Handler = router
+
+	return srv
+}
+
+// relyingParty is a minimal OpenID Connect client
+type relyingParty struct {
+	t         *testing.T
+	http      *http.Client
+	discovery handlers.Discovery
+	keys      token.JWKSet
+}
+
+func newRelyingParty(t *testing.T, issuer string) *relyingParty {
+	rp := &relyingParty{
+		t: t,
+		http: &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}},
+	}
+
+	rp.getJSON(issuer+handlers.PathDiscovery, &rp.discovery)
+	rp.getJSON(rp.discovery.JWKSURI, &rp.keys)
+
+	return rp
+}
+
+func (rp *relyingParty) getJSON(target string, v interface{}) {
+	resp, err := rp.http.Get(target)
+	require.NoError(rp.t, err)
+	defer resp.Body.Close()
+
+	require.Equal(rp.t, http.StatusOK, resp.StatusCode, target)
+	require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(v))
+}
+
+func (rp *relyingParty) do(r *http.Request) *http.Response {
+	resp, err := rp.http.Do(r)
+	require.NoError(rp.t, err)
+
+	return resp
+}
+
+// authorize runs authorization request as the user and returns parameters of redirect back to client
+func (rp *relyingParty) authorize(params url.Values) url.Values {
+	r, err := http.NewRequest(http.MethodGet, rp.discovery.AuthorizationEndpoint+"?"+params.Encode(), nil)
+	require.NoError(rp.t, err)
+	r.SetBasicAuth(oidcUser.Username, rpUserPassword)
+
+	resp := rp.do(r)
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(rp.t, err)
+
+		match := consentTokenExpr.FindSubmatch(body)
+		require.Len(rp.t, match, 2)
+
+		form := url.Values{"consent_token": {string(match[1])}, "decision": {"allow"}}
+
+		r, err = http.NewRequest(http.MethodPost, rp.discovery.AuthorizationEndpoint, strings.NewReader(form.Encode()))
+		require.NoError(rp.t, err)
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.SetBasicAuth(oidcUser.Username, rpUserPassword)
+
+		resp = rp.do(r)
+		defer resp.Body.Close()
+	}
+
+	require.Equal(rp.t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(rp.t, err)
+
+	return location.Query()
+}
+
+func (rp *relyingParty) token(form url.Values) (*handlers.TokenResponse, *oauth.Error) {
+	form.Set("client_id", rpClientID)
+
+	resp, err := rp.http.PostForm(rp.discovery.TokenEndpoint, form)
+	require.NoError(rp.t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e oauth.Error
+		require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(&e))
+
+		return nil, &e
+	}
+
+	var tr handlers.TokenResponse
+	require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(&tr))
+
+	return &tr, nil
+}
+
+// login runs authorization code flow with PKCE and returns tokens
+func (rp *relyingParty) login(scope, nonce string) *handlers.TokenResponse {
+	verifier := strings.Repeat("k", 64)
+
+	q := rp.authorize(url.Values{
+		"response_type":         {"code"},
+		"client_id":             {rpClientID},
+		"redirect_uri":          {rpRedirectURI},
+		"scope":                 {scope},
+		"state":                 {"af0ifjsldkj"},
+		"nonce":                 {nonce},
+		"code_challenge":        {oauth.S256Challenge(verifier)},
+		"code_challenge_method": {oauth.ChallengeMethodS256},
+	})
+	require.Equal(rp.t, "af0ifjsldkj", q.Get("state"))
+	require.NotEmpty(rp.t, q.Get("code"), q.Get("error"))
+
+	tr, oerr := rp.token(url.Values{
+		"grant_type":    {model.GrantAuthorizationCode},
+		"code":          {q.Get("code")},
+		"redirect_uri":  {rpRedirectURI},
+		"code_verifier": {verifier},
+	})
+	require.Nil(rp.t, oerr)
+
+	return tr
+}
+
+// verifyIDToken checks ID token the way relying party does (OpenID Connect Core section 3.1.3.7)
+func (rp *relyingParty) verifyIDToken(raw, nonce string) map[string]interface{} {
+	parts := strings.Split(raw, ".")
+	require.Len(rp.t, parts, 3)
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+
+	decodeSegment(rp.t, parts[0], &header)
+	assert.Contains(rp.t, rp.discovery.IDTokenSigningAlgValuesSupported, header.Algorithm)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(rp.t, err)
+
+	var jwk *token.JWK
+
+	for i := range rp.keys.Keys {
+		if rp.keys.Keys[i].KeyID == header.KeyID {
+			jwk = &rp.keys.Keys[i]
+		}
+	}
+
+	require.NotNil(rp.t, jwk, "signing key is not published")
+	require.True(rp.t, verifyWithJWK(rp.t, jwk, []byte(parts[0]+"."+parts[1]), signature), "signature mismatch")
+
+	var claims map[string]interface{}
+
+	decodeSegment(rp.t, parts[1], &claims)
+
+	assert.Equal(rp.t, rp.discovery.Issuer, claims["iss"])
+	assert.Equal(rp.t, rpClientID, claims["aud"])
+	assert.Greater(rp.t, claims["exp"].(float64), float64(time.Now().Unix()))
+	assert.NotZero(rp.t, claims["iat"])
+
+	if nonce == "" {
+		assert.NotContains(rp.t, claims, "nonce")
+	} else {
+		assert.Equal(rp.t, nonce, claims["nonce"])
+	}
+
+	return claims
+}
+
+func decodeSegment(t *testing.T, segment string, v interface{}) {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, v))
+}
+
+func verifyWithJWK(t *testing.T, jwk *token.JWK, input, signature []byte) bool {
+	switch jwk.KeyType {
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		require.NoError(t, err)
+
+		return ed25519.Verify(ed25519.PublicKey(x), input, signature)
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		require.NoError(t, err)
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		require.NoError(t, err)
+
+		public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		digest := sha256.Sum256(input)
+
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	}
+
+	return false
+}
+
+func (rp *relyingParty) userInfo(accessToken string) (*http.Response, map[string]interface{}) {
+	r, err := http.NewRequest(http.MethodGet, rp.discovery.UserInfoEndpoint, nil)
+	require.NoError(rp.t, err)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp := rp.do(r)
+	defer resp.Body.Close()
+
+	var claims map[string]interface{}
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(rp.t, json.NewDecoder(resp.Body).Decode(&claims))
+	}
+
+	return resp, claims
+}
+
+func TestOIDCConformance(t *testing.T) {
+	provider := newTestProvider(t)
+	defer provider.Close()
+
+	rp := newRelyingParty(t, provider.URL)
+
+	var tokens *handlers.TokenResponse
+
+	t.Run("Discovery", func(t *testing.T) {
+		d := rp.discovery
+
+		assert.Equal(t, provider.URL, d.Issuer)
+		assert.Equal(t, provider.URL+"/oauth/authorize", d.AuthorizationEndpoint)
+		assert.Equal(t, provider.URL+"/oauth/token", d.TokenEndpoint)
+		assert.Equal(t, provider.URL+"/userinfo", d.UserInfoEndpoint)
+		assert.Equal(t, provider.URL+"/oauth/logout", d.EndSessionEndpoint)
+		assert.Contains(t, d.ScopesSupported, oauth.ScopeOpenID)
+		assert.Contains(t, d.ResponseTypesSupported, "code")
+		assert.Contains(t, d.SubjectTypesSupported, "public")
+		assert.Equal(t, []string{token.AlgorithmEdDSA}, d.IDTokenSigningAlgValuesSupported)
+		assert.Contains(t, d.ACRValuesSupported, token.ACRMultiFactor)
+		assert.NotEmpty(t, rp.keys.Keys)
+	})
+
+	t.Run("Authorization code flow", func(t *testing.T) {
+		tokens = rp.login(rpAuthorizedScope, "n-0S6_WzA2Mj")
+		require.NotEmpty(t, tokens.IDToken)
+		assert.Equal(t, rpAuthorizedScope, tokens.Scope)
+
+		claims := rp.verifyIDToken(tokens.IDToken, "n-0S6_WzA2Mj")
+		assert.Equal(t, oidcUser.ID, claims["sub"])
+		assert.Equal(t, oidcUser.Email, claims["email"])
+		assert.Equal(t, oidcUser.FirstName, claims["given_name"])
+		assert.Equal(t, oidcUser.LastName, claims["family_name"])
+		assert.Equal(t, oidcUser.Username, claims["preferred_username"])
+		// phone scope was not requested
+		assert.NotContains(t, claims, "phone_number")
+		// User authenticated with password
+		assert.Contains(t, claims, "auth_time")
+		assert.Equal(t, []interface{}{token.AMRPassword}, claims["amr"])
+		assert.Equal(t, token.ACRSingleFactor, claims["acr"])
+	})
+
+	t.Run("UserInfo", func(t *testing.T) {
+		resp, claims := rp.userInfo(tokens.AccessToken)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Equal(t, oidcUser.ID, claims["sub"])
+		assert.Equal(t, oidcUser.Email, claims["email"])
+		assert.NotContains(t, claims, "phone_number")
+
+		resp, _ = rp.userInfo("invalid")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	t.Run("Consent is remembered", func(t *testing.T) {
+		q := rp.authorize(url.Values{
+			"response_type":         {"code"},
+			"client_id":             {rpClientID},
+			"redirect_uri":          {rpRedirectURI},
+			"scope":                 {"openid email"},
+			"prompt":                {"none"},
+			"code_challenge":        {oauth.S256Challenge(strings.Repeat("k", 64))},
+			"code_challenge_method": {oauth.ChallengeMethodS256},
+		})
+		assert.NotEmpty(t, q.Get("code"))
+
+		q = rp.authorize(url.Values{
+			"response_type":         {"code"},
+			"client_id":             {rpClientID},
+			"redirect_uri":          {rpRedirectURI},
+			"scope":                 {"openid phone"},
+			"prompt":                {"none"},
+			"code_challenge":        {oauth.S256Challenge(strings.Repeat("k", 64))},
+			"code_challenge_method": {oauth.ChallengeMethodS256},
+		})
+		assert.Equal(t, oauth.ErrorConsentRequired, q.Get("error"))
+	})
+
+	t.Run("Phone scope", func(t *testing.T) {
+		tr := rp.login("openid phone", "n-1")
+
+		claims := rp.verifyIDToken(tr.IDToken, "n-1")
+		assert.Equal(t, oidcUser.Phone, claims["phone_number"])
+		assert.NotContains(t, claims, "email")
+	})
+
+	t.Run("Refresh token is not rotated as first-party one", func(t *testing.T) {
+		form := url.Values{"refresh_token": {tokens.RefreshToken}, "client_id": {rpClientID}}
+
+		resp, err := rp.http.PostForm(strings.TrimSuffix(rp.discovery.Issuer, "/")+pathFirstPartyRefresh, form)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		authTime := rp.verifyIDToken(tokens.IDToken, "n-0S6_WzA2Mj")["auth_time"]
+
+		tr, oerr := rp.token(url.Values{
+			"grant_type":    {model.GrantRefreshToken},
+			"refresh_token": {tokens.RefreshToken},
+		})
+		require.Nil(t, oerr)
+
+		claims := rp.verifyIDToken(tr.IDToken, "")
+		assert.Equal(t, oidcUser.ID, claims["sub"])
+		// Refreshed ID token keeps time of the original authentication
+		assert.Equal(t, authTime, claims["auth_time"])
+		assert.Equal(t, token.ACRSingleFactor, claims["acr"])
+
+		tokens = tr
+
+		// Access token narrowed down to profile can not be used for user info
+		tr, oerr = rp.token(url.Values{
+			"grant_type":    {model.GrantRefreshToken},
+			"refresh_token": {tokens.RefreshToken},
+			"scope":         {"profile"},
+		})
+		require.Nil(t, oerr)
+		assert.Empty(t, tr.IDToken)
+
+		tokens.RefreshToken = tr.RefreshToken
+
+		resp, _ := rp.userInfo(tr.AccessToken)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Contains(t, resp.Header.Get("WWW-Authenticate"), `error="insufficient_scope"`)
+	})
+
+	t.Run("RP-initiated logout", func(t *testing.T) {
+		params := url.Values{
+			"id_token_hint":            {tokens.IDToken},
+			"post_logout_redirect_uri": {"https://evil.example.com/"},
+		}
+
+		resp := rp.do(mustRequest(t, rp.discovery.EndSessionEndpoint+"?"+params.Encode()))
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		params.Set("post_logout_redirect_uri", rpPostLogoutURI)
+		params.Set("state", "bye")
+
+		resp = rp.do(mustRequest(t, rp.discovery.EndSessionEndpoint+"?"+params.Encode()))
+		resp.Body.Close()
+		require.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, rpPostLogoutURI+"?state=bye", resp.Header.Get("Location"))
+
+		_, oerr := rp.token(url.Values{
+			"grant_type":    {model.GrantRefreshToken},
+			"refresh_token": {tokens.RefreshToken},
+		})
+		require.NotNil(t, oerr)
+		assert.Equal(t, oauth.ErrorInvalidGrant, oerr.Code)
+	})
+}
+
+func mustRequest(t *testing.T, target string) *http.Request {
+	r, err := http.NewRequest(http.MethodGet, target, nil)
+	require.NoError(t, err)
+
+	return r
+}
@@ -0,0 +1,694 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	"github.com/gorilla/mux"
+)
+
+// Paths of hosted login and logout pages
+const (
+	PathLogin       = "/login"
+	PathLoginVerify = "/login/verify"
+	// PathLoginSendCode sends one-time code of pending session by email or SMS
+	PathLoginSendCode = "/login/code"
+	PathSignOut       = "/logout"
+)
+
+const (
+	// loginCSRFCookie carries CSRF token of login form, which is posted before session exists
+	loginCSRFCookie = "um_login_csrf"
+	// loginCSRFMaxAge is how long login form can be posted after it was shown, in seconds
+	loginCSRFMaxAge = 3600
+
+	messageInvalidCredentials = "Invalid username or password."
+	messageFormExpired        = "The form has expired, please try again."
+	messageInvalidCode        = "Invalid authentication code."
+	messageFactorLocked       = "Too many invalid codes, please try again later."
+	messageCodeSent           = "A code was sent to %s."
+	messageCodeTooSoon        = "A code was sent recently, please wait before requesting another one."
+	messageNoCodeChannel      = "Codes by email or SMS are not enabled for your account."
+	messageSignInAgain        = "Please sign in again to continue."
+	messageLoginThrottled     = "Too many failed attempts, please try again later."
+	messageSessionNotFound    = "Session not found"
+)
+
+// Types of sessions
+const (
+	SessionTypeBrowser      = "browser"
+	SessionTypeRefreshToken = "refresh_token"
+)
+
+// SessionInfo describes browser session or refresh token of user, where and when user signed in
+type SessionInfo struct {
+	ID string `json:"id"`
+	// Type is SessionTypeBrowser or SessionTypeRefreshToken, refresh token is identified by its family
+	Type string `json:"type"`
+	// ClientID is the client refresh token was issued to
+	ClientID   string    `json:"client_id,omitempty"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	// Current marks session the request was made with
+	Current bool `json:"current,omitempty"`
+}
+
+// loginPage asks for credentials, or shows signed in user with logout button
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in</title></head>
+<body>
+{{if .Username}}
+<h1>Signed in as {{.Username}}</h1>
+<form method="post" action="{{.LogoutAction}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<button type="submit">Sign out</button>
+</form>
+{{else if .SecondFactor}}
+<h1>Two-factor authentication</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}">
+<input type="text" name="code" placeholder="Authentication or recovery code" autocomplete="one-time-code" autofocus required>
+<button type="submit">Verify</button>
+</form>
+<form method="post" action="{{.SendCodeAction}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}">
+<button type="submit">Send code by email or SMS</button>
+</form>
+{{template "passkey" "Use a security key"}}
+{{else}}
+<h1>Sign in</h1>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
+<input type="hidden" name="return_to" value="{{.ReturnTo}}">
+<input type="text" name="username" placeholder="Username" autocomplete="username" autofocus required>
+<input type="password" name="password" placeholder="Password" autocomplete="current-password" required>
+<button type="submit">Sign in</button>
+</form>
+{{template "passkey" "Sign in with a passkey"}}
+{{end}}
+</body>
+</html>
+{{define "passkey"}}
+<p id="passkey-message" hidden>Passkey sign in failed.</p>
+<button type="button" id="passkey" hidden>{{.}}</button>
+<script>
+(function () {
+  var form = document.forms[0], button = document.getElementById("passkey");
+  if (!window.PublicKeyCredential) return;
+  button.hidden = false;
+  function decode(s) {
+    return Uint8Array.from(atob(s.replace(/-/g, "+").replace(/_/g, "/")), function (c) { return c.charCodeAt(0); });
+  }
+  function encode(b) {
+    return btoa(String.fromCharCode.apply(null, new Uint8Array(b))).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+  function post(url, body) {
+    return fetch(url, {method: "POST", credentials: "same-origin", body: JSON.stringify(body),
+      headers: {"Content-Type": "application/json", "X-CSRF-Token": form.csrf_token.value}
+    }).then(function (r) { if (!r.ok) throw new Error(r.status); return r.json(); });
+  }
+  button.onclick = function () {
+    post("/login/webauthn/begin", {username: form.username ? form.username.value : ""}).then(function (o) {
+      o.challenge = decode(o.challenge);
+      o.allowCredentials.forEach(function (c) { c.id = decode(c.id); });
+      return navigator.credentials.get({publicKey: o});
+    }).then(function (c) {
+      var r = c.response;
+      return post("/login/webauthn/finish?return_to=" + encodeURIComponent(form.return_to.value), {
+        id: c.id, rawId: encode(c.rawId), type: c.type, response: {
+          clientDataJSON: encode(r.clientDataJSON), authenticatorData: encode(r.authenticatorData),
+          signature: encode(r.signature), userHandle: r.userHandle ? encode(r.userHandle) : undefined
+        }
+      });
+    }).then(function (r) { location.assign(r.redirect); }).catch(function () {
+      document.getElementById("passkey-message").hidden = false;
+    });
+  };
+})();
+</script>
+{{end}}
+`))
+
+// Session handles hosted login and logout pages, which start and end browser sessions,
+// and lets users see and end their sessions and refresh tokens
+type Session struct {
+	users    Users
+	sessions Sessions
+	refresh  RefreshTokens
+	factors  SecondFactors
+	attempts LoginAttempts
+	codes    CodeSender
+	// secure restricts cookies to HTTPS
+	secure bool
+}
+
+func NewSession(users Users, sessions Sessions, refresh RefreshTokens, factors SecondFactors, attempts LoginAttempts,
+	codes CodeSender, secureCookies bool) *Session {
+	return &Session{users: users, sessions: sessions, refresh: refresh, factors: factors, attempts: attempts,
+		codes: codes, secure: secureCookies}
+}
+
+// LoginPage shows login form. Signed in user is sent to return_to at once or shown logout button,
+// unless prompt=login asks to authenticate again before sensitive operation.
+func (h *Session) LoginPage(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.URL.Query().Get(middleware.ReturnToParam)
+
+	if raw, ok := middleware.SessionToken(r); ok {
+		session, err := h.sessions.Touch(raw)
+
+		switch {
+		case err == nil && r.URL.Query().Get("prompt") == promptLogin:
+			h.renderLoginForm(w, r, http.StatusOK, returnTo, messageSignInAgain)
+			return
+		case err == nil && returnTo != "":
+			http.Redirect(w, r, safeReturnTo(returnTo), http.StatusFound)
+			return
+		case err == nil:
+			renderLoginPage(w, http.StatusOK, map[string]interface{}{
+				"Username":     session.Username,
+				"CSRFToken":    session.CSRFToken,
+				"LogoutAction": PathSignOut,
+			})
+			return
+		case err != model.ErrSessionInvalid:
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	h.renderLoginForm(w, r, http.StatusOK, returnTo, "")
+}
+
+// Login checks credentials posted from login form, starts session and sends browser to return_to
+func (h *Session) Login(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.PostFormValue(middleware.ReturnToParam)
+
+	// Login form is protected by double submit cookie, so other sites can not sign user in to their account
+	c, err := r.Cookie(loginCSRFCookie)
+	if err != nil || !middleware.ValidCSRF(r, c.Value) {
+		h.renderLoginForm(w, r, http.StatusForbidden, returnTo, messageFormExpired)
+		return
+	}
+
+	username := r.PostFormValue("username")
+	ip := ClientIP(r)
+
+	// Locked or delayed login is refused before password is checked, so it can not be guessed meanwhile
+	retryAfter, err := h.attempts.Check(username, ip)
+
+	switch {
+	case err == model.ErrLoginLocked || err == model.ErrLoginThrottled:
+		logger.Component(logger.ComponentAuth).WithField("user", username).Info("Login throttled")
+		SetRetryAfter(w, retryAfter)
+		h.renderLoginForm(w, r, http.StatusTooManyRequests, returnTo, messageLoginThrottled)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	user, err := h.users.GetInfo(username)
+
+	switch {
+	case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+		h.loginFailed(w, r, username, ip, returnTo)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	matched, err := h.users.VerifyAndUpgrade(user, r.PostFormValue("password"))
+	if err != nil {
+		HashingError(w, err)
+		return
+	}
+
+	if !matched {
+		h.loginFailed(w, r, username, ip, returnTo)
+		return
+	}
+
+	err = h.attempts.Reset(username)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	pending, err := h.factors.Enabled(user.ID)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	// Session of user with two-factor authentication is not signed in until code is verified
+	raw, session, err := h.sessions.Create(user, r.UserAgent(), ClientIP(r), token.AMRPassword, pending)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	// Signing in again replaces session browser had
+	if old, ok := middleware.SessionToken(r); ok {
+		err = h.sessions.Delete(old)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+	}
+
+	middleware.SetSessionCookie(w, raw, session.ExpiresAt, h.secure)
+	h.setLoginCSRF(w, "", -1)
+
+	if pending {
+		renderSecondFactorForm(w, http.StatusOK, session, returnTo, "")
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("Session started")
+
+	http.Redirect(w, r, safeReturnTo(returnTo), http.StatusSeeOther)
+}
+
+// loginFailed counts failed login of user from ip and shows login form again
+func (h *Session) loginFailed(w http.ResponseWriter, r *http.Request, username, ip, returnTo string) {
+	logger.Component(logger.ComponentAuth).WithField("user", username).Info("Login failed")
+
+	err := h.attempts.Fail(username, ip)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	h.renderLoginForm(w, r, http.StatusUnauthorized, returnTo, messageInvalidCredentials)
+}
+
+// LoginVerify checks second factor code of pending session and signs the session in
+func (h *Session) LoginVerify(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.PostFormValue(middleware.ReturnToParam)
+
+	raw, session, ok := h.pendingSession(w, r, returnTo)
+	if !ok {
+		return
+	}
+
+	err := h.factors.Verify(session.UserID, r.PostFormValue("code"))
+
+	switch {
+	// User with WebAuthn credentials only has no codes, the form is shown for the security key button
+	case err == model.ErrTwoFactorCodeInvalid || err == model.ErrTwoFactorNotEnrolled:
+		logger.Component(logger.ComponentAuth).WithField("user", session.Username).Info("Second factor failed")
+		renderSecondFactorForm(w, http.StatusUnauthorized, session, returnTo, messageInvalidCode)
+		return
+	case err == model.ErrTwoFactorLocked:
+		renderSecondFactorForm(w, http.StatusUnauthorized, session, returnTo, messageFactorLocked)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	err = h.sessions.Complete(raw, token.AMROTP)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", session.Username).Info("Session started")
+
+	http.Redirect(w, r, safeReturnTo(returnTo), http.StatusSeeOther)
+}
+
+// SendCode sends one-time code of pending session by email or SMS and shows second factor form again
+func (h *Session) SendCode(w http.ResponseWriter, r *http.Request) {
+	returnTo := r.PostFormValue(middleware.ReturnToParam)
+
+	_, session, ok := h.pendingSession(w, r, returnTo)
+	if !ok {
+		return
+	}
+
+	d, err := h.factors.IssueOTP(session.UserID)
+
+	switch {
+	case err == model.ErrTwoFactorNotEnrolled:
+		renderSecondFactorForm(w, http.StatusBadRequest, session, returnTo, messageNoCodeChannel)
+		return
+	case err == model.ErrOTPTooSoon:
+		renderSecondFactorForm(w, http.StatusTooManyRequests, session, returnTo, messageCodeTooSoon)
+		return
+	case err == model.ErrTwoFactorLocked:
+		renderSecondFactorForm(w, http.StatusUnauthorized, session, returnTo, messageFactorLocked)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	err = h.codes.Send(r.Context(), d.Channel, d.Destination, d.Code)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", session.Username).Info("One-time code sent")
+
+	renderSecondFactorForm(w, http.StatusOK, session, returnTo,
+		fmt.Sprintf(messageCodeSent, maskDestination(d.Destination)))
+}
+
+// Logout ends browser session. Form must carry CSRF token of the session, so other sites can not sign user out.
+func (h *Session) Logout(w http.ResponseWriter, r *http.Request) {
+	if raw, ok := middleware.SessionToken(r); ok {
+		session, err := h.sessions.Touch(raw)
+
+		switch {
+		case err == model.ErrSessionInvalid:
+		case err != nil:
+			InternalServerError(w, err)
+			return
+		case !middleware.ValidCSRF(r, session.CSRFToken):
+			Forbidden(w)
+			return
+		default:
+			err = h.sessions.Delete(raw)
+			if err != nil {
+				InternalServerError(w, err)
+				return
+			}
+
+			logger.Component(logger.ComponentAuth).WithField("user", session.Username).Info("Session ended")
+		}
+	}
+
+	middleware.ClearSessionCookie(w)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	err := signedOutPage.Execute(w, nil)
+	if err != nil {
+		logger.Component(logger.ComponentHTTP).Errorf("Render signed out page error: %v", err)
+	}
+}
+
+// ListOwn returns active sessions and refresh tokens of authenticated user
+func (h *Session) ListOwn(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	h.list(w, r, user.Username)
+}
+
+// ListUser returns active sessions and refresh tokens of user with login from path
+func (h *Session) ListUser(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, mux.Vars(r)["login"])
+}
+
+// DeleteOwn ends all sessions of authenticated user except the one the request was made with,
+// and revokes all refresh tokens of the user
+func (h *Session) DeleteOwn(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	h.deleteAll(w, r, user.Username)
+}
+
+// DeleteUser ends all sessions of user with login from path, except the one the request was made with,
+// and revokes all refresh tokens of the user
+func (h *Session) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.deleteAll(w, r, mux.Vars(r)["login"])
+}
+
+// Unlock forgets failed logins of user with login from path, so user locked after them can log in at once
+func (h *Session) Unlock(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+
+	err := h.attempts.Reset(login)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", login).Info("User unlocked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteOwnByID ends session or revokes refresh token of authenticated user with id from path
+func (h *Session) DeleteOwnByID(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	h.deleteByID(w, r, user.Username)
+}
+
+// DeleteUserByID ends session or revokes refresh token with id of user with login from path
+func (h *Session) DeleteUserByID(w http.ResponseWriter, r *http.Request) {
+	h.deleteByID(w, r, mux.Vars(r)["login"])
+}
+
+func (h *Session) list(w http.ResponseWriter, r *http.Request, login string) {
+	sessions, err := h.sessions.List(login)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	tokens, err := h.refresh.List(login)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	current := currentSessionID(r)
+
+	resp := make([]*SessionInfo, 0, len(sessions)+len(tokens))
+	for _, s := range sessions {
+		resp = append(resp, &SessionInfo{
+			ID:         s.ID,
+			Type:       SessionTypeBrowser,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    s.ID == current,
+		})
+	}
+
+	for _, t := range tokens {
+		resp = append(resp, &SessionInfo{
+			ID:         t.FamilyID,
+			Type:       SessionTypeRefreshToken,
+			ClientID:   t.ClientID,
+			UserAgent:  t.UserAgent,
+			IPAddress:  t.IPAddress,
+			CreatedAt:  t.CreatedAt,
+			LastSeenAt: t.LastSeenAt,
+			ExpiresAt:  t.ExpiresAt,
+		})
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, resp)
+}
+
+func (h *Session) deleteAll(w http.ResponseWriter, r *http.Request, login string) {
+	err := h.sessions.DeleteOthers(login, currentSessionID(r))
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	err = h.refresh.RevokeUser(login)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", login).Info("Sessions ended")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Session) deleteByID(w http.ResponseWriter, r *http.Request, login string) {
+	id := mux.Vars(r)["id"]
+
+	err := h.sessions.DeleteByID(login, id)
+	if err == model.ErrSessionNotFound {
+		// Refresh tokens are listed with id of their family
+		err = h.refresh.RevokeFamily(login, id)
+	}
+
+	switch {
+	case err == model.ErrSessionNotFound || err == model.ErrRefreshTokenNotFound:
+		NotFound(w, messageSessionNotFound)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", login).Info("Session ended")
+
+	if id == currentSessionID(r) {
+		middleware.ClearSessionCookie(w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pendingSession returns session of request waiting for second factor, form must carry its CSRF token.
+// It responds to request and returns false when there is no such session.
+func (h *Session) pendingSession(w http.ResponseWriter, r *http.Request, returnTo string) (string, *model.Session,
+	bool) {
+	raw, ok := middleware.SessionToken(r)
+	if !ok {
+		h.renderLoginForm(w, r, http.StatusUnauthorized, returnTo, messageFormExpired)
+		return "", nil, false
+	}
+
+	session, err := h.sessions.TouchPending(raw)
+
+	switch {
+	case err == model.ErrSessionInvalid:
+		h.renderLoginForm(w, r, http.StatusUnauthorized, returnTo, messageFormExpired)
+		return "", nil, false
+	case err != nil:
+		InternalServerError(w, err)
+		return "", nil, false
+	case !middleware.ValidCSRF(r, session.CSRFToken):
+		Forbidden(w)
+		return "", nil, false
+	}
+
+	return raw, session, true
+}
+
+// renderLoginForm shows login form with a new CSRF token
+func (h *Session) renderLoginForm(w http.ResponseWriter, r *http.Request, status int, returnTo, message string) {
+	csrf, _, err := token.NewOpaque()
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	h.setLoginCSRF(w, csrf, loginCSRFMaxAge)
+
+	renderLoginPage(w, status, map[string]interface{}{
+		"Action":    r.URL.Path,
+		"CSRFToken": csrf,
+		"ReturnTo":  returnTo,
+		"Message":   message,
+	})
+}
+
+func (h *Session) setLoginCSRF(w http.ResponseWriter, value string, maxAge int) {
+	setLoginCSRF(w, value, maxAge, h.secure)
+}
+
+// setLoginCSRF sends CSRF token of login form, it is sent back with forms and requests of login pages
+func setLoginCSRF(w http.ResponseWriter, value string, maxAge int, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCSRFCookie,
+		Value:    value,
+		Path:     PathLogin,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// renderSecondFactorForm asks for code of pending session, form is protected by CSRF token of the session
+func renderSecondFactorForm(w http.ResponseWriter, status int, session *model.Session, returnTo, message string) {
+	renderLoginPage(w, status, map[string]interface{}{
+		"SecondFactor":   true,
+		"Action":         PathLoginVerify,
+		"SendCodeAction": PathLoginSendCode,
+		"CSRFToken":      session.CSRFToken,
+		"ReturnTo":       returnTo,
+		"Message":        message,
+	})
+}
+
+func renderLoginPage(w http.ResponseWriter, status int, page map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Login page must not be framed by other sites, it could be used to capture credentials
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+
+	err := loginPage.Execute(w, page)
+	if err != nil {
+		logger.Component(logger.ComponentHTTP).Errorf("Render login page error: %v", err)
+	}
+}
+
+// safeReturnTo allows only local paths as return_to, so login page can not redirect to other sites.
+// Control characters and backslashes are rejected, browsers drop or treat them as slashes
+// and would read /\t/evil.com as //evil.com.
+func safeReturnTo(returnTo string) string {
+	if strings.IndexFunc(returnTo, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '\\' }) >= 0 {
+		return PathLogin
+	}
+
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") ||
+		strings.HasPrefix(u.Path, "//") {
+		return PathLogin
+	}
+
+	return returnTo
+}
+
+// csrfToken returns CSRF token of browser session the request was authenticated with, forms of pages
+// shown within the session must send it back
+func csrfToken(r *http.Request) string {
+	session, ok := middleware.SessionFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+
+	return session.CSRFToken
+}
+
+// currentSessionID returns id of browser session the request was authenticated with
+func currentSessionID(r *http.Request) string {
+	session, ok := middleware.SessionFromContext(r.Context())
+	if !ok {
+		return ""
+	}
+
+	return session.ID
+}
@@ -0,0 +1,613 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var csrfPattern = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+func testSession() *model.Session {
+	return &model.Session{
+		ID:        "0f8b5a7e-4a55-4c5e-9d5e-8f0c1b2a3d4e",
+		UserID:    testUser.ID,
+		Username:  testUser.Username,
+		CSRFToken: "session-csrf",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+}
+
+// loginForm returns CSRF token of login form and cookie it is bound to
+func loginForm(t *testing.T, h *handlers.Session) (string, *http.Cookie) {
+	w := httptest.NewRecorder()
+	h.LoginPage(w, httptest.NewRequest(http.MethodGet, handlers.PathLogin+"?return_to=%2Fdevice", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Contains(t, w.Body.String(), `value="/device"`)
+	assert.Contains(t, w.Body.String(), `id="passkey"`)
+
+	m := csrfPattern.FindStringSubmatch(w.Body.String())
+	require.Len(t, m, 2)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+
+	return m[1], cookies[0]
+}
+
+func postLogin(h *handlers.Session, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	r := formRequest(http.MethodPost, handlers.PathLogin, form)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	h.Login(w, r)
+
+	return w
+}
+
+// loginUser is testUser as found by login name
+var loginUser = &model.User{ID: testUser.ID, Username: testUser.Username}
+
+func TestSessionLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo(testUser.Username).Return(loginUser, nil).Times(2)
+	users.EXPECT().VerifyAndUpgrade(loginUser, "wrong").Return(false, nil)
+	users.EXPECT().VerifyAndUpgrade(loginUser, "1q2w3e4r").Return(true, nil)
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any(), "pwd", false).Return("raw", testSession(), nil)
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	factors.EXPECT().Enabled(testUser.ID).Return(false, nil)
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Check(testUser.Username, "192.0.2.1").Return(time.Duration(0), nil).Times(2)
+	attempts.EXPECT().Fail(testUser.Username, "192.0.2.1").Return(nil)
+	attempts.EXPECT().Reset(testUser.Username).Return(nil)
+
+	h := handlers.NewSession(users, sessions, nil, factors, attempts, nil, true)
+	csrf, cookie := loginForm(t, h)
+
+	form := url.Values{"csrf_token": {csrf}, "return_to": {"/device"}, "username": {testUser.Username},
+		"password": {"wrong"}}
+
+	w := postLogin(h, cookie, form)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid username or password")
+
+	form.Set("password", "1q2w3e4r")
+
+	w = postLogin(h, cookie, form)
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	assert.Equal(t, "/device", w.Header().Get("Location"))
+
+	var session *http.Cookie
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == middleware.SessionCookie {
+			session = c
+		}
+	}
+
+	require.NotNil(t, session)
+	assert.Equal(t, "raw", session.Value)
+	assert.True(t, session.HttpOnly)
+	assert.True(t, session.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, session.SameSite)
+}
+
+func TestSessionLoginHashingBusy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Password which could not be checked is neither accepted nor counted as failed login
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo(testUser.Username).Return(loginUser, nil)
+	users.EXPECT().VerifyAndUpgrade(loginUser, "1q2w3e4r").Return(false, model.ErrHashingBusy)
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Check(testUser.Username, "192.0.2.1").Return(time.Duration(0), nil)
+
+	h := handlers.NewSession(users, mock.NewMockSessions(ctrl), nil, mock.NewMockSecondFactors(ctrl), attempts, nil, true)
+	csrf, cookie := loginForm(t, h)
+
+	w := postLogin(h, cookie, url.Values{"csrf_token": {csrf}, "username": {testUser.Username},
+		"password": {"1q2w3e4r"}})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestSessionLoginReplacesSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo(testUser.Username).Return(loginUser, nil)
+	users.EXPECT().VerifyAndUpgrade(loginUser, "1q2w3e4r").Return(true, nil)
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any(), "pwd", false).Return("raw", testSession(), nil)
+	sessions.EXPECT().Delete("old").Return(nil)
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	factors.EXPECT().Enabled(testUser.ID).Return(false, nil)
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Check(testUser.Username, gomock.Any()).Return(time.Duration(0), nil)
+	attempts.EXPECT().Reset(testUser.Username).Return(nil)
+
+	h := handlers.NewSession(users, sessions, nil, factors, attempts, nil, true)
+	csrf, cookie := loginForm(t, h)
+
+	r := formRequest(http.MethodPost, handlers.PathLogin, url.Values{"csrf_token": {csrf}, "username": {testUser.Username},
+		"password": {"1q2w3e4r"}})
+	r.AddCookie(cookie)
+	r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "old"})
+
+	w := httptest.NewRecorder()
+	h.Login(w, r)
+	assert.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+}
+
+func TestSessionLoginSecondFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo(testUser.Username).Return(loginUser, nil)
+	users.EXPECT().VerifyAndUpgrade(loginUser, "1q2w3e4r").Return(true, nil)
+
+	pending := testSession()
+	pending.Pending = true
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Create(gomock.Any(), gomock.Any(), gomock.Any(), "pwd", true).Return("raw", pending, nil)
+	sessions.EXPECT().TouchPending("raw").Return(pending, nil).Times(3)
+	sessions.EXPECT().Complete("raw", "otp").Return(nil)
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	factors.EXPECT().Enabled(testUser.ID).Return(true, nil)
+	factors.EXPECT().Verify(testUser.ID, "000000").Return(model.ErrTwoFactorCodeInvalid)
+	factors.EXPECT().Verify(testUser.ID, "123456").Return(nil)
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Check(testUser.Username, gomock.Any()).Return(time.Duration(0), nil)
+	attempts.EXPECT().Reset(testUser.Username).Return(nil)
+
+	h := handlers.NewSession(users, sessions, nil, factors, attempts, nil, false)
+	csrf, cookie := loginForm(t, h)
+
+	w := postLogin(h, cookie, url.Values{"csrf_token": {csrf}, "return_to": {"/device"},
+		"username": {testUser.Username}, "password": {"1q2w3e4r"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `action="/login/verify"`)
+	assert.Contains(t, w.Body.String(), `value="session-csrf"`)
+
+	verify := func(form url.Values) *httptest.ResponseRecorder {
+		r := formRequest(http.MethodPost, handlers.PathLoginVerify, form)
+		r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+
+		w := httptest.NewRecorder()
+		h.LoginVerify(w, r)
+
+		return w
+	}
+
+	w = verify(url.Values{"csrf_token": {"forged"}, "code": {"123456"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = verify(url.Values{"csrf_token": {"session-csrf"}, "return_to": {"/device"}, "code": {"000000"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid authentication code")
+
+	w = verify(url.Values{"csrf_token": {"session-csrf"}, "return_to": {"/device"}, "code": {"123456"}})
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/device", w.Header().Get("Location"))
+}
+
+func TestSessionSendCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	pending := testSession()
+	pending.Pending = true
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().TouchPending("raw").Return(pending, nil).Times(3)
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	gomock.InOrder(
+		factors.EXPECT().IssueOTP(testUser.ID).
+			Return(&model.OTPDelivery{Channel: "sms", Destination: "+380501234567", Code: "123456"}, nil),
+		factors.EXPECT().IssueOTP(testUser.ID).Return(nil, model.ErrOTPTooSoon),
+		factors.EXPECT().IssueOTP(testUser.ID).Return(nil, model.ErrTwoFactorNotEnrolled),
+	)
+
+	codes := mock.NewMockCodeSender(ctrl)
+	codes.EXPECT().Send(gomock.Any(), "sms", "+380501234567", "123456").Return(nil)
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), sessions, nil, factors, nil, codes, false)
+
+	send := func() *httptest.ResponseRecorder {
+		r := formRequest(http.MethodPost, handlers.PathLoginSendCode, url.Values{"csrf_token": {"session-csrf"},
+			"return_to": {"/device"}})
+		r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+
+		w := httptest.NewRecorder()
+		h.SendCode(w, r)
+
+		return w
+	}
+
+	w := send()
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "A code was sent to *********4567.")
+	assert.Contains(t, w.Body.String(), `action="/login/verify"`)
+
+	w = send()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	w = send()
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not enabled for your account")
+}
+
+func TestSessionLoginRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo("disabled").Return(nil, model.ErrUserDisabled)
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Check("disabled", gomock.Any()).Return(time.Duration(0), nil)
+	attempts.EXPECT().Fail("disabled", gomock.Any()).Return(nil)
+
+	h := handlers.NewSession(users, mock.NewMockSessions(ctrl), nil, mock.NewMockSecondFactors(ctrl), attempts, nil, false)
+	csrf, cookie := loginForm(t, h)
+
+	// Form posted from other site has no CSRF cookie or token
+	w := postLogin(h, nil, url.Values{"csrf_token": {csrf}, "username": {"disabled"}, "password": {"x"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postLogin(h, cookie, url.Values{"csrf_token": {"forged"}, "username": {"disabled"}, "password": {"x"}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postLogin(h, cookie, url.Values{"csrf_token": {csrf}, "username": {"disabled"}, "password": {"x"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSessionLoginThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Check(testUser.Username, gomock.Any()).Return(2*time.Second, model.ErrLoginThrottled)
+
+	// Password is not checked until delay after failed login ends
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), mock.NewMockSessions(ctrl), nil, mock.NewMockSecondFactors(ctrl),
+		attempts, nil, false)
+	csrf, cookie := loginForm(t, h)
+
+	w := postLogin(h, cookie, url.Values{"csrf_token": {csrf}, "username": {testUser.Username},
+		"password": {"1q2w3e4r"}})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "Too many failed attempts")
+}
+
+func TestSessionUnlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	attempts := mock.NewMockLoginAttempts(ctrl)
+	attempts.EXPECT().Reset("i3odja").Return(nil)
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), mock.NewMockSessions(ctrl), nil, mock.NewMockSecondFactors(ctrl),
+		attempts, nil, false)
+
+	w := httptest.NewRecorder()
+	h.Unlock(w, jsonRequest(http.MethodDelete, "/admin/users/i3odja/lockout", "", map[string]string{"login": "i3odja"}))
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestSessionLoginPageSignedIn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Touch("raw").Return(testSession(), nil).Times(3)
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), sessions, nil, mock.NewMockSecondFactors(ctrl), nil, nil, false)
+
+	request := func(target string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+
+		w := httptest.NewRecorder()
+		h.LoginPage(w, r)
+
+		return w
+	}
+
+	w := request(handlers.PathLogin)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Signed in as "+testUser.Username)
+	assert.Contains(t, w.Body.String(), `value="session-csrf"`)
+
+	w = request(handlers.PathLogin + "?return_to=%2Foauth%2Fauthorize%3Fclient_id%3Dspa")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/oauth/authorize?client_id=spa", w.Header().Get("Location"))
+
+	// Signed in user is asked to authenticate again before sensitive operation
+	w = request(handlers.PathLogin + "?prompt=login&return_to=%2Faccount")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Please sign in again to continue.")
+	assert.Contains(t, w.Body.String(), `name="password"`)
+	assert.Contains(t, w.Body.String(), `value="/account"`)
+}
+
+func TestSessionLoginPageReturnTo(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Touch("raw").Return(testSession(), nil).AnyTimes()
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), sessions, nil, mock.NewMockSecondFactors(ctrl), nil, nil, false)
+
+	// Login page does not redirect to other sites
+	tests := []struct {
+		name     string
+		returnTo string
+		location string
+	}{
+		{name: "Local", returnTo: "/account?tab=security", location: "/account?tab=security"},
+		{name: "ProtocolRelative", returnTo: "//evil.example.com", location: handlers.PathLogin},
+		{name: "Backslash", returnTo: "/\\evil.example.com", location: handlers.PathLogin},
+		{name: "EscapedSlashes", returnTo: "\\/\\/evil.example.com", location: handlers.PathLogin},
+		// Sent as return_to=/%09/evil.example.com
+		{name: "Tab", returnTo: "/\t/evil.example.com", location: handlers.PathLogin},
+		{name: "Newline", returnTo: "/\r\n/evil.example.com", location: handlers.PathLogin},
+		{name: "Absolute", returnTo: "https://evil.example.com/", location: handlers.PathLogin},
+		{name: "Scheme", returnTo: "javascript:alert(1)", location: handlers.PathLogin},
+		{name: "Relative", returnTo: "evil.example.com", location: handlers.PathLogin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, handlers.PathLogin+"?"+url.Values{"return_to": {tt.returnTo}}.Encode(),
+				nil)
+			r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+
+			w := httptest.NewRecorder()
+			h.LoginPage(w, r)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestSessionLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Touch("raw").Return(testSession(), nil).Times(2)
+	sessions.EXPECT().Delete("raw").Return(nil)
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), sessions, nil, mock.NewMockSecondFactors(ctrl), nil, nil, false)
+
+	logout := func(csrf string) *httptest.ResponseRecorder {
+		r := formRequest(http.MethodPost, handlers.PathSignOut, url.Values{"csrf_token": {csrf}})
+		r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+
+		w := httptest.NewRecorder()
+		h.Logout(w, r)
+
+		return w
+	}
+
+	w := logout("forged")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = logout("session-csrf")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "signed out")
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, middleware.SessionCookie, cookies[0].Name)
+	assert.True(t, cookies[0].MaxAge < 0)
+}
+
+func TestOAuthLogoutEndsSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	h, m, issuer := newTestOAuth(t, ctrl)
+
+	hint, err := issuer.IssueID(&token.IDClaims{Claims: token.Claims{Subject: testUser.ID, Audience: token.Audience{"spa"}}})
+	require.NoError(t, err)
+
+	other := testSession()
+	other.UserID = "9b2d3c4e-0000-4000-8000-000000000002"
+
+	m.refresh.EXPECT().RevokeClient(testUser.ID, "spa").Return(nil).Times(2)
+	m.sessions.EXPECT().Touch("other").Return(other, nil)
+	m.sessions.EXPECT().Touch("raw").Return(testSession(), nil)
+	m.sessions.EXPECT().Delete("raw").Return(nil)
+
+	logout := func(raw string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, handlers.PathLogout+"?"+url.Values{"id_token_hint": {hint}}.Encode(), nil)
+		r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: raw})
+
+		w := httptest.NewRecorder()
+		h.Logout(w, r)
+
+		return w
+	}
+
+	// Browser signed in as other user keeps its session
+	w := logout("other")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+
+	w = logout("raw")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, middleware.SessionCookie, cookies[0].Name)
+	assert.True(t, cookies[0].MaxAge < 0)
+}
+
+// accountRequest is request of testUser made within session from testSession
+func accountRequest(method, target, body string, vars map[string]string) *http.Request {
+	r := jsonRequest(method, target, body, vars)
+	ctx := middleware.WithSession(r.Context(), testSession())
+
+	return r.WithContext(middleware.WithUser(ctx, testUser))
+}
+
+func TestSessionListOwn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	other := testSession()
+	other.ID = "7d3e2f1a-1b2c-4d3e-8f4a-5b6c7d8e9f00"
+	other.UserAgent = "curl/7.68.0"
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().List(testUser.Username).Return([]*model.Session{testSession(), other}, nil)
+
+	refresh := mock.NewMockRefreshTokens(ctrl)
+	refresh.EXPECT().List(testUser.Username).Return([]*model.RefreshToken{{
+		FamilyID:  "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0",
+		ClientID:  "umcli",
+		UserAgent: "umcli/1.0",
+		IPAddress: "192.0.2.7",
+	}}, nil)
+
+	w := httptest.NewRecorder()
+	handlers.NewSession(mock.NewMockUsers(ctrl), sessions, refresh, mock.NewMockSecondFactors(ctrl), nil, nil,
+		false).ListOwn(w, accountRequest(http.MethodGet, "/account/sessions", "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp []handlers.SessionInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+	require.Len(t, resp, 3)
+	assert.True(t, resp[0].Current)
+	assert.Equal(t, handlers.SessionTypeBrowser, resp[0].Type)
+	assert.False(t, resp[1].Current)
+	assert.Equal(t, "curl/7.68.0", resp[1].UserAgent)
+
+	// Refresh tokens are listed by family with device they were used from
+	assert.Equal(t, handlers.SessionTypeRefreshToken, resp[2].Type)
+	assert.Equal(t, "0f1e2d3c-4b5a-4968-8776-a5b4c3d2e1f0", resp[2].ID)
+	assert.Equal(t, "umcli", resp[2].ClientID)
+	assert.Equal(t, "umcli/1.0", resp[2].UserAgent)
+	assert.Equal(t, "192.0.2.7", resp[2].IPAddress)
+	assert.False(t, resp[2].Current)
+	assert.NotContains(t, w.Body.String(), "session-csrf")
+}
+
+func TestSessionDeleteOwn(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().DeleteOthers(testUser.Username, testSession().ID).Return(nil)
+	sessions.EXPECT().DeleteByID(testUser.Username, "unknown").Return(model.ErrSessionNotFound)
+	sessions.EXPECT().DeleteByID(testUser.Username, "family").Return(model.ErrSessionNotFound)
+	sessions.EXPECT().DeleteByID(testUser.Username, testSession().ID).Return(nil)
+
+	refresh := mock.NewMockRefreshTokens(ctrl)
+	refresh.EXPECT().RevokeUser(testUser.Username).Return(nil)
+	refresh.EXPECT().RevokeFamily(testUser.Username, "unknown").Return(model.ErrRefreshTokenNotFound)
+	refresh.EXPECT().RevokeFamily(testUser.Username, "family").Return(nil)
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), sessions, refresh, mock.NewMockSecondFactors(ctrl), nil, nil,
+		false)
+
+	// Sign out everywhere else keeps the session of the request
+	w := httptest.NewRecorder()
+	h.DeleteOwn(w, accountRequest(http.MethodDelete, "/account/sessions", "", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteOwnByID(w, accountRequest(http.MethodDelete, "/account/sessions/unknown", "",
+		map[string]string{"id": "unknown"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Id that is not a session revokes refresh token family, cookie of request is kept
+	w = httptest.NewRecorder()
+	h.DeleteOwnByID(w, accountRequest(http.MethodDelete, "/account/sessions/family", "",
+		map[string]string{"id": "family"}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+
+	w = httptest.NewRecorder()
+	h.DeleteOwnByID(w, accountRequest(http.MethodDelete, "/account/sessions/"+testSession().ID, "",
+		map[string]string{"id": testSession().ID}))
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.True(t, cookies[0].MaxAge < 0)
+}
+
+func TestSessionAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().List("john").Return(nil, nil)
+	sessions.EXPECT().DeleteOthers("john", "").Return(nil)
+	sessions.EXPECT().DeleteByID("john", "sid").Return(nil)
+
+	refresh := mock.NewMockRefreshTokens(ctrl)
+	refresh.EXPECT().List("john").Return(nil, nil)
+	refresh.EXPECT().RevokeUser("john").Return(nil)
+
+	h := handlers.NewSession(mock.NewMockUsers(ctrl), sessions, refresh, mock.NewMockSecondFactors(ctrl), nil, nil,
+		false)
+
+	w := httptest.NewRecorder()
+	h.ListUser(w, jsonRequest(http.MethodGet, "/admin/users/john/sessions", "", map[string]string{"login": "john"}))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.DeleteUser(w, jsonRequest(http.MethodDelete, "/admin/users/john/sessions", "", map[string]string{"login": "john"}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteUserByID(w, jsonRequest(http.MethodDelete, "/admin/users/john/sessions/sid", "",
+		map[string]string{"login": "john", "id": "sid"}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Result().Cookies())
+}
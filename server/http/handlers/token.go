@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	tokenTypeBearer = "Bearer"
+	// jwksMaxAge is how long clients may cache published keys, it is much shorter than key overlap
+	jwksMaxAge = 300
+
+	messageInvalidRefreshToken = "Invalid refresh token"
+)
+
+// TokenResponse is a successful response of token endpoint (RFC 6749 section 5.1)
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	// RefreshToken can be exchanged for a new pair of tokens once
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// Scope of access token, it is omitted for tokens not issued through OAuth flows
+	Scope string `json:"scope,omitempty"`
+	// IDToken is OpenID Connect ID token, it is issued when openid scope is granted
+	IDToken string `json:"id_token,omitempty"`
+	// IssuedTokenType is type of token issued by token exchange (RFC 8693 section 2.2.1)
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+// Token handles issuing, refreshing and revocation of tokens and publishing of keys to verify them
+type Token struct {
+	issuer  *token.Issuer
+	refresh RefreshTokens
+}
+
+func NewToken(issuer *token.Issuer, refresh RefreshTokens) *Token {
+	return &Token{issuer: issuer, refresh: refresh}
+}
+
+// Issue exchanges credentials checked by authentication middleware for access token. Refresh token is
+// first-party, client_id of the request is not authenticated, so it is not bound to the token.
+func (h *Token) Issue(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	auth := authContext(r)
+
+	refreshToken, err := h.refresh.Create(user.ID, model.FirstPartyClientID, "", auth.Time, auth.Methods,
+		r.UserAgent(), ClientIP(r))
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	claims := &token.Claims{Subject: user.ID, Username: user.Username}
+	claims.Authenticated(auth.Time, auth.Methods)
+
+	h.respond(w, claims, refreshToken)
+}
+
+// Refresh exchanges refresh token for a new access token and a new refresh token. Only first-party tokens
+// are rotated, tokens of OAuth clients are refreshed at the token endpoint with client authentication.
+func (h *Token) Refresh(w http.ResponseWriter, r *http.Request) {
+	rt, next, err := h.refresh.Rotate(r.FormValue("refresh_token"), model.FirstPartyClientID, r.UserAgent(),
+		ClientIP(r))
+
+	switch {
+	case err == model.ErrRefreshTokenReused:
+		logger.Component(logger.ComponentAuth).Warn("Refresh token reuse detected, token family revoked")
+		BadRequest(w, messageInvalidRefreshToken)
+		return
+	case err == model.ErrRefreshTokenInvalid:
+		BadRequest(w, messageInvalidRefreshToken)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	// Refreshed token keeps authentication context of the login the token family was issued for
+	claims := &token.Claims{Subject: rt.UserID, Username: rt.Username}
+	claims.Authenticated(rt.AuthTime, rt.AMR)
+
+	h.respond(w, claims, next)
+}
+
+// respond issues access token with claims and writes it with refresh token
+func (h *Token) respond(w http.ResponseWriter, claims *token.Claims, refreshToken string) {
+	accessToken, err := h.issuer.Issue(claims)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", claims.Username).Debug("Access token issued")
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	JSON(w, http.StatusOK, &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresIn:    int(h.issuer.TTL().Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+// Revoke revokes refresh token with its family. Response is the same for unknown tokens.
+func (h *Token) Revoke(w http.ResponseWriter, r *http.Request) {
+	err := h.refresh.Revoke(r.FormValue("refresh_token"))
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RevokeOwn revokes all refresh tokens of authenticated user
+func (h *Token) RevokeOwn(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	h.revokeUser(w, user.Username)
+}
+
+// RevokeUser revokes all refresh tokens of user with login from path
+func (h *Token) RevokeUser(w http.ResponseWriter, r *http.Request) {
+	h.revokeUser(w, mux.Vars(r)["login"])
+}
+
+func (h *Token) revokeUser(w http.ResponseWriter, login string) {
+	err := h.refresh.RevokeUser(login)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", login).Info("Refresh tokens revoked")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS publishes keys to verify access tokens
+func (h *Token) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+
+	JSON(w, http.StatusOK, h.issuer.Keys().JWKS())
+}
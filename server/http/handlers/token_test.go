@@ -0,0 +1,188 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIssuer(t *testing.T) *token.Issuer {
+	keys, err := token.NewKeyRing(token.KeyRingConfig{
+		Algorithm: token.AlgorithmRS256,
+		Rotation:  time.Hour,
+		Overlap:   time.Hour,
+	}, token.NewMemoryKeyStore())
+	require.NoError(t, err)
+
+	issuer, err := token.NewIssuer(keys, &token.Config{Issuer: "user-manager", TTL: 5 * time.Minute})
+	require.NoError(t, err)
+
+	return issuer
+}
+
+var testUser = &model.User{
+	ID:       "123e4567-e89b-12d3-a456-426655440000",
+	Username: "i3odja",
+}
+
+func formRequest(method, target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return r
+}
+
+func TestTokenIssue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	issuer := newTestIssuer(t)
+	refresh := mock.NewMockRefreshTokens(ctrl)
+	refresh.EXPECT().Create(testUser.ID, model.FirstPartyClientID, "", time.Unix(1600000000, 0),
+		[]string{token.AMRPassword, token.AMROTP}, "curl/7.68.0", "192.0.2.1").Return("refresh", nil)
+
+	// client_id of the request is not authenticated, refresh token is first-party anyway
+	r := formRequest(http.MethodPost, "/token", url.Values{"client_id": {"spa"}})
+	r.Header.Set("User-Agent", "curl/7.68.0")
+	ctx := middleware.WithUser(r.Context(), testUser)
+	ctx = middleware.WithAuthContext(ctx, &middleware.AuthContext{Time: time.Unix(1600000000, 0),
+		Methods: []string{token.AMRPassword, token.AMROTP}})
+	w := httptest.NewRecorder()
+
+	handlers.NewToken(issuer, refresh).Issue(w, r.WithContext(ctx))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var resp handlers.TokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, 300, resp.ExpiresIn)
+	assert.Equal(t, "refresh", resp.RefreshToken)
+
+	claims, err := issuer.Validate(resp.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, testUser.ID, claims.Subject)
+	assert.Equal(t, testUser.Username, claims.Username)
+	assert.Equal(t, int64(1600000000), claims.AuthTime)
+	assert.Equal(t, []string{token.AMRPassword, token.AMROTP}, claims.AMR)
+	assert.Equal(t, token.ACRMultiFactor, claims.ACR)
+}
+
+func TestTokenIssueUnauthenticated(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/token", nil)
+	w := httptest.NewRecorder()
+
+	handlers.NewToken(newTestIssuer(t), nil).Issue(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokenJWKS(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+
+	handlers.NewToken(newTestIssuer(t), nil).JWKS(w, r)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var set token.JWKSet
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, "RSA", set.Keys[0].KeyType)
+	assert.Equal(t, "AQAB", set.Keys[0].E)
+}
+
+func TestTokenRefresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	issuer := newTestIssuer(t)
+	refresh := mock.NewMockRefreshTokens(ctrl)
+
+	rotated := &model.RefreshToken{UserID: testUser.ID, Username: testUser.Username,
+		AuthTime: time.Unix(1600000000, 0), AMR: []string{token.AMRPassword}}
+
+	refresh.EXPECT().Rotate("valid", model.FirstPartyClientID, gomock.Any(), gomock.Any()).Return(rotated, "next", nil)
+	refresh.EXPECT().Rotate("used", model.FirstPartyClientID, gomock.Any(), gomock.Any()).Return(nil, "", model.ErrRefreshTokenReused)
+	refresh.EXPECT().Rotate("unknown", model.FirstPartyClientID, gomock.Any(), gomock.Any()).Return(nil, "", model.ErrRefreshTokenInvalid)
+	refresh.EXPECT().Rotate("broken", model.FirstPartyClientID, gomock.Any(), gomock.Any()).Return(nil, "", errors.New("db is down"))
+
+	tests := []struct {
+		token string
+		code  int
+	}{
+		{token: "valid", code: http.StatusOK},
+		{token: "used", code: http.StatusBadRequest},
+		{token: "unknown", code: http.StatusBadRequest},
+		{token: "broken", code: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			// client_id chosen by caller does not let tokens of OAuth clients be rotated
+			r := formRequest(http.MethodPost, "/token/refresh", url.Values{"refresh_token": {tt.token}, "client_id": {"spa"}})
+			w := httptest.NewRecorder()
+
+			handlers.NewToken(issuer, refresh).Refresh(w, r)
+
+			require.Equal(t, tt.code, w.Code)
+
+			if tt.code != http.StatusOK {
+				return
+			}
+
+			var resp handlers.TokenResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "next", resp.RefreshToken)
+
+			claims, err := issuer.Validate(resp.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, testUser.Username, claims.Username)
+			assert.Equal(t, int64(1600000000), claims.AuthTime)
+			assert.Equal(t, token.ACRSingleFactor, claims.ACR)
+		})
+	}
+}
+
+func TestTokenRevoke(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	refresh := mock.NewMockRefreshTokens(ctrl)
+	refresh.EXPECT().Revoke("refresh").Return(nil)
+	refresh.EXPECT().RevokeUser(testUser.Username).Return(nil).Times(2)
+
+	h := handlers.NewToken(newTestIssuer(t), refresh)
+
+	w := httptest.NewRecorder()
+	h.Revoke(w, formRequest(http.MethodPost, "/token/revoke", url.Values{"refresh_token": {"refresh"}}))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r := httptest.NewRequest(http.MethodDelete, "/account/tokens", nil)
+	w = httptest.NewRecorder()
+	h.RevokeOwn(w, r.WithContext(middleware.WithUser(r.Context(), testUser)))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	r = mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/admin/users/i3odja/tokens", nil), map[string]string{"login": testUser.Username})
+	w = httptest.NewRecorder()
+	h.RevokeUser(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/notify"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/totp"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	messageTwoFactorEnabled     = "Two-factor authentication is already enabled"
+	messageTwoFactorNotEnrolled = "Two-factor authentication is not enrolled"
+	messageUnsupportedChannel   = "Channel is not supported"
+	messageNoDestination        = "Account has no email address or phone number for the channel"
+)
+
+// TwoFactorStatus describes second factor of user
+type TwoFactorStatus struct {
+	TOTP                bool   `json:"totp"`
+	WebAuthnCredentials int    `json:"webauthn_credentials"`
+	OTPChannel          string `json:"otp_channel,omitempty"`
+	RecoveryCodesLeft   int    `json:"recovery_codes_left"`
+}
+
+// TOTPEnrollment is TOTP secret to add to authenticator app, OTPAuthURI is payload of QR code for it
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TOTPConfirmation proves authenticator app generates codes of enrolled secret
+type TOTPConfirmation struct {
+	Code string `json:"code"`
+}
+
+// OTPEnrollment chooses channel one-time codes are sent over, email or sms. Codes go to email address
+// or phone number of the account.
+type OTPEnrollment struct {
+	Channel string `json:"channel"`
+}
+
+// OTPDelivery tells where one-time code was sent, destination is masked
+type OTPDelivery struct {
+	Channel     string `json:"channel"`
+	Destination string `json:"destination"`
+	// ExpiresIn is lifetime of the code in seconds
+	ExpiresIn int `json:"expires_in"`
+}
+
+// RecoveryCodes can be used once each instead of TOTP code, they are shown only when generated
+type RecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// TwoFactor handles enrollment of second factor by users and its reset by admins
+type TwoFactor struct {
+	factors SecondFactors
+	users   Users
+	codes   CodeSender
+	// issuer is name of the service shown by authenticator apps
+	issuer string
+}
+
+func NewTwoFactor(factors SecondFactors, users Users, codes CodeSender, issuer string) *TwoFactor {
+	return &TwoFactor{factors: factors, users: users, codes: codes, issuer: issuer}
+}
+
+// Status returns second factor of authenticated user
+func (h *TwoFactor) Status(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	status, err := h.factors.Status(user.ID)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	JSON(w, http.StatusOK, &TwoFactorStatus{
+		TOTP:                status.TOTP,
+		WebAuthnCredentials: status.WebAuthnCredentials,
+		OTPChannel:          status.OTPChannel,
+		RecoveryCodesLeft:   status.RecoveryCodesLeft,
+	})
+}
+
+// EnrollTOTP generates TOTP secret of authenticated user. It is enabled after ConfirmTOTP.
+func (h *TwoFactor) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	secret, err := h.factors.EnrollTOTP(user.ID)
+
+	switch {
+	case err == model.ErrTwoFactorEnabled:
+		Conflict(w, messageTwoFactorEnabled)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusCreated, &TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(h.issuer, user.Username, secret),
+	})
+}
+
+// ConfirmTOTP enables enrolled TOTP when code from authenticator app matches and returns recovery codes
+func (h *TwoFactor) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	var c TOTPConfirmation
+
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	codes, err := h.factors.ConfirmTOTP(user.ID, c.Code)
+
+	switch {
+	case err == model.ErrTwoFactorCodeInvalid:
+		BadRequest(w, messageInvalidCode)
+		return
+	case err == model.ErrTwoFactorNotEnrolled:
+		NotFound(w, messageTwoFactorNotEnrolled)
+		return
+	case err == model.ErrTwoFactorEnabled:
+		Conflict(w, messageTwoFactorEnabled)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("Two-factor authentication enabled")
+
+	writeRecoveryCodes(w, codes)
+}
+
+// EnrollOTP sends code to email address or phone number of authenticated user. Channel is enabled
+// after ConfirmOTP with the code.
+func (h *TwoFactor) EnrollOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	var e OTPEnrollment
+
+	err := json.NewDecoder(r.Body).Decode(&e)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	if !h.codes.Supports(e.Channel) {
+		BadRequest(w, messageUnsupportedChannel)
+		return
+	}
+
+	// User from bearer token or session has no contacts, they are read from account
+	account, err := h.users.GetInfo(user.Username)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	destination := account.Email
+	if e.Channel == notify.SMS {
+		destination = account.Phone
+	}
+
+	if destination == "" {
+		BadRequest(w, messageNoDestination)
+		return
+	}
+
+	d, err := h.factors.EnrollOTP(user.ID, e.Channel, destination)
+
+	switch {
+	case err == model.ErrTwoFactorEnabled:
+		Conflict(w, messageTwoFactorEnabled)
+		return
+	case err == model.ErrOTPTooSoon:
+		TooManyRequests(w, model.OTPResendInterval)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	err = h.codes.Send(r.Context(), d.Channel, d.Destination, d.Code)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	JSON(w, http.StatusAccepted, otpDelivery(d))
+}
+
+// ConfirmOTP enables enrolled email or SMS channel when code sent over it matches and returns recovery codes
+func (h *TwoFactor) ConfirmOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	var c TOTPConfirmation
+
+	err := json.NewDecoder(r.Body).Decode(&c)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	codes, err := h.factors.ConfirmOTP(user.ID, c.Code)
+
+	switch {
+	case err == model.ErrTwoFactorCodeInvalid:
+		BadRequest(w, messageInvalidCode)
+		return
+	case err == model.ErrTwoFactorLocked:
+		BadRequest(w, messageFactorLocked)
+		return
+	case err == model.ErrTwoFactorNotEnrolled:
+		NotFound(w, messageTwoFactorNotEnrolled)
+		return
+	case err == model.ErrTwoFactorEnabled:
+		Conflict(w, messageTwoFactorEnabled)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("Two-factor authentication enabled")
+
+	writeRecoveryCodes(w, codes)
+}
+
+// RegenerateRecoveryCodes replaces recovery codes of authenticated user
+func (h *TwoFactor) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	codes, err := h.factors.RegenerateRecoveryCodes(user.ID)
+
+	switch {
+	case err == model.ErrTwoFactorNotEnrolled:
+		NotFound(w, messageTwoFactorNotEnrolled)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+// Disable turns off two-factor authentication of authenticated user
+func (h *TwoFactor) Disable(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	err := h.factors.Disable(user.ID)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("Two-factor authentication disabled")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reset removes second factor of user with login from path, so user who lost it can log in with password
+func (h *TwoFactor) Reset(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["login"]
+
+	err := h.factors.Reset(login)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", login).Info("Two-factor authentication reset")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, &RecoveryCodes{RecoveryCodes: codes})
+}
+
+func otpDelivery(d *model.OTPDelivery) *OTPDelivery {
+	return &OTPDelivery{
+		Channel:     d.Channel,
+		Destination: maskDestination(d.Destination),
+		ExpiresIn:   int(model.OTPTTL.Seconds()),
+	}
+}
+
+// maskDestination hides most of email address or phone number, so response does not disclose it
+// to someone who got hold of the session
+func maskDestination(destination string) string {
+	if at := strings.LastIndex(destination, "@"); at > 0 {
+		return destination[:1] + strings.Repeat("*", at-1) + destination[at:]
+	}
+
+	if len(destination) <= 4 {
+		return strings.Repeat("*", len(destination))
+	}
+
+	return strings.Repeat("*", len(destination)-4) + destination[len(destination)-4:]
+}
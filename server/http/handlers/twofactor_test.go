@@ -0,0 +1,159 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/handlers"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	factors.EXPECT().EnrollTOTP(testUser.ID).Return("JBSWY3DPEHPK3PXP", nil)
+	factors.EXPECT().ConfirmTOTP(testUser.ID, "000000").Return(nil, model.ErrTwoFactorCodeInvalid)
+	factors.EXPECT().ConfirmTOTP(testUser.ID, "123456").Return([]string{"abcde-fghij"}, nil)
+	factors.EXPECT().EnrollTOTP(testUser.ID).Return("", model.ErrTwoFactorEnabled)
+
+	h := handlers.NewTwoFactor(factors, nil, nil, "user-manager")
+
+	w := httptest.NewRecorder()
+	h.EnrollTOTP(w, accountRequest(http.MethodPost, "/account/2fa/totp", "", nil))
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var enrollment handlers.TOTPEnrollment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&enrollment))
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", enrollment.Secret)
+
+	uri, err := url.Parse(enrollment.OTPAuthURI)
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "/user-manager:"+testUser.Username, uri.Path)
+
+	confirm := func(body string) *httptest.ResponseRecorder {
+		r := accountRequest(http.MethodPost, "/account/2fa/totp/confirm", body, nil)
+
+		w := httptest.NewRecorder()
+		h.ConfirmTOTP(w, r)
+
+		return w
+	}
+
+	w = confirm("{")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = confirm(`{"code":"000000"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = confirm(`{"code":"123456"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"recovery_codes":["abcde-fghij"]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.EnrollTOTP(w, accountRequest(http.MethodPost, "/account/2fa/totp", "", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestTwoFactorStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	factors.EXPECT().Status(testUser.ID).Return(&model.TwoFactorStatus{TOTP: true, WebAuthnCredentials: 1,
+		RecoveryCodesLeft: 9}, nil)
+	factors.EXPECT().RegenerateRecoveryCodes(testUser.ID).Return(nil, model.ErrTwoFactorNotEnrolled)
+	factors.EXPECT().Disable(testUser.ID).Return(nil)
+	factors.EXPECT().Reset("john").Return(nil)
+
+	h := handlers.NewTwoFactor(factors, nil, nil, "user-manager")
+
+	w := httptest.NewRecorder()
+	h.Status(w, accountRequest(http.MethodGet, "/account/2fa", "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"totp":true,"webauthn_credentials":1,"recovery_codes_left":9}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	h.RegenerateRecoveryCodes(w, accountRequest(http.MethodPost, "/account/2fa/recovery-codes", "", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	h.Disable(w, accountRequest(http.MethodDelete, "/account/2fa", "", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.Reset(w, jsonRequest(http.MethodDelete, "/admin/users/john/2fa", "", map[string]string{"login": "john"}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestTwoFactorOTPEnrollment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo(testUser.Username).Return(&model.User{ID: testUser.ID, Username: testUser.Username,
+		Email: "i3odja@example.com"}, nil).Times(3)
+
+	codes := mock.NewMockCodeSender(ctrl)
+	codes.EXPECT().Supports("email").Return(true).AnyTimes()
+	codes.EXPECT().Supports("sms").Return(true).AnyTimes()
+	codes.EXPECT().Supports("fax").Return(false)
+	codes.EXPECT().Send(gomock.Any(), "email", "i3odja@example.com", "123456").Return(nil)
+
+	factors := mock.NewMockSecondFactors(ctrl)
+	factors.EXPECT().EnrollOTP(testUser.ID, "email", "i3odja@example.com").
+		Return(&model.OTPDelivery{Channel: "email", Destination: "i3odja@example.com", Code: "123456"}, nil)
+	factors.EXPECT().EnrollOTP(testUser.ID, "email", "i3odja@example.com").Return(nil, model.ErrOTPTooSoon)
+	factors.EXPECT().ConfirmOTP(testUser.ID, "000000").Return(nil, model.ErrTwoFactorCodeInvalid)
+	factors.EXPECT().ConfirmOTP(testUser.ID, "123456").Return([]string{"abcde-fghij"}, nil)
+
+	h := handlers.NewTwoFactor(factors, users, codes, "user-manager")
+
+	enroll := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.EnrollOTP(w, accountRequest(http.MethodPost, "/account/2fa/otp", body, nil))
+
+		return w
+	}
+
+	w := enroll(`{"channel":"fax"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Account has no phone number
+	w = enroll(`{"channel":"sms"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = enroll(`{"channel":"email"}`)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.JSONEq(t, `{"channel":"email","destination":"i*****@example.com","expires_in":600}`, w.Body.String())
+
+	// Enrolling again does not send another code at once
+	w = enroll(`{"channel":"email"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	confirm := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ConfirmOTP(w, accountRequest(http.MethodPost, "/account/2fa/otp/confirm", body, nil))
+
+		return w
+	}
+
+	w = confirm(`{"code":"000000"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = confirm(`{"code":"123456"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"recovery_codes":["abcde-fghij"]}`, w.Body.String())
+}
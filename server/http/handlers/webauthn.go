@@ -0,0 +1,489 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+	"github.com/lvl484/user-manager/webauthn"
+
+	"github.com/gorilla/mux"
+)
+
+// Paths of WebAuthn ceremonies of hosted login page
+const (
+	PathLoginWebAuthnBegin  = "/login/webauthn/begin"
+	PathLoginWebAuthnFinish = "/login/webauthn/finish"
+)
+
+const (
+	// defaultCredentialName is name of credential registered without name
+	defaultCredentialName = "Passkey"
+	maxCredentialName     = 64
+
+	messageCredentialExists   = "WebAuthn credential is already registered"
+	messageCredentialNotFound = "WebAuthn credential not found"
+	messageInvalidCredential  = "Invalid WebAuthn credential"
+	messageInvalidName        = "Credential name is too long"
+)
+
+// ceremonyTimeout is timeout of WebAuthn ceremonies in browser, in milliseconds
+var ceremonyTimeout = int64(model.ChallengeTTL / time.Millisecond)
+
+// WebAuthnCredentialInfo describes registered WebAuthn credential
+type WebAuthnCredentialInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Algorithm int64  `json:"algorithm"`
+	Format    string `json:"format"`
+	// AAGUID identifies authenticator model, it is all zeros when authenticator does not disclose it
+	AAGUID     string     `json:"aaguid"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnLogin optionally names user signing in with passkey. Without username user picks
+// discoverable credential stored by authenticator.
+type WebAuthnLogin struct {
+	Username string `json:"username"`
+}
+
+// WebAuthnRedirect is where browser goes after signing in with passkey
+type WebAuthnRedirect struct {
+	Redirect string `json:"redirect"`
+}
+
+// WebAuthn handles registration of WebAuthn credentials by users and sign in with them on login page,
+// either instead of password or as second factor after it
+type WebAuthn struct {
+	users       Users
+	credentials WebAuthnCredentials
+	sessions    Sessions
+	rp          *webauthn.RelyingParty
+	// secure restricts cookies to HTTPS
+	secure bool
+}
+
+func NewWebAuthn(users Users, credentials WebAuthnCredentials, sessions Sessions, rp *webauthn.RelyingParty,
+	secureCookies bool) *WebAuthn {
+	return &WebAuthn{users: users, credentials: credentials, sessions: sessions, rp: rp, secure: secureCookies}
+}
+
+// RegisterBegin returns options of navigator.credentials.create() for authenticated user
+func (h *WebAuthn) RegisterBegin(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	credentials, err := h.credentials.List(user.ID)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	exclude := make([][]byte, 0, len(credentials))
+
+	for _, c := range credentials {
+		id, err := base64.RawURLEncoding.DecodeString(c.ID)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		exclude = append(exclude, id)
+	}
+
+	challenge, err := h.credentials.CreateChallenge(user.ID, model.CeremonyRegister)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	displayName := strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if displayName == "" {
+		displayName = user.Username
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, h.rp.CreationOptions(webauthn.UserEntity{
+		ID:          webauthn.Bytes(user.ID),
+		Name:        user.Username,
+		DisplayName: displayName,
+	}, challenge, ceremonyTimeout, exclude))
+}
+
+// RegisterFinish verifies response of authenticator and stores new credential of authenticated user.
+// Credential is named by name query parameter.
+func (h *WebAuthn) RegisterFinish(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = defaultCredentialName
+	}
+
+	if utf8.RuneCountInString(name) > maxCredentialName {
+		BadRequest(w, messageInvalidName)
+		return
+	}
+
+	var resp webauthn.AttestationResponse
+
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	challenge, err := h.consumeChallenge(resp.Response.ClientDataJSON, model.CeremonyRegister)
+
+	switch {
+	case err == model.ErrChallengeInvalid || err == webauthn.ErrInvalidResponse:
+		BadRequest(w, messageInvalidCredential)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	case challenge.userID != user.ID:
+		BadRequest(w, messageInvalidCredential)
+		return
+	}
+
+	cred, err := h.rp.VerifyRegistration(&resp, challenge.value)
+	if err != nil {
+		logger.Component(logger.ComponentAuth).WithField("user", user.Username).Infof("WebAuthn registration failed: %v", err)
+		BadRequest(w, messageInvalidCredential)
+		return
+	}
+
+	c := &model.WebAuthnCredential{
+		ID:        base64.RawURLEncoding.EncodeToString(cred.ID),
+		UserID:    user.ID,
+		Username:  user.Username,
+		Name:      name,
+		PublicKey: cred.PublicKey,
+		Algorithm: cred.Algorithm,
+		SignCount: cred.SignCount,
+		AAGUID:    cred.AAGUID,
+		Format:    cred.Format,
+	}
+
+	err = h.credentials.Add(c)
+
+	switch {
+	case err == model.ErrCredentialExists:
+		Conflict(w, messageCredentialExists)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("WebAuthn credential registered")
+
+	JSON(w, http.StatusCreated, credentialInfo(c))
+}
+
+// ListCredentials returns WebAuthn credentials of authenticated user
+func (h *WebAuthn) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	credentials, err := h.credentials.List(user.ID)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	resp := make([]*WebAuthnCredentialInfo, 0, len(credentials))
+	for _, c := range credentials {
+		resp = append(resp, credentialInfo(c))
+	}
+
+	JSON(w, http.StatusOK, resp)
+}
+
+// DeleteCredential removes WebAuthn credential of authenticated user with id from path
+func (h *WebAuthn) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.UserFromContext(r.Context())
+	if !ok {
+		Unauthorized(w)
+		return
+	}
+
+	err := h.credentials.Delete(user.ID, mux.Vars(r)["id"])
+
+	switch {
+	case err == model.ErrCredentialNotFound:
+		NotFound(w, messageCredentialNotFound)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("WebAuthn credential removed")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LoginBegin returns options of navigator.credentials.get(). Browser with session waiting for second factor
+// gets options for credentials of its user, otherwise options of passwordless login are returned.
+func (h *WebAuthn) LoginBegin(w http.ResponseWriter, r *http.Request) {
+	pending, ok := h.authorizeLogin(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		userID           string
+		ceremony         = model.CeremonyLogin
+		userVerification = webauthn.UserVerificationRequired
+	)
+
+	if pending != nil {
+		userID, ceremony, userVerification = pending.UserID, model.CeremonySecondFactor, webauthn.UserVerificationDiscouraged
+	} else {
+		var login WebAuthnLogin
+
+		err := json.NewDecoder(r.Body).Decode(&login)
+		if err != nil {
+			BadRequest(w, messageInvalidBody)
+			return
+		}
+
+		if login.Username != "" {
+			user, err := h.users.GetInfo(login.Username)
+
+			switch {
+			// Unknown user gets options without credentials, so existence of users is not disclosed
+			case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+			case err != nil:
+				InternalServerError(w, err)
+				return
+			default:
+				userID = user.ID
+			}
+		}
+	}
+
+	var allow [][]byte
+
+	if userID != "" {
+		credentials, err := h.credentials.List(userID)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		for _, c := range credentials {
+			id, err := base64.RawURLEncoding.DecodeString(c.ID)
+			if err != nil {
+				InternalServerError(w, err)
+				return
+			}
+
+			allow = append(allow, id)
+		}
+	}
+
+	challenge, err := h.credentials.CreateChallenge(userID, ceremony)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	JSON(w, http.StatusOK, h.rp.RequestOptions(challenge, ceremonyTimeout, allow, userVerification))
+}
+
+// LoginFinish verifies assertion of authenticator. Passwordless login starts new session, second factor
+// signs in session waiting for it. Response tells where browser goes next.
+func (h *WebAuthn) LoginFinish(w http.ResponseWriter, r *http.Request) {
+	pending, ok := h.authorizeLogin(w, r)
+	if !ok {
+		return
+	}
+
+	var resp webauthn.AssertionResponse
+
+	err := json.NewDecoder(r.Body).Decode(&resp)
+	if err != nil {
+		BadRequest(w, messageInvalidBody)
+		return
+	}
+
+	ceremony := model.CeremonyLogin
+	if pending != nil {
+		ceremony = model.CeremonySecondFactor
+	}
+
+	challenge, err := h.consumeChallenge(resp.Response.ClientDataJSON, ceremony)
+
+	switch {
+	case err == model.ErrChallengeInvalid || err == webauthn.ErrInvalidResponse:
+		Unauthorized(w)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	cred, err := h.credentials.Get(base64.RawURLEncoding.EncodeToString(resp.RawID))
+
+	switch {
+	case err == model.ErrCredentialNotFound:
+		Unauthorized(w)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	log := logger.Component(logger.ComponentAuth).WithField("user", cred.Username)
+
+	// Challenge issued for user and user handle returned by authenticator have to belong to credential owner
+	if challenge.userID != "" && challenge.userID != cred.UserID || pending != nil && pending.UserID != cred.UserID ||
+		len(resp.Response.UserHandle) != 0 && string(resp.Response.UserHandle) != cred.UserID {
+		log.Info("WebAuthn login failed")
+		Unauthorized(w)
+		return
+	}
+
+	signCount, err := h.rp.VerifyAssertion(&resp, challenge.value, cred.PublicKey, cred.SignCount, pending == nil)
+	if err == nil {
+		err = h.credentials.Use(cred.ID, signCount)
+	}
+
+	switch {
+	case err == webauthn.ErrSignCount || err == model.ErrCredentialCloned:
+		log.WithField("credential", cred.ID).Warn("WebAuthn signature counter did not increase, credential may be cloned")
+		Unauthorized(w)
+		return
+	case err == webauthn.ErrInvalidResponse || err == webauthn.ErrInvalidSignature ||
+		err == webauthn.ErrUserNotVerified || err == webauthn.ErrUnsupportedKey:
+		log.Infof("WebAuthn login failed: %v", err)
+		Unauthorized(w)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	}
+
+	if pending != nil {
+		raw, _ := middleware.SessionToken(r)
+
+		err = h.sessions.Complete(raw, token.AMRWebAuthn)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+	} else {
+		raw, session, err := h.sessions.Create(&model.User{ID: cred.UserID, Username: cred.Username}, r.UserAgent(),
+			ClientIP(r), token.AMRWebAuthn, false)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		middleware.SetSessionCookie(w, raw, session.ExpiresAt, h.secure)
+		setLoginCSRF(w, "", -1, h.secure)
+	}
+
+	log.Info("Session started")
+
+	JSON(w, http.StatusOK, &WebAuthnRedirect{Redirect: safeReturnTo(r.URL.Query().Get(middleware.ReturnToParam))})
+}
+
+// authorizeLogin checks CSRF token of login page request. It returns session waiting for second factor
+// when browser has one, its CSRF token is used then instead of token of login form.
+func (h *WebAuthn) authorizeLogin(w http.ResponseWriter, r *http.Request) (*model.Session, bool) {
+	if raw, ok := middleware.SessionToken(r); ok {
+		session, err := h.sessions.TouchPending(raw)
+
+		switch {
+		case err == model.ErrSessionInvalid:
+		case err != nil:
+			InternalServerError(w, err)
+			return nil, false
+		case !middleware.ValidCSRF(r, session.CSRFToken):
+			Forbidden(w)
+			return nil, false
+		default:
+			return session, true
+		}
+	}
+
+	// Login form is protected by double submit cookie, so other sites can not sign user in to their account
+	c, err := r.Cookie(loginCSRFCookie)
+	if err != nil || !middleware.ValidCSRF(r, c.Value) {
+		Forbidden(w)
+		return nil, false
+	}
+
+	return nil, true
+}
+
+// pendingChallenge is challenge of WebAuthn ceremony and user it was issued for
+type pendingChallenge struct {
+	value  string
+	userID string
+}
+
+// consumeChallenge finds challenge signed in client data, so it can not be used again
+func (h *WebAuthn) consumeChallenge(clientDataJSON []byte, ceremony string) (*pendingChallenge, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := h.credentials.ConsumeChallenge(challenge, ceremony)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pendingChallenge{value: challenge, userID: userID}, nil
+}
+
+func credentialInfo(c *model.WebAuthnCredential) *WebAuthnCredentialInfo {
+	return &WebAuthnCredentialInfo{
+		ID:         c.ID,
+		Name:       c.Name,
+		Algorithm:  c.Algorithm,
+		Format:     c.Format,
+		AAGUID:     formatAAGUID(c.AAGUID),
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+// formatAAGUID formats AAGUID like UUID
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+
+	s := hex.EncodeToString(aaguid)
+
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
@@ -0,0 +1,360 @@
+package handlers_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/handlers"
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/webauthn"
+	"github.com/lvl484/user-manager/webauthn/webauthntest"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRP = &webauthn.RelyingParty{ID: "localhost", Name: "user-manager", Origin: "http://localhost:8000"}
+
+// newPasskey returns software authenticator with credential registered for testUser
+func newPasskey(t *testing.T) (*webauthntest.Authenticator, *model.WebAuthnCredential) {
+	a, err := webauthntest.New(*testRP)
+	require.NoError(t, err)
+
+	resp, err := a.Create("registration", []byte(testUser.ID))
+	require.NoError(t, err)
+
+	cred, err := testRP.VerifyRegistration(resp, "registration")
+	require.NoError(t, err)
+
+	return a, &model.WebAuthnCredential{
+		ID:        base64.RawURLEncoding.EncodeToString(cred.ID),
+		UserID:    testUser.ID,
+		Username:  testUser.Username,
+		Name:      "Laptop",
+		PublicKey: cred.PublicKey,
+		Algorithm: cred.Algorithm,
+		SignCount: cred.SignCount,
+	}
+}
+
+func encodeJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+// loginRequest returns request of login page script protected by login form CSRF token
+func loginRequest(target, body string) *http.Request {
+	r := jsonRequest(http.MethodPost, target, body, nil)
+	r.AddCookie(&http.Cookie{Name: "um_login_csrf", Value: "login-csrf"})
+	r.Header.Set(middleware.CSRFHeader, "login-csrf")
+
+	return r
+}
+
+// pendingRequest returns request of second factor page script with session waiting for second factor
+func pendingRequest(target, body string) *http.Request {
+	r := jsonRequest(http.MethodPost, target, body, nil)
+	r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+	r.Header.Set(middleware.CSRFHeader, "session-csrf")
+
+	return r
+}
+
+func TestWebAuthnRegister(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, existing := newPasskey(t)
+
+	var added *model.WebAuthnCredential
+
+	credentials := mock.NewMockWebAuthnCredentials(ctrl)
+	credentials.EXPECT().List(testUser.ID).Return([]*model.WebAuthnCredential{existing}, nil)
+	credentials.EXPECT().CreateChallenge(testUser.ID, model.CeremonyRegister).Return("challenge", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyRegister).Return(testUser.ID, nil)
+	credentials.EXPECT().Add(gomock.Any()).DoAndReturn(func(c *model.WebAuthnCredential) error {
+		added = c
+		return nil
+	})
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyRegister).Return("", model.ErrChallengeInvalid)
+
+	h := handlers.NewWebAuthn(nil, credentials, nil, testRP, true)
+
+	w := httptest.NewRecorder()
+	h.RegisterBegin(w, accountRequest(http.MethodPost, "/account/webauthn/register/begin", "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var options webauthn.CreationOptions
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+	assert.Equal(t, "challenge", options.Challenge)
+	assert.Equal(t, "localhost", options.RP.ID)
+	assert.Equal(t, testUser.ID, string(options.User.ID))
+	assert.Equal(t, testUser.Username, options.User.DisplayName)
+	assert.Equal(t, webauthn.AlgorithmES256, options.PubKeyCredParams[0].Algorithm)
+	require.Len(t, options.ExcludeCredentials, 1)
+	assert.Equal(t, existing.ID, base64.RawURLEncoding.EncodeToString(options.ExcludeCredentials[0].ID))
+
+	a, err := webauthntest.New(*testRP)
+	require.NoError(t, err)
+
+	a.Format = webauthn.FormatPacked
+
+	resp, err := a.Create(options.Challenge, options.User.ID)
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.RegisterFinish(w, accountRequest(http.MethodPost, "/account/webauthn/register/finish?name=Phone",
+		encodeJSON(t, resp), nil))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var info handlers.WebAuthnCredentialInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&info))
+	assert.Equal(t, "Phone", info.Name)
+	assert.Equal(t, webauthn.FormatPacked, info.Format)
+	assert.Equal(t, "77656261-7574-686e-7465-73742d737731", info.AAGUID)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(a.ID), added.ID)
+	assert.Equal(t, testUser.ID, added.UserID)
+
+	// Challenge is used once
+	w = httptest.NewRecorder()
+	h.RegisterFinish(w, accountRequest(http.MethodPost, "/account/webauthn/register/finish", encodeJSON(t, resp), nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebAuthnRegisterRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	credentials := mock.NewMockWebAuthnCredentials(ctrl)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyRegister).Return("other-user", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyRegister).Return(testUser.ID, nil)
+
+	h := handlers.NewWebAuthn(nil, credentials, nil, testRP, true)
+
+	a, err := webauthntest.New(*testRP)
+	require.NoError(t, err)
+
+	resp, err := a.Create("challenge", []byte(testUser.ID))
+	require.NoError(t, err)
+
+	finish := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.RegisterFinish(w, accountRequest(http.MethodPost, target, encodeJSON(t, resp), nil))
+
+		return w
+	}
+
+	// Challenge issued for other user
+	w := finish("/account/webauthn/register/finish")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Response of authenticator of other site
+	a.RP.Origin = "https://evil.example"
+
+	resp, err = a.Create("challenge", []byte(testUser.ID))
+	require.NoError(t, err)
+
+	w = finish("/account/webauthn/register/finish")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = finish("/account/webauthn/register/finish?name=" + strings.Repeat("a", 65))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebAuthnPasswordlessLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a, cred := newPasskey(t)
+
+	credentials := mock.NewMockWebAuthnCredentials(ctrl)
+	credentials.EXPECT().CreateChallenge("", model.CeremonyLogin).Return("challenge", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyLogin).Return("", nil).Times(2)
+	credentials.EXPECT().Get(cred.ID).Return(cred, nil).Times(2)
+	credentials.EXPECT().Use(cred.ID, cred.SignCount+1).Return(nil)
+	credentials.EXPECT().Use(cred.ID, cred.SignCount+1).Return(model.ErrCredentialCloned)
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().Create(&model.User{ID: testUser.ID, Username: testUser.Username}, gomock.Any(), gomock.Any(),
+		"webauthn", false).Return("raw", testSession(), nil)
+
+	h := handlers.NewWebAuthn(nil, credentials, sessions, testRP, true)
+
+	// Login page CSRF token is required
+	w := httptest.NewRecorder()
+	h.LoginBegin(w, jsonRequest(http.MethodPost, handlers.PathLoginWebAuthnBegin, `{}`, nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	h.LoginBegin(w, loginRequest(handlers.PathLoginWebAuthnBegin, `{}`))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var options webauthn.RequestOptions
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+	assert.Equal(t, "challenge", options.Challenge)
+	assert.Equal(t, webauthn.UserVerificationRequired, options.UserVerification)
+	assert.Empty(t, options.AllowCredentials)
+
+	resp, err := a.Get(options.Challenge)
+	require.NoError(t, err)
+
+	body := encodeJSON(t, resp)
+
+	w = httptest.NewRecorder()
+	h.LoginFinish(w, loginRequest(handlers.PathLoginWebAuthnFinish+"?return_to=%2Fdevice", body))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"redirect":"/device"}`, w.Body.String())
+
+	var session *http.Cookie
+
+	for _, c := range w.Result().Cookies() {
+		if c.Name == middleware.SessionCookie {
+			session = c
+		}
+	}
+
+	require.NotNil(t, session)
+	assert.Equal(t, "raw", session.Value)
+
+	// Replayed assertion does not increase signature counter
+	w = httptest.NewRecorder()
+	h.LoginFinish(w, loginRequest(handlers.PathLoginWebAuthnFinish, body))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestWebAuthnPasswordlessLoginRejected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a, cred := newPasskey(t)
+
+	users := mock.NewMockUsers(ctrl)
+	users.EXPECT().GetInfo("john").Return(nil, model.ErrUserNotFound)
+
+	credentials := mock.NewMockWebAuthnCredentials(ctrl)
+	credentials.EXPECT().CreateChallenge("", model.CeremonyLogin).Return("challenge", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyLogin).Return("other-user", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyLogin).Return("", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonyLogin).Return("", model.ErrChallengeInvalid)
+	credentials.EXPECT().Get(cred.ID).Return(cred, nil).Times(2)
+
+	h := handlers.NewWebAuthn(users, credentials, nil, testRP, true)
+
+	// Unknown user gets the same options as passwordless login
+	w := httptest.NewRecorder()
+	h.LoginBegin(w, loginRequest(handlers.PathLoginWebAuthnBegin, `{"username":"john"}`))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	finish := func() *httptest.ResponseRecorder {
+		resp, err := a.Get("challenge")
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		h.LoginFinish(w, loginRequest(handlers.PathLoginWebAuthnFinish, encodeJSON(t, resp)))
+
+		return w
+	}
+
+	// Challenge was issued for other user
+	assert.Equal(t, http.StatusUnauthorized, finish().Code)
+
+	// Passwordless login requires user verification
+	a.UserVerified = false
+	assert.Equal(t, http.StatusUnauthorized, finish().Code)
+
+	assert.Equal(t, http.StatusUnauthorized, finish().Code)
+}
+
+func TestWebAuthnSecondFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	a, cred := newPasskey(t)
+	a.UserVerified = false
+
+	pending := testSession()
+	pending.Pending = true
+
+	credentials := mock.NewMockWebAuthnCredentials(ctrl)
+	credentials.EXPECT().List(testUser.ID).Return([]*model.WebAuthnCredential{cred}, nil)
+	credentials.EXPECT().CreateChallenge(testUser.ID, model.CeremonySecondFactor).Return("challenge", nil)
+	credentials.EXPECT().ConsumeChallenge("challenge", model.CeremonySecondFactor).Return(testUser.ID, nil)
+	credentials.EXPECT().Get(cred.ID).Return(cred, nil)
+	credentials.EXPECT().Use(cred.ID, cred.SignCount+1).Return(nil)
+
+	sessions := mock.NewMockSessions(ctrl)
+	sessions.EXPECT().TouchPending("raw").Return(pending, nil).Times(3)
+	sessions.EXPECT().Complete("raw", "webauthn").Return(nil)
+
+	h := handlers.NewWebAuthn(nil, credentials, sessions, testRP, true)
+
+	// Session waiting for second factor is protected by its own CSRF token
+	r := pendingRequest(handlers.PathLoginWebAuthnBegin, `{}`)
+	r.Header.Set(middleware.CSRFHeader, "login-csrf")
+
+	w := httptest.NewRecorder()
+	h.LoginBegin(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	h.LoginBegin(w, pendingRequest(handlers.PathLoginWebAuthnBegin, `{}`))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var options webauthn.RequestOptions
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&options))
+	assert.Equal(t, webauthn.UserVerificationDiscouraged, options.UserVerification)
+	require.Len(t, options.AllowCredentials, 1)
+	assert.Equal(t, cred.ID, base64.RawURLEncoding.EncodeToString(options.AllowCredentials[0].ID))
+
+	resp, err := a.Get(options.Challenge)
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.LoginFinish(w, pendingRequest(handlers.PathLoginWebAuthnFinish, encodeJSON(t, resp)))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"redirect":"/login"}`, w.Body.String())
+	assert.Empty(t, w.Result().Cookies())
+}
+
+func TestWebAuthnCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	_, cred := newPasskey(t)
+
+	credentials := mock.NewMockWebAuthnCredentials(ctrl)
+	credentials.EXPECT().List(testUser.ID).Return([]*model.WebAuthnCredential{cred}, nil)
+	credentials.EXPECT().Delete(testUser.ID, cred.ID).Return(nil)
+	credentials.EXPECT().Delete(testUser.ID, cred.ID).Return(model.ErrCredentialNotFound)
+
+	h := handlers.NewWebAuthn(nil, credentials, nil, testRP, true)
+
+	w := httptest.NewRecorder()
+	h.ListCredentials(w, accountRequest(http.MethodGet, "/account/webauthn/credentials", "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var list []handlers.WebAuthnCredentialInfo
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, "Laptop", list[0].Name)
+	assert.Equal(t, webauthn.AlgorithmES256, list[0].Algorithm)
+
+	vars := map[string]string{"id": cred.ID}
+
+	w = httptest.NewRecorder()
+	h.DeleteCredential(w, accountRequest(http.MethodDelete, "/account/webauthn/credentials/"+cred.ID, "", vars))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = httptest.NewRecorder()
+	h.DeleteCredential(w, accountRequest(http.MethodDelete, "/account/webauthn/credentials/"+cred.ID, "", vars))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/lvl484/user-manager/logger"
+	. "github.com/lvl484/user-manager/server/http"
+)
+
+// Admin allows request only for users listed as administrators.
+// It must be used after one of authentication middlewares.
+type Admin struct {
+	admins map[string]bool
+}
+
+func NewAdmin(admins []string) *Admin {
+	a := &Admin{admins: make(map[string]bool, len(admins))}
+
+	for _, name := range admins {
+		a.admins[name] = true
+	}
+
+	return a
+}
+
+// IsAdmin reports whether user with username has admin rights
+func (a *Admin) IsAdmin(username string) bool {
+	return a.admins[username]
+}
+
+func (a *Admin) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok {
+			Unauthorized(w)
+			return
+		}
+
+		if !a.IsAdmin(user.Username) {
+			Forbidden(w)
+			return
+		}
+
+		logger.Component(logger.ComponentAuth).WithField("user", user.Username).Debug("Admin access granted")
+
+		handler.ServeHTTP(w, r)
+	})
+}
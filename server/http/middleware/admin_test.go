@@ -0,0 +1,50 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/middleware"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminMiddleware(t *testing.T) {
+	admin := middleware.NewAdmin([]string{"root"})
+
+	tests := []struct {
+		name string
+		user *model.User
+		code int
+	}{
+		{
+			name: "Admin",
+			user: &model.User{Username: "root"},
+			code: http.StatusOK,
+		}, {
+			name: "Not admin",
+			user: &model.User{Username: "i3odja"},
+			code: http.StatusForbidden,
+		}, {
+			name: "Not authenticated",
+			code: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tt.user != nil {
+				r = r.WithContext(middleware.WithUser(r.Context(), tt.user))
+			}
+
+			w := httptest.NewRecorder()
+
+			admin.Middleware(wrappedHandler).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
@@ -26,22 +26,41 @@ package middleware
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/lvl484/user-manager/logger"
 	"github.com/lvl484/user-manager/model"
 	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/token"
 )
 
-type UserProvider interface {
-	GetInfo(username string) (*model.User, error)
-}
+// OTPHeader carries TOTP, emailed or texted code or recovery code of user with two-factor authentication
+// enabled. It is set to "required" in response when code is missing. Request with OTPSend value asks
+// to send code by email or SMS, response has OTPSent value then.
+const (
+	OTPHeader = "X-OTP"
+	OTPSend   = "send"
+	OTPSent   = "sent"
+)
 
 type BasicAuthentication struct {
-	ur UserProvider
+	ur       UserProvider
+	factors  SecondFactorProvider
+	codes    CodeDeliveryProvider
+	attempts LoginAttemptsProvider
+	// cache skips loading user and checking password of recently verified credentials, nil disables it
+	cache CredentialCacheProvider
+}
+
+func NewBasicAuthentication(ur UserProvider, factors SecondFactorProvider, codes CodeDeliveryProvider,
+	attempts LoginAttemptsProvider) *BasicAuthentication {
+	return &BasicAuthentication{ur: ur, factors: factors, codes: codes, attempts: attempts}
 }
 
-func NewBasicAuthentication(ur UserProvider) *BasicAuthentication {
-	return &BasicAuthentication{ur: ur}
+// Cache remembers verified credentials in cache
+func (a *BasicAuthentication) Cache(cache CredentialCacheProvider) *BasicAuthentication {
+	a.cache = cache
+	return a
 }
 
 func (a *BasicAuthentication) Middleware(handler http.Handler) http.Handler {
@@ -52,25 +71,167 @@ func (a *BasicAuthentication) Middleware(handler http.Handler) http.Handler {
 			return
 		}
 
-		userFromDB, err := a.ur.GetInfo(user)
-		if err != nil {
+		ip := ClientIP(r)
+
+		// Locked or delayed login is refused before password is checked, so it can not be guessed meanwhile
+		retryAfter, err := a.attempts.Check(user, ip)
+
+		switch {
+		case err == model.ErrLoginLocked || err == model.ErrLoginThrottled:
+			logger.Component(logger.ComponentAuth).WithField("user", user).Info("Login throttled")
+			LoginThrottled(w, retryAfter)
+			return
+		case err != nil:
 			InternalServerError(w, err)
 			return
 		}
 
-		matched, err := model.ComparePassword(pass, userFromDB.Password)
+		userFromDB, ok := a.verify(w, user, pass, ip)
+		if !ok {
+			return
+		}
+
+		err = a.attempts.Reset(user)
 		if err != nil {
 			InternalServerError(w, err)
 			return
 		}
 
-		if !matched {
-			Unauthorized(w)
+		methods, ok := a.secondFactor(w, r, userFromDB)
+		if !ok {
 			return
 		}
 
-		logger.LogUM.Debugf("Authentication successful! Hello, %s", user)
+		logger.Component(logger.ComponentAuth).WithField("user", user).Debug("Authentication successful!")
+
+		// Credentials are checked with every request, so user has just authenticated
+		ctx := WithUser(r.Context(), userFromDB)
+		ctx = WithAuthContext(ctx, &AuthContext{Time: time.Now(), Methods: methods})
 
-		handler.ServeHTTP(w, r)
+		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// verify returns user whose password matches, from cache when credentials were verified recently.
+// It responds to request and returns false when credentials are wrong.
+func (a *BasicAuthentication) verify(w http.ResponseWriter, user, pass, ip string) (*model.User, bool) {
+	var gen uint64
+
+	if a.cache != nil {
+		if cached, ok := a.cache.Get(user, pass); ok {
+			return cached, true
+		}
+
+		// Password may change while it is verified, then the stale verification is not cached
+		gen = a.cache.Generation(user)
+	}
+
+	userFromDB, err := a.ur.GetInfo(user)
+
+	switch {
+	case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+		a.fail(w, user, ip)
+		return nil, false
+	case err != nil:
+		InternalServerError(w, err)
+		return nil, false
+	}
+
+	matched, err := a.ur.VerifyAndUpgrade(userFromDB, pass)
+	if err != nil {
+		HashingError(w, err)
+		return nil, false
+	}
+
+	if !matched {
+		a.fail(w, user, ip)
+		return nil, false
+	}
+
+	if a.cache != nil {
+		a.cache.Put(user, pass, userFromDB, gen)
+	}
+
+	return userFromDB, true
+}
+
+// fail counts failed login of user from ip and responds to request
+func (a *BasicAuthentication) fail(w http.ResponseWriter, user, ip string) {
+	err := a.attempts.Fail(user, ip)
+	if err != nil {
+		InternalServerError(w, err)
+		return
+	}
+
+	Unauthorized(w)
+}
+
+// secondFactor checks code from OTPHeader when user enabled two-factor authentication and returns
+// methods user authenticated with. It responds to request and returns false when code is missing or wrong.
+func (a *BasicAuthentication) secondFactor(w http.ResponseWriter, r *http.Request, user *model.User) ([]string, bool) {
+	enabled, err := a.factors.Enabled(user.ID)
+	if err != nil {
+		InternalServerError(w, err)
+		return nil, false
+	}
+
+	if !enabled {
+		return []string{token.AMRPassword}, true
+	}
+
+	code := r.Header.Get(OTPHeader)
+	if code == "" {
+		w.Header().Set(OTPHeader, "required")
+		Unauthorized(w)
+		return nil, false
+	}
+
+	if code == OTPSend {
+		a.sendCode(w, r, user)
+		return nil, false
+	}
+
+	err = a.factors.Verify(user.ID, code)
+
+	// User with WebAuthn credentials only can not pass second factor with a code
+	switch {
+	case err == model.ErrTwoFactorCodeInvalid || err == model.ErrTwoFactorLocked || err == model.ErrTwoFactorNotEnrolled:
+		logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("Second factor failed")
+		w.Header().Set(OTPHeader, "required")
+		Unauthorized(w)
+		return nil, false
+	case err != nil:
+		InternalServerError(w, err)
+		return nil, false
+	}
+
+	return []string{token.AMRPassword, token.AMROTP}, true
+}
+
+// sendCode sends code of user with email or SMS channel, request is retried with the code then.
+// Code sent recently is not sent again, user is told to use it.
+func (a *BasicAuthentication) sendCode(w http.ResponseWriter, r *http.Request, user *model.User) {
+	d, err := a.factors.IssueOTP(user.ID)
+
+	switch {
+	case err == model.ErrOTPTooSoon:
+	case err == model.ErrTwoFactorNotEnrolled || err == model.ErrTwoFactorLocked:
+		w.Header().Set(OTPHeader, "required")
+		Unauthorized(w)
+		return
+	case err != nil:
+		InternalServerError(w, err)
+		return
+	default:
+		err = a.codes.Send(r.Context(), d.Channel, d.Destination, d.Code)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		logger.Component(logger.ComponentAuth).WithField("user", user.Username).Info("One-time code sent")
+	}
+
+	w.Header().Set(OTPHeader, OTPSent)
+	Unauthorized(w)
+}
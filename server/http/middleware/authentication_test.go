@@ -9,9 +9,11 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/lvl484/user-manager/mock"
 	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/lvl484/user-manager/logger"
@@ -33,11 +35,17 @@ func TestBasicAuthenticationMiddlewareValidPass(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
 	mock := mock.NewMockUserProvider(ctrl)
 
-	mock.EXPECT().GetInfo("i3odja").Return(userInfo, nil)
+	attempts.EXPECT().Check("i3odja", gomock.Any()).Return(time.Duration(0), nil).Times(2)
+	attempts.EXPECT().Reset("i3odja").Return(nil).Times(2)
+	mock.EXPECT().GetInfo("i3odja").Return(userInfo, nil).Times(2)
+	mock.EXPECT().VerifyAndUpgrade(userInfo, "1q2w3e4r").Return(true, nil).Times(2)
+	factors.EXPECT().Enabled(userInfo.ID).Return(false, nil).Times(2)
 
-	ba := middleware.NewBasicAuthentication(mock)
+	ba := middleware.NewBasicAuthentication(mock, factors, nil, attempts)
 
 	r, err := http.NewRequest("GET", "/summer", nil)
 	require.NoError(t, err)
@@ -49,6 +57,75 @@ func TestBasicAuthenticationMiddlewareValidPass(t *testing.T) {
 	ba.Middleware(wrappedHandler).ServeHTTP(w, r)
 
 	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Password alone is recent, but not multi-factor authentication
+	w = httptest.NewRecorder()
+
+	ba.Middleware(middleware.NewStepUp(time.Minute, token.ACRMultiFactor).Middleware(wrappedHandler)).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+}
+
+func TestBasicAuthenticationMiddlewareCache(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
+	users := mock.NewMockUserProvider(ctrl)
+
+	cache, err := model.NewCredentialCache(time.Minute, 10)
+	require.NoError(t, err)
+
+	// User is loaded and password is checked once, wrong password is not served from cache
+	attempts.EXPECT().Check("i3odja", gomock.Any()).Return(time.Duration(0), nil).Times(3)
+	attempts.EXPECT().Reset("i3odja").Return(nil).Times(2)
+	attempts.EXPECT().Fail("i3odja", gomock.Any()).Return(nil)
+	users.EXPECT().GetInfo("i3odja").Return(userInfo, nil).Times(2)
+	users.EXPECT().VerifyAndUpgrade(userInfo, "1q2w3e4r").Return(true, nil)
+	users.EXPECT().VerifyAndUpgrade(userInfo, "wrong").Return(false, nil)
+	factors.EXPECT().Enabled(userInfo.ID).Return(false, nil).Times(2)
+
+	ba := middleware.NewBasicAuthentication(users, factors, nil, attempts).Cache(cache)
+
+	for _, tt := range []struct {
+		pass string
+		code int
+	}{{"1q2w3e4r", http.StatusOK}, {"1q2w3e4r", http.StatusOK}, {"wrong", http.StatusUnauthorized}} {
+		r := httptest.NewRequest(http.MethodGet, "/summer", nil)
+		r.SetBasicAuth("i3odja", tt.pass)
+
+		w := httptest.NewRecorder()
+		ba.Middleware(wrappedHandler).ServeHTTP(w, r)
+
+		assert.Equal(t, tt.code, w.Code)
+	}
+}
+
+func TestBasicAuthenticationMiddlewareHashingBusy(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
+	users := mock.NewMockUserProvider(ctrl)
+
+	// Password which could not be checked is neither accepted nor counted as failed login
+	attempts.EXPECT().Check("i3odja", gomock.Any()).Return(time.Duration(0), nil)
+	users.EXPECT().GetInfo("i3odja").Return(userInfo, nil)
+	users.EXPECT().VerifyAndUpgrade(userInfo, "1q2w3e4r").Return(false, model.ErrHashingBusy)
+
+	r := httptest.NewRequest(http.MethodGet, "/summer", nil)
+	r.SetBasicAuth("i3odja", "1q2w3e4r")
+
+	w := httptest.NewRecorder()
+	middleware.NewBasicAuthentication(users, factors, nil, attempts).Middleware(wrappedHandler).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
 }
 
 func TestBasicAuthenticationMiddlewareInvalidPass(t *testing.T) {
@@ -56,11 +133,16 @@ func TestBasicAuthenticationMiddlewareInvalidPass(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
 	mock := mock.NewMockUserProvider(ctrl)
 
+	attempts.EXPECT().Check("i3odja", gomock.Any()).Return(time.Duration(0), nil)
+	attempts.EXPECT().Fail("i3odja", gomock.Any()).Return(nil)
 	mock.EXPECT().GetInfo("i3odja").Return(userInfo, nil)
+	mock.EXPECT().VerifyAndUpgrade(userInfo, "123123").Return(false, nil)
 
-	ba := middleware.NewBasicAuthentication(mock)
+	ba := middleware.NewBasicAuthentication(mock, factors, nil, attempts)
 
 	r, err := http.NewRequest("GET", "/summer", nil)
 	require.NoError(t, err)
@@ -79,11 +161,14 @@ func TestBasicAuthenticationMiddlewareError(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
 	mock := mock.NewMockUserProvider(ctrl)
 
+	attempts.EXPECT().Check("i3odja", gomock.Any()).Return(time.Duration(0), nil)
 	mock.EXPECT().GetInfo("i3odja").Return(nil, errors.New("middleware error"))
 
-	ba := middleware.NewBasicAuthentication(mock)
+	ba := middleware.NewBasicAuthentication(mock, factors, nil, attempts)
 
 	r, err := http.NewRequest("GET", "/summer", nil)
 	require.NoError(t, err)
@@ -102,9 +187,11 @@ func TestBasicAuthenticationMiddlewareResponseInvalid(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
 	mock := mock.NewMockUserProvider(ctrl)
 
-	ba := middleware.NewBasicAuthentication(mock)
+	ba := middleware.NewBasicAuthentication(mock, factors, nil, attempts)
 
 	r, err := http.NewRequest("GET", "/summer", nil)
 	require.NoError(t, err)
@@ -116,6 +203,106 @@ func TestBasicAuthenticationMiddlewareResponseInvalid(t *testing.T) {
 	checkErrorResponse(t, w, http.StatusUnauthorized)
 }
 
+func TestBasicAuthenticationMiddlewareSecondFactor(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
+	mock := mock.NewMockUserProvider(ctrl)
+
+	attempts.EXPECT().Check("i3odja", gomock.Any()).Return(time.Duration(0), nil).Times(4)
+	attempts.EXPECT().Reset("i3odja").Return(nil).Times(4)
+	mock.EXPECT().GetInfo("i3odja").Return(userInfo, nil).Times(4)
+	mock.EXPECT().VerifyAndUpgrade(userInfo, "1q2w3e4r").Return(true, nil).Times(4)
+	factors.EXPECT().Enabled(userInfo.ID).Return(true, nil).Times(4)
+	factors.EXPECT().Verify(userInfo.ID, "000000").Return(model.ErrTwoFactorCodeInvalid)
+	factors.EXPECT().Verify(userInfo.ID, "111111").Return(model.ErrTwoFactorNotEnrolled)
+	factors.EXPECT().Verify(userInfo.ID, "123456").Return(nil)
+
+	ba := middleware.NewBasicAuthentication(mock, factors, nil, attempts)
+	// Password with code is multi-factor authentication
+	mfa := middleware.NewStepUp(time.Minute, token.ACRMultiFactor).Middleware(wrappedHandler)
+
+	request := func(code string) *httptest.ResponseRecorder {
+		r, err := http.NewRequest("GET", "/summer", nil)
+		require.NoError(t, err)
+
+		r.SetBasicAuth("i3odja", "1q2w3e4r")
+
+		if code != "" {
+			r.Header.Set(middleware.OTPHeader, code)
+		}
+
+		w := httptest.NewRecorder()
+		ba.Middleware(mfa).ServeHTTP(w, r)
+
+		return w
+	}
+
+	w := request("")
+	checkErrorResponse(t, w, http.StatusUnauthorized)
+	assert.Equal(t, "required", w.Header().Get(middleware.OTPHeader))
+
+	w = request("000000")
+	checkErrorResponse(t, w, http.StatusUnauthorized)
+
+	// User with WebAuthn credentials only has no code to send
+	w = request("111111")
+	checkErrorResponse(t, w, http.StatusUnauthorized)
+
+	w = request("123456")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestBasicAuthenticationMiddlewareUnknownUser(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	factors := mock.NewMockSecondFactorProvider(ctrl)
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
+	mock := mock.NewMockUserProvider(ctrl)
+
+	// Unknown user name is counted like wrong password, so it does not differ from existing user
+	attempts.EXPECT().Check("nobody", "192.0.2.1").Return(time.Duration(0), nil)
+	attempts.EXPECT().Fail("nobody", "192.0.2.1").Return(nil)
+	mock.EXPECT().GetInfo("nobody").Return(nil, model.ErrUserNotFound)
+
+	r := httptest.NewRequest("GET", "/summer", nil)
+	r.SetBasicAuth("nobody", "123123")
+
+	w := httptest.NewRecorder()
+
+	middleware.NewBasicAuthentication(mock, factors, nil, attempts).Middleware(wrappedHandler).ServeHTTP(w, r)
+
+	checkErrorResponse(t, w, http.StatusUnauthorized)
+}
+
+func TestBasicAuthenticationMiddlewareLocked(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	attempts := mock.NewMockLoginAttemptsProvider(ctrl)
+	attempts.EXPECT().Check("i3odja", "192.0.2.1").Return(90*time.Second+time.Millisecond, model.ErrLoginLocked)
+
+	// Password is not checked while login is locked
+	ba := middleware.NewBasicAuthentication(mock.NewMockUserProvider(ctrl), mock.NewMockSecondFactorProvider(ctrl),
+		nil, attempts)
+
+	r := httptest.NewRequest("GET", "/summer", nil)
+	r.SetBasicAuth("i3odja", "1q2w3e4r")
+
+	w := httptest.NewRecorder()
+
+	ba.Middleware(wrappedHandler).ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "91", w.Header().Get("Retry-After"))
+}
+
 var wrappedHandler http.Handler = http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 	writer.WriteHeader(http.StatusOK)
 })
@@ -138,7 +325,7 @@ func checkErrorResponse(t *testing.T, w *httptest.ResponseRecorder, expectedCode
 var userInfo = &model.User{
 	ID:        "123e4567-e89b-12d3-a456-426655440000",
 	Username:  "i3odja",
-	Password:  "$argon2id$v=19$m=65536,t=3,p=1$Ga9X4EvymyOzUoz+uVMy6w$y5sQVQ",
+	Password:  "$argon2id$v=19$m=65536,t=3,p=1$lkSivcrDeHZ/BmZ5I8CVnw$hqqBQy88as3tDhu3xlDd0g",
 	Email:     "qwerty@gmail.com",
 	FirstName: "UserF",
 	LastName:  "UserL",
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/token"
+)
+
+const bearerPrefix = "bearer "
+
+type TokenValidator interface {
+	Validate(token string) (*token.Claims, error)
+	FirstParty(c *token.Claims) bool
+}
+
+// BearerAuthentication authenticates requests by access tokens issued by the service.
+// Tokens issued to OAuth clients are rejected unless they are allowed with OAuth.
+type BearerAuthentication struct {
+	tv      TokenValidator
+	revoked RevokedTokenProvider
+	users   UserProvider
+	clients ClientProvider
+	oauth   bool
+}
+
+func NewBearerAuthentication(tv TokenValidator, revoked RevokedTokenProvider, users UserProvider,
+	clients ClientProvider) *BearerAuthentication {
+	return &BearerAuthentication{
+		tv:      tv,
+		revoked: revoked,
+		users:   users,
+		clients: clients,
+	}
+}
+
+// OAuth accepts also tokens issued by OAuth grants, it is meant for OAuth resources like user info endpoint
+func (a *BearerAuthentication) OAuth() *BearerAuthentication {
+	a.oauth = true
+	return a
+}
+
+func (a *BearerAuthentication) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := BearerToken(r)
+		if !ok {
+			InvalidToken(w)
+			return
+		}
+
+		claims, err := a.tv.Validate(raw)
+		if err != nil {
+			logger.Component(logger.ComponentAuth).Debugf("Token rejected: %v", err)
+			InvalidToken(w)
+			return
+		}
+
+		// Token granted to OAuth client must not act as the user on account and admin APIs
+		if !a.oauth && !a.tv.FirstParty(claims) {
+			logger.Component(logger.ComponentAuth).WithField("client", claims.ClientID).
+				Debug("Token of OAuth client rejected")
+			InvalidToken(w)
+			return
+		}
+
+		active, err := ActiveClaims(claims, a.revoked, a.users, a.clients)
+		if err != nil {
+			InternalServerError(w, err)
+			return
+		}
+
+		if !active {
+			logger.Component(logger.ComponentAuth).WithField("user", claims.Username).
+				Debug("Token was revoked or its subject lost access")
+			InvalidToken(w)
+			return
+		}
+
+		logger.Component(logger.ComponentAuth).WithField("user", claims.Username).Debug("Token authentication successful!")
+
+		ctx := WithClaims(r.Context(), claims)
+		ctx = WithUser(ctx, &model.User{ID: claims.Subject, Username: claims.Username})
+		ctx = WithAuthContext(ctx, claimsAuthContext(claims))
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ActiveClaims reports whether valid token was not revoked and its user or client has not lost access
+// after it was issued: user was not disabled, deleted or replaced by other user with the same login,
+// and client was not deleted
+func ActiveClaims(claims *token.Claims, revoked RevokedTokenProvider, users UserProvider,
+	clients ClientProvider) (bool, error) {
+	isRevoked, err := revoked.IsRevoked(claims.ID)
+	if err != nil || isRevoked {
+		return false, err
+	}
+
+	if claims.Username != "" {
+		user, err := users.GetInfo(claims.Username)
+
+		switch {
+		case err == model.ErrUserNotFound || err == model.ErrUserDisabled:
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+
+		return user.ID == claims.Subject, nil
+	}
+
+	_, err = clients.Get(claims.ClientID)
+
+	switch {
+	case err == model.ErrClientNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	return true, nil
+}
+
+// claimsAuthContext returns authentication context of user recorded in access token
+func claimsAuthContext(claims *token.Claims) *AuthContext {
+	auth := &AuthContext{Methods: claims.AMR}
+
+	if claims.AuthTime != 0 {
+		auth.Time = time.Unix(claims.AuthTime, 0)
+	}
+
+	return auth
+}
+
+// BearerToken returns token from Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+
+	return strings.TrimSpace(header[len(bearerPrefix):]), true
+}
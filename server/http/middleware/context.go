@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/token"
+)
+
+type contextKey string
+
+const (
+	userContextKey    contextKey = "user"
+	claimsContextKey  contextKey = "claims"
+	sessionContextKey contextKey = "session"
+	authContextKey    contextKey = "auth"
+)
+
+// AuthContext is when and how user of request authenticated
+type AuthContext struct {
+	// Time is zero when it is not known, e.g. for access token issued without user authentication
+	Time time.Time
+	// Methods are authentication methods, see token.AMRPassword and others
+	Methods []string
+}
+
+// ACR returns authentication context class reached with methods
+func (a *AuthContext) ACR() string {
+	return token.ACR(a.Methods)
+}
+
+// WithUser returns copy of ctx with authenticated user
+func WithUser(ctx context.Context, user *model.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFromContext returns user authenticated by one of middlewares
+func UserFromContext(ctx context.Context) (*model.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*model.User)
+	return user, ok
+}
+
+// WithClaims returns copy of ctx with claims of validated access token
+func WithClaims(ctx context.Context, claims *token.Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey, claims)
+}
+
+// ClaimsFromContext returns claims of access token the request was authenticated with
+func ClaimsFromContext(ctx context.Context) (*token.Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*token.Claims)
+	return claims, ok
+}
+
+// WithSession returns copy of ctx with browser session the request was authenticated with
+func WithSession(ctx context.Context, session *model.Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey, session)
+}
+
+// SessionFromContext returns browser session the request was authenticated with
+func SessionFromContext(ctx context.Context) (*model.Session, bool) {
+	session, ok := ctx.Value(sessionContextKey).(*model.Session)
+	return session, ok
+}
+
+// WithAuthContext returns copy of ctx with authentication context of user
+func WithAuthContext(ctx context.Context, auth *AuthContext) context.Context {
+	return context.WithValue(ctx, authContextKey, auth)
+}
+
+// AuthContextFromContext returns when and how user of request authenticated
+func AuthContextFromContext(ctx context.Context) (*AuthContext, bool) {
+	auth, ok := ctx.Value(authContextKey).(*AuthContext)
+	return auth, ok
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/ratelimit"
+)
+
+// UserProvider finds users and verifies their passwords
+type UserProvider interface {
+	GetInfo(username string) (*model.User, error)
+	VerifyAndUpgrade(user *model.User, password string) (bool, error)
+}
+
+// RevokedTokenProvider tells whether access token was revoked before expiry
+type RevokedTokenProvider interface {
+	IsRevoked(id string) (bool, error)
+}
+
+// ClientProvider finds OAuth clients
+type ClientProvider interface {
+	Get(id string) (*model.Client, error)
+}
+
+// SessionProvider finds active browser sessions
+type SessionProvider interface {
+	Touch(raw string) (*model.Session, error)
+}
+
+// SecondFactorProvider verifies second factor of users who enabled it
+type SecondFactorProvider interface {
+	Enabled(userID string) (bool, error)
+	Verify(userID, code string) error
+	IssueOTP(userID string) (*model.OTPDelivery, error)
+}
+
+// LoginAttemptsProvider counts failed logins of users and IP addresses and tells when login is not allowed
+type LoginAttemptsProvider interface {
+	Check(login, ip string) (time.Duration, error)
+	Fail(login, ip string) error
+	Reset(login string) error
+}
+
+// CredentialCacheProvider remembers recently verified credentials
+type CredentialCacheProvider interface {
+	Generation(login string) uint64
+	Get(login, password string) (*model.User, bool)
+	Put(login, password string, user *model.User, gen uint64)
+}
+
+// CodeDeliveryProvider delivers one-time codes by email or SMS
+type CodeDeliveryProvider interface {
+	Send(ctx context.Context, channel, to, code string) error
+}
+
+// RateLimiterProvider counts requests in token buckets
+type RateLimiterProvider interface {
+	Allow(key string, rate ratelimit.Rate) (*ratelimit.Result, error)
+}
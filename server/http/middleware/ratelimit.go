@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/ratelimit"
+	. "github.com/lvl484/user-manager/server/http"
+)
+
+// KeyFunc returns key requests are counted by
+type KeyFunc func(r *http.Request) string
+
+// ByIP counts requests by address of the client
+func ByIP(r *http.Request) string {
+	return "ip:" + ClientIP(r)
+}
+
+// ByUser counts requests by authenticated user, or by address when request is not authenticated.
+// It must be used after one of authentication middlewares.
+func ByUser(r *http.Request) string {
+	if user, ok := UserFromContext(r.Context()); ok {
+		return "user:" + user.ID
+	}
+
+	return ByIP(r)
+}
+
+// ByAPIKey counts requests by client id OAuth client authenticates with, or by address when there is none.
+// Client id is not verified yet, so it should be combined with a limit by address.
+func ByAPIKey(r *http.Request) string {
+	if id, _, ok := r.BasicAuth(); ok && id != "" {
+		return "client:" + id
+	}
+
+	if id := r.PostFormValue("client_id"); id != "" {
+		return "client:" + id
+	}
+
+	return ByIP(r)
+}
+
+// RateLimitPolicy limits requests counted by Key to Rate
+type RateLimitPolicy struct {
+	// Name separates buckets of policies which count requests by the same key
+	Name string
+	Rate ratelimit.Rate
+	Key  KeyFunc
+	// Methods are methods of counted requests, all requests are counted when it is empty
+	Methods []string
+}
+
+func (p *RateLimitPolicy) counts(r *http.Request) bool {
+	if p.Rate.Unlimited() {
+		return false
+	}
+
+	if len(p.Methods) == 0 {
+		return true
+	}
+
+	for _, m := range p.Methods {
+		if m == r.Method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RateLimit rejects requests over limits of its policies with 429 Too Many Requests and Retry-After.
+// RateLimit-* headers (draft-ietf-httpapi-ratelimit-headers) describe the policy closest to its limit.
+// Requests are allowed when limiter fails, so an unavailable store does not take the service down.
+type RateLimit struct {
+	limiter  RateLimiterProvider
+	policies []RateLimitPolicy
+}
+
+func NewRateLimit(limiter RateLimiterProvider, policies ...RateLimitPolicy) *RateLimit {
+	return &RateLimit{limiter: limiter, policies: policies}
+}
+
+func (rl *RateLimit) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := range rl.policies {
+			p := &rl.policies[i]
+			if !p.counts(r) {
+				continue
+			}
+
+			key := p.Key(r)
+
+			res, err := rl.limiter.Allow(p.Name+":"+key, p.Rate)
+			if err != nil {
+				logger.Component(logger.ComponentHTTP).Errorf("Rate limit check failed: %v", err)
+				continue
+			}
+
+			setRateLimitHeaders(w, p, res)
+
+			if !res.Allowed {
+				logger.Component(logger.ComponentHTTP).WithField("policy", p.Name).WithField("key", key).
+					Info("Request is over rate limit")
+
+				TooManyRequests(w, res.RetryAfter)
+
+				return
+			}
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// setRateLimitHeaders describes result of policy unless earlier policy has fewer requests left
+func setRateLimitHeaders(w http.ResponseWriter, p *RateLimitPolicy, res *ratelimit.Result) {
+	h := w.Header()
+
+	if prev, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && prev <= res.Remaining && res.Allowed {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Rate.Limit, seconds(p.Rate.Period)))
+}
+
+// seconds returns d rounded up to whole seconds
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,133 @@
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/ratelimit"
+	"github.com/lvl484/user-manager/server/http/middleware"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	rl := middleware.NewRateLimit(limiter, middleware.RateLimitPolicy{
+		Name: "login",
+		Rate: ratelimit.Rate{Limit: 2, Period: time.Minute},
+		Key:  middleware.ByIP,
+	})
+
+	handler := rl.Middleware(wrappedHandler)
+
+	for i, remaining := range []string{"1", "0"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code, i)
+		assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, remaining, w.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "2;w=60", w.Header().Get("RateLimit-Policy"))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+
+	checkErrorResponse(t, w, http.StatusTooManyRequests)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Other clients have their own limit
+	r := httptest.NewRequest(http.MethodPost, "/login", nil)
+	r.RemoteAddr = "192.0.2.2:1234"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitMiddlewarePolicies(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore())
+	rl := middleware.NewRateLimit(limiter, middleware.RateLimitPolicy{
+		Name:    "read",
+		Rate:    ratelimit.Rate{Limit: 100, Period: time.Minute},
+		Key:     middleware.ByUser,
+		Methods: []string{http.MethodGet},
+	}, middleware.RateLimitPolicy{
+		Name:    "write",
+		Rate:    ratelimit.Rate{Limit: 1, Period: time.Minute},
+		Key:     middleware.ByUser,
+		Methods: []string{http.MethodPost, http.MethodDelete},
+	})
+
+	handler := rl.Middleware(wrappedHandler)
+	user := &model.User{ID: "1", Username: "i3odja"}
+
+	request := func(method string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/account/sessions", nil)
+		r = r.WithContext(middleware.WithUser(r.Context(), user))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request(http.MethodDelete).Code)
+	assert.Equal(t, http.StatusTooManyRequests, request(http.MethodDelete).Code)
+
+	// Reads are counted separately and more leniently
+	w := request(http.MethodGet)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "99", w.Header().Get("RateLimit-Remaining"))
+
+	// Methods which are not listed are not counted
+	w = request(http.MethodPut)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Remaining"))
+}
+
+func TestRateLimitMiddlewareError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	limiter := mock.NewMockRateLimiterProvider(ctrl)
+	limiter.EXPECT().Allow("login:ip:192.0.2.1", gomock.Any()).Return(nil, errors.New("store error"))
+
+	rl := middleware.NewRateLimit(limiter, middleware.RateLimitPolicy{
+		Name: "login",
+		Rate: ratelimit.Rate{Limit: 10, Period: time.Minute},
+		Key:  middleware.ByIP,
+	})
+
+	w := httptest.NewRecorder()
+	rl.Middleware(wrappedHandler).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", nil))
+
+	// Unavailable store does not reject requests
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader("client_id=cli"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	assert.Equal(t, "ip:192.0.2.1", middleware.ByIP(r))
+	assert.Equal(t, "ip:192.0.2.1", middleware.ByUser(r))
+	assert.Equal(t, "client:cli", middleware.ByAPIKey(r))
+
+	r.SetBasicAuth("app", "secret")
+	assert.Equal(t, "client:app", middleware.ByAPIKey(r))
+
+	r = r.WithContext(middleware.WithUser(r.Context(), &model.User{ID: "1"}))
+	assert.Equal(t, "user:1", middleware.ByUser(r))
+
+	assert.Equal(t, "ip:192.0.2.1", middleware.ByAPIKey(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Authentication selects middleware by scheme of Authorization header,
+// so Basic credentials and Bearer tokens are accepted on the same routes
+type Authentication struct {
+	schemes  map[string]mux.MiddlewareFunc
+	fallback mux.MiddlewareFunc
+}
+
+// NewAuthentication returns Authentication, which uses fallback for unknown or missing scheme
+func NewAuthentication(fallback mux.MiddlewareFunc) *Authentication {
+	return &Authentication{
+		schemes:  make(map[string]mux.MiddlewareFunc),
+		fallback: fallback,
+	}
+}
+
+// Scheme registers middleware for authentication scheme
+func (a *Authentication) Scheme(name string, mw mux.MiddlewareFunc) *Authentication {
+	a.schemes[strings.ToLower(name)] = mw
+	return a
+}
+
+func (a *Authentication) Middleware(handler http.Handler) http.Handler {
+	fallback := a.fallback(handler)
+
+	wrapped := make(map[string]http.Handler, len(a.schemes))
+	for name, mw := range a.schemes {
+		wrapped[name] = mw(handler)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := strings.ToLower(strings.SplitN(r.Header.Get("Authorization"), " ", 2)[0])
+
+		if h, ok := wrapped[scheme]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		fallback.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	"github.com/lvl484/user-manager/model"
+	. "github.com/lvl484/user-manager/server/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// SessionCookie is name of cookie with session token set by login page
+	SessionCookie = "um_session"
+	// CSRFField is form field and CSRFHeader is header with CSRF token of the session
+	CSRFField  = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+	// ReturnToParam is parameter of login page with path to return to after login
+	ReturnToParam = "return_to"
+)
+
+// SessionAuthentication authenticates browser requests by session cookie set by hosted login page.
+// Requests without valid session are passed to fallback, except page requests of browsers,
+// which are redirected to login page instead of getting Basic authentication prompt.
+type SessionAuthentication struct {
+	sessions  SessionProvider
+	fallback  mux.MiddlewareFunc
+	loginPath string
+}
+
+func NewSessionAuthentication(sessions SessionProvider, fallback mux.MiddlewareFunc, loginPath string) *SessionAuthentication {
+	return &SessionAuthentication{sessions: sessions, fallback: fallback, loginPath: loginPath}
+}
+
+func (a *SessionAuthentication) Middleware(handler http.Handler) http.Handler {
+	fallback := a.fallback(handler)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, ok := SessionToken(r)
+		if !ok {
+			a.unauthenticated(fallback, w, r)
+			return
+		}
+
+		session, err := a.sessions.Touch(raw)
+
+		switch {
+		case err == model.ErrSessionInvalid:
+			logger.Component(logger.ComponentAuth).Debug("Session is expired or invalid")
+			a.unauthenticated(fallback, w, r)
+			return
+		case err != nil:
+			InternalServerError(w, err)
+			return
+		}
+
+		// Browser sends cookie with requests initiated by other sites, so state changing requests
+		// must prove they come from a page of the session
+		if !safeMethod(r.Method) && !ValidCSRF(r, session.CSRFToken) {
+			logger.Component(logger.ComponentAuth).WithField("user", session.Username).Warn("CSRF token mismatch")
+			Forbidden(w)
+			return
+		}
+
+		logger.Component(logger.ComponentAuth).WithField("user", session.Username).Debug("Session authentication successful!")
+
+		ctx := WithSession(r.Context(), session)
+		ctx = WithUser(ctx, &model.User{ID: session.UserID, Username: session.Username})
+		ctx = WithAuthContext(ctx, &AuthContext{Time: session.AuthTime, Methods: session.AMR})
+
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// unauthenticated redirects browser to login page or passes request to fallback
+func (a *SessionAuthentication) unauthenticated(fallback http.Handler, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		fallback.ServeHTTP(w, r)
+		return
+	}
+
+	http.Redirect(w, r, a.loginPath+"?"+url.Values{ReturnToParam: {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+}
+
+// SessionToken returns token from session cookie
+func SessionToken(r *http.Request) (string, bool) {
+	c, err := r.Cookie(SessionCookie)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+
+	return c.Value, true
+}
+
+// SetSessionCookie sends session token to browser. Cookie is not readable by scripts and is not sent
+// with requests from other sites, except top level navigation needed by OAuth redirects.
+func SetSessionCookie(w http.ResponseWriter, raw string, expiresAt time.Time, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    raw,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearSessionCookie removes session cookie from browser. Expired cookie does not need Secure attribute,
+// secure origins may overwrite secure cookies with it.
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ValidCSRF reports whether request carries expected CSRF token in form field or header
+func ValidCSRF(r *http.Request, expected string) bool {
+	got := r.Header.Get(CSRFHeader)
+	if got == "" {
+		got = r.PostFormValue(CSRFField)
+	}
+
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(expected)) == 1
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,125 @@
+package middleware_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/mock"
+	"github.com/lvl484/user-manager/model"
+	"github.com/lvl484/user-manager/server/http/middleware"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSession = &model.Session{
+	ID:        "5c1f0a52-7d0e-4cf1-b3a1-3f4d0f6c2a10",
+	UserID:    userInfo.ID,
+	Username:  userInfo.Username,
+	CSRFToken: "csrf",
+	ExpiresAt: time.Now().Add(time.Hour),
+	AuthTime:  time.Now(),
+	AMR:       []string{"pwd"},
+}
+
+// fallbackHandler marks requests passed to fallback middleware
+func fallbackHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+}
+
+func sessionRequest(method, body string) *http.Request {
+	r := httptest.NewRequest(method, "/oauth/authorize?client_id=spa", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: middleware.SessionCookie, Value: "raw"})
+
+	return r
+}
+
+func TestSessionAuthenticationMiddleware(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessionProvider(ctrl)
+	sessions.EXPECT().Touch("raw").Return(testSession, nil).Times(4)
+
+	var user *model.User
+
+	handler := middleware.NewSessionAuthentication(sessions, fallbackHandler, "/login").Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ = middleware.UserFromContext(r.Context())
+			_, ok := middleware.SessionFromContext(r.Context())
+			assert.True(t, ok)
+			auth, ok := middleware.AuthContextFromContext(r.Context())
+			require.True(t, ok)
+			assert.Equal(t, testSession.AMR, auth.Methods)
+		}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(http.MethodGet, ""))
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, user)
+	assert.Equal(t, userInfo.Username, user.Username)
+
+	// Forms must carry CSRF token of the session
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(http.MethodPost, url.Values{"csrf_token": {"csrf"}}.Encode()))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	r := sessionRequest(http.MethodPost, "")
+	r.Header.Set(middleware.CSRFHeader, "csrf")
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(http.MethodPost, url.Values{"csrf_token": {"other"}}.Encode()))
+	checkErrorResponse(t, w, http.StatusForbidden)
+}
+
+func TestSessionAuthenticationMiddlewareUnauthenticated(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sessions := mock.NewMockSessionProvider(ctrl)
+	sessions.EXPECT().Touch("raw").Return(nil, model.ErrSessionInvalid).Times(2)
+	sessions.EXPECT().Touch("raw").Return(nil, errors.New("connection refused"))
+
+	handler := middleware.NewSessionAuthentication(sessions, fallbackHandler, "/login").Middleware(wrappedHandler)
+
+	// Browser is sent to login page and back
+	r := sessionRequest(http.MethodGet, "")
+	r.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusFound, w.Code)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/login", location.Path)
+	assert.Equal(t, "/oauth/authorize?client_id=spa", location.Query().Get(middleware.ReturnToParam))
+
+	// API clients get response of fallback
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(http.MethodGet, ""))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/uuid", nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, sessionRequest(http.MethodGet, ""))
+	checkErrorResponse(t, w, http.StatusInternalServerError)
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+	. "github.com/lvl484/user-manager/server/http"
+	"github.com/lvl484/user-manager/token"
+)
+
+// StepUp allows request only when user authenticated recently enough and with strong enough methods,
+// other requests get challenge to authenticate again. It must be used after one of authentication middlewares.
+type StepUp struct {
+	// maxAge is how long ago user may have authenticated, 0 means any time
+	maxAge time.Duration
+	// acr is required authentication context class, empty means any
+	acr string
+}
+
+func NewStepUp(maxAge time.Duration, acr string) *StepUp {
+	return &StepUp{maxAge: maxAge, acr: acr}
+}
+
+// Satisfied reports whether authentication context meets requirements at now
+func (s *StepUp) Satisfied(auth *AuthContext, now time.Time) bool {
+	if s.maxAge > 0 && !token.AuthenticatedWithin(auth.Time, s.maxAge, now) {
+		return false
+	}
+
+	return token.SatisfiesACR(auth.ACR(), s.acr)
+}
+
+func (s *StepUp) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth, ok := AuthContextFromContext(r.Context())
+		if !ok || !s.Satisfied(auth, time.Now()) {
+			if user, ok := UserFromContext(r.Context()); ok {
+				logger.Component(logger.ComponentAuth).WithField("user", user.Username).Debug("Step-up authentication required")
+			}
+
+			InsufficientUserAuthentication(w, s.acr, s.maxAge)
+
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
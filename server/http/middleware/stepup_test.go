@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lvl484/user-manager/server/http/middleware"
+	"github.com/lvl484/user-manager/token"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStepUpMiddleware(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		stepUp    *middleware.StepUp
+		auth      *middleware.AuthContext
+		code      int
+		challenge string
+	}{
+		{
+			name:   "Recent login",
+			stepUp: middleware.NewStepUp(10*time.Minute, ""),
+			auth:   &middleware.AuthContext{Time: now.Add(-time.Minute), Methods: []string{token.AMRPassword}},
+			code:   http.StatusOK,
+		}, {
+			name:   "Old login",
+			stepUp: middleware.NewStepUp(10*time.Minute, ""),
+			auth:   &middleware.AuthContext{Time: now.Add(-time.Hour), Methods: []string{token.AMRPassword}},
+			code:   http.StatusUnauthorized,
+			challenge: `Bearer realm="user-manager", error="insufficient_user_authentication", ` +
+				`max_age=600`,
+		}, {
+			name:   "Unknown login time",
+			stepUp: middleware.NewStepUp(10*time.Minute, ""),
+			auth:   &middleware.AuthContext{},
+			code:   http.StatusUnauthorized,
+			challenge: `Bearer realm="user-manager", error="insufficient_user_authentication", ` +
+				`max_age=600`,
+		}, {
+			name:   "Second factor",
+			stepUp: middleware.NewStepUp(10*time.Minute, token.ACRMultiFactor),
+			auth:   &middleware.AuthContext{Time: now, Methods: []string{token.AMRPassword, token.AMROTP}},
+			code:   http.StatusOK,
+		}, {
+			name:   "Password only",
+			stepUp: middleware.NewStepUp(10*time.Minute, token.ACRMultiFactor),
+			auth:   &middleware.AuthContext{Time: now, Methods: []string{token.AMRPassword}},
+			code:   http.StatusUnauthorized,
+			challenge: `Bearer realm="user-manager", error="insufficient_user_authentication", ` +
+				`acr_values="urn:user-manager:acr:mfa", max_age=600`,
+		}, {
+			name:   "Any time with passkey",
+			stepUp: middleware.NewStepUp(0, token.ACRMultiFactor),
+			auth:   &middleware.AuthContext{Time: now.Add(-24 * time.Hour), Methods: []string{token.AMRWebAuthn}},
+			code:   http.StatusOK,
+		}, {
+			name:   "Not authenticated",
+			stepUp: middleware.NewStepUp(10*time.Minute, ""),
+			code:   http.StatusUnauthorized,
+			challenge: `Bearer realm="user-manager", error="insufficient_user_authentication", ` +
+				`max_age=600`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, "/account/2fa", nil)
+			if tt.auth != nil {
+				r = r.WithContext(middleware.WithAuthContext(r.Context(), tt.auth))
+			}
+
+			w := httptest.NewRecorder()
+
+			tt.stepUp.Middleware(wrappedHandler).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.challenge, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package http
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns address of the peer which sent request
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
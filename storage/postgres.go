@@ -6,6 +6,8 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/lvl484/user-manager/logger"
+
 	// _ is used for registering the pq driver as a database driver,
 	// without importing any other functions
 	_ "github.com/lib/pq"
@@ -27,6 +29,8 @@ type DBConfig struct {
 
 // ConnectToDB make connect to Postgres DB
 func ConnectToDB(pg *DBConfig) (*sql.DB, error) {
+	logger.Component(logger.ComponentStorage).Debugf("Connecting to %s at %s:%d", pg.DBName, pg.Host, pg.Port)
+
 	pgConfig := getDBConfigString(pg)
 	database, err := sql.Open(dbDriverName, pgConfig)
 	if err != nil {
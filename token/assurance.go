@@ -0,0 +1,68 @@
+package token
+
+import "time"
+
+// Authentication methods of "amr" claim (RFC 8176)
+const (
+	// AMRPassword is password of user
+	AMRPassword = "pwd"
+	// AMROTP is TOTP, recovery code or one-time code sent by email or SMS
+	AMROTP = "otp"
+	// AMRWebAuthn is WebAuthn credential, security key or passkey
+	AMRWebAuthn = "webauthn"
+)
+
+// Authentication context classes of "acr" claim, multi-factor class is stronger than single-factor one
+const (
+	ACRSingleFactor = "urn:user-manager:acr:sfa"
+	ACRMultiFactor  = "urn:user-manager:acr:mfa"
+)
+
+// acrLevels orders known authentication context classes
+var acrLevels = map[string]int{
+	ACRSingleFactor: 1,
+	ACRMultiFactor:  2,
+}
+
+// ACR returns authentication context class reached with methods. Two different methods make multi-factor
+// authentication, and so does WebAuthn credential alone, passkey login requires user verification.
+func ACR(amr []string) string {
+	methods := make(map[string]bool, len(amr))
+
+	for _, m := range amr {
+		methods[m] = true
+	}
+
+	switch {
+	case len(methods) == 0:
+		return ""
+	case len(methods) > 1 || methods[AMRWebAuthn]:
+		return ACRMultiFactor
+	default:
+		return ACRSingleFactor
+	}
+}
+
+// SatisfiesACR reports whether class acr is at least as strong as required one.
+// Empty requirement is satisfied by any class, unknown requirement by none.
+func SatisfiesACR(acr, required string) bool {
+	if required == "" {
+		return true
+	}
+
+	want, ok := acrLevels[required]
+
+	return ok && acrLevels[acr] >= want
+}
+
+// ValidACR reports whether acr is known authentication context class
+func ValidACR(acr string) bool {
+	_, ok := acrLevels[acr]
+	return ok
+}
+
+// AuthenticatedWithin reports whether authentication at authTime happened at most maxAge before now.
+// Zero maxAge is met by authentication that just happened, allowing for clock skew.
+func AuthenticatedWithin(authTime time.Time, maxAge time.Duration, now time.Time) bool {
+	return !authTime.IsZero() && now.Sub(authTime) <= maxAge+leeway
+}
@@ -0,0 +1,55 @@
+package token
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestACR(t *testing.T) {
+	assert.Equal(t, "", ACR(nil))
+	assert.Equal(t, ACRSingleFactor, ACR([]string{AMRPassword}))
+	assert.Equal(t, ACRSingleFactor, ACR([]string{AMRPassword, AMRPassword}))
+	assert.Equal(t, ACRMultiFactor, ACR([]string{AMRPassword, AMROTP}))
+	assert.Equal(t, ACRMultiFactor, ACR([]string{AMRWebAuthn}))
+}
+
+func TestSatisfiesACR(t *testing.T) {
+	assert.True(t, SatisfiesACR("", ""))
+	assert.True(t, SatisfiesACR(ACRSingleFactor, ACRSingleFactor))
+	assert.True(t, SatisfiesACR(ACRMultiFactor, ACRSingleFactor))
+	assert.False(t, SatisfiesACR(ACRSingleFactor, ACRMultiFactor))
+	assert.False(t, SatisfiesACR("", ACRSingleFactor))
+	assert.False(t, SatisfiesACR(ACRMultiFactor, "urn:other:acr"))
+
+	assert.True(t, ValidACR(ACRMultiFactor))
+	assert.False(t, ValidACR("urn:other:acr"))
+}
+
+func TestAuthenticatedWithin(t *testing.T) {
+	now := time.Now()
+
+	assert.True(t, AuthenticatedWithin(now.Add(-5*time.Minute), 10*time.Minute, now))
+	assert.True(t, AuthenticatedWithin(now.Add(-10*time.Second), 0, now))
+	assert.False(t, AuthenticatedWithin(now.Add(-15*time.Minute), 10*time.Minute, now))
+	assert.False(t, AuthenticatedWithin(time.Time{}, time.Hour, now))
+}
+
+func TestClaimsAuthenticated(t *testing.T) {
+	at := time.Unix(1600000000, 0)
+
+	c := Claims{Subject: "user"}
+	c.Authenticated(at, []string{AMRPassword, AMROTP})
+
+	b, err := json.Marshal(&c)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sub":"user","auth_time":1600000000,"amr":["pwd","otp"],
+		"acr":"urn:user-manager:acr:mfa"}`, string(b))
+
+	c = Claims{Subject: "client"}
+	c.Authenticated(time.Time{}, nil)
+	assert.Equal(t, Claims{Subject: "client"}, c)
+}
@@ -0,0 +1,119 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Errors returned by claims validation
+var (
+	ErrExpired         = errors.New("token is expired")
+	ErrNotYetValid     = errors.New("token is not valid yet")
+	ErrInvalidIssuer   = errors.New("token issued by other issuer")
+	ErrInvalidAudience = errors.New("token issued for other audience")
+)
+
+// leeway is allowed clock skew between issuer and verifier
+const leeway = 30 * time.Second
+
+// Audience is "aud" claim, which can be a single string or an array of strings
+type Audience []string
+
+// MarshalJSON writes single audience as string
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON reads audience both from string and array of strings
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+
+	*a = multiple
+
+	return nil
+}
+
+// Contains reports whether audience includes aud
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Claims of access token issued by user-manager
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	// Username is login of the user identified by Subject
+	Username string `json:"username,omitempty"`
+	// Scope is space-delimited list of scopes granted to the token (RFC 8693 section 4.2)
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OAuth client the token was issued to
+	ClientID string `json:"client_id,omitempty"`
+	// Actor is the party acting on behalf of Subject, it is set for tokens issued by delegation (RFC 8693 section 4.1)
+	Actor *Actor `json:"act,omitempty"`
+	// AuthTime is when user authenticated, it is not set for tokens issued without user authentication
+	AuthTime int64 `json:"auth_time,omitempty"`
+	// AMR are methods user authenticated with and ACR is authentication context class they reached
+	AMR []string `json:"amr,omitempty"`
+	ACR string   `json:"acr,omitempty"`
+}
+
+// Authenticated sets time and methods of user authentication
+func (c *Claims) Authenticated(at time.Time, amr []string) {
+	if at.IsZero() {
+		return
+	}
+
+	c.AuthTime = at.Unix()
+	c.AMR = amr
+	c.ACR = ACR(amr)
+}
+
+// Actor identifies acting party of delegated token. Actor of prior delegation is nested.
+type Actor struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	Actor    *Actor `json:"act,omitempty"`
+}
+
+// Valid checks time based claims against now, and issuer and audience when they are not empty
+func (c *Claims) Valid(now time.Time, issuer, audience string) error {
+	switch {
+	case c.ExpiresAt == 0 || now.Add(-leeway).Unix() >= c.ExpiresAt:
+		return ErrExpired
+	case c.NotBefore != 0 && now.Add(leeway).Unix() < c.NotBefore:
+		return ErrNotYetValid
+	case issuer != "" && c.Issuer != issuer:
+		return fmt.Errorf("%w: %q", ErrInvalidIssuer, c.Issuer)
+	case audience != "" && !c.Audience.Contains(audience):
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
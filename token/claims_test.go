@@ -0,0 +1,81 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudienceJSON(t *testing.T) {
+	b, err := json.Marshal(Audience{"api"})
+	require.NoError(t, err)
+	assert.Equal(t, `"api"`, string(b))
+
+	b, err = json.Marshal(Audience{"api", "web"})
+	require.NoError(t, err)
+	assert.Equal(t, `["api","web"]`, string(b))
+
+	var a Audience
+	require.NoError(t, json.Unmarshal([]byte(`"api"`), &a))
+	assert.Equal(t, Audience{"api"}, a)
+
+	require.NoError(t, json.Unmarshal([]byte(`["api","web"]`), &a))
+	assert.True(t, a.Contains("web"))
+	assert.False(t, a.Contains("mobile"))
+
+	assert.Error(t, json.Unmarshal([]byte(`42`), &a))
+}
+
+func TestClaimsValid(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		claims Claims
+		err    error
+	}{
+		{
+			name:   "Valid",
+			claims: Claims{Issuer: "um", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Minute).Unix()},
+		}, {
+			name:   "Within leeway",
+			claims: Claims{Issuer: "um", Audience: Audience{"api"}, ExpiresAt: now.Add(-10 * time.Second).Unix()},
+		}, {
+			name:   "Without expiration",
+			claims: Claims{Issuer: "um", Audience: Audience{"api"}},
+			err:    ErrExpired,
+		}, {
+			name:   "Expired",
+			claims: Claims{Issuer: "um", Audience: Audience{"api"}, ExpiresAt: now.Add(-time.Minute).Unix()},
+			err:    ErrExpired,
+		}, {
+			name:   "Not yet valid",
+			claims: Claims{Issuer: "um", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Hour).Unix(), NotBefore: now.Add(time.Minute).Unix()},
+			err:    ErrNotYetValid,
+		}, {
+			name:   "Other issuer",
+			claims: Claims{Issuer: "other", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Minute).Unix()},
+			err:    ErrInvalidIssuer,
+		}, {
+			name:   "Other audience",
+			claims: Claims{Issuer: "um", Audience: Audience{"web"}, ExpiresAt: now.Add(time.Minute).Unix()},
+			err:    ErrInvalidAudience,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.claims.Valid(now, "um", "api")
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tt.err), err)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package token
+
+// UserInfo are standard OpenID Connect claims about the user (OpenID Connect Core section 5.1)
+type UserInfo struct {
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PhoneNumber       string `json:"phone_number,omitempty"`
+}
+
+// IDClaims are claims of OpenID Connect ID token, audience of the token is client id
+type IDClaims struct {
+	Claims
+	Nonce string `json:"nonce,omitempty"`
+	UserInfo
+}
+
+// IssueID fills registered claims of ID token which are not set yet and signs it
+func (i *Issuer) IssueID(c *IDClaims) (string, error) {
+	i.fill(&c.Claims)
+
+	return i.keys.Sign(TypeJWT, c)
+}
+
+// VerifyID verifies signature and issuer of ID token. Expired tokens are accepted,
+// ID token presented back to the service is only a hint of user and client.
+func (i *Issuer) VerifyID(token string) (*IDClaims, error) {
+	var c IDClaims
+
+	err := i.keys.Verify(token, TypeJWT, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Issuer != i.issuer {
+		return nil, ErrInvalidIssuer
+	}
+
+	return &c, nil
+}
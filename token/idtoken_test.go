@@ -0,0 +1,65 @@
+package token
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIssuerIssueID(t *testing.T) {
+	now := time.Now()
+	i := newTestIssuer(t, &now)
+
+	c := &IDClaims{
+		Claims:   Claims{Subject: "123e4567-e89b-12d3-a456-426655440000", Audience: Audience{"spa"}},
+		Nonce:    "n-0S6",
+		UserInfo: UserInfo{Email: "i3odja@example.com", GivenName: "Ivan"},
+	}
+
+	signed, err := i.IssueID(c)
+	require.NoError(t, err)
+
+	got, err := i.VerifyID(signed)
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+	assert.Equal(t, "user-manager", got.Issuer)
+
+	// ID token is not accepted as access token and vice versa
+	_, err = i.Validate(signed)
+	assert.Error(t, err)
+
+	access, err := i.Issue(&Claims{Subject: "user"})
+	require.NoError(t, err)
+
+	_, err = i.VerifyID(access)
+	assert.Error(t, err)
+
+	// Expired ID token is still a valid hint
+	now = now.Add(time.Hour)
+
+	_, err = i.VerifyID(signed)
+	assert.NoError(t, err)
+}
+
+func TestIDClaimsJSON(t *testing.T) {
+	b, err := json.Marshal(&IDClaims{
+		Claims:   Claims{Subject: "user", Audience: Audience{"spa"}},
+		Nonce:    "n-0S6",
+		UserInfo: UserInfo{FamilyName: "Petrenko", PhoneNumber: "+380501234567"},
+	})
+	require.NoError(t, err)
+
+	var flat map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &flat))
+
+	assert.Equal(t, map[string]interface{}{
+		"sub":          "user",
+		"aud":          "spa",
+		"nonce":        "n-0S6",
+		"family_name":  "Petrenko",
+		"phone_number": "+380501234567",
+	}, flat)
+}
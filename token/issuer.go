@@ -0,0 +1,140 @@
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultOAuthAudience is audience of tokens issued to OAuth clients when it is not configured
+const DefaultOAuthAudience = "oauth"
+
+// Config of tokens issued by the service
+type Config struct {
+	Issuer   string
+	Audience string
+	// OAuthAudience is set in tokens issued by OAuth grants, so they are not accepted by the service's own APIs
+	OAuthAudience string
+	TTL           time.Duration
+	KeyRing       KeyRingConfig
+}
+
+// Issuer signs access tokens and validates tokens presented by clients
+type Issuer struct {
+	keys          *KeyRing
+	issuer        string
+	audience      string
+	oauthAudience string
+	ttl           time.Duration
+	now           func() time.Time
+}
+
+// NewIssuer returns issuer of tokens signed by keys.
+// Lifetime of tokens can not exceed key overlap, otherwise tokens would outlive their keys.
+func NewIssuer(keys *KeyRing, cfg *Config) (*Issuer, error) {
+	if cfg.TTL <= 0 || cfg.TTL > keys.cfg.Overlap {
+		return nil, fmt.Errorf("token TTL %s must be positive and not exceed key overlap %s", cfg.TTL, keys.cfg.Overlap)
+	}
+
+	oauthAudience := cfg.OAuthAudience
+	if oauthAudience == "" {
+		oauthAudience = DefaultOAuthAudience
+	}
+
+	if oauthAudience == cfg.Audience {
+		return nil, fmt.Errorf("OAuth audience %q must differ from audience of the service", oauthAudience)
+	}
+
+	return &Issuer{
+		keys:          keys,
+		issuer:        cfg.Issuer,
+		audience:      cfg.Audience,
+		oauthAudience: oauthAudience,
+		ttl:           cfg.TTL,
+		now:           time.Now,
+	}, nil
+}
+
+// TTL returns lifetime of issued tokens
+func (i *Issuer) TTL() time.Duration {
+	return i.ttl
+}
+
+// Issuer returns identifier of the issuer set in "iss" claim
+func (i *Issuer) Issuer() string {
+	return i.issuer
+}
+
+// OAuthAudience returns audience of tokens issued by OAuth grants
+func (i *Issuer) OAuthAudience() string {
+	return i.oauthAudience
+}
+
+// Keys returns key ring of the issuer
+func (i *Issuer) Keys() *KeyRing {
+	return i.keys
+}
+
+// Issue fills registered claims which are not set yet and signs the token
+func (i *Issuer) Issue(c *Claims) (string, error) {
+	i.fill(c)
+
+	return i.keys.Sign(TypeAccess, c)
+}
+
+// fill sets issuer, default audience, id and lifetime of the token
+func (i *Issuer) fill(c *Claims) {
+	now := i.now()
+
+	if c.Issuer == "" {
+		c.Issuer = i.issuer
+	}
+
+	if len(c.Audience) == 0 && i.audience != "" {
+		c.Audience = Audience{i.audience}
+	}
+
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+
+	c.IssuedAt = now.Unix()
+	c.NotBefore = now.Unix()
+
+	if c.ExpiresAt == 0 {
+		c.ExpiresAt = now.Add(i.ttl).Unix()
+	}
+}
+
+// Validate verifies signature, lifetime, issuer and audience of the token.
+// Both tokens of the service and tokens issued by OAuth grants are valid.
+func (i *Issuer) Validate(token string) (*Claims, error) {
+	var c Claims
+
+	err := i.keys.Verify(token, TypeAccess, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Valid(i.now(), i.issuer, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if i.audience != "" && !c.Audience.Contains(i.audience) && !c.Audience.Contains(i.oauthAudience) {
+		return nil, ErrInvalidAudience
+	}
+
+	return &c, nil
+}
+
+// FirstParty reports whether token was issued for APIs of the service itself, tokens issued by OAuth grants
+// or exchanged for other audience are not
+func (i *Issuer) FirstParty(c *Claims) bool {
+	if i.audience == "" {
+		return len(c.Audience) == 0
+	}
+
+	return c.Audience.Contains(i.audience) && !c.Audience.Contains(i.oauthAudience)
+}
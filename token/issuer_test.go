@@ -0,0 +1,100 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIssuer(t *testing.T, now *time.Time) *Issuer {
+	r, _ := newTestKeyRing(t, now)
+
+	i, err := NewIssuer(r, &Config{Issuer: "user-manager", Audience: "api", TTL: 15 * time.Minute})
+	require.NoError(t, err)
+
+	i.now = func() time.Time { return *now }
+
+	return i
+}
+
+func TestNewIssuer(t *testing.T) {
+	now := time.Now()
+	r, _ := newTestKeyRing(t, &now)
+
+	_, err := NewIssuer(r, &Config{TTL: 2 * time.Hour})
+	assert.Error(t, err)
+
+	_, err = NewIssuer(r, &Config{})
+	assert.Error(t, err)
+
+	_, err = NewIssuer(r, &Config{Audience: DefaultOAuthAudience, TTL: time.Minute})
+	assert.Error(t, err)
+}
+
+func TestIssuerIssue(t *testing.T) {
+	now := time.Now()
+	i := newTestIssuer(t, &now)
+
+	c := &Claims{Subject: "123e4567-e89b-12d3-a456-426655440000", Username: "i3odja"}
+	signed, err := i.Issue(c)
+	require.NoError(t, err)
+
+	assert.Equal(t, "user-manager", c.Issuer)
+	assert.Equal(t, Audience{"api"}, c.Audience)
+	assert.Equal(t, now.Add(15*time.Minute).Unix(), c.ExpiresAt)
+	assert.NotEmpty(t, c.ID)
+
+	got, err := i.Validate(signed)
+	require.NoError(t, err)
+	assert.Equal(t, c, got)
+}
+
+func TestIssuerValidate(t *testing.T) {
+	now := time.Now()
+	i := newTestIssuer(t, &now)
+
+	valid, err := i.Issue(&Claims{Subject: "user"})
+	require.NoError(t, err)
+
+	otherIssuer, err := i.keys.Sign(TypeAccess, &Claims{Issuer: "other", Audience: Audience{"api"}, ExpiresAt: now.Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	otherAudience, err := i.keys.Sign(TypeAccess, &Claims{Issuer: "user-manager", Audience: Audience{"web", "mobile"}, ExpiresAt: now.Add(time.Minute).Unix()})
+	require.NoError(t, err)
+
+	_, err = i.Validate(otherIssuer)
+	assert.True(t, errors.Is(err, ErrInvalidIssuer))
+
+	_, err = i.Validate(otherAudience)
+	assert.True(t, errors.Is(err, ErrInvalidAudience))
+
+	now = now.Add(16 * time.Minute)
+
+	_, err = i.Validate(valid)
+	assert.True(t, errors.Is(err, ErrExpired))
+}
+
+func TestIssuerFirstParty(t *testing.T) {
+	now := time.Now()
+	i := newTestIssuer(t, &now)
+
+	own := &Claims{Subject: "user"}
+	_, err := i.Issue(own)
+	require.NoError(t, err)
+	assert.True(t, i.FirstParty(own))
+
+	granted := &Claims{Subject: "user", ClientID: "spa", Audience: Audience{i.OAuthAudience()}}
+	signed, err := i.Issue(granted)
+	require.NoError(t, err)
+	assert.False(t, i.FirstParty(granted))
+
+	// Tokens issued by OAuth grants are valid, but only for OAuth resources
+	_, err = i.Validate(signed)
+	assert.NoError(t, err)
+
+	assert.False(t, i.FirstParty(&Claims{Audience: Audience{"billing"}}))
+	assert.False(t, i.FirstParty(&Claims{Audience: Audience{"api", i.OAuthAudience()}}))
+}
@@ -0,0 +1,106 @@
+package token
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Types of signed tokens, the type is set in JOSE header, so a token of one type
+// can not be accepted where a token of other type is expected
+const (
+	TypeJWT     = "JWT"
+	TypeAccess  = "at+jwt"
+	TypeConsent = "consent+jwt"
+	TypeDevice  = "device+jwt"
+)
+
+// ErrInvalidToken is the error returned when token is malformed or its signature does not match
+var ErrInvalidToken = errors.New("invalid token")
+
+// header is JOSE header of signed token
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid"`
+}
+
+// encode returns compact serialization of claims signed with key
+func encode(key *Key, typ string, claims interface{}) (string, error) {
+	h, err := json.Marshal(header{Algorithm: key.Algorithm, Type: typ, KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	signature, err := key.sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// decode verifies type and signature of compact serialized token with key returned by lookup and unmarshals claims
+func decode(token, typ string, lookup func(kid string) (*Key, bool), claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+
+	if !strings.EqualFold(h.Type, typ) {
+		return fmt.Errorf("%w: type %q is not %q", ErrInvalidToken, h.Type, typ)
+	}
+
+	key, ok := lookup(h.KeyID)
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidToken, h.KeyID)
+	}
+
+	// Algorithm is dictated by the key, never by the token
+	if h.Algorithm != key.Algorithm {
+		return fmt.Errorf("%w: algorithm %q does not match key", ErrInvalidToken, h.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("%w: payload: %v", ErrInvalidToken, err)
+	}
+
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+
+	if err := d.Decode(claims); err != nil {
+		return fmt.Errorf("%w: payload: %v", ErrInvalidToken, err)
+	}
+
+	return nil
+}
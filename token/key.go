@@ -0,0 +1,179 @@
+// Package token provides signed JSON Web Tokens issued by user-manager.
+// Tokens are signed with keys from a KeyRing, which rotates them on schedule
+// and keeps previous keys published long enough to verify already issued tokens.
+package token
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Supported signing algorithms
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits     = 2048
+	pemPrivateType = "PRIVATE KEY"
+)
+
+// ErrUnsupportedAlgorithm is the error returned for algorithms other than RS256 and EdDSA
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+// Key is a signing key of the ring
+type Key struct {
+	ID         string
+	Algorithm  string
+	ActivateAt time.Time
+	private    crypto.Signer
+}
+
+// GenerateKey creates new key, which will be used for signing since activateAt
+func GenerateKey(algorithm string, activateAt time.Time) (*Key, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("generate %s key error: %w", algorithm, err)
+	}
+
+	return &Key{
+		ID:         uuid.New().String(),
+		Algorithm:  algorithm,
+		ActivateAt: activateAt,
+		private:    private,
+	}, nil
+}
+
+// ParseKey restores key from PEM encoded PKCS #8 private key
+func ParseKey(id, algorithm string, activateAt time.Time, privatePEM []byte) (*Key, error) {
+	block, _ := pem.Decode(privatePEM)
+	if block == nil || block.Type != pemPrivateType {
+		return nil, fmt.Errorf("key %s: invalid PEM block", id)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	var ok bool
+
+	switch algorithm {
+	case AlgorithmRS256:
+		_, ok = parsed.(*rsa.PrivateKey)
+	case AlgorithmEdDSA:
+		_, ok = parsed.(ed25519.PrivateKey)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, algorithm)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("key %s: private key does not match %s", id, algorithm)
+	}
+
+	return &Key{
+		ID:         id,
+		Algorithm:  algorithm,
+		ActivateAt: activateAt,
+		private:    parsed.(crypto.Signer),
+	}, nil
+}
+
+// MarshalPrivate returns PEM encoded PKCS #8 private key
+func (k *Key) MarshalPrivate() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", k.ID, err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: pemPrivateType, Bytes: der}), nil
+}
+
+// sign returns signature of JWS signing input
+func (k *Key) sign(input []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		digest := sha256.Sum256(input)
+		return k.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case AlgorithmEdDSA:
+		return k.private.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, k.Algorithm)
+}
+
+// verify checks signature of JWS signing input
+func (k *Key) verify(input, signature []byte) bool {
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(input)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, input, signature)
+	}
+
+	return false
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is a set of public keys published by the service
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns public part of the key
+func (k *Key) JWK() JWK {
+	jwk := JWK{
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: k.Algorithm,
+	}
+
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return jwk
+}
@@ -0,0 +1,71 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateKey(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		keyType   string
+	}{
+		{algorithm: AlgorithmRS256, keyType: "RSA"},
+		{algorithm: AlgorithmEdDSA, keyType: "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm, func(t *testing.T) {
+			key, err := GenerateKey(tt.algorithm, time.Now())
+			require.NoError(t, err)
+
+			signature, err := key.sign([]byte("input"))
+			require.NoError(t, err)
+			assert.True(t, key.verify([]byte("input"), signature))
+			assert.False(t, key.verify([]byte("other input"), signature))
+
+			jwk := key.JWK()
+			assert.Equal(t, tt.keyType, jwk.KeyType)
+			assert.Equal(t, tt.algorithm, jwk.Algorithm)
+			assert.Equal(t, key.ID, jwk.KeyID)
+		})
+	}
+
+	_, err := GenerateKey("HS256", time.Now())
+	assert.Error(t, err)
+}
+
+func TestParseKey(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmRS256, AlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateKey(algorithm, time.Now())
+			require.NoError(t, err)
+
+			private, err := key.MarshalPrivate()
+			require.NoError(t, err)
+
+			parsed, err := ParseKey(key.ID, algorithm, key.ActivateAt, private)
+			require.NoError(t, err)
+			assert.Equal(t, key.JWK(), parsed.JWK())
+
+			signature, err := parsed.sign([]byte("input"))
+			require.NoError(t, err)
+			assert.True(t, key.verify([]byte("input"), signature))
+		})
+	}
+
+	key, err := GenerateKey(AlgorithmEdDSA, time.Now())
+	require.NoError(t, err)
+
+	private, err := key.MarshalPrivate()
+	require.NoError(t, err)
+
+	_, err = ParseKey(key.ID, AlgorithmRS256, key.ActivateAt, private)
+	assert.Error(t, err)
+
+	_, err = ParseKey(key.ID, AlgorithmEdDSA, key.ActivateAt, []byte("not a pem"))
+	assert.Error(t, err)
+}
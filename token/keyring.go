@@ -0,0 +1,261 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lvl484/user-manager/logger"
+)
+
+// refreshInterval is how often key ring reloads keys and checks if rotation is due
+const refreshInterval = time.Minute
+
+// ErrNoSigningKey is the error returned when ring has no active key
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// KeyStore persists keys, so all replicas of the service sign and verify with the same keys
+type KeyStore interface {
+	Keys() ([]*Key, error)
+	AddKey(key *Key) error
+	DeleteKey(id string) error
+}
+
+// KeyRingConfig describes rotation schedule of signing keys
+type KeyRingConfig struct {
+	// Algorithm of newly generated keys
+	Algorithm string
+	// Rotation is how long a key is used for signing
+	Rotation time.Duration
+	// Overlap is how long a key is published before it becomes active
+	// and how long it is kept after next key becomes active.
+	// It must not be shorter than lifetime of tokens.
+	Overlap time.Duration
+}
+
+// KeyRing holds signing keys. The newest active key signs tokens,
+// upcoming and retiring keys are published and accepted for verification.
+type KeyRing struct {
+	cfg   KeyRingConfig
+	store KeyStore
+	now   func() time.Time
+
+	mu   sync.RWMutex
+	keys []*Key
+}
+
+// NewKeyRing loads keys from store and generates the first one when store is empty
+func NewKeyRing(cfg KeyRingConfig, store KeyStore) (*KeyRing, error) {
+	if cfg.Algorithm != AlgorithmRS256 && cfg.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, cfg.Algorithm)
+	}
+
+	if cfg.Rotation <= 0 || cfg.Overlap < 0 {
+		return nil, errors.New("key rotation period must be positive and overlap not negative")
+	}
+
+	r := &KeyRing{
+		cfg:   cfg,
+		store: store,
+		now:   time.Now,
+	}
+
+	err := r.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Algorithm returns algorithm of signing keys
+func (r *KeyRing) Algorithm() string {
+	return r.cfg.Algorithm
+}
+
+// Refresh reloads keys from store, generates new key when rotation is due and removes retired keys
+func (r *KeyRing) Refresh() error {
+	keys, err := r.store.Keys()
+	if err != nil {
+		return fmt.Errorf("load signing keys error: %w", err)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].ActivateAt.Before(keys[j].ActivateAt)
+	})
+
+	now := r.now()
+
+	if r.rotationDue(keys, now) {
+		// The first key is used at once, next ones are published in advance
+		activateAt := now
+		if len(keys) > 0 {
+			activateAt = now.Add(r.cfg.Overlap)
+		}
+
+		key, err := GenerateKey(r.cfg.Algorithm, activateAt)
+		if err != nil {
+			return err
+		}
+
+		err = r.store.AddKey(key)
+		if err != nil {
+			return fmt.Errorf("save signing key error: %w", err)
+		}
+
+		keys = append(keys, key)
+
+		logger.Component(logger.ComponentAuth).Infof("Signing key %s generated, active since %s",
+			key.ID, activateAt.Format(time.RFC3339))
+	}
+
+	// Key is retired when the next one was active long enough for all tokens signed by it to expire
+	for len(keys) > 1 && !keys[1].ActivateAt.Add(r.cfg.Overlap).After(now) {
+		err = r.store.DeleteKey(keys[0].ID)
+		if err != nil {
+			return fmt.Errorf("delete signing key error: %w", err)
+		}
+
+		logger.Component(logger.ComponentAuth).Infof("Signing key %s retired", keys[0].ID)
+
+		keys = keys[1:]
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+
+	return nil
+}
+
+// rotationDue reports whether new key has to be published
+func (r *KeyRing) rotationDue(keys []*Key, now time.Time) bool {
+	if len(keys) == 0 {
+		return true
+	}
+
+	newest := keys[len(keys)-1]
+
+	return newest.Algorithm != r.cfg.Algorithm ||
+		!newest.ActivateAt.Add(r.cfg.Rotation).After(now.Add(r.cfg.Overlap))
+}
+
+// Run refreshes keys periodically until ctx is done
+func (r *KeyRing) Run(ctx context.Context) {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := r.Refresh()
+			if err != nil {
+				logger.Component(logger.ComponentAuth).Errorf("Key ring refresh failed: %v", err)
+			}
+		}
+	}
+}
+
+// signingKey returns the newest active key
+func (r *KeyRing) signingKey() (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := r.now()
+
+	for i := len(r.keys) - 1; i >= 0; i-- {
+		if !r.keys[i].ActivateAt.After(now) {
+			return r.keys[i], nil
+		}
+	}
+
+	return nil, ErrNoSigningKey
+}
+
+// key returns published key by id
+func (r *KeyRing) key(id string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+
+	return nil, false
+}
+
+// Sign returns compact serialized JWT of type typ with claims signed by active key
+func (r *KeyRing) Sign(typ string, claims interface{}) (string, error) {
+	key, err := r.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	return encode(key, typ, claims)
+}
+
+// Verify checks type and signature of the token with published keys and unmarshals its claims.
+// Time based claims are not validated.
+func (r *KeyRing) Verify(token, typ string, claims interface{}) error {
+	return decode(token, typ, r.key, claims)
+}
+
+// JWKS returns all published keys
+func (r *KeyRing) JWKS() JWKSet {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(r.keys))}
+	for _, k := range r.keys {
+		set.Keys = append(set.Keys, k.JWK())
+	}
+
+	return set
+}
+
+// MemoryKeyStore keeps keys in memory, keys are lost on restart and not shared between replicas
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys []*Key
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{}
+}
+
+func (s *MemoryKeyStore) Keys() ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Key(nil), s.keys...), nil
+}
+
+func (s *MemoryKeyStore) AddKey(key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys = append(s.keys, key)
+
+	return nil
+}
+
+func (s *MemoryKeyStore) DeleteKey(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, k := range s.keys {
+		if k.ID == id {
+			s.keys = append(s.keys[:i], s.keys[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
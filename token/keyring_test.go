@@ -0,0 +1,136 @@
+package token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyRing(t *testing.T, now *time.Time) (*KeyRing, *MemoryKeyStore) {
+	store := NewMemoryKeyStore()
+
+	r := &KeyRing{
+		cfg:   KeyRingConfig{Algorithm: AlgorithmEdDSA, Rotation: 24 * time.Hour, Overlap: time.Hour},
+		store: store,
+		now:   func() time.Time { return *now },
+	}
+	require.NoError(t, r.Refresh())
+
+	return r, store
+}
+
+func TestNewKeyRing(t *testing.T) {
+	r, err := NewKeyRing(KeyRingConfig{Algorithm: AlgorithmRS256, Rotation: time.Hour, Overlap: time.Minute}, NewMemoryKeyStore())
+	require.NoError(t, err)
+	assert.Len(t, r.JWKS().Keys, 1)
+
+	_, err = NewKeyRing(KeyRingConfig{Algorithm: "none", Rotation: time.Hour}, NewMemoryKeyStore())
+	assert.Error(t, err)
+
+	_, err = NewKeyRing(KeyRingConfig{Algorithm: AlgorithmEdDSA}, NewMemoryKeyStore())
+	assert.Error(t, err)
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	now := time.Now()
+	r, store := newTestKeyRing(t, &now)
+
+	first, err := r.Sign(TypeAccess, &Claims{Subject: "first"})
+	require.NoError(t, err)
+
+	// New key is published an overlap before rotation, but is not used yet
+	now = now.Add(23*time.Hour + time.Minute)
+	require.NoError(t, r.Refresh())
+	assert.Len(t, r.JWKS().Keys, 2)
+
+	second, err := r.Sign(TypeAccess, &Claims{Subject: "second"})
+	require.NoError(t, err)
+	assert.Equal(t, kid(t, first), kid(t, second))
+
+	// New key becomes active, old one is still accepted
+	now = now.Add(time.Hour)
+	require.NoError(t, r.Refresh())
+
+	third, err := r.Sign(TypeAccess, &Claims{Subject: "third"})
+	require.NoError(t, err)
+	assert.NotEqual(t, kid(t, first), kid(t, third))
+	assert.NoError(t, r.Verify(first, TypeAccess, &Claims{}))
+
+	// Old key is retired after overlap
+	now = now.Add(time.Hour)
+	require.NoError(t, r.Refresh())
+
+	keys, err := store.Keys()
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Error(t, r.Verify(first, TypeAccess, &Claims{}))
+	assert.NoError(t, r.Verify(third, TypeAccess, &Claims{}))
+}
+
+func TestKeyRingSharedStore(t *testing.T) {
+	now := time.Now()
+	r, store := newTestKeyRing(t, &now)
+
+	replica := &KeyRing{cfg: r.cfg, store: store, now: r.now}
+	require.NoError(t, replica.Refresh())
+
+	signed, err := r.Sign(TypeAccess, &Claims{Subject: "user"})
+	require.NoError(t, err)
+
+	var c Claims
+	require.NoError(t, replica.Verify(signed, TypeAccess, &c))
+	assert.Equal(t, "user", c.Subject)
+}
+
+func TestKeyRingVerify(t *testing.T) {
+	now := time.Now()
+	r, _ := newTestKeyRing(t, &now)
+
+	signed, err := r.Sign(TypeAccess, &Claims{Subject: "user", Username: "i3odja"})
+	require.NoError(t, err)
+
+	var c Claims
+	require.NoError(t, r.Verify(signed, TypeAccess, &c))
+	assert.Equal(t, "i3odja", c.Username)
+
+	parts := strings.Split(signed, ".")
+	tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin"}`)) + "." + parts[2]
+	noneAlg := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"`+kid(t, signed)+`"}`)) + "." + parts[1] + "."
+
+	for name, tok := range map[string]string{
+		"Tampered payload": tampered,
+		"None algorithm":   noneAlg,
+		"Malformed":        "abc.def",
+		"Empty":            "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, r.Verify(tok, TypeAccess, &Claims{}))
+		})
+	}
+}
+
+func kid(t *testing.T, token string) string {
+	var h header
+
+	raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &h))
+
+	return h.KeyID
+}
+
+func TestKeyRingVerifyType(t *testing.T) {
+	now := time.Now()
+	r, _ := newTestKeyRing(t, &now)
+
+	consent, err := r.Sign(TypeConsent, &Claims{Subject: "user"})
+	require.NoError(t, err)
+
+	assert.NoError(t, r.Verify(consent, TypeConsent, &Claims{}))
+	assert.Error(t, r.Verify(consent, TypeAccess, &Claims{}))
+}
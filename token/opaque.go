@@ -0,0 +1,34 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// opaqueLength is number of random bytes in opaque token
+const opaqueLength = 32
+
+// NewOpaque returns random opaque token and its hash.
+// Only hash has to be stored, so leaked storage does not disclose usable tokens.
+func NewOpaque() (string, string, error) {
+	b := make([]byte, opaqueLength)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("generate opaque token error: %w", err)
+	}
+
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	return raw, HashOpaque(raw), nil
+}
+
+// HashOpaque returns hex encoded SHA-256 of opaque token.
+// Tokens have enough entropy, so slow password hashing is not needed.
+func HashOpaque(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
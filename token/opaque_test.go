@@ -0,0 +1,21 @@
+package token
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOpaque(t *testing.T) {
+	raw, hash, err := NewOpaque()
+	require.NoError(t, err)
+
+	assert.Len(t, raw, 43)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, HashOpaque(raw))
+
+	other, _, err := NewOpaque()
+	require.NoError(t, err)
+	assert.NotEqual(t, raw, other)
+}
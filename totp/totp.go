@@ -0,0 +1,113 @@
+// Package totp implements time-based one-time passwords (RFC 6238) compatible with authenticator apps:
+// HMAC-SHA1, 6 digits, 30 seconds period.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits is length of generated codes
+	Digits = 6
+	// Period is how long code is valid, in seconds
+	Period = 30
+	// Skew is number of periods before and after current one which codes are accepted,
+	// it tolerates clock drift of authenticator and time user needs to type the code
+	Skew = 1
+
+	// secretLength is number of random bytes in secret, RFC 4226 recommends 160 bits
+	secretLength = 20
+	modulo       = 1000000
+)
+
+// encoding is base32 without padding used by authenticator apps
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret returns random base32 encoded secret
+func NewSecret() (string, error) {
+	b := make([]byte, secretLength)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("generate TOTP secret error: %w", err)
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// URI returns otpauth URI of secret, authenticator apps enroll it from QR code with the URI
+func URI(issuer, account, secret string) string {
+	params := url.Values{
+		"secret":    {secret},
+		"issuer":    {issuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(Digits)},
+		"period":    {fmt.Sprint(Period)},
+	}
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// Counter returns number of period at time t
+func Counter(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code returns code of secret for counter
+func Code(secret string, counter int64) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("decode TOTP secret error: %w", err)
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, bin%modulo), nil
+}
+
+// Validate checks code at time t and returns counter it was generated for. Codes of counters
+// not greater than last are rejected, so every code can be used only once.
+func Validate(secret, code string, t time.Time, last int64) (int64, bool, error) {
+	if len(code) != Digits {
+		return 0, false, nil
+	}
+
+	now := Counter(t)
+
+	for counter := now - Skew; counter <= now+Skew; counter++ {
+		if counter <= last {
+			continue
+		}
+
+		expected, err := Code(secret, counter)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is SHA1 secret of RFC 6238 test vectors
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B lists 8 digit codes, 6 digit codes are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tt.code, code, tt.unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+
+	now := time.Now()
+	code, err := Code(secret, Counter(now))
+	require.NoError(t, err)
+
+	counter, ok, err := Validate(secret, code, now, 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Counter(now), counter)
+
+	// Code of previous period is accepted for clock drift
+	_, ok, err = Validate(secret, code, now.Add(Period*time.Second), 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Used code is rejected
+	_, ok, err = Validate(secret, code, now, counter)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = Validate(secret, code, now.Add(3*Period*time.Second), 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, ok, err = Validate(secret, "12345", now, 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestURI(t *testing.T) {
+	u, err := url.Parse(URI("user-manager", "i3odja", "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/user-manager:i3odja", u.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", u.Query().Get("secret"))
+	assert.Equal(t, "user-manager", u.Query().Get("issuer"))
+	assert.Equal(t, "6", u.Query().Get("digits"))
+}
@@ -0,0 +1,88 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Flags of authenticator data
+const (
+	FlagUserPresent          byte = 0x01
+	FlagUserVerified         byte = 0x04
+	FlagAttestedCredential   byte = 0x40
+	FlagExtensionData        byte = 0x80
+	authenticatorDataMinSize      = 37
+	aaguidSize                    = 16
+	maxCredentialIDSize           = 1023
+)
+
+var errAuthenticatorData = errors.New("malformed authenticator data")
+
+// authenticatorData is parsed authenticator data (WebAuthn section 6.1)
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// aaguid, credentialID and publicKey are set only when FlagAttestedCredential is set
+	aaguid       []byte
+	credentialID []byte
+	publicKey    *PublicKey
+	rawPublicKey []byte
+}
+
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < authenticatorDataMinSize {
+		return nil, errAuthenticatorData
+	}
+
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rest := data[authenticatorDataMinSize:]
+
+	if ad.flags&FlagAttestedCredential != 0 {
+		if len(rest) < aaguidSize+2 {
+			return nil, errAuthenticatorData
+		}
+
+		ad.aaguid = rest[:aaguidSize]
+		rest = rest[aaguidSize:]
+
+		size := int(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+
+		if size == 0 || size > maxCredentialIDSize || size > len(rest) {
+			return nil, errAuthenticatorData
+		}
+
+		ad.credentialID = rest[:size]
+		rest = rest[size:]
+
+		key, after, err := parsePublicKey(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		ad.publicKey = key
+		ad.rawPublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+
+	if ad.flags&FlagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, errAuthenticatorData
+		}
+
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, errAuthenticatorData
+	}
+
+	return ad, nil
+}
@@ -0,0 +1,153 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// CBOR major types (RFC 7049 section 2.1)
+const (
+	cborUnsigned = iota
+	cborNegative
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// maxCBORDepth limits nesting of decoded items, WebAuthn structures are at most a few levels deep
+const maxCBORDepth = 16
+
+var errCBOR = errors.New("malformed CBOR")
+
+// decodeCBOR decodes first CBOR item of data and returns the rest of data. Only definite length items
+// used by WebAuthn are supported: integers are int64, byte strings []byte, text strings string, arrays
+// []interface{} and maps map[interface{}]interface{} with int64 or string keys.
+func decodeCBOR(data []byte) (interface{}, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, nil, errCBOR
+	}
+
+	major := data[0] >> 5
+
+	arg, rest, err := decodeArgument(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case cborUnsigned:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+
+		return int64(arg), rest, nil
+	case cborNegative:
+		if arg > math.MaxInt64 {
+			return nil, nil, errCBOR
+		}
+
+		return -1 - int64(arg), rest, nil
+	case cborBytes, cborText:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+
+		b := rest[:arg]
+		if major == cborText {
+			return string(b), rest[arg:], nil
+		}
+
+		return append([]byte(nil), b...), rest[arg:], nil
+	case cborArray:
+		// Every item takes at least one byte, so longer arrays can not be valid
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+
+		items := make([]interface{}, 0, arg)
+
+		for i := uint64(0); i < arg; i++ {
+			var item interface{}
+
+			item, rest, err = decodeItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		return items, rest, nil
+	case cborMap:
+		if arg > uint64(len(rest)) {
+			return nil, nil, errCBOR
+		}
+
+		m := make(map[interface{}]interface{}, arg)
+
+		for i := uint64(0); i < arg; i++ {
+			var key, value interface{}
+
+			key, rest, err = decodeItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errCBOR
+			}
+
+			value, rest, err = decodeItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			m[key] = value
+		}
+
+		return m, rest, nil
+	case cborSimple:
+		switch data[0] & 0x1f {
+		case 20:
+			return false, rest, nil
+		case 21:
+			return true, rest, nil
+		case 22:
+			return nil, rest, nil
+		}
+	}
+
+	return nil, nil, errCBOR
+}
+
+// decodeArgument returns argument of item head: value of integers, length of strings and containers
+func decodeArgument(data []byte) (uint64, []byte, error) {
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+
+	// Indefinite lengths and reserved values are not used by WebAuthn
+	return 0, nil, errCBOR
+}
@@ -0,0 +1,80 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples of RFC 7049 appendix A
+	tests := []struct {
+		hex  string
+		item interface{}
+	}{
+		{hex: "00", item: int64(0)},
+		{hex: "17", item: int64(23)},
+		{hex: "1818", item: int64(24)},
+		{hex: "1903e8", item: int64(1000)},
+		{hex: "1a000f4240", item: int64(1000000)},
+		{hex: "1b000000e8d4a51000", item: int64(1000000000000)},
+		{hex: "20", item: int64(-1)},
+		{hex: "3903e7", item: int64(-1000)},
+		{hex: "4401020304", item: []byte{1, 2, 3, 4}},
+		{hex: "6449455446", item: "IETF"},
+		{hex: "f4", item: false},
+		{hex: "f5", item: true},
+		{hex: "f6", item: nil},
+		{hex: "8301820203820405", item: []interface{}{int64(1), []interface{}{int64(2), int64(3)}, []interface{}{int64(4), int64(5)}}},
+		{hex: "a201020304", item: map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(4)}},
+		{hex: "a26161016162820203", item: map[interface{}]interface{}{"a": int64(1), "b": []interface{}{int64(2), int64(3)}}},
+	}
+
+	for _, tt := range tests {
+		data, err := hex.DecodeString(tt.hex)
+		require.NoError(t, err)
+
+		item, rest, err := decodeCBOR(append(data, 0xff))
+		require.NoError(t, err, tt.hex)
+		assert.Equal(t, tt.item, item, tt.hex)
+		assert.Equal(t, []byte{0xff}, rest, tt.hex)
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	tests := []string{
+		"",
+		// Truncated argument, string and array
+		"19",
+		"4401",
+		"8201",
+		// Integer out of int64 range
+		"1bffffffffffffffff",
+		// Indefinite length, tag and float
+		"5f",
+		"c11a514b67b0",
+		"f93c00",
+		// Map with array key
+		"a18001",
+		// Length which can not fit in data
+		"9bffffffffffffffff",
+	}
+
+	for _, tt := range tests {
+		data, err := hex.DecodeString(tt)
+		require.NoError(t, err)
+
+		_, _, err = decodeCBOR(data)
+		assert.Equal(t, errCBOR, err, tt)
+	}
+
+	deep := make([]byte, maxCBORDepth+2)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+
+	_, _, err := decodeCBOR(deep)
+	assert.Equal(t, errCBOR, err)
+}
@@ -0,0 +1,159 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+)
+
+// COSE algorithms of credential keys (RFC 8152 and RFC 8812), all are offered on registration
+const (
+	AlgorithmES256 int64 = -7
+	AlgorithmEdDSA int64 = -8
+	AlgorithmRS256 int64 = -257
+)
+
+// Algorithms are COSE algorithms accepted for credentials, in order of preference
+var Algorithms = []int64{AlgorithmES256, AlgorithmEdDSA, AlgorithmRS256}
+
+// COSE key parameters
+const (
+	coseKty = 1
+	coseAlg = 3
+	// coseCrv, coseX and coseY of EC2 and OKP keys are coseN and coseE of RSA keys
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+
+	// minRSABits is the smallest accepted RSA modulus
+	minRSABits = 2048
+)
+
+// ErrUnsupportedKey is returned for keys of algorithms which are not in Algorithms
+var ErrUnsupportedKey = errors.New("unsupported credential public key")
+
+// PublicKey is credential public key decoded from COSE_Key structure
+type PublicKey struct {
+	Algorithm int64
+	key       crypto.PublicKey
+}
+
+// ParsePublicKey decodes COSE_Key stored after registration
+func ParsePublicKey(cose []byte) (*PublicKey, error) {
+	key, rest, err := parsePublicKey(cose)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rest) != 0 {
+		return nil, ErrUnsupportedKey
+	}
+
+	return key, nil
+}
+
+// parsePublicKey decodes COSE_Key at the start of data and returns the rest of data
+func parsePublicKey(data []byte) (*PublicKey, []byte, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, nil, ErrUnsupportedKey
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgorithmES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, nil, ErrUnsupportedKey
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, nil, ErrUnsupportedKey
+		}
+
+		return &PublicKey{Algorithm: alg, key: key}, rest, nil
+	case kty == coseKtyOKP && alg == AlgorithmEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, nil, ErrUnsupportedKey
+		}
+
+		return &PublicKey{Algorithm: alg, key: ed25519.PublicKey(x)}, rest, nil
+	case kty == coseKtyRSA && alg == AlgorithmRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+
+		if len(e) == 0 || len(e) > 4 {
+			return nil, nil, ErrUnsupportedKey
+		}
+
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < minRSABits {
+			return nil, nil, ErrUnsupportedKey
+		}
+
+		return &PublicKey{Algorithm: alg, key: key}, rest, nil
+	}
+
+	return nil, nil, ErrUnsupportedKey
+}
+
+// Verify checks signature of data made with the key
+func (k *PublicKey) Verify(data, sig []byte) bool {
+	return verifySignature(k.Algorithm, k.key, data, sig)
+}
+
+// ecdsaSignature is ASN.1 encoded ECDSA signature used by WebAuthn
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func verifySignature(alg int64, key crypto.PublicKey, data, sig []byte) bool {
+	digest := sha256.Sum256(data)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var s ecdsaSignature
+
+		rest, err := asn1.Unmarshal(sig, &s)
+		if err != nil || len(rest) != 0 || alg != AlgorithmES256 {
+			return false
+		}
+
+		return ecdsa.Verify(k, digest[:], s.R, s.S)
+	case ed25519.PublicKey:
+		return alg == AlgorithmEdDSA && ed25519.Verify(k, data, sig)
+	case *rsa.PublicKey:
+		return alg == AlgorithmRS256 && rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig) == nil
+	}
+
+	return false
+}
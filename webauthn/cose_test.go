@@ -0,0 +1,83 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestParsePublicKeyEdDSA(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	// {1: 1, 3: -8, -1: 6, -2: pub}
+	cose := append(mustHex(t, "a4010103272006215820"), pub...)
+
+	key, err := ParsePublicKey(cose)
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmEdDSA, key.Algorithm)
+
+	data := []byte("signed data")
+	assert.True(t, key.Verify(data, ed25519.Sign(priv, data)))
+	assert.False(t, key.Verify([]byte("other data"), ed25519.Sign(priv, data)))
+
+	_, err = ParsePublicKey(append(cose, 0))
+	assert.Equal(t, ErrUnsupportedKey, err)
+}
+
+func TestParsePublicKeyRS256(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// {1: 3, 3: -257, -1: n, -2: e}
+	cose := append(mustHex(t, "a401030339010020590100"), priv.N.Bytes()...)
+	cose = append(cose, mustHex(t, "2143010001")...)
+
+	key, err := ParsePublicKey(cose)
+	require.NoError(t, err)
+	assert.Equal(t, AlgorithmRS256, key.Algorithm)
+
+	data := []byte("signed data")
+	digest := sha256.Sum256(data)
+
+	sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	assert.True(t, key.Verify(data, sig))
+
+	sig[0] ^= 1
+	assert.False(t, key.Verify(data, sig))
+}
+
+func TestParsePublicKeyUnsupported(t *testing.T) {
+	tests := []string{
+		// Not a map
+		"01",
+		// ES256 with P-384 curve
+		"a5010203262002215820" + "00000000000000000000000000000000000000000000000000000000000000002258200000000000000000000000000000000000000000000000000000000000000000",
+		// ES256 point which is not on curve
+		"a5010203262001215820" + "00000000000000000000000000000000000000000000000000000000000000012258200000000000000000000000000000000000000000000000000000000000000001",
+		// EC2 key type with EdDSA algorithm
+		"a201020327",
+		// RSA key shorter than 2048 bits
+		"a40103033901002041012143010001",
+	}
+
+	for _, tt := range tests {
+		_, err := ParsePublicKey(mustHex(t, tt))
+		assert.Equal(t, ErrUnsupportedKey, err, tt)
+	}
+}
@@ -0,0 +1,454 @@
+// Package webauthn implements relying party side of Web Authentication (W3C WebAuthn Level 2):
+// registration of passkeys and security keys with none or packed attestation and verification of
+// their assertions with ES256, EdDSA and RS256 credential keys.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	// Ceremony types of client data
+	typeCreate = "webauthn.create"
+	typeGet    = "webauthn.get"
+
+	// Attestation statement formats
+	FormatNone   = "none"
+	FormatPacked = "packed"
+
+	// UserVerification values of options
+	UserVerificationRequired    = "required"
+	UserVerificationPreferred   = "preferred"
+	UserVerificationDiscouraged = "discouraged"
+
+	// challengeLength is number of random bytes in challenge, WebAuthn requires at least 16
+	challengeLength = 32
+	// attestationOU is subject organizational unit required in packed attestation certificates
+	attestationOU = "Authenticator Attestation"
+)
+
+var (
+	// ErrInvalidResponse is returned for malformed response or client data not matching the ceremony
+	ErrInvalidResponse = errors.New("invalid WebAuthn response")
+	// ErrUserNotVerified is returned when authenticator did not check user presence or required verification
+	ErrUserNotVerified = errors.New("user is not verified by authenticator")
+	// ErrInvalidSignature is returned when assertion signature does not match credential public key
+	ErrInvalidSignature = errors.New("invalid WebAuthn signature")
+	// ErrInvalidAttestation is returned for unsupported or invalid attestation statement
+	ErrInvalidAttestation = errors.New("invalid attestation statement")
+	// ErrSignCount is returned when signature counter did not increase, authenticator may be cloned
+	ErrSignCount = errors.New("signature counter did not increase")
+)
+
+// oidFIDOAAGUID is id-fido-gen-ce-aaguid extension of attestation certificates
+var oidFIDOAAGUID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}
+
+// encoding is base64url without padding used for binary values in JSON
+var encoding = base64.RawURLEncoding
+
+// Bytes is binary value encoded in JSON as base64url string
+type Bytes []byte
+
+// MarshalJSON encodes b as base64url without padding
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url string with or without padding
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+
+	*b, err = encoding.DecodeString(strings.TrimRight(s, "="))
+
+	return err
+}
+
+// RelyingParty is the service credentials are registered for. ID is domain credentials are scoped to,
+// Origin is scheme, host and port of pages running the ceremonies.
+type RelyingParty struct {
+	ID     string
+	Name   string
+	Origin string
+}
+
+// NewChallenge returns random base64url encoded challenge
+func NewChallenge() (string, error) {
+	b := make([]byte, challengeLength)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b), nil
+}
+
+// RPEntity is relying party of creation options
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UserEntity is user account of creation options, ID is user handle returned by discoverable credentials
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameters is credential type and algorithm accepted by relying party
+type CredentialParameters struct {
+	Type      string `json:"type"`
+	Algorithm int64  `json:"alg"`
+}
+
+// CredentialDescriptor identifies registered credential
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// AuthenticatorSelection is requirements for authenticator of new credential
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create() after decoding binary values
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              string                 `json:"challenge"`
+	PubKeyCredParams       []CredentialParameters `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are passed to navigator.credentials.get() after decoding binary values
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions returns options of registration of credential for user, credentials in exclude are
+// already registered and authenticators holding them refuse to create another one
+func (rp *RelyingParty) CreationOptions(user UserEntity, challenge string, timeout int64, exclude [][]byte) *CreationOptions {
+	params := make([]CredentialParameters, 0, len(Algorithms))
+	for _, alg := range Algorithms {
+		params = append(params, CredentialParameters{Type: "public-key", Algorithm: alg})
+	}
+
+	return &CreationOptions{
+		RP:                     RPEntity{ID: rp.ID, Name: rp.Name},
+		User:                   user,
+		Challenge:              challenge,
+		PubKeyCredParams:       params,
+		Timeout:                timeout,
+		ExcludeCredentials:     descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{ResidentKey: "preferred", UserVerification: UserVerificationPreferred},
+		Attestation:            FormatNone,
+	}
+}
+
+// RequestOptions returns options of authentication, empty allow lets user pick discoverable credential
+func (rp *RelyingParty) RequestOptions(challenge string, timeout int64, allow [][]byte, userVerification string) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout,
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: userVerification,
+	}
+}
+
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	d := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		d = append(d, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+
+	return d
+}
+
+// AttestationResponse is PublicKeyCredential returned by navigator.credentials.create()
+type AttestationResponse struct {
+	ID       string                   `json:"id"`
+	RawID    Bytes                    `json:"rawId"`
+	Type     string                   `json:"type"`
+	Response AuthenticatorAttestation `json:"response"`
+}
+
+// AuthenticatorAttestation is response of authenticator to registration
+type AuthenticatorAttestation struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AttestationObject Bytes `json:"attestationObject"`
+}
+
+// AssertionResponse is PublicKeyCredential returned by navigator.credentials.get()
+type AssertionResponse struct {
+	ID       string                 `json:"id"`
+	RawID    Bytes                  `json:"rawId"`
+	Type     string                 `json:"type"`
+	Response AuthenticatorAssertion `json:"response"`
+}
+
+// AuthenticatorAssertion is response of authenticator to authentication
+type AuthenticatorAssertion struct {
+	ClientDataJSON    Bytes `json:"clientDataJSON"`
+	AuthenticatorData Bytes `json:"authenticatorData"`
+	Signature         Bytes `json:"signature"`
+	UserHandle        Bytes `json:"userHandle,omitempty"`
+}
+
+// clientData is collected by browser and signed by authenticator along with authenticator data
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Credential is registered credential to store for user
+type Credential struct {
+	ID []byte
+	// PublicKey is COSE_Key to pass to VerifyAssertion
+	PublicKey []byte
+	Algorithm int64
+	SignCount uint32
+	AAGUID    []byte
+	Format    string
+	// UserVerified is true when authenticator verified user during registration
+	UserVerified bool
+}
+
+// VerifyRegistration checks response to creation options with challenge and returns new credential.
+// Packed attestation certificates are checked against WebAuthn requirements, but not against trust
+// anchors, since attestation is used to record authenticator model rather than to restrict them.
+func (rp *RelyingParty) VerifyRegistration(resp *AttestationResponse, challenge string) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, ErrInvalidResponse
+	}
+
+	err := rp.verifyClientData(resp.Response.ClientDataJSON, typeCreate, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	item, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, ErrInvalidResponse
+	}
+
+	obj, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrInvalidResponse
+	}
+
+	format, _ := obj["fmt"].(string)
+	stmt, _ := obj["attStmt"].(map[interface{}]interface{})
+	rawAuthData, _ := obj["authData"].([]byte)
+
+	if stmt == nil {
+		return nil, ErrInvalidResponse
+	}
+
+	ad, err := rp.verifyAuthenticatorData(rawAuthData, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if ad.publicKey == nil || !bytes.Equal(ad.credentialID, resp.RawID) {
+		return nil, ErrInvalidResponse
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+
+	switch format {
+	case FormatNone:
+		if len(stmt) != 0 {
+			return nil, ErrInvalidAttestation
+		}
+	case FormatPacked:
+		err = verifyPacked(stmt, ad, append(append([]byte(nil), rawAuthData...), clientDataHash[:]...))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidAttestation
+	}
+
+	return &Credential{
+		ID:           ad.credentialID,
+		PublicKey:    ad.rawPublicKey,
+		Algorithm:    ad.publicKey.Algorithm,
+		SignCount:    ad.signCount,
+		AAGUID:       ad.aaguid,
+		Format:       format,
+		UserVerified: ad.flags&FlagUserVerified != 0,
+	}, nil
+}
+
+// VerifyAssertion checks response to request options with challenge made with credential having publicKey
+// and signCount, it returns new signature counter of the credential
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge string, publicKey []byte, signCount uint32,
+	requireUV bool) (uint32, error) {
+	if resp.Type != "public-key" {
+		return 0, ErrInvalidResponse
+	}
+
+	err := rp.verifyClientData(resp.Response.ClientDataJSON, typeGet, challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	ad, err := rp.verifyAuthenticatorData(resp.Response.AuthenticatorData, requireUV)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), resp.Response.AuthenticatorData...), clientDataHash[:]...)
+
+	if !key.Verify(signed, resp.Response.Signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// Authenticators without counter always return 0, any other value has to grow
+	if (ad.signCount != 0 || signCount != 0) && ad.signCount <= signCount {
+		return 0, ErrSignCount
+	}
+
+	return ad.signCount, nil
+}
+
+// Challenge returns challenge signed in client data, relying party uses it to find pending ceremony.
+// Response has to be verified with the challenge afterwards.
+func Challenge(clientDataJSON []byte) (string, error) {
+	var cd clientData
+
+	err := json.Unmarshal(clientDataJSON, &cd)
+	if err != nil || cd.Challenge == "" {
+		return "", ErrInvalidResponse
+	}
+
+	return strings.TrimRight(cd.Challenge, "="), nil
+}
+
+func (rp *RelyingParty) verifyClientData(raw []byte, typ, challenge string) error {
+	var cd clientData
+
+	err := json.Unmarshal(raw, &cd)
+	if err != nil {
+		return ErrInvalidResponse
+	}
+
+	if cd.Type != typ || cd.Origin != rp.Origin || cd.CrossOrigin {
+		return ErrInvalidResponse
+	}
+
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(challenge)) != 1 {
+		return ErrInvalidResponse
+	}
+
+	return nil
+}
+
+func (rp *RelyingParty) verifyAuthenticatorData(raw []byte, requireUV bool) (*authenticatorData, error) {
+	ad, err := parseAuthenticatorData(raw)
+	if err != nil {
+		return nil, ErrInvalidResponse
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(ad.rpIDHash, rpIDHash[:]) {
+		return nil, ErrInvalidResponse
+	}
+
+	if ad.flags&FlagUserPresent == 0 || requireUV && ad.flags&FlagUserVerified == 0 {
+		return nil, ErrUserNotVerified
+	}
+
+	return ad, nil
+}
+
+// verifyPacked checks packed attestation statement (WebAuthn section 8.2) over signed data
+func verifyPacked(stmt map[interface{}]interface{}, ad *authenticatorData, signed []byte) error {
+	alg, _ := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+
+	x5c, ok := stmt["x5c"].([]interface{})
+	if !ok {
+		// Self attestation is signed with credential key
+		if _, present := stmt["x5c"]; present || alg != ad.publicKey.Algorithm || !ad.publicKey.Verify(signed, sig) {
+			return ErrInvalidAttestation
+		}
+
+		return nil
+	}
+
+	if len(x5c) == 0 {
+		return ErrInvalidAttestation
+	}
+
+	der, _ := x5c[0].([]byte)
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return ErrInvalidAttestation
+	}
+
+	if !verifySignature(alg, cert.PublicKey, signed, sig) {
+		return ErrInvalidAttestation
+	}
+
+	return verifyAttestationCertificate(cert, ad.aaguid)
+}
+
+// verifyAttestationCertificate checks packed attestation certificate requirements (WebAuthn section 8.2.1)
+func verifyAttestationCertificate(cert *x509.Certificate, aaguid []byte) error {
+	subject := cert.Subject
+
+	if cert.Version != 3 || cert.IsCA || len(subject.Country) == 0 || len(subject.Organization) == 0 ||
+		subject.CommonName == "" || len(subject.OrganizationalUnit) != 1 || subject.OrganizationalUnit[0] != attestationOU {
+		return ErrInvalidAttestation
+	}
+
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidFIDOAAGUID) {
+			continue
+		}
+
+		var value []byte
+
+		_, err := asn1.Unmarshal(ext.Value, &value)
+		if err != nil || ext.Critical || !bytes.Equal(value, aaguid) {
+			return ErrInvalidAttestation
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package webauthn_test
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/lvl484/user-manager/webauthn"
+	"github.com/lvl484/user-manager/webauthn/webauthntest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRP = webauthn.RelyingParty{ID: "localhost", Name: "user-manager", Origin: "http://localhost:8000"}
+
+func newAuthenticator(t *testing.T, format string) *webauthntest.Authenticator {
+	a, err := webauthntest.New(testRP)
+	require.NoError(t, err)
+
+	a.Format = format
+
+	return a
+}
+
+func register(t *testing.T, a *webauthntest.Authenticator) (*webauthn.Credential, error) {
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+
+	resp, err := a.Create(challenge, []byte("user"))
+	require.NoError(t, err)
+
+	return testRP.VerifyRegistration(resp, challenge)
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	for _, format := range []string{webauthn.FormatNone, webauthn.FormatPacked} {
+		a := newAuthenticator(t, format)
+
+		cred, err := register(t, a)
+		require.NoError(t, err, format)
+		assert.Equal(t, a.ID, cred.ID)
+		assert.Equal(t, webauthn.AlgorithmES256, cred.Algorithm)
+		assert.Equal(t, a.Counter, cred.SignCount)
+		assert.Equal(t, webauthntest.AAGUID, cred.AAGUID)
+		assert.Equal(t, format, cred.Format)
+		assert.True(t, cred.UserVerified)
+
+		_, err = webauthn.ParsePublicKey(cred.PublicKey)
+		assert.NoError(t, err)
+	}
+}
+
+func TestVerifyRegistrationPackedCertificate(t *testing.T) {
+	a := newAuthenticator(t, webauthn.FormatPacked)
+	require.NoError(t, a.Certificate(webauthntest.AttestationTemplate()))
+
+	_, err := register(t, a)
+	require.NoError(t, err)
+
+	value, err := asn1.Marshal(webauthntest.AAGUID)
+	require.NoError(t, err)
+
+	template := webauthntest.AttestationTemplate()
+	template.ExtraExtensions = []pkix.Extension{{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 45724, 1, 1, 4}, Value: value}}
+	require.NoError(t, a.Certificate(template))
+
+	_, err = register(t, a)
+	require.NoError(t, err)
+
+	template.ExtraExtensions[0].Value, err = asn1.Marshal([]byte("other-authn-aaguid"))
+	require.NoError(t, err)
+	require.NoError(t, a.Certificate(template))
+
+	_, err = register(t, a)
+	assert.Equal(t, webauthn.ErrInvalidAttestation, err)
+
+	template = webauthntest.AttestationTemplate()
+	template.Subject.OrganizationalUnit = []string{"Other"}
+	require.NoError(t, a.Certificate(template))
+
+	_, err = register(t, a)
+	assert.Equal(t, webauthn.ErrInvalidAttestation, err)
+
+	template = webauthntest.AttestationTemplate()
+	template.IsCA = true
+	require.NoError(t, a.Certificate(template))
+
+	_, err = register(t, a)
+	assert.Equal(t, webauthn.ErrInvalidAttestation, err)
+}
+
+func TestVerifyRegistrationRejected(t *testing.T) {
+	a := newAuthenticator(t, webauthn.FormatNone)
+
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+
+	other, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+
+	resp, err := a.Create(challenge, []byte("user"))
+	require.NoError(t, err)
+
+	_, err = testRP.VerifyRegistration(resp, other)
+	assert.Equal(t, webauthn.ErrInvalidResponse, err)
+
+	rp := testRP
+	rp.Origin = "https://evil.example"
+
+	_, err = rp.VerifyRegistration(resp, challenge)
+	assert.Equal(t, webauthn.ErrInvalidResponse, err)
+
+	rp = testRP
+	rp.ID = "example.com"
+
+	_, err = rp.VerifyRegistration(resp, challenge)
+	assert.Equal(t, webauthn.ErrInvalidResponse, err)
+
+	// Assertion can not be used for registration
+	assertion, err := a.Get(challenge)
+	require.NoError(t, err)
+
+	resp.Response.ClientDataJSON = assertion.Response.ClientDataJSON
+
+	_, err = testRP.VerifyRegistration(resp, challenge)
+	assert.Equal(t, webauthn.ErrInvalidResponse, err)
+
+	resp, err = a.Create(challenge, []byte("user"))
+	require.NoError(t, err)
+
+	resp.Response.AttestationObject = resp.Response.AttestationObject[:len(resp.Response.AttestationObject)-1]
+
+	_, err = testRP.VerifyRegistration(resp, challenge)
+	assert.Equal(t, webauthn.ErrInvalidResponse, err)
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	a := newAuthenticator(t, webauthn.FormatNone)
+
+	cred, err := register(t, a)
+	require.NoError(t, err)
+
+	challenge, err := webauthn.NewChallenge()
+	require.NoError(t, err)
+
+	resp, err := a.Get(challenge)
+	require.NoError(t, err)
+
+	count, err := testRP.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, true)
+	require.NoError(t, err)
+	assert.Equal(t, cred.SignCount+1, count)
+
+	// Replayed assertion has counter which did not increase
+	_, err = testRP.VerifyAssertion(resp, challenge, cred.PublicKey, count, true)
+	assert.Equal(t, webauthn.ErrSignCount, err)
+
+	resp.Response.Signature[len(resp.Response.Signature)-1] ^= 1
+
+	_, err = testRP.VerifyAssertion(resp, challenge, cred.PublicKey, cred.SignCount, true)
+	assert.Equal(t, webauthn.ErrInvalidSignature, err)
+
+	_, err = testRP.VerifyAssertion(resp, "other", cred.PublicKey, cred.SignCount, true)
+	assert.Equal(t, webauthn.ErrInvalidResponse, err)
+
+	a.UserVerified = false
+
+	resp, err = a.Get(challenge)
+	require.NoError(t, err)
+
+	_, err = testRP.VerifyAssertion(resp, challenge, cred.PublicKey, count, true)
+	assert.Equal(t, webauthn.ErrUserNotVerified, err)
+
+	_, err = testRP.VerifyAssertion(resp, challenge, cred.PublicKey, count, false)
+	assert.NoError(t, err)
+}
+
+func TestVerifyAssertionWithoutCounter(t *testing.T) {
+	a := newAuthenticator(t, webauthn.FormatNone)
+	a.Counter = 0
+
+	cred, err := register(t, a)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		resp, err := a.Get("challenge")
+		require.NoError(t, err)
+
+		count, err := testRP.VerifyAssertion(resp, "challenge", cred.PublicKey, 0, false)
+		require.NoError(t, err)
+		assert.Zero(t, count)
+	}
+}
+
+func TestBytesJSON(t *testing.T) {
+	var b webauthn.Bytes
+
+	require.NoError(t, b.UnmarshalJSON([]byte(`"AQID_w=="`)))
+	assert.Equal(t, webauthn.Bytes{1, 2, 3, 0xff}, b)
+
+	data, err := b.MarshalJSON()
+	require.NoError(t, err)
+	assert.Equal(t, `"AQID_w"`, string(data))
+
+	assert.Error(t, b.UnmarshalJSON([]byte(`"AQID+w"`)))
+}
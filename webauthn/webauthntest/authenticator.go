@@ -0,0 +1,227 @@
+// Package webauthntest provides software authenticator producing WebAuthn responses for tests.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math/big"
+	"time"
+
+	"github.com/lvl484/user-manager/webauthn"
+)
+
+// AAGUID identifies model of the software authenticator
+var AAGUID = []byte("webauthntest-sw1")
+
+// Authenticator holds single ES256 credential. Format is attestation statement format of Create, packed
+// attestation is self attestation unless Certificate was called.
+type Authenticator struct {
+	RP     webauthn.RelyingParty
+	Format string
+	// UserVerified sets UV flag of responses
+	UserVerified bool
+	// Counter is signature counter, it is incremented before each signature unless it is 0
+	Counter uint32
+
+	ID         []byte
+	UserHandle []byte
+
+	key     *ecdsa.PrivateKey
+	certKey *ecdsa.PrivateKey
+	cert    []byte
+}
+
+// New returns authenticator with new credential for rp
+func New(rp webauthn.RelyingParty) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+
+	_, err = rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{RP: rp, Format: webauthn.FormatNone, UserVerified: true, Counter: 1, ID: id, key: key}, nil
+}
+
+// AttestationTemplate returns certificate template meeting packed attestation requirements
+func AttestationTemplate() *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:            []string{"UA"},
+			Organization:       []string{"user-manager"},
+			OrganizationalUnit: []string{"Authenticator Attestation"},
+			CommonName:         "webauthntest",
+		},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+	}
+}
+
+// Certificate makes packed attestation signed with new key certified by self-signed certificate from template
+func (a *Authenticator) Certificate(template *x509.Certificate) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	a.certKey, a.cert = key, cert
+
+	return nil
+}
+
+// Create registers the credential for user with handle in response to creation challenge
+func (a *Authenticator) Create(challenge string, userHandle []byte) (*webauthn.AttestationResponse, error) {
+	a.UserHandle = userHandle
+
+	clientDataJSON, clientDataHash, err := a.clientData("webauthn.create", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	credential := make([]byte, 0, 18+len(a.ID))
+	credential = append(credential, AAGUID...)
+	credential = append(credential, byte(len(a.ID)>>8), byte(len(a.ID)))
+	credential = append(credential, a.ID...)
+	credential = append(credential, a.publicKey()...)
+
+	authData := a.authenticatorData(webauthn.FlagAttestedCredential, credential)
+
+	stmt := cborMap{}
+
+	if a.Format == webauthn.FormatPacked {
+		key := a.key
+		if a.certKey != nil {
+			key = a.certKey
+		}
+
+		sig, err := sign(key, append(append([]byte(nil), authData...), clientDataHash...))
+		if err != nil {
+			return nil, err
+		}
+
+		stmt = cborMap{{"alg", webauthn.AlgorithmES256}, {"sig", sig}}
+		if a.cert != nil {
+			stmt = append(stmt, cborPair{"x5c", []interface{}{a.cert}})
+		}
+	}
+
+	obj := cborMap{{"fmt", a.Format}, {"attStmt", stmt}, {"authData", authData}}
+
+	return &webauthn.AttestationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.ID),
+		RawID: a.ID,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAttestation{
+			ClientDataJSON:    clientDataJSON,
+			AttestationObject: encodeCBOR(obj),
+		},
+	}, nil
+}
+
+// Get signs authentication challenge with the credential
+func (a *Authenticator) Get(challenge string) (*webauthn.AssertionResponse, error) {
+	clientDataJSON, clientDataHash, err := a.clientData("webauthn.get", challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	authData := a.authenticatorData(0, nil)
+
+	sig, err := sign(a.key, append(append([]byte(nil), authData...), clientDataHash...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.ID),
+		RawID: a.ID,
+		Type:  "public-key",
+		Response: webauthn.AuthenticatorAssertion{
+			ClientDataJSON:    clientDataJSON,
+			AuthenticatorData: authData,
+			Signature:         sig,
+			UserHandle:        a.UserHandle,
+		},
+	}, nil
+}
+
+func (a *Authenticator) clientData(typ, challenge string) ([]byte, []byte, error) {
+	raw, err := json.Marshal(map[string]interface{}{
+		"type":        typ,
+		"challenge":   challenge,
+		"origin":      a.RP.Origin,
+		"crossOrigin": false,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hash := sha256.Sum256(raw)
+
+	return raw, hash[:], nil
+}
+
+func (a *Authenticator) authenticatorData(flags byte, credential []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.RP.ID))
+
+	flags |= webauthn.FlagUserPresent
+	if a.UserVerified {
+		flags |= webauthn.FlagUserVerified
+	}
+
+	if a.Counter != 0 {
+		a.Counter++
+	}
+
+	counter := make([]byte, 4)
+	binary.BigEndian.PutUint32(counter, a.Counter)
+
+	data := append(rpIDHash[:], flags)
+	data = append(data, counter...)
+
+	return append(data, credential...)
+}
+
+// publicKey returns COSE_Key of the credential
+func (a *Authenticator) publicKey() []byte {
+	x := pad(a.key.X.Bytes())
+	y := pad(a.key.Y.Bytes())
+
+	return encodeCBOR(cborMap{{1, 2}, {3, webauthn.AlgorithmES256}, {-1, 1}, {-2, x}, {-3, y}})
+}
+
+// pad returns coordinate of P-256 point as 32 bytes
+func pad(b []byte) []byte {
+	return append(make([]byte, 32-len(b)), b...)
+}
+
+func sign(key *ecdsa.PrivateKey, data []byte) ([]byte, error) {
+	digest := sha256.Sum256(data)
+
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+}
@@ -0,0 +1,80 @@
+package webauthntest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// cborPair is entry of cborMap
+type cborPair struct {
+	key, value interface{}
+}
+
+// cborMap is CBOR map encoded with entries in given order
+type cborMap []cborPair
+
+// encodeCBOR encodes integers, byte and text strings, arrays and maps used by WebAuthn structures
+func encodeCBOR(item interface{}) []byte {
+	switch v := item.(type) {
+	case int:
+		return encodeInt(int64(v))
+	case int64:
+		return encodeInt(v)
+	case []byte:
+		return append(encodeHead(2, uint64(len(v))), v...)
+	case string:
+		return append(encodeHead(3, uint64(len(v))), v...)
+	case []interface{}:
+		b := encodeHead(4, uint64(len(v)))
+		for _, i := range v {
+			b = append(b, encodeCBOR(i)...)
+		}
+
+		return b
+	case cborMap:
+		b := encodeHead(5, uint64(len(v)))
+		for _, p := range v {
+			b = append(b, encodeCBOR(p.key)...)
+			b = append(b, encodeCBOR(p.value)...)
+		}
+
+		return b
+	}
+
+	panic(fmt.Sprintf("webauthntest: can not encode %T", item))
+}
+
+func encodeInt(v int64) []byte {
+	if v < 0 {
+		return encodeHead(1, uint64(-1-v))
+	}
+
+	return encodeHead(0, uint64(v))
+}
+
+// encodeHead encodes major type and argument in the shortest form
+func encodeHead(major byte, arg uint64) []byte {
+	major <<= 5
+
+	switch {
+	case arg < 24:
+		return []byte{major | byte(arg)}
+	case arg <= 0xff:
+		return []byte{major | 24, byte(arg)}
+	case arg <= 0xffff:
+		b := []byte{major | 25, 0, 0}
+		binary.BigEndian.PutUint16(b[1:], uint16(arg))
+
+		return b
+	case arg <= 0xffffffff:
+		b := []byte{major | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[1:], uint32(arg))
+
+		return b
+	}
+
+	b := []byte{major | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(b[1:], arg)
+
+	return b
+}